@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"github.com/Osselnet/gophermart.git/internal/server"
+	"github.com/Osselnet/gophermart.git/pkg/accrualsim"
+	"log"
+	"os"
+	"time"
+)
+
+func main() {
+	addr := flag.String("a", ":8081", "Simulator run address")
+	rules := flag.String("rules", "", "JSON file with reward rules")
+	auto := flag.Bool("auto", true, "Register unknown orders on their first poll")
+	autoPrice := flag.Float64("auto-price", 1000, "Price of the goods of auto registered orders")
+	autoReward := flag.Float64("auto-reward", 10, "Reward in percent for auto registered orders")
+	processing := flag.Duration("processing-delay", 2*time.Second, "Time an order stays NEW")
+	processed := flag.Duration("processed-delay", 5*time.Second, "Time an order stays PROCESSING")
+	rateLimit := flag.Int("rate-limit", 0, "Requests per minute before 429, 0 for no limit")
+	flag.Parse()
+
+	if env := os.Getenv("RUN_ADDRESS"); env != "" {
+		*addr = env
+	}
+
+	cfg := accrualsim.Config{
+		ProcessingDelay: *processing,
+		ProcessedDelay:  *processed,
+		AutoRegister:    *auto,
+		RateLimit:       *rateLimit,
+	}
+
+	if *rules != "" {
+		data, err := os.ReadFile(*rules)
+		if err != nil {
+			log.Fatalln("[FATAL] Failed to read reward rules -", err)
+		}
+		err = json.Unmarshal(data, &cfg.Rules)
+		if err != nil {
+			log.Fatalln("[FATAL] Failed to parse reward rules -", err)
+		}
+	}
+
+	if *auto {
+		const autoGood = "accrual-sim goods"
+		cfg.AutoGoods = []accrualsim.Good{{Description: autoGood, Price: *autoPrice}}
+		cfg.Rules = append(cfg.Rules, accrualsim.Rule{Match: autoGood, Reward: *autoReward, RewardType: accrualsim.RewardPercent})
+	}
+
+	s := server.New(accrualsim.New(cfg), *addr)
+	s.Serve()
+}
@@ -5,9 +5,12 @@ import (
 	"github.com/Osselnet/gophermart.git/internal/client"
 	"github.com/Osselnet/gophermart.git/internal/db"
 	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/Osselnet/gophermart.git/internal/memory"
 	"github.com/Osselnet/gophermart.git/internal/server"
 	"github.com/Osselnet/gophermart.git/internal/server/config"
 	"github.com/Osselnet/gophermart.git/internal/server/handlers"
+	"github.com/Osselnet/gophermart.git/pkg/jwt"
+	"github.com/Osselnet/gophermart.git/pkg/password"
 	"log"
 	"os"
 	"os/signal"
@@ -20,20 +23,156 @@ const (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err := runMigrate(os.Args[2:])
+		if err != nil {
+			log.Fatalln("[FATAL] Migration failed -", err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "unlock" {
+		err := runUnlock(os.Args[2:])
+		if err != nil {
+			log.Fatalln("[FATAL] Unlock failed -", err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "role" {
+		err := runRole(os.Args[2:])
+		if err != nil {
+			log.Fatalln("[FATAL] Role command failed -", err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "queue" {
+		err := runQueue(os.Args[2:])
+		if err != nil {
+			log.Fatalln("[FATAL] Queue command failed -", err)
+		}
+		return
+	}
+
 	cfg, err := config.ParseConfig()
 	if err != nil {
 		panic(err)
 	}
-	log.Printf("[DEBUG] Receive config: %#v\n", cfg)
+	logCfg := cfg
+	if logCfg.AccrualCallbackSecret != "" {
+		logCfg.AccrualCallbackSecret = "***"
+	}
+	if logCfg.TokenKeys != "" {
+		logCfg.TokenKeys = "***"
+	}
+	log.Printf("[DEBUG] Receive config: %#v\n", logCfg)
 
-	st, err := db.New(cfg.DatabaseURI)
-	if err != nil {
-		log.Fatalln("[FATAL] Postgres initialization failed - ", err)
+	var st gophermart.Storer
+	if cfg.DatabaseURI == "" {
+		log.Println("[WARNING] DATABASE_URI is empty, all data will be kept in memory and lost on exit")
+		st = memory.New()
+	} else {
+		st, err = db.New(cfg.DatabaseURI)
+		if err != nil {
+			log.Fatalln("[FATAL] Postgres initialization failed - ", err)
+		}
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	gm := gophermart.New(st)
+	gm.SetCacheConfig(gophermart.CacheConfig{
+		SessionSize: cfg.SessionCacheSize,
+		UserSize:    cfg.UserCacheSize,
+		TTL:         cfg.CacheTTL,
+	})
+	go gm.ListenInvalidations(ctx)
+	go gm.ListenEvents(ctx)
+	go gm.PruneEvents(ctx, cfg.EventRetention)
+	go gm.ReapSessions(ctx, cfg.SessionReapInterval, uint32(cfg.SessionReapBatch))
+	gm.IdempotencyKeys.SetRetention(cfg.IdempotencyRetention)
+	go gm.PruneIdempotencyKeys(ctx)
+
+	tokenCfg := gophermart.TokenConfig{
+		AccessTTL:  cfg.AccessTokenTTL,
+		RefreshTTL: cfg.RefreshTokenTTL,
+	}
+	if cfg.TokenKeys == "" {
+		log.Println("[WARNING] TOKEN_KEYS is empty, tokens are signed with a random key and won't survive a restart")
+	} else {
+		tokenCfg.Keys, err = jwt.ParseKeyring(cfg.TokenKeys)
+		if err != nil {
+			log.Fatalln("[FATAL] Failed to parse token keys -", err)
+		}
+	}
+	gm.SetTokenConfig(tokenCfg)
+
+	withdrawThreshold, err := gophermart.ParseMoney(cfg.TOTPWithdrawThreshold)
+	if err != nil {
+		log.Fatalln("[FATAL] Failed to parse TOTP withdraw threshold -", err)
+	}
+	gm.SetTOTPConfig(gophermart.TOTPConfig{
+		Issuer:            cfg.TOTPIssuer,
+		WithdrawThreshold: withdrawThreshold,
+		ChallengeTTL:      cfg.TOTPChallengeTTL,
+	})
+
+	if cfg.PasswordHash != password.Argon2id && cfg.PasswordHash != password.Bcrypt {
+		log.Fatalf("[FATAL] Unknown password hash algorithm `%s`", cfg.PasswordHash)
+	}
+	gm.SetPasswordConfig(gophermart.PasswordConfig{
+		Params: password.Params{
+			Algorithm: cfg.PasswordHash,
+			Memory:    uint32(cfg.Argon2Memory),
+			Time:      uint32(cfg.Argon2Time),
+			Threads:   uint8(cfg.Argon2Threads),
+			Cost:      cfg.BcryptCost,
+		},
+		Policy: password.Policy{
+			MinLength: cfg.PasswordMinLength,
+			MaxLength: cfg.PasswordMaxLength,
+		},
+	})
+	gm.SetAuditConfig(gophermart.AuditConfig{HashChain: cfg.AuditHashChain})
+	gm.SetBulkConfig(gophermart.BulkConfig{
+		MaxOrders:   cfg.BulkMaxOrders,
+		SyncLimit:   cfg.BulkSyncLimit,
+		ResumeAfter: cfg.BulkResumeAfter,
+	})
+	go gm.ResumeBulkJobs(ctx)
+	gm.SetLoginGuardConfig(gophermart.LoginGuardConfig{
+		Window:       cfg.LoginWindow,
+		FreeAttempts: uint32(cfg.LoginFreeAttempts),
+		BaseDelay:    cfg.LoginBaseDelay,
+		MaxDelay:     cfg.LoginMaxDelay,
+		LockAfter:    uint32(cfg.LoginLockAfter),
+		LockAfterIP:  uint32(cfg.LoginLockAfterIP),
+		LockFor:      cfg.LoginLockFor,
+	})
+
+	queue := client.NewQueue(st, client.Config{
+		Address: cfg.AccrualSystemAddress,
+		Retry: client.RetryPolicy{
+			BaseDelay:   cfg.AccrualRetryBase,
+			MaxDelay:    cfg.AccrualRetryMax,
+			MaxAttempts: uint32(cfg.AccrualMaxAttempts),
+			MaxAge:      cfg.AccrualMaxOrderAge,
+		},
+		Workers:          cfg.AccrualWorkers,
+		RateLimit:        cfg.AccrualRateLimit,
+		BreakerThreshold: uint32(cfg.AccrualBreakerThreshold),
+		BreakerCooldown:  cfg.AccrualBreakerCooldown,
+	})
+	queue.SetAuditor(gm.Audit)
+	queue.SetEvents(gm.Events)
+	gm.SetAccrualMonitor(queue)
 
 	h := handlers.New(gm)
+	if cfg.AccrualCallbackSecret != "" {
+		h.EnableAccrualCallback([]byte(cfg.AccrualCallbackSecret), cfg.AccrualCallbackWindow, queue)
+	}
 
 	s := server.New(h.GetRouter(), cfg.Addr)
 	go s.Serve()
@@ -42,6 +181,7 @@ func main() {
 		sig := make(chan os.Signal, 1)
 		signal.Notify(sig, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 		<-sig
+		cancel()
 
 		shutdownCtx, shutdownCtxCancel := context.WithTimeout(context.Background(), defaultGraceTimeout)
 		defer shutdownCtxCancel()
@@ -59,6 +199,6 @@ func main() {
 		}
 	}()
 
-	queue := client.NewQueue(st, cfg.AccrualSystemAddress)
 	queue.Start()
+	gm.StopBulkJobs()
 }
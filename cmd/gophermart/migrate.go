@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/Osselnet/gophermart.git/internal/db"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+const migrateUsage = `Usage: gophermart migrate up|down|status [flags]
+
+  up      apply all pending migrations
+  down    roll back the latest applied migrations (see -n)
+  status  list migrations and whether they are applied
+
+Flags:
+`
+
+func runMigrate(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return fmt.Errorf("migrate command needed")
+	}
+	command := args[0]
+
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), migrateUsage)
+		fs.PrintDefaults()
+	}
+	dsn := fs.String("d", "", "Postgres URI")
+	steps := fs.Int("n", 1, "Number of migrations to roll back")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if env := os.Getenv("DATABASE_URI"); env != "" {
+		*dsn = env
+	}
+
+	m, err := db.NewMigrator(*dsn)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	switch command {
+	case "up":
+		done, err := m.Up(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d migration(s) applied\n", len(done))
+	case "down":
+		done, err := m.Down(ctx, *steps)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d migration(s) rolled back\n", len(done))
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, st := range statuses {
+			appliedAt := "pending"
+			if st.Applied {
+				appliedAt = st.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", st.Version, st.Name, appliedAt)
+		}
+		return w.Flush()
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown migrate command `%s`", command)
+	}
+
+	return nil
+}
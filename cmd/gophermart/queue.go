@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/Osselnet/gophermart.git/internal/db"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+const queueUsage = `Usage: gophermart queue parked|requeue [flags] [order...]
+
+  parked   list orders the accrual poller gave up on
+  requeue  put the given parked orders back into the accrual queue
+
+Flags:
+`
+
+func runQueue(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, queueUsage)
+		return fmt.Errorf("queue command needed")
+	}
+	command := args[0]
+
+	fs := flag.NewFlagSet("queue", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), queueUsage)
+		fs.PrintDefaults()
+	}
+	dsn := fs.String("d", "", "Postgres URI")
+	limit := fs.Uint("n", 100, "Maximum number of orders to list")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if env := os.Getenv("DATABASE_URI"); env != "" {
+		*dsn = env
+	}
+
+	st, err := db.New(*dsn)
+	if err != nil {
+		return err
+	}
+	gm := gophermart.New(st)
+
+	switch command {
+	case "parked":
+		ors, err := gm.Orders.Parked(uint32(*limit))
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ORDER\tUSER\tSTATUS\tATTEMPTS\tUPLOADED AT\tPARKED AT\tLAST ERROR")
+		for _, o := range ors {
+			fmt.Fprintf(w, "%d\t%d\t%s\t%d\t%s\t%s\t%s\n", o.ID, o.UserID, o.Status, o.Attempts,
+				o.UploadedAt.Format(time.RFC3339), o.ParkedAt.Format(time.RFC3339), o.LastError)
+		}
+		return w.Flush()
+	case "requeue":
+		if fs.NArg() == 0 {
+			return fmt.Errorf("order numbers needed")
+		}
+		for _, number := range fs.Args() {
+			orderID, err := strconv.ParseUint(number, 10, 64)
+			if err != nil {
+				return fmt.Errorf("%w `%s`", gophermart.ErrOrderInvalidFormat, number)
+			}
+
+			err = gm.Orders.Requeue(orderID)
+			if err != nil {
+				return fmt.Errorf("failed to requeue order %d - %w", orderID, err)
+			}
+			fmt.Printf("order %d requeued\n", orderID)
+		}
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown queue command `%s`", command)
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/Osselnet/gophermart.git/internal/db"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"os"
+)
+
+const roleUsage = `Usage: gophermart role [flags] login role
+
+  grant the role to the user, role is "admin" or "user"
+
+Flags:
+`
+
+func runRole(args []string) error {
+	fs := flag.NewFlagSet("role", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), roleUsage)
+		fs.PrintDefaults()
+	}
+	dsn := fs.String("d", "", "Postgres URI")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if env := os.Getenv("DATABASE_URI"); env != "" {
+		*dsn = env
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return fmt.Errorf("login and role needed")
+	}
+
+	st, err := db.New(*dsn)
+	if err != nil {
+		return err
+	}
+	gm := gophermart.New(st)
+
+	login, role := fs.Arg(0), fs.Arg(1)
+	u, err := gm.Users.Get(login)
+	if err != nil {
+		return fmt.Errorf("failed to get user %s - %w", login, err)
+	}
+	err = gm.Users.SetRole(u, role)
+	if err != nil {
+		return fmt.Errorf("failed to grant %s to %s - %w", role, login, err)
+	}
+	fmt.Printf("%s is now %s\n", login, role)
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/Osselnet/gophermart.git/internal/db"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"os"
+)
+
+const unlockUsage = `Usage: gophermart unlock [flags] login...
+
+  clear the failed logins and the lockout of the given logins, or of the
+  given client IPs with -ip
+
+Flags:
+`
+
+func runUnlock(args []string) error {
+	fs := flag.NewFlagSet("unlock", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), unlockUsage)
+		fs.PrintDefaults()
+	}
+	dsn := fs.String("d", "", "Postgres URI")
+	byIP := fs.Bool("ip", false, "Unlock client IPs instead of logins")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if env := os.Getenv("DATABASE_URI"); env != "" {
+		*dsn = env
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("logins needed")
+	}
+
+	st, err := db.New(*dsn)
+	if err != nil {
+		return err
+	}
+	gm := gophermart.New(st)
+
+	for _, key := range fs.Args() {
+		if *byIP {
+			err = gm.UnlockIP(key)
+		} else {
+			err = gm.Unlock(key)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to unlock %s - %w", key, err)
+		}
+		fmt.Printf("%s unlocked\n", key)
+	}
+
+	return nil
+}
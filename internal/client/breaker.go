@@ -0,0 +1,125 @@
+package client
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// breaker stops polling the accrual system after threshold consecutive
+// failures. Once cooldown has passed a single probe request is let through:
+// its success closes the breaker, its failure opens it again.
+type breaker struct {
+	mu        sync.Mutex
+	state     string
+	failures  uint32
+	threshold uint32
+	cooldown  time.Duration
+	openedAt  time.Time
+	probing   bool
+}
+
+func newBreaker(threshold uint32, cooldown time.Duration) *breaker {
+	if threshold == 0 {
+		threshold = 1
+	}
+
+	return &breaker{
+		state:     BreakerClosed,
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+func (b *breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.advance(time.Now())
+
+	switch b.state {
+	case BreakerClosed:
+		return true
+	case BreakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return false
+	}
+}
+
+func (b *breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != BreakerClosed {
+		log.Println("[INFO] Accrual circuit breaker closed")
+	}
+	b.state = BreakerClosed
+	b.failures = 0
+	b.probing = false
+}
+
+func (b *breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		if b.state != BreakerOpen {
+			log.Printf("[WARNING] Accrual circuit breaker opened after %d failures, cooldown %s\n", b.failures, b.cooldown)
+		}
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+		b.probing = false
+	}
+}
+
+// Release gives the probe slot back when a probe ended without telling
+// anything about the accrual system, e.g. on shutdown.
+func (b *breaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+func (b *breaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.advance(time.Now())
+
+	return b.state
+}
+
+// RetryIn returns how long the breaker stays open, zero if requests may be
+// attempted right away.
+func (b *breaker) RetryIn() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.advance(now)
+	if b.state != BreakerOpen {
+		return 0
+	}
+
+	return b.openedAt.Add(b.cooldown).Sub(now)
+}
+
+func (b *breaker) advance(now time.Time) {
+	if b.state == BreakerOpen && !now.Before(b.openedAt.Add(b.cooldown)) {
+		b.state = BreakerHalfOpen
+		b.probing = false
+	}
+}
@@ -0,0 +1,33 @@
+package client
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	b := newBreaker(2, 50*time.Millisecond)
+
+	assert.True(t, b.Allow())
+	b.Failure()
+	assert.Equal(t, BreakerClosed, b.State())
+	b.Failure()
+	assert.Equal(t, BreakerOpen, b.State())
+	assert.False(t, b.Allow())
+	assert.Greater(t, b.RetryIn(), time.Duration(0))
+
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, BreakerHalfOpen, b.State())
+	assert.True(t, b.Allow(), "one probe is let through")
+	assert.False(t, b.Allow(), "only one probe at a time")
+
+	b.Failure()
+	assert.Equal(t, BreakerOpen, b.State(), "failed probe opens the breaker again")
+
+	time.Sleep(60 * time.Millisecond)
+	assert.True(t, b.Allow())
+	b.Success()
+	assert.Equal(t, BreakerClosed, b.State())
+	assert.Zero(t, b.RetryIn())
+}
@@ -0,0 +1,155 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var rateHint = regexp.MustCompile(`(?i)(\d+)\s+requests?\s+per\s+(second|minute|hour)`)
+
+// limiter is a token bucket shared by all the workers. It starts unlimited
+// unless a rate is configured, and learns the rate from the accrual system's
+// 429 responses.
+type limiter struct {
+	mu          sync.Mutex
+	rate        float64
+	burst       float64
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time
+}
+
+func newLimiter(rate float64) *limiter {
+	l := &limiter{last: time.Now()}
+	l.setRate(rate)
+	l.tokens = l.burst
+
+	return l
+}
+
+func (l *limiter) setRate(rate float64) {
+	l.rate = rate
+	l.burst = rate
+	if l.burst < 1 {
+		l.burst = 1
+	}
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+}
+
+func (l *limiter) Wait(ctx context.Context) error {
+	for {
+		d := l.reserve()
+		if d <= 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(d):
+		}
+	}
+}
+
+func (l *limiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(l.pausedUntil) {
+		return l.pausedUntil.Sub(now)
+	}
+	if l.rate <= 0 {
+		return 0
+	}
+
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+// Throttle stops all requests for retryAfter and, if the response body
+// states the allowed rate, limits further requests to it.
+func (l *limiter) Throttle(retryAfter time.Duration, body string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if until := now.Add(retryAfter); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+
+	if rate, ok := parseRateHint(body); ok {
+		l.setRate(rate)
+		l.tokens = 0
+		l.last = l.pausedUntil
+	}
+}
+
+func (l *limiter) Rate() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.rate
+}
+
+func (l *limiter) PausedUntil() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.pausedUntil
+}
+
+func parseRateHint(body string) (float64, bool) {
+	match := rateHint.FindStringSubmatch(body)
+	if match == nil {
+		return 0, false
+	}
+
+	n, err := strconv.ParseFloat(match[1], 64)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+
+	switch strings.ToLower(match[2]) {
+	case "minute":
+		n /= 60
+	case "hour":
+		n /= 3600
+	}
+
+	return n, true
+}
+
+// parseRetryAfter accepts both forms allowed by RFC 9110: delay in seconds
+// and an HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if at, err := http.ParseTime(value); err == nil {
+		if d := at.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+
+	return 0, false
+}
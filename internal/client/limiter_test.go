@@ -0,0 +1,33 @@
+package client
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestLimiter_Throttle(t *testing.T) {
+	l := newLimiter(0)
+	assert.Zero(t, l.reserve(), "no rate means no limit")
+
+	l.Throttle(time.Minute, "No more than 10 requests per minute allowed")
+	assert.InDelta(t, 10.0/60, l.Rate(), 1e-9)
+	assert.Greater(t, l.reserve(), 59*time.Second, "Retry-After pauses every request")
+
+	rate, ok := parseRateHint("no hint here")
+	assert.False(t, ok)
+	assert.Zero(t, rate)
+
+	now := time.Now()
+	d, ok := parseRetryAfter("120", now)
+	assert.True(t, ok)
+	assert.Equal(t, 2*time.Minute, d)
+
+	d, ok = parseRetryAfter(now.Add(time.Hour).UTC().Format(http.TimeFormat), now)
+	assert.True(t, ok)
+	assert.InDelta(t, time.Hour.Seconds(), d.Seconds(), 1)
+
+	_, ok = parseRetryAfter("soon", now)
+	assert.False(t, ok)
+}
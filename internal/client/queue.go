@@ -5,51 +5,130 @@ import (
 	"errors"
 	"fmt"
 	"github.com/Osselnet/gophermart.git/internal/gophermart"
-	"golang.org/x/sync/errgroup"
+	"github.com/google/uuid"
 	"log"
 	"math/rand"
 	"os"
 	"os/signal"
+	"sync"
 	"sync/atomic"
 	"syscall"
 	"time"
 )
 
+var ErrAccrualNotApplied = errors.New("accrual answer not applied")
+
+// ErrAccrualPending tells the accrual system is still processing the order,
+// which is no failure of the poll.
+var ErrAccrualPending = fmt.Errorf("%w: order is still processing", ErrAccrualNotApplied)
+
+// AccrualStatusRegistered is the status of orders the accrual system knows
+// but has not started processing yet. Orders never get it themselves.
+const AccrualStatusRegistered = "REGISTERED"
+
 const (
-	limitDefault = 1000
-	limitDelta   = 1
+	limitDefault = 100
+	limitMin     = 1
+	limitMax     = 1000
+	limitDelta   = 10
+
+	// Must outlive the accrual request timeout, otherwise another replica may
+	// lease the order while the request is still in flight.
+	leaseTTL = 90 * time.Second
 )
 
-type accrualOrder struct {
-	Order   string  `json:"order"`
-	Status  string  `json:"status"`
-	Accrual float64 `json:"accrual"`
+// AccrualOrder is the accrual system's answer about an order, the same for
+// polls and callbacks.
+type AccrualOrder struct {
+	Order   string           `json:"order"`
+	Status  string           `json:"status"`
+	Accrual gophermart.Money `json:"accrual"`
+}
+
+type Config struct {
+	Address          string
+	Retry            RetryPolicy
+	Workers          int
+	RateLimit        float64
+	BreakerThreshold uint32
+	BreakerCooldown  time.Duration
 }
 
 type Queue struct {
-	url       string
-	storage   gophermart.Storer
-	limit     uint32
-	sleep     uint32
-	needSleep int32
-	pool      map[uint64]*gophermart.Order
+	owner   string
+	url     string
+	storage gophermart.Storer
+	limit   uint32
+	pool    map[uint64]*gophermart.Order
+	retry   RetryPolicy
+	workers int
+	limiter *limiter
+	breaker *breaker
+	audit   *gophermart.Auditor
+	events  *gophermart.Events
 }
 
-func NewQueue(st gophermart.Storer, addr string) *Queue {
+type job struct {
+	order *gophermart.Order
+	done  func(error)
+}
+
+type batchStats struct {
+	ok        int32
+	throttled int32
+	failed    int32
+}
+
+func NewQueue(st gophermart.Storer, cfg Config) *Queue {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "gophermart"
+	}
+
+	workers := cfg.Workers
+	if workers < 1 {
+		workers = 1
+	}
 
 	return &Queue{
+		owner:   fmt.Sprintf("%s-%d-%s", host, os.Getpid(), uuid.NewString()[:8]),
 		limit:   limitDefault,
-		url:     addr + "/api/orders/",
+		url:     cfg.Address + "/api/orders/",
 		storage: st,
+		retry:   cfg.Retry,
+		workers: workers,
+		limiter: newLimiter(cfg.RateLimit),
+		breaker: newBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown),
 	}
 }
 
-func (q *Queue) updatePool() {
-	limit := atomic.LoadUint32(&q.limit)
+// SetAuditor makes the queue record every accrual status change it applies.
+func (q *Queue) SetAuditor(a *gophermart.Auditor) {
+	q.audit = a
+}
+
+// SetEvents makes the queue tell users about the changes of their orders and
+// balances it applies.
+func (q *Queue) SetEvents(e *gophermart.Events) {
+	q.events = e
+}
+
+func (q *Queue) AccrualStatus() gophermart.AccrualStatus {
+	return gophermart.AccrualStatus{
+		Breaker:     q.breaker.State(),
+		RetryIn:     q.breaker.RetryIn(),
+		Limit:       atomic.LoadUint32(&q.limit),
+		Workers:     q.workers,
+		RateLimit:   q.limiter.Rate(),
+		PausedUntil: q.limiter.PausedUntil(),
+	}
+}
 
-	ors, err := q.storage.GetPullOrders(limit)
+func (q *Queue) updatePool(limit uint32) {
+	ors, err := q.storage.LeaseOrders(q.owner, limit, leaseTTL)
 	if err != nil {
 		log.Println("[ERROR] Failed to get orders for pool -", err)
+		q.pool = nil
 		return
 	}
 
@@ -62,45 +141,189 @@ func (q *Queue) updatePool() {
 	log.Printf("[DEBUG] Orders pool updated, now in pool: %d", len(q.pool))
 }
 
-func (q *Queue) updateOrder(ao *accrualOrder, qo *queueOrder) error {
-	qo.order.Status = ao.Status
-	qo.order.Accrual = uint64(ao.Accrual * 100)
+// Apply checks the accrual system's answer about order and stores it. Answers
+// that don't move the order forward are rejected with ErrAccrualNotApplied.
+// Applying the same answer twice is not an error.
+func (q *Queue) Apply(order *gophermart.Order, ao *AccrualOrder) error {
+	if fmt.Sprint(order.ID) != ao.Order {
+		return fmt.Errorf("%w: accrual system answered for order %s", ErrAccrualNotApplied, ao.Order)
+	}
+
+	if ao.Status == AccrualStatusRegistered || order.Status == ao.Status && order.Status == gophermart.StatusProcessing {
+		return ErrAccrualPending
+	}
 
-	if err := q.storage.UpdateOrder(qo.order); err != nil {
-		return fmt.Errorf("failed to update order ID %d - %w", qo.order.ID, err)
+	if !gophermart.IsValidStatus(ao.Status) {
+		return fmt.Errorf("%w: accrual status is %s", ErrAccrualNotApplied, ao.Status)
+	}
+
+	return q.updateOrder(order, ao)
+}
+
+func (q *Queue) updateOrder(order *gophermart.Order, ao *AccrualOrder) error {
+	before := *order
+	order.Status = ao.Status
+	order.Accrual = ao.Accrual
+
+	err := q.storage.UpdateOrder(order)
+	if errors.Is(err, gophermart.ErrOrderFinalized) {
+		log.Printf("[DEBUG] Order %d already finalized, update skipped\n", order.ID)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update order ID %d - %w", order.ID, err)
+	}
+	log.Printf("[DEBUG] Order successfully updated: order %v\n", order)
+
+	if before.Status == order.Status && before.Accrual == order.Accrual {
+		return nil
+	}
+	if q.audit != nil {
+		_ = q.audit.RecordOrderStatus(&before, order)
+	}
+	if q.events != nil {
+		_ = q.events.PublishOrder(order)
+		if order.Status == gophermart.StatusProcessed && order.Accrual > 0 {
+			_ = q.events.PublishBalance(order.UserID)
+		}
 	}
-	log.Printf("[DEBUG] Order successfully updated: order %v\n", qo.order)
 
 	return nil
 }
 
-func (q *Queue) processor(ctx context.Context) {
-	for {
-		q.updatePool()
+func (q *Queue) worker(ctx context.Context, jobs <-chan job) {
+	for j := range jobs {
+		j.done(q.process(ctx, j.order))
+	}
+}
+
+func (q *Queue) process(ctx context.Context, order *gophermart.Order) error {
+	err := q.limiter.Wait(ctx)
+	if err != nil {
+		return err
+	}
 
-		g, _ := errgroup.WithContext(ctx)
-		for _, order := range q.pool {
-			w := &queueOrder{Queue: q, ctx: ctx, order: order}
-			g.Go(w.Do)
+	if !q.breaker.Allow() {
+		retryIn := q.breaker.RetryIn()
+		if retryIn < time.Second {
+			retryIn = time.Second
 		}
-		err := g.Wait()
-		if err != nil {
-			atomic.StoreInt32(&q.needSleep, 1)
-			if !errors.Is(err, gophermart.ErrTooManyRequests) {
-				atomic.StoreUint32(&q.limit, limitDefault)
-			}
-			log.Println("[ERROR] Accrual service request failed -", err)
+		q.postpone(order, retryIn)
+		return gophermart.ErrCircuitOpen
+	}
+
+	w := &queueOrder{Queue: q, ctx: ctx, order: order}
+	err = w.Do()
+	switch {
+	case err == nil:
+		q.breaker.Success()
+	case errors.Is(err, gophermart.ErrTooManyRequests):
+		q.breaker.Release()
+	case ctx.Err() != nil:
+		q.breaker.Release()
+	default:
+		q.breaker.Failure()
+	}
+
+	return err
+}
+
+// runBatch hands the pool to the workers and waits until every order of it
+// is processed.
+func (q *Queue) runBatch(jobs chan<- job) batchStats {
+	var stats batchStats
+	var wg sync.WaitGroup
+
+	for _, order := range q.pool {
+		wg.Add(1)
+		jobs <- job{
+			order: order,
+			done: func(err error) {
+				defer wg.Done()
+				switch {
+				case err == nil:
+					atomic.AddInt32(&stats.ok, 1)
+				case errors.Is(err, gophermart.ErrTooManyRequests), errors.Is(err, gophermart.ErrCircuitOpen):
+					atomic.AddInt32(&stats.throttled, 1)
+				default:
+					atomic.AddInt32(&stats.failed, 1)
+					log.Println("[ERROR] Accrual service request failed -", err)
+				}
+			},
+		}
+	}
+	wg.Wait()
+
+	return stats
+}
+
+// adapt grows the batch additively while the accrual system keeps up and
+// halves it on the first sign of trouble. With a known rate limit the batch is
+// also kept small enough to be processed before the leases expire.
+func (q *Queue) adapt(stats batchStats, leased int) {
+	limit := atomic.LoadUint32(&q.limit)
+
+	if stats.throttled > 0 || stats.failed > 0 {
+		limit /= 2
+	} else if uint32(leased) >= limit {
+		limit += limitDelta
+	}
+
+	if rate := q.limiter.Rate(); rate > 0 {
+		if byRate := uint32(rate * leaseTTL.Seconds() / 2); limit > byRate {
+			limit = byRate
 		}
+	}
+	if limit < limitMin {
+		limit = limitMin
+	}
+	if limit > limitMax {
+		limit = limitMax
+	}
+
+	atomic.StoreUint32(&q.limit, limit)
+}
+
+func (q *Queue) processor(ctx context.Context) {
+	jobs := make(chan job)
 
+	var wg sync.WaitGroup
+	for i := 0; i < q.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.worker(ctx, jobs)
+		}()
+	}
+	defer func() {
+		close(jobs)
+		wg.Wait()
+	}()
+
+	for {
 		sleep := 1 * time.Second
-		if atomic.LoadInt32(&q.needSleep) == 0 {
-			atomic.AddUint32(&q.limit, limitDelta)
+
+		if retryIn := q.breaker.RetryIn(); retryIn > 0 {
+			sleep = retryIn
+			log.Printf("[WARNING] Accrual circuit breaker is open, next probe in %s\n", sleep)
 		} else {
-			sleep = time.Duration(atomic.LoadUint32(&q.sleep)) * time.Second
-			atomic.StoreInt32(&q.needSleep, 0)
+			limit := atomic.LoadUint32(&q.limit)
+			if q.breaker.State() == BreakerHalfOpen {
+				limit = 1
+			}
+
+			q.updatePool(limit)
+			if len(q.pool) > 0 {
+				stats := q.runBatch(jobs)
+				q.adapt(stats, len(q.pool))
+				log.Println("[DEBUG] Got new limit:", atomic.LoadUint32(&q.limit))
+
+				if stats.failed == 0 && stats.throttled == 0 && uint32(len(q.pool)) >= limit {
+					sleep = 0
+				}
+			}
 		}
-		log.Println("[DEBUG] Got new limit:", atomic.LoadUint32(&q.limit))
-		log.Printf("[DEBUG] Sleeping for %s seconds\n", sleep)
+		log.Printf("[DEBUG] Sleeping for %s\n", sleep)
 
 		select {
 		case <-ctx.Done():
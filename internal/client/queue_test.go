@@ -0,0 +1,198 @@
+package client
+
+import (
+	"context"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/Osselnet/gophermart.git/internal/memory"
+	"github.com/Osselnet/gophermart.git/pkg/accrualsim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *clock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+func newTestQueue(t *testing.T, cfg accrualsim.Config) (*Queue, *accrualsim.Sim, gophermart.Storer, uint64) {
+	sim := accrualsim.New(cfg)
+	srv := httptest.NewServer(sim)
+	t.Cleanup(srv.Close)
+
+	st := memory.New()
+	session, err := gophermart.New(st).Register(&gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}, gophermart.Client{})
+	require.NoError(t, err)
+
+	q := NewQueue(st, Config{
+		Address:          srv.URL,
+		Retry:            RetryPolicy{BaseDelay: time.Hour, MaxDelay: time.Hour},
+		Workers:          1,
+		BreakerThreshold: 2,
+		BreakerCooldown:  time.Hour,
+	})
+
+	return q, sim, st, session.UserID
+}
+
+func lease(t *testing.T, st gophermart.Storer, q *Queue, orderID uint64) *gophermart.Order {
+	require.NoError(t, st.RequeueOrder(orderID, nil, false))
+	pool, err := st.LeaseOrders(q.owner, 10, time.Minute)
+	require.NoError(t, err)
+	require.Contains(t, pool, orderID)
+
+	return pool[orderID]
+}
+
+func TestQueue_process(t *testing.T) {
+	clk := &clock{now: time.Now()}
+	q, sim, st, userID := newTestQueue(t, accrualsim.Config{
+		Rules:           []accrualsim.Rule{{Match: "Bork", Reward: 10, RewardType: accrualsim.RewardPercent}},
+		ProcessingDelay: time.Minute,
+		ProcessedDelay:  time.Minute,
+		Now:             clk.Now,
+	})
+	ctx := context.Background()
+	audit := gophermart.NewAuditor(st, gophermart.AuditConfig{HashChain: true})
+	q.SetAuditor(audit)
+	events := gophermart.NewEvents(st)
+	q.SetEvents(events)
+
+	const orderID = 6767584380420
+	require.NoError(t, st.AddOrder(&gophermart.Order{ID: orderID, UserID: userID, Status: gophermart.StatusNew, UploadedAt: time.Now()}))
+
+	assert.NoError(t, q.process(ctx, lease(t, st, q, orderID)), "unknown order")
+	o, err := st.GetOrder(orderID)
+	require.NoError(t, err)
+	assert.Equal(t, gophermart.StatusNew, o.Status)
+	assert.Equal(t, uint32(1), o.Attempts)
+
+	require.NoError(t, sim.Register("6767584380420", accrualsim.Good{Description: "Чайник Bork", Price: 7000}))
+
+	assert.NoError(t, q.process(ctx, lease(t, st, q, orderID)))
+	clk.Add(90 * time.Second)
+	assert.NoError(t, q.process(ctx, lease(t, st, q, orderID)))
+	o, err = st.GetOrder(orderID)
+	require.NoError(t, err)
+	assert.Equal(t, gophermart.StatusProcessing, o.Status)
+
+	assert.NoError(t, q.process(ctx, lease(t, st, q, orderID)))
+	o, err = st.GetOrder(orderID)
+	require.NoError(t, err)
+	assert.Equal(t, gophermart.StatusProcessing, o.Status)
+	assert.Equal(t, uint32(0), o.Attempts, "polls of orders still in processing are not counted")
+	assert.False(t, o.NextAttemptAt.IsZero())
+
+	clk.Add(time.Minute)
+	assert.NoError(t, q.process(ctx, lease(t, st, q, orderID)))
+	o, err = st.GetOrder(orderID)
+	require.NoError(t, err)
+	assert.Equal(t, gophermart.StatusProcessed, o.Status)
+	assert.Equal(t, gophermart.Money(70000), o.Accrual)
+
+	b, err := st.GetBalance(userID)
+	require.NoError(t, err)
+	assert.Equal(t, gophermart.Money(70000), b.Current)
+	assert.Equal(t, 5, sim.Requests())
+
+	es, err := audit.Query(gophermart.AuditFilter{Action: gophermart.AuditOrderStatus})
+	require.NoError(t, err)
+	require.Len(t, es, 2, "only status changes are recorded")
+	assert.Equal(t, "order:6767584380420", es[0].Target)
+	assert.Equal(t, userID, es[0].TargetUserID)
+	assert.JSONEq(t, `{"status":"PROCESSING","accrual":0}`, es[0].Before)
+	assert.JSONEq(t, `{"status":"PROCESSED","accrual":700}`, es[0].After)
+	assert.JSONEq(t, `{"status":"NEW","accrual":0}`, es[1].Before)
+	n, err := audit.Verify()
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	evs, err := events.Since(userID, 0)
+	require.NoError(t, err)
+	require.Len(t, evs, 3)
+	assert.Equal(t, gophermart.EventOrder, evs[0].Type)
+	assert.Contains(t, evs[1].Data, `"status":"PROCESSED","accrual":700`)
+	assert.Equal(t, gophermart.EventBalance, evs[2].Type)
+	assert.JSONEq(t, `{"current":700,"withdrawn":0}`, evs[2].Data)
+}
+
+func TestQueue_processFaults(t *testing.T) {
+	q, sim, st, userID := newTestQueue(t, accrualsim.Config{AutoRegister: true})
+	ctx := context.Background()
+
+	const orderID = 6767584380420
+	require.NoError(t, st.AddOrder(&gophermart.Order{ID: orderID, UserID: userID, Status: gophermart.StatusNew, UploadedAt: time.Now()}))
+
+	sim.Script(accrualsim.Fault{
+		Status:     http.StatusTooManyRequests,
+		RetryAfter: "0",
+		Body:       "No more than 600 requests per minute allowed",
+	})
+	assert.ErrorIs(t, q.process(ctx, lease(t, st, q, orderID)), gophermart.ErrTooManyRequests)
+	assert.Equal(t, float64(10), q.limiter.Rate(), "rate must be learned from the 429 body")
+	assert.Equal(t, BreakerClosed, q.breaker.State(), "throttling is not a failure")
+
+	sim.Script(
+		accrualsim.Fault{Status: http.StatusInternalServerError},
+		accrualsim.Fault{Status: http.StatusInternalServerError},
+	)
+	o := lease(t, st, q, orderID)
+	assert.Error(t, q.process(ctx, o))
+	assert.Error(t, q.process(ctx, o))
+	assert.Equal(t, BreakerOpen, q.breaker.State())
+	assert.Equal(t, uint32(2), o.Attempts, "throttled poll is not counted")
+
+	assert.ErrorIs(t, q.process(ctx, o), gophermart.ErrCircuitOpen)
+	assert.Equal(t, 3, sim.Requests(), "open breaker must not let requests through")
+}
+
+func TestQueue_processRegistered(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"order":"6767584380420","status":"REGISTERED"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	st := memory.New()
+	session, err := gophermart.New(st).Register(&gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}, gophermart.Client{})
+	require.NoError(t, err)
+	q := NewQueue(st, Config{
+		Address: srv.URL,
+		Retry:   RetryPolicy{BaseDelay: time.Hour, MaxDelay: time.Hour, MaxAttempts: 1},
+		Workers: 1,
+	})
+
+	const orderID = 6767584380420
+	require.NoError(t, st.AddOrder(&gophermart.Order{ID: orderID, UserID: session.UserID, Status: gophermart.StatusNew, UploadedAt: time.Now()}))
+
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, q.process(context.Background(), lease(t, st, q, orderID)))
+	}
+	o, err := st.GetOrder(orderID)
+	require.NoError(t, err)
+	assert.Equal(t, gophermart.StatusNew, o.Status)
+	assert.Equal(t, uint32(0), o.Attempts, "registered orders are polled again without counting an attempt")
+	assert.True(t, o.ParkedAt.IsZero())
+	assert.False(t, o.NextAttemptAt.IsZero())
+	assert.Equal(t, 2, requests)
+}
@@ -2,13 +2,12 @@ package client
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/Osselnet/gophermart.git/internal/gophermart"
 	"github.com/go-resty/resty/v2"
 	"log"
 	"net/http"
-	"strconv"
-	"sync/atomic"
 	"time"
 )
 
@@ -25,7 +24,7 @@ func (qo *queueOrder) Do() error {
 	url := fmt.Sprintf("%s%d", qo.url, order.ID)
 	log.Println("[DEBUG] Making request:", url)
 
-	ao := &accrualOrder{}
+	ao := &AccrualOrder{}
 	client := resty.New()
 	resp, err := client.R().
 		SetHeader("Accept", "*/*").
@@ -35,45 +34,57 @@ func (qo *queueOrder) Do() error {
 		SetResult(&ao).
 		Get(url)
 	if err != nil {
+		qo.retryLater(order, err.Error())
 		return err
 	}
 
 	if resp.StatusCode() == http.StatusInternalServerError {
-		return fmt.Errorf("internal server error, status code %d", resp.StatusCode())
+		err = fmt.Errorf("internal server error, status code %d", resp.StatusCode())
+		qo.retryLater(order, err.Error())
+		return err
 	}
 
 	if resp.StatusCode() == http.StatusTooManyRequests {
-		retryAfter, err := strconv.Atoi(resp.Header().Get("Retry-After"))
-		atomic.StoreUint32(&qo.sleep, uint32(retryAfter))
-		if err != nil {
-			return fmt.Errorf("[ERROR] Error failed to parse Retry-After value, err: %w", err)
+		retryAfter, ok := parseRetryAfter(resp.Header().Get("Retry-After"), time.Now())
+		if !ok {
+			log.Printf("[WARNING] Failed to parse Retry-After value `%s`\n", resp.Header().Get("Retry-After"))
+			retryAfter = time.Minute
 		}
-		fmt.Println("[WARNING] Too many requests detected", string(resp.Body()))
+		qo.limiter.Throttle(retryAfter, string(resp.Body()))
+		qo.postpone(order, retryAfter)
+		log.Println("[WARNING] Too many requests detected", string(resp.Body()))
 		return gophermart.ErrTooManyRequests
 	}
 
 	if resp.StatusCode() == http.StatusNoContent {
 		log.Printf("[WARNING] No content for order %d\n", order.ID)
+		qo.retryLater(order, "order is not registered in the accrual system")
 		return nil
 	}
 
 	if resp.StatusCode() != http.StatusOK {
-		return fmt.Errorf("unknown status code %d", resp.StatusCode())
+		err = fmt.Errorf("unknown status code %d", resp.StatusCode())
+		qo.retryLater(order, err.Error())
+		return err
 	}
 
-	if fmt.Sprint(order.ID) != ao.Order {
-		log.Printf("[WARNING] Order ID not match, want %d, got %s\n", order.ID, ao.Order)
+	err = qo.Apply(order, ao)
+	if errors.Is(err, ErrAccrualPending) {
+		qo.pollLater(order)
 		return nil
 	}
-
-	if order.Status == ao.Status && order.Status == gophermart.StatusProcessing {
-		log.Printf("[DEBUG] Order %d already in processing\n", order.ID)
+	if errors.Is(err, ErrAccrualNotApplied) {
+		log.Printf("[DEBUG] Order %d not updated - %s\n", order.ID, err)
+		qo.retryLater(order, err.Error())
 		return nil
 	}
+	if err != nil {
+		return err
+	}
 
-	if !gophermart.IsValidStatus(ao.Status) {
-		log.Printf("[WARNING] Unknown status detected: %s\n", ao.Status)
-		return nil
+	if order.Status == gophermart.StatusNew || order.Status == gophermart.StatusProcessing {
+		qo.pollLater(order)
 	}
-	return qo.updateOrder(ao, qo)
+
+	return nil
 }
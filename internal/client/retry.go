@@ -0,0 +1,125 @@
+package client
+
+import (
+	"fmt"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"log"
+	"math/rand"
+	"time"
+)
+
+type RetryPolicy struct {
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	MaxAttempts uint32
+	MaxAge      time.Duration
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		BaseDelay:   time.Second,
+		MaxDelay:    time.Hour,
+		MaxAttempts: 30,
+		MaxAge:      7 * 24 * time.Hour,
+	}
+}
+
+// Delay returns the pause before the given attempt: the exponential delay
+// capped by MaxDelay, half of which is randomised so orders uploaded together
+// don't keep hitting the accrual system together.
+func (p RetryPolicy) Delay(attempt uint32) time.Duration {
+	delay := p.BaseDelay
+	for i := uint32(1); i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	return jitter(delay)
+}
+
+// PollDelay returns the pause before the next poll of an order the accrual
+// system is still processing. It grows with the age of the order, so long
+// processing is polled less and less often, up to MaxDelay.
+func (p RetryPolicy) PollDelay(age time.Duration) time.Duration {
+	delay := age
+	if delay < p.BaseDelay {
+		delay = p.BaseDelay
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	return jitter(delay)
+}
+
+func jitter(delay time.Duration) time.Duration {
+	half := delay / 2
+	if half <= 0 {
+		return delay
+	}
+
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+func (p RetryPolicy) GiveUp(o *gophermart.Order, now time.Time) bool {
+	if p.MaxAttempts > 0 && o.Attempts >= p.MaxAttempts {
+		return true
+	}
+
+	return p.MaxAge > 0 && now.Sub(o.UploadedAt) > p.MaxAge
+}
+
+// retryLater counts a failed poll: an error, no content or a rejected answer,
+// and schedules the next one, or parks the order once the policy gives up on it.
+func (q *Queue) retryLater(o *gophermart.Order, reason string) {
+	now := time.Now()
+
+	o.Attempts++
+	o.LastError = reason
+	if q.retry.GiveUp(o, now) {
+		o.ParkedAt = now
+		log.Printf("[WARNING] Order %d parked after %d attempts - %s\n", o.ID, o.Attempts, reason)
+	} else {
+		o.NextAttemptAt = now.Add(q.retry.Delay(o.Attempts))
+		log.Printf("[DEBUG] Order %d attempt %d failed, next at %s - %s\n", o.ID, o.Attempts, o.NextAttemptAt.Format(time.RFC3339), reason)
+	}
+
+	err := q.storage.RescheduleOrder(o)
+	if err != nil {
+		log.Printf("[ERROR] Failed to reschedule order %d - %s\n", o.ID, err)
+	}
+}
+
+// pollLater schedules the next poll of an order the accrual system is still
+// processing. That is no failure, so no attempt is counted, only MaxAge can
+// park the order.
+func (q *Queue) pollLater(o *gophermart.Order) {
+	now := time.Now()
+
+	if q.retry.GiveUp(o, now) {
+		o.ParkedAt = now
+		o.LastError = fmt.Sprintf("order is still %s", o.Status)
+		log.Printf("[WARNING] Order %d parked, still %s after %s\n", o.ID, o.Status, now.Sub(o.UploadedAt).Round(time.Second))
+	} else {
+		o.NextAttemptAt = now.Add(q.retry.PollDelay(now.Sub(o.UploadedAt)))
+		log.Printf("[DEBUG] Order %d is %s, next poll at %s\n", o.ID, o.Status, o.NextAttemptAt.Format(time.RFC3339))
+	}
+
+	err := q.storage.RescheduleOrder(o)
+	if err != nil {
+		log.Printf("[ERROR] Failed to reschedule order %d - %s\n", o.ID, err)
+	}
+}
+
+// postpone moves the next poll without counting an attempt, e.g. when the
+// accrual system asks everyone to back off.
+func (q *Queue) postpone(o *gophermart.Order, d time.Duration) {
+	o.NextAttemptAt = time.Now().Add(d)
+
+	err := q.storage.RescheduleOrder(o)
+	if err != nil {
+		log.Printf("[ERROR] Failed to reschedule order %d - %s\n", o.ID, err)
+	}
+}
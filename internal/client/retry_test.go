@@ -0,0 +1,75 @@
+package client
+
+import (
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/Osselnet/gophermart.git/internal/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	p := RetryPolicy{BaseDelay: time.Second, MaxDelay: time.Minute}
+
+	tests := []struct {
+		attempt uint32
+		max     time.Duration
+	}{
+		{attempt: 1, max: time.Second},
+		{attempt: 2, max: 2 * time.Second},
+		{attempt: 5, max: 16 * time.Second},
+		{attempt: 7, max: time.Minute},
+		{attempt: 1000, max: time.Minute},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			d := p.Delay(tt.attempt)
+			assert.GreaterOrEqual(t, d, tt.max/2, "attempt %d", tt.attempt)
+			assert.LessOrEqual(t, d, tt.max, "attempt %d", tt.attempt)
+		}
+	}
+}
+
+func TestRetryPolicy_PollDelay(t *testing.T) {
+	p := RetryPolicy{BaseDelay: time.Second, MaxDelay: time.Hour}
+
+	for i := 0; i < 100; i++ {
+		assert.LessOrEqual(t, p.PollDelay(0), time.Second)
+		d := p.PollDelay(10 * time.Minute)
+		assert.GreaterOrEqual(t, d, 5*time.Minute)
+		assert.LessOrEqual(t, d, 10*time.Minute)
+		assert.LessOrEqual(t, p.PollDelay(48*time.Hour), time.Hour)
+	}
+}
+
+func TestQueue_retryLater(t *testing.T) {
+	st := memory.New()
+	q := NewQueue(st, Config{Retry: RetryPolicy{BaseDelay: time.Hour, MaxDelay: time.Hour, MaxAttempts: 2}})
+
+	require.NoError(t, st.AddOrder(&gophermart.Order{ID: 6767584380420, UserID: 1, Status: gophermart.StatusNew, UploadedAt: time.Now()}))
+
+	pool, err := st.LeaseOrders(q.owner, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, pool, 1)
+
+	q.retryLater(pool[6767584380420], "no content")
+	pool, err = st.LeaseOrders(q.owner, 10, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, pool, "order must wait for its next attempt")
+
+	require.NoError(t, st.RequeueOrder(6767584380420, nil, false))
+	pool, err = st.LeaseOrders(q.owner, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, pool, 1)
+
+	o := pool[6767584380420]
+	q.retryLater(o, "no content")
+	q.retryLater(o, "no content")
+
+	parked, err := st.GetParkedOrders(10)
+	require.NoError(t, err)
+	require.Len(t, parked, 1)
+	assert.Equal(t, uint32(2), parked[0].Attempts)
+	assert.Equal(t, "no content", parked[0].LastError)
+}
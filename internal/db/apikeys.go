@@ -0,0 +1,164 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"strings"
+	"time"
+)
+
+const (
+	tableNameAPIKeys   = "api_keys"
+	apiKeysColumns     = "id, user_id, name, hash, scopes, created_at, expires_at, last_used_at"
+	apiKeysInsert      = "INSERT INTO " + tableNameAPIKeys + " (" + apiKeysColumns + ") VALUES ($1, $2, $3, $4, $5, $6, $7, $8)"
+	apiKeysGet         = "SELECT " + apiKeysColumns + " FROM " + tableNameAPIKeys + " WHERE id=$1"
+	apiKeysGetForUser  = "SELECT " + apiKeysColumns + " FROM " + tableNameAPIKeys + " WHERE user_id=$1 ORDER BY created_at DESC"
+	apiKeysDelete      = "DELETE FROM " + tableNameAPIKeys + " WHERE user_id=$1 AND id=$2"
+	apiKeysDeleteAll   = "DELETE FROM " + tableNameAPIKeys + " WHERE user_id=$1"
+	apiKeysTouch       = "UPDATE " + tableNameAPIKeys + " SET last_used_at=$2 WHERE id=$1"
+	apiKeysScopesDelim = ","
+)
+
+func (s *StorageDB) initAPIKeysStatements() error {
+	var err error
+	var stmt *sql.Stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, apiKeysInsert,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["apiKeysInsert"] = stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, apiKeysGet,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["apiKeysGet"] = stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, apiKeysGetForUser,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["apiKeysGetForUser"] = stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, apiKeysDelete,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["apiKeysDelete"] = stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, apiKeysDeleteAll,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["apiKeysDeleteAll"] = stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, apiKeysTouch,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["apiKeysTouch"] = stmt
+
+	return nil
+}
+
+func scanAPIKey(row scanner) (*gophermart.APIKey, error) {
+	k := &gophermart.APIKey{}
+	var scopes string
+	var expiresAt, lastUsedAt sql.NullTime
+	err := row.Scan(&k.ID, &k.UserID, &k.Name, &k.Hash, &scopes, &k.CreatedAt, &expiresAt, &lastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+	if scopes != "" {
+		k.Scopes = strings.Split(scopes, apiKeysScopesDelim)
+	}
+	k.ExpiresAt = expiresAt.Time
+	k.LastUsedAt = lastUsedAt.Time
+
+	return k, nil
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+func (s *StorageDB) AddAPIKey(k *gophermart.APIKey) error {
+	_, err := s.stmts["apiKeysInsert"].ExecContext(s.ctx, k.ID, k.UserID, k.Name, k.Hash,
+		strings.Join(k.Scopes, apiKeysScopesDelim), k.CreatedAt, nullTime(k.ExpiresAt), nullTime(k.LastUsedAt))
+	if err != nil {
+		return fmt.Errorf("failed to insert API key - %w", err)
+	}
+
+	return nil
+}
+
+func (s *StorageDB) GetAPIKey(id string) (*gophermart.APIKey, error) {
+	k, err := scanAPIKey(s.stmts["apiKeysGet"].QueryRowContext(s.ctx, id))
+	if err == sql.ErrNoRows {
+		return nil, gophermart.ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API key - %w", err)
+	}
+
+	return k, nil
+}
+
+func (s *StorageDB) GetUserAPIKeys(userID uint64) ([]*gophermart.APIKey, error) {
+	rows, err := s.stmts["apiKeysGetForUser"].QueryContext(s.ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API keys - %w", err)
+	}
+	defer rows.Close()
+
+	var keys []*gophermart.APIKey
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+
+	return keys, rows.Err()
+}
+
+func (s *StorageDB) DeleteAPIKey(userID uint64, id string) error {
+	res, err := s.stmts["apiKeysDelete"].ExecContext(s.ctx, userID, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete API key - %w", err)
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return gophermart.ErrAPIKeyNotFound
+	}
+
+	return nil
+}
+
+func (s *StorageDB) TouchAPIKey(id string, at time.Time) error {
+	_, err := s.stmts["apiKeysTouch"].ExecContext(s.ctx, id, at)
+	if err != nil {
+		return fmt.Errorf("failed to touch API key - %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,144 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+)
+
+const (
+	tableNameAudit = "audit_log"
+	auditColumns   = "id, created_at, action, actor_id, target_user_id, target, ip, request_id, before_value, after_value, details, prev_hash, hash"
+	auditInsert    = "INSERT INTO " + tableNameAudit +
+		" (created_at, action, actor_id, target_user_id, target, ip, request_id, before_value, after_value, details, prev_hash, hash)" +
+		" VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING id"
+	auditGetLastHash = "SELECT hash FROM " + tableNameAudit + " ORDER BY id DESC LIMIT 1"
+	// Zero parameters match everything, so one statement serves every
+	// filter. An action ending with a dot matches as a prefix.
+	auditFind = "SELECT " + auditColumns + " FROM " + tableNameAudit + ` WHERE
+		($1 = '' OR action = $1 OR (right($1, 1) = '.' AND left(action, length($1)) = $1))
+		AND ($2 = 0 OR actor_id = $2)
+		AND ($3 = 0 OR target_user_id = $3)
+		AND ($4 = '' OR target = $4)
+		AND ($5 = '' OR ip = $5)
+		AND ($6 = '' OR request_id = $6)
+		AND ($7::timestamptz IS NULL OR created_at >= $7)
+		AND ($8::timestamptz IS NULL OR created_at < $8)
+		AND ($9 = 0 OR id < $9)
+		ORDER BY id DESC LIMIT $10`
+
+	// Serialises chained inserts, so every entry links to the one before it.
+	auditChainLockKey = 7243917254
+	auditChainLock    = "SELECT pg_advisory_xact_lock($1)"
+)
+
+func (s *StorageDB) initAuditStatements() error {
+	var err error
+	var stmt *sql.Stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, auditInsert,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["auditInsert"] = stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, auditGetLastHash,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["auditGetLastHash"] = stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, auditFind,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["auditFind"] = stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, auditChainLock,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["auditChainLock"] = stmt
+
+	return nil
+}
+
+func (s *StorageDB) AddAuditEntry(e *gophermart.AuditEntry, chain bool) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = s.addAuditEntry(tx, e, chain)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("add audit entry transaction failed - %w", err)
+	}
+
+	return nil
+}
+
+// addAuditEntry appends the entry within tx, so it is written along with
+// the change it records. The chain stays locked until tx ends.
+func (s *StorageDB) addAuditEntry(tx *sql.Tx, e *gophermart.AuditEntry, chain bool) error {
+	if chain {
+		_, err := tx.StmtContext(s.ctx, s.stmts["auditChainLock"]).ExecContext(s.ctx, auditChainLockKey)
+		if err != nil {
+			return fmt.Errorf("failed to lock audit log - %w", err)
+		}
+
+		e.PrevHash = ""
+		err = tx.StmtContext(s.ctx, s.stmts["auditGetLastHash"]).QueryRowContext(s.ctx).Scan(&e.PrevHash)
+		if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("failed to get last audit hash - %w", err)
+		}
+		e.Hash = e.ComputeHash(e.PrevHash)
+	}
+
+	target := sql.NullInt64{Int64: int64(e.TargetUserID), Valid: e.TargetUserID != 0}
+	row := tx.StmtContext(s.ctx, s.stmts["auditInsert"]).QueryRowContext(s.ctx, e.CreatedAt, e.Action, e.ActorID, target,
+		e.Target, e.IP, e.RequestID, e.Before, e.After, e.Details, e.PrevHash, e.Hash)
+	err := row.Scan(&e.ID)
+	if err != nil {
+		return fmt.Errorf("failed to insert audit entry - %w", err)
+	}
+
+	return nil
+}
+
+func (s *StorageDB) GetAuditEntries(f gophermart.AuditFilter) ([]*gophermart.AuditEntry, error) {
+	rows, err := s.stmts["auditFind"].QueryContext(s.ctx, f.Action, int64(f.ActorID), int64(f.TargetUserID),
+		f.Target, f.IP, f.RequestID, nullTime(f.Since), nullTime(f.Until), int64(f.BeforeID), f.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit entries - %w", err)
+	}
+	defer rows.Close()
+
+	var es []*gophermart.AuditEntry
+	for rows.Next() {
+		e := &gophermart.AuditEntry{}
+		var target sql.NullInt64
+		err = rows.Scan(&e.ID, &e.CreatedAt, &e.Action, &e.ActorID, &target, &e.Target, &e.IP, &e.RequestID,
+			&e.Before, &e.After, &e.Details, &e.PrevHash, &e.Hash)
+		if err != nil {
+			return nil, err
+		}
+		e.TargetUserID = uint64(target.Int64)
+		es = append(es, e)
+	}
+
+	return es, rows.Err()
+}
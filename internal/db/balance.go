@@ -1,47 +1,20 @@
 package db
 
 import (
-	"context"
 	"database/sql"
 	"fmt"
 	"github.com/Osselnet/gophermart.git/internal/gophermart"
-	"log"
 )
 
 const (
-	tableNameBalance        = "balance"
-	queryCreateTableBalance = `
-			CREATE TABLE IF NOT EXISTS ` + tableNameBalance + ` (
-				user_id bigint PRIMARY KEY,
-				current bigint NOT NULL,
-				withdrawn bigint NOT NULL
-			);
-		`
+	tableNameBalance     = "balance"
 	balanceInsert        = "INSERT INTO " + tableNameBalance + " (user_id, current, withdrawn) VALUES ($1, 0, 0)"
 	balanceGet           = "SELECT * FROM " + tableNameBalance + " WHERE user_id=$1"
+	balanceGetForUpdate  = "SELECT * FROM " + tableNameBalance + " WHERE user_id=$1 FOR UPDATE"
 	balanceUpdate        = "UPDATE " + tableNameBalance + " SET current = $2, withdrawn = $3 WHERE user_id = $1"
 	balanceUpdateCurrent = "UPDATE " + tableNameBalance + " SET current = current+$2 WHERE user_id = $1"
 )
 
-func (s *StorageDB) initBalance(ctx context.Context) error {
-	_, err := s.db.ExecContext(ctx, "select * from "+tableNameBalance+";")
-	if err != nil {
-		_, err = s.db.ExecContext(ctx, queryCreateTableBalance)
-		if err != nil {
-			return err
-		}
-
-		log.Printf("[DEBUG] table `%s` created", tableNameBalance)
-	}
-
-	err = s.initBalanceStatements()
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
 func (s *StorageDB) initBalanceStatements() error {
 	var err error
 	var stmt *sql.Stmt
@@ -62,6 +35,14 @@ func (s *StorageDB) initBalanceStatements() error {
 	}
 	s.stmts["balanceGet"] = stmt
 
+	stmt, err = s.db.PrepareContext(
+		s.ctx, balanceGetForUpdate,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["balanceGetForUpdate"] = stmt
+
 	stmt, err = s.db.PrepareContext(
 		s.ctx, balanceUpdate,
 	)
@@ -96,6 +77,63 @@ func (s *StorageDB) GetBalance(userID uint64) (gophermart.Balance, error) {
 	return b, nil
 }
 
+func (s *StorageDB) AdjustBalance(adj *gophermart.Adjustment, e *gophermart.AuditEntry, chain bool) (gophermart.Balance, error) {
+	b := gophermart.Balance{}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return b, err
+	}
+	defer tx.Rollback()
+
+	row := tx.StmtContext(s.ctx, s.stmts["balanceGetForUpdate"]).QueryRowContext(s.ctx, adj.UserID)
+	err = row.Scan(&b.UserID, &b.Current, &b.Withdrawn)
+	if err == sql.ErrNoRows {
+		return b, gophermart.ErrUserNotFound
+	}
+	if err != nil {
+		return b, fmt.Errorf("failed to get user balance - %w", err)
+	}
+	before := b
+
+	if adj.Direction == gophermart.DirectionDebit {
+		b.Current, err = b.Current.Sub(adj.Amount)
+		if err != nil {
+			return gophermart.Balance{}, gophermart.ErrNotEnoughFunds
+		}
+	} else {
+		b.Current, err = b.Current.Add(adj.Amount)
+		if err != nil {
+			return gophermart.Balance{}, err
+		}
+	}
+
+	_, err = tx.StmtContext(s.ctx, s.stmts["balanceUpdate"]).ExecContext(s.ctx, b.UserID, b.Current, b.Withdrawn)
+	if err != nil {
+		return gophermart.Balance{}, fmt.Errorf("failed to update user balance - %w", err)
+	}
+
+	err = s.addLedgerEntries(tx, gophermart.NewAdjustmentEntries(adj, adj.CreatedAt))
+	if err != nil {
+		return gophermart.Balance{}, err
+	}
+
+	if e != nil {
+		e.SetBalances(before, b)
+		err = s.addAuditEntry(tx, e, chain)
+		if err != nil {
+			return gophermart.Balance{}, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return gophermart.Balance{}, fmt.Errorf("adjust balance transaction failed - %w", err)
+	}
+
+	return b, nil
+}
+
 func (s *StorageDB) UpdateBalance(b *gophermart.Balance) error {
 	result, err := s.stmts["balanceUpdate"].ExecContext(s.ctx, b.UserID, b.Current, b.Withdrawn)
 	if err != nil {
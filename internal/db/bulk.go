@@ -0,0 +1,204 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"strconv"
+	"time"
+)
+
+const (
+	tableNameBulkJobs = "bulk_jobs"
+	bulkJobsColumns   = "id, user_id, status, total, processed, results, error, created_at, updated_at"
+	// Orders uploaded meanwhile by another transaction are waited for and
+	// skipped, their owner is looked up afterwards.
+	ordersInsertNew = "INSERT INTO " + tableNameOrders + " (id, user_id, status, uploaded_at) VALUES ($1, $2, $3, $4) ON CONFLICT (id) DO NOTHING"
+	bulkJobsInsert  = "INSERT INTO " + tableNameBulkJobs + " (" + bulkJobsColumns + ") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)"
+	bulkJobsUpdate  = "UPDATE " + tableNameBulkJobs + " SET status = $2, processed = $3, results = $4, error = $5, updated_at = $6 WHERE id = $1"
+	bulkJobsGet     = "SELECT " + bulkJobsColumns + " FROM " + tableNameBulkJobs + " WHERE id = $1"
+	// Jobs claimed meanwhile by another replica are skipped.
+	bulkJobsClaim = `
+			UPDATE ` + tableNameBulkJobs + ` SET updated_at = $2
+			WHERE id IN (
+				SELECT id FROM ` + tableNameBulkJobs + `
+				WHERE status IN ('pending', 'running') AND updated_at < $1
+				ORDER BY updated_at
+				LIMIT $3
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING ` + bulkJobsColumns + `
+		`
+)
+
+func (s *StorageDB) initBulkStatements() error {
+	var err error
+	var stmt *sql.Stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, ordersInsertNew,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["ordersInsertNew"] = stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, bulkJobsInsert,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["bulkJobsInsert"] = stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, bulkJobsUpdate,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["bulkJobsUpdate"] = stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, bulkJobsGet,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["bulkJobsGet"] = stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, bulkJobsClaim,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["bulkJobsClaim"] = stmt
+
+	return nil
+}
+
+func (s *StorageDB) AddOrders(ors []*gophermart.Order) (map[uint64]uint64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	txInsert := tx.StmtContext(s.ctx, s.stmts["ordersInsertNew"])
+	txGetByID := tx.StmtContext(s.ctx, s.stmts["ordersGetByID"])
+
+	owners := make(map[uint64]uint64)
+	for _, o := range ors {
+		id := strconv.FormatUint(o.ID, 10)
+		res, err := txInsert.ExecContext(s.ctx, id, o.UserID, o.Status, o.UploadedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to insert order %s - %w", id, err)
+		}
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		if rows != 0 {
+			continue
+		}
+
+		stored, err := scanOrder(txGetByID.QueryRowContext(s.ctx, id))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get order %s - %w", id, err)
+		}
+		owners[o.ID] = stored.UserID
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("add orders transaction failed - %w", err)
+	}
+
+	return owners, nil
+}
+
+func (s *StorageDB) AddBulkJob(j *gophermart.BulkJob) error {
+	results, err := json.Marshal(j.Results)
+	if err != nil {
+		return fmt.Errorf("failed to marshal bulk job results - %w", err)
+	}
+
+	_, err = s.stmts["bulkJobsInsert"].ExecContext(s.ctx,
+		j.ID, j.UserID, j.Status, j.Total, j.Processed, string(results), j.Error, j.CreatedAt, j.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to add bulk job - %w", err)
+	}
+
+	return nil
+}
+
+func (s *StorageDB) UpdateBulkJob(j *gophermart.BulkJob) error {
+	results, err := json.Marshal(j.Results)
+	if err != nil {
+		return fmt.Errorf("failed to marshal bulk job results - %w", err)
+	}
+
+	res, err := s.stmts["bulkJobsUpdate"].ExecContext(s.ctx, j.ID, j.Status, j.Processed, string(results), j.Error, j.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to update bulk job - %w", err)
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return gophermart.ErrBulkJobNotFound
+	}
+
+	return nil
+}
+
+func scanBulkJob(row scanner) (*gophermart.BulkJob, error) {
+	j := &gophermart.BulkJob{}
+	var results string
+
+	err := row.Scan(&j.ID, &j.UserID, &j.Status, &j.Total, &j.Processed, &results, &j.Error, &j.CreatedAt, &j.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(results), &j.Results)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal bulk job results - %w", err)
+	}
+
+	return j, nil
+}
+
+func (s *StorageDB) GetBulkJob(id string) (*gophermart.BulkJob, error) {
+	j, err := scanBulkJob(s.stmts["bulkJobsGet"].QueryRowContext(s.ctx, id))
+	if err == sql.ErrNoRows {
+		return nil, gophermart.ErrBulkJobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bulk job - %w", err)
+	}
+
+	return j, nil
+}
+
+func (s *StorageDB) ClaimBulkJobs(staleBefore, now time.Time, limit uint32) ([]*gophermart.BulkJob, error) {
+	rows, err := s.stmts["bulkJobsClaim"].QueryContext(s.ctx, staleBefore, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim bulk jobs - %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []*gophermart.BulkJob
+	for rows.Next() {
+		j, err := scanBulkJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, j)
+	}
+
+	return jobs, rows.Err()
+}
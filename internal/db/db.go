@@ -50,29 +50,38 @@ func (s *StorageDB) init(dsn string) error {
 	ctx, cancel := context.WithTimeout(s.ctx, initTimeOut)
 	defer cancel()
 
-	err = s.initUsers(ctx)
+	m, err := newMigrator(s.db)
 	if err != nil {
-		return fmt.Errorf(`failed to create 'users' table - %w`, err)
-	}
-
-	err = s.initSessions(ctx)
-	if err != nil {
-		return fmt.Errorf(`failed to create 'sessions' table - %w`, err)
-	}
-
-	err = s.initOrders(ctx)
-	if err != nil {
-		return fmt.Errorf(`failed to create 'orders' table - %w`, err)
+		return err
 	}
 
-	err = s.initBalance(ctx)
+	_, err = m.Up(ctx)
 	if err != nil {
-		return fmt.Errorf(`failed to create 'balance' table - %w`, err)
+		return fmt.Errorf("failed to migrate database schema - %w", err)
 	}
 
-	err = s.initWithdrawals(ctx)
-	if err != nil {
-		return fmt.Errorf(`failed to create 'withdrawals' table - %w`, err)
+	for name, prepare := range map[string]func() error{
+		"users":         s.initUsersStatements,
+		"sessions":      s.initSessionsStatements,
+		"orders":        s.initOrdersStatements,
+		"balance":       s.initBalanceStatements,
+		"withdrawals":   s.initWithdrawalsStatements,
+		"ledger":        s.initLedgerStatements,
+		"nonces":        s.initNoncesStatements,
+		"idempotency":   s.initIdempotencyStatements,
+		"recovery":      s.initRecoveryCodesStatements,
+		"loginAttempts": s.initLoginAttemptsStatements,
+		"invalidations": s.initInvalidationsStatements,
+		"apiKeys":       s.initAPIKeysStatements,
+		"audit":         s.initAuditStatements,
+		"lists":         s.initListsStatements,
+		"events":        s.initEventsStatements,
+		"bulk":          s.initBulkStatements,
+	} {
+		err = prepare()
+		if err != nil {
+			return fmt.Errorf("failed to prepare '%s' statements - %w", name, err)
+		}
 	}
 
 	s.db.SetMaxOpenConns(40)
@@ -0,0 +1,188 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/jackc/pgx/v4/stdlib"
+	"strconv"
+	"time"
+)
+
+const (
+	tableNameEvents = "user_events"
+	eventsChannel   = "gophermart_events"
+	eventsInsert    = "INSERT INTO " + tableNameEvents + " (user_id, type, data, created_at) VALUES ($1, $2, $3, $4) RETURNING id"
+	eventsNotify    = "SELECT pg_notify('" + eventsChannel + "', $1)"
+	// eventsLockClass keeps the per user locks of events apart from other
+	// two-key advisory locks.
+	eventsLockClass  = 2201
+	eventsLock       = "SELECT pg_advisory_xact_lock($1, ($2::bigint % 2147483647)::int)"
+	eventsGetForUser = "SELECT id, user_id, type, data, created_at FROM " + tableNameEvents +
+		" WHERE user_id = $1 AND id > $2 ORDER BY id LIMIT $3"
+	eventsGetLastID    = "SELECT COALESCE(max(id), 0) FROM " + tableNameEvents + " WHERE user_id = $1"
+	eventsDeleteBefore = "DELETE FROM " + tableNameEvents + " WHERE id IN (SELECT id FROM " + tableNameEvents +
+		" WHERE created_at < $1 ORDER BY id LIMIT $2)"
+	eventsListen = "LISTEN " + eventsChannel
+)
+
+func (s *StorageDB) initEventsStatements() error {
+	var err error
+	var stmt *sql.Stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, eventsInsert,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["eventsInsert"] = stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, eventsLock,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["eventsLock"] = stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, eventsNotify,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["eventsNotify"] = stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, eventsGetForUser,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["eventsGetForUser"] = stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, eventsGetLastID,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["eventsGetLastID"] = stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, eventsDeleteBefore,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["eventsDeleteBefore"] = stmt
+
+	return nil
+}
+
+// AddUserEvent notifies in the same transaction, notifications are sent on
+// commit, so listeners always find the event. Events of a user are added one
+// at a time, so they commit in the order of their IDs and streams resuming
+// after an ID never miss an event committed late.
+func (s *StorageDB) AddUserEvent(e *gophermart.UserEvent) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.StmtContext(s.ctx, s.stmts["eventsLock"]).ExecContext(s.ctx, eventsLockClass, e.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to lock user events - %w", err)
+	}
+
+	err = tx.StmtContext(s.ctx, s.stmts["eventsInsert"]).QueryRowContext(s.ctx, e.UserID, e.Type, e.Data, e.CreatedAt).Scan(&e.ID)
+	if err != nil {
+		return fmt.Errorf("failed to insert user event - %w", err)
+	}
+
+	_, err = tx.StmtContext(s.ctx, s.stmts["eventsNotify"]).ExecContext(s.ctx, strconv.FormatUint(e.UserID, 10))
+	if err != nil {
+		return fmt.Errorf("failed to notify about user event - %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("add user event transaction failed - %w", err)
+	}
+
+	return nil
+}
+
+func (s *StorageDB) GetUserEvents(userID, afterID uint64, limit uint32) ([]*gophermart.UserEvent, error) {
+	rows, err := s.stmts["eventsGetForUser"].QueryContext(s.ctx, userID, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user events - %w", err)
+	}
+	defer rows.Close()
+
+	var es []*gophermart.UserEvent
+	for rows.Next() {
+		e := &gophermart.UserEvent{}
+		err = rows.Scan(&e.ID, &e.UserID, &e.Type, &e.Data, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		es = append(es, e)
+	}
+
+	return es, rows.Err()
+}
+
+func (s *StorageDB) GetLastUserEventID(userID uint64) (uint64, error) {
+	var id uint64
+	err := s.stmts["eventsGetLastID"].QueryRowContext(s.ctx, userID).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get last user event - %w", err)
+	}
+
+	return id, nil
+}
+
+func (s *StorageDB) DeleteUserEventsBefore(before time.Time, limit uint32) (int64, error) {
+	res, err := s.stmts["eventsDeleteBefore"].ExecContext(s.ctx, before, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete user events - %w", err)
+	}
+
+	return res.RowsAffected()
+}
+
+// SubscribeUserEvents holds a connection of the pool for as long as it
+// listens, until ctx is done or the connection breaks.
+func (s *StorageDB) SubscribeUserEvents(ctx context.Context, fn func(userID uint64)) error {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection - %w", err)
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn interface{}) error {
+		pgConn := driverConn.(*stdlib.Conn).Conn()
+
+		_, err := pgConn.Exec(ctx, eventsListen)
+		if err != nil {
+			return fmt.Errorf("failed to listen for user events - %w", err)
+		}
+		fn(0)
+
+		for {
+			n, err := pgConn.WaitForNotification(ctx)
+			if err != nil {
+				return err
+			}
+			userID, err := strconv.ParseUint(n.Payload, 10, 64)
+			if err != nil {
+				continue
+			}
+			fn(userID)
+		}
+	})
+}
@@ -0,0 +1,133 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"time"
+)
+
+const (
+	tableNameIdempotency = "idempotency_keys"
+	idempotencyColumns   = "user_id, key, fingerprint, status_code, content_type, body, created_at, expires_at"
+	idempotencyInsert    = "INSERT INTO " + tableNameIdempotency + " (" + idempotencyColumns + ") VALUES ($1, $2, $3, $4, $5, $6, $7, $8) " +
+		"ON CONFLICT (user_id, key) DO UPDATE SET fingerprint = EXCLUDED.fingerprint, status_code = EXCLUDED.status_code, " +
+		"content_type = EXCLUDED.content_type, body = EXCLUDED.body, created_at = EXCLUDED.created_at, expires_at = EXCLUDED.expires_at " +
+		"WHERE " + tableNameIdempotency + ".expires_at <= EXCLUDED.created_at"
+	idempotencyGet           = "SELECT " + idempotencyColumns + " FROM " + tableNameIdempotency + " WHERE user_id = $1 AND key = $2"
+	idempotencyUpdate        = "UPDATE " + tableNameIdempotency + " SET status_code = $3, content_type = $4, body = $5 WHERE user_id = $1 AND key = $2"
+	idempotencyDelete        = "DELETE FROM " + tableNameIdempotency + " WHERE user_id = $1 AND key = $2"
+	idempotencyDeleteExpired = "DELETE FROM " + tableNameIdempotency + " WHERE (user_id, key) IN (SELECT user_id, key FROM " +
+		tableNameIdempotency + " WHERE expires_at <= $1 LIMIT $2)"
+)
+
+func (s *StorageDB) initIdempotencyStatements() error {
+	var err error
+	var stmt *sql.Stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, idempotencyInsert,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["idempotencyInsert"] = stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, idempotencyGet,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["idempotencyGet"] = stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, idempotencyUpdate,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["idempotencyUpdate"] = stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, idempotencyDelete,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["idempotencyDelete"] = stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, idempotencyDeleteExpired,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["idempotencyDeleteExpired"] = stmt
+
+	return nil
+}
+
+func (s *StorageDB) AddIdempotencyKey(k *gophermart.IdempotencyKey) (*gophermart.IdempotencyKey, error) {
+	res, err := s.stmts["idempotencyInsert"].ExecContext(s.ctx,
+		k.UserID, k.Key, k.Fingerprint, k.StatusCode, k.ContentType, k.Body, k.CreatedAt, k.ExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add idempotency key - %w", err)
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rows == 1 {
+		return k, nil
+	}
+
+	stored := &gophermart.IdempotencyKey{}
+	err = s.stmts["idempotencyGet"].QueryRowContext(s.ctx, k.UserID, k.Key).Scan(
+		&stored.UserID, &stored.Key, &stored.Fingerprint, &stored.StatusCode,
+		&stored.ContentType, &stored.Body, &stored.CreatedAt, &stored.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("idempotency key expired concurrently - %w", gophermart.ErrIdempotencyKeyNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get idempotency key - %w", err)
+	}
+
+	return stored, gophermart.ErrIdempotencyKeyExists
+}
+
+func (s *StorageDB) SaveIdempotencyKey(k *gophermart.IdempotencyKey) error {
+	res, err := s.stmts["idempotencyUpdate"].ExecContext(s.ctx, k.UserID, k.Key, k.StatusCode, k.ContentType, k.Body)
+	if err != nil {
+		return fmt.Errorf("failed to save idempotency key - %w", err)
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return gophermart.ErrIdempotencyKeyNotFound
+	}
+
+	return nil
+}
+
+func (s *StorageDB) DeleteIdempotencyKey(userID uint64, key string) error {
+	_, err := s.stmts["idempotencyDelete"].ExecContext(s.ctx, userID, key)
+	if err != nil {
+		return fmt.Errorf("failed to delete idempotency key - %w", err)
+	}
+
+	return nil
+}
+
+func (s *StorageDB) DeleteIdempotencyKeysBefore(before time.Time, limit uint32) (int64, error) {
+	res, err := s.stmts["idempotencyDeleteExpired"].ExecContext(s.ctx, before, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired idempotency keys - %w", err)
+	}
+
+	return res.RowsAffected()
+}
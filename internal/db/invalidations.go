@@ -0,0 +1,62 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v4/stdlib"
+)
+
+const (
+	invalidationsChannel = "gophermart_cache"
+	invalidationsNotify  = "SELECT pg_notify('" + invalidationsChannel + "', $1)"
+	invalidationsListen  = "LISTEN " + invalidationsChannel
+)
+
+func (s *StorageDB) initInvalidationsStatements() error {
+	stmt, err := s.db.PrepareContext(
+		s.ctx, invalidationsNotify,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["invalidationsNotify"] = stmt
+
+	return nil
+}
+
+func (s *StorageDB) PublishInvalidation(key string) error {
+	_, err := s.stmts["invalidationsNotify"].ExecContext(s.ctx, key)
+	if err != nil {
+		return fmt.Errorf("failed to publish invalidation - %w", err)
+	}
+
+	return nil
+}
+
+// SubscribeInvalidations holds a connection of the pool for as long as it
+// listens, until ctx is done or the connection breaks.
+func (s *StorageDB) SubscribeInvalidations(ctx context.Context, fn func(key string)) error {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection - %w", err)
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn interface{}) error {
+		pgConn := driverConn.(*stdlib.Conn).Conn()
+
+		_, err := pgConn.Exec(ctx, invalidationsListen)
+		if err != nil {
+			return fmt.Errorf("failed to listen for invalidations - %w", err)
+		}
+		fn("")
+
+		for {
+			n, err := pgConn.WaitForNotification(ctx)
+			if err != nil {
+				return err
+			}
+			fn(n.Payload)
+		}
+	})
+}
@@ -0,0 +1,127 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"time"
+)
+
+const (
+	tableNameLedger  = "ledger"
+	ledgerInsert     = "INSERT INTO " + tableNameLedger + " (tx_id, account, user_id, direction, amount, kind, ref, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)"
+	ledgerColumns    = "id, tx_id, account, user_id, direction, amount, kind, ref, created_at"
+	ledgerGetForUser = "SELECT " + ledgerColumns + " FROM " + tableNameLedger + " WHERE account=$1 AND created_at < $2 ORDER BY created_at, id"
+	ledgerPage       = "SELECT " + ledgerColumns + " FROM " + tableNameLedger +
+		" WHERE account=$1 AND (created_at, id) > ($2, $3) AND created_at < $4 ORDER BY created_at, id LIMIT $5"
+	ledgerTotals = "SELECT COALESCE(sum(amount) FILTER (WHERE direction = 'CREDIT'), 0)::bigint, " +
+		"COALESCE(sum(amount) FILTER (WHERE direction = 'DEBIT'), 0)::bigint FROM " + tableNameLedger +
+		" WHERE account=$1 AND created_at < $2"
+)
+
+func (s *StorageDB) initLedgerStatements() error {
+	var err error
+	var stmt *sql.Stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, ledgerInsert,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["ledgerInsert"] = stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, ledgerGetForUser,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["ledgerGetForUser"] = stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, ledgerPage,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["ledgerPage"] = stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, ledgerTotals,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["ledgerTotals"] = stmt
+
+	return nil
+}
+
+func (s *StorageDB) addLedgerEntries(tx *sql.Tx, entries []*gophermart.LedgerEntry) error {
+	txInsert := tx.StmtContext(s.ctx, s.stmts["ledgerInsert"])
+
+	for _, e := range entries {
+		userID := sql.NullInt64{Int64: int64(e.UserID), Valid: e.UserID != 0}
+		_, err := txInsert.ExecContext(s.ctx, e.TxID, e.Account, userID, e.Direction, e.Amount, e.Kind, e.Ref, e.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to insert ledger entry - %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (s *StorageDB) GetLedgerEntries(userID uint64, until time.Time) ([]*gophermart.LedgerEntry, error) {
+	rows, err := s.stmts["ledgerGetForUser"].QueryContext(s.ctx, gophermart.UserAccount(userID), until)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanLedgerEntries(rows)
+}
+
+func (s *StorageDB) GetLedgerPage(userID uint64, afterAt time.Time, afterID uint64, until time.Time, limit uint32) ([]*gophermart.LedgerEntry, error) {
+	rows, err := s.stmts["ledgerPage"].QueryContext(s.ctx, gophermart.UserAccount(userID), afterAt, afterID, until, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ledger page - %w", err)
+	}
+
+	return scanLedgerEntries(rows)
+}
+
+func (s *StorageDB) GetLedgerTotals(userID uint64, before time.Time) (gophermart.Money, gophermart.Money, error) {
+	var credits, debits gophermart.Money
+	err := s.stmts["ledgerTotals"].QueryRowContext(s.ctx, gophermart.UserAccount(userID), before).Scan(&credits, &debits)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get ledger totals - %w", err)
+	}
+
+	return credits, debits, nil
+}
+
+func scanLedgerEntries(rows *sql.Rows) ([]*gophermart.LedgerEntry, error) {
+	defer rows.Close()
+
+	var entries []*gophermart.LedgerEntry
+	for rows.Next() {
+		var e gophermart.LedgerEntry
+		owner := new(sql.NullInt64)
+
+		err := rows.Scan(&e.ID, &e.TxID, &e.Account, owner, &e.Direction, &e.Amount, &e.Kind, &e.Ref, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		if owner.Valid {
+			e.UserID = uint64(owner.Int64)
+		}
+
+		entries = append(entries, &e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
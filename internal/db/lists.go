@@ -0,0 +1,163 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"strings"
+	"time"
+)
+
+// Zero parameters match everything. Each sort order gets its own statement,
+// the keyset condition and ORDER BY are filled in by listQuery.
+const (
+	ordersFind = "SELECT " + ordersColumns + " FROM " + tableNameOrders + ` WHERE user_id = $1
+		AND ($2::timestamp IS NULL OR uploaded_at >= $2)
+		AND ($3::timestamp IS NULL OR uploaded_at < $3)
+		AND ($4::bigint = 0 OR COALESCE(accrual, 0) >= $4)
+		AND ($5::bigint = 0 OR COALESCE(accrual, 0) <= $5)
+		AND (NOT $6::boolean OR %s)
+		AND ($10::text = '' OR rtrim(status) = ANY(string_to_array($10, ',')))
+		ORDER BY %s LIMIT $9`
+	withdrawalsColumns = "order_id, user_id, sum, processed_at"
+	withdrawalsFind    = "SELECT " + withdrawalsColumns + " FROM " + tableNameWithdrawals + ` WHERE user_id = $1
+		AND ($2::timestamp IS NULL OR processed_at >= $2)
+		AND ($3::timestamp IS NULL OR processed_at < $3)
+		AND ($4::bigint = 0 OR sum >= $4)
+		AND ($5::bigint = 0 OR sum <= $5)
+		AND (NOT $6::boolean OR %s)
+		ORDER BY %s LIMIT $9`
+)
+
+// timestampLayout writes times the way timestamp columns keep them: the
+// wall clock, without a zone, to the microsecond.
+const timestampLayout = "2006-01-02 15:04:05.999999"
+
+// listKey is the column expression a list is sorted by and the type of its
+// cursor parameter.
+type listKey struct {
+	expr string
+	typ  string
+}
+
+var (
+	ordersListKeys = map[string]listKey{
+		gophermart.SortUploadedAt: {"uploaded_at", "timestamp"},
+		gophermart.SortAccrual:    {"COALESCE(accrual, 0)", "bigint"},
+	}
+	withdrawalsListKeys = map[string]listKey{
+		gophermart.SortProcessedAt: {"processed_at", "timestamp"},
+		gophermart.SortSum:         {"sum", "bigint"},
+	}
+)
+
+// listQuery fills the keyset condition on the cursor parameters $7 and $8
+// and the ORDER BY clause of the sort into query. Order numbers are stored
+// as text, the tiebreak compares them as numbers like the memory storage.
+func listQuery(query, sort string, key listKey, idColumn string) string {
+	cmp, dir := ">", "ASC"
+	if gophermart.IsDesc(sort) {
+		cmp, dir = "<", "DESC"
+	}
+	id := idColumn + "::bigint"
+	keyset := fmt.Sprintf("(%s, %s) %s ($7::%s, $8::bigint)", key.expr, id, cmp, key.typ)
+	orderBy := fmt.Sprintf("%s %s, %s %s", key.expr, dir, id, dir)
+
+	return fmt.Sprintf(query, keyset, orderBy)
+}
+
+func (s *StorageDB) initListsStatements() error {
+	lists := []struct {
+		name     string
+		query    string
+		keys     map[string]listKey
+		idColumn string
+	}{
+		{"ordersFind", ordersFind, ordersListKeys, "id"},
+		{"withdrawalsFind", withdrawalsFind, withdrawalsListKeys, "order_id"},
+	}
+
+	for _, l := range lists {
+		for sort, key := range l.keys {
+			for _, sort := range []string{sort, "-" + sort} {
+				stmt, err := s.db.PrepareContext(
+					s.ctx, listQuery(l.query, sort, key, l.idColumn),
+				)
+				if err != nil {
+					return err
+				}
+				s.stmts[l.name+sort] = stmt
+			}
+		}
+	}
+
+	return nil
+}
+
+// listArgs returns the parameters shared by the list statements. Times are
+// read from timestamp columns as UTC, so the time of a cursor is passed as
+// that wall clock and matches the stored value whatever the session zone.
+func listArgs(q gophermart.ListQuery) []interface{} {
+	var after bool
+	var key interface{} = int64(0)
+	var afterID int64
+	if strings.HasSuffix(q.Sort, "_at") {
+		key = sql.NullString{}
+	}
+	if q.After != nil {
+		after = true
+		afterID = int64(q.After.OrderID)
+		key = q.After.Key
+		if strings.HasSuffix(q.Sort, "_at") {
+			key = timestampParam(q.After.Time())
+		}
+	}
+
+	return []interface{}{q.UserID, nullTime(q.From), nullTime(q.To), int64(q.MinAmount), int64(q.MaxAmount),
+		after, key, afterID, q.Limit}
+}
+
+func timestampParam(t time.Time) string {
+	return t.UTC().Format(timestampLayout)
+}
+
+func (s *StorageDB) FindUserOrders(q gophermart.ListQuery) ([]*gophermart.Order, error) {
+	stmt, ok := s.stmts["ordersFind"+q.Sort]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown sort %s", gophermart.ErrListQueryInvalid, q.Sort)
+	}
+
+	args := append(listArgs(q), strings.Join(q.Statuses, ","))
+	rows, err := stmt.QueryContext(s.ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanOrders(rows)
+}
+
+func (s *StorageDB) FindUserWithdrawals(q gophermart.ListQuery) ([]*gophermart.Withdraw, error) {
+	stmt, ok := s.stmts["withdrawalsFind"+q.Sort]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown sort %s", gophermart.ErrListQueryInvalid, q.Sort)
+	}
+
+	rows, err := stmt.QueryContext(s.ctx, listArgs(q)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ws []*gophermart.Withdraw
+	for rows.Next() {
+		w := &gophermart.Withdraw{}
+		err = rows.Scan(&w.OrderID, &w.UserID, &w.Sum, &w.ProcessedAt)
+		if err != nil {
+			return nil, err
+		}
+		ws = append(ws, w)
+	}
+
+	return ws, rows.Err()
+}
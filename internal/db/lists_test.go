@@ -0,0 +1,26 @@
+package db
+
+import (
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestListQuery(t *testing.T) {
+	q := listQuery("WHERE %s ORDER BY %s", "-"+gophermart.SortUploadedAt, ordersListKeys[gophermart.SortUploadedAt], "id")
+	assert.Equal(t, "WHERE (uploaded_at, id::bigint) < ($7::timestamp, $8::bigint) ORDER BY uploaded_at DESC, id::bigint DESC", q,
+		"order numbers are compared as numbers")
+}
+
+func TestListArgs(t *testing.T) {
+	at := time.Date(2026, 3, 1, 12, 30, 15, 123456789, time.UTC)
+	q := gophermart.ListQuery{
+		Sort:  gophermart.SortUploadedAt,
+		After: &gophermart.Cursor{Sort: gophermart.SortUploadedAt, Key: at.UnixNano(), OrderID: 6767584380420},
+	}
+
+	args := listArgs(q)
+	assert.Equal(t, "2026-03-01 12:30:15.123456", args[6], "cursor times are passed as the stored wall clock")
+	assert.Equal(t, int64(6767584380420), args[7])
+}
@@ -0,0 +1,142 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"time"
+)
+
+const (
+	tableNameLoginAttempts = "login_attempts"
+	loginAttemptsColumns   = "key, failures, last_failure_at, locked_until"
+	loginAttemptsGet       = "SELECT " + loginAttemptsColumns + " FROM " + tableNameLoginAttempts + " WHERE key=$1"
+	loginAttemptsReserve   = "INSERT INTO " + tableNameLoginAttempts + " (key, failures, last_failure_at) VALUES ($1, 1, $2) " +
+		"ON CONFLICT (key) DO UPDATE SET failures = CASE WHEN " + tableNameLoginAttempts + ".last_failure_at IS NULL OR " +
+		tableNameLoginAttempts + ".last_failure_at < $3 THEN 1 ELSE " + tableNameLoginAttempts + ".failures + 1 END, " +
+		"last_failure_at = $2 WHERE " + tableNameLoginAttempts + ".failures = $4 AND " +
+		tableNameLoginAttempts + ".last_failure_at IS NOT DISTINCT FROM $5 AND " +
+		tableNameLoginAttempts + ".locked_until IS NOT DISTINCT FROM $6"
+	loginAttemptsRelease = "UPDATE " + tableNameLoginAttempts + " SET failures = failures - 1, " +
+		"last_failure_at = CASE WHEN last_failure_at = $2 THEN $3 ELSE last_failure_at END WHERE key=$1 AND failures > 0"
+	loginAttemptsLock  = "UPDATE " + tableNameLoginAttempts + " SET failures = 0, locked_until = $2 WHERE key=$1 AND failures >= $3"
+	loginAttemptsClear = "DELETE FROM " + tableNameLoginAttempts + " WHERE key=$1"
+)
+
+func (s *StorageDB) initLoginAttemptsStatements() error {
+	stmt, err := s.db.PrepareContext(
+		s.ctx, loginAttemptsGet,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["loginAttemptsGet"] = stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, loginAttemptsReserve,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["loginAttemptsReserve"] = stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, loginAttemptsRelease,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["loginAttemptsRelease"] = stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, loginAttemptsLock,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["loginAttemptsLock"] = stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, loginAttemptsClear,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["loginAttemptsClear"] = stmt
+
+	return nil
+}
+
+func scanLoginAttempts(row scanner) (*gophermart.LoginAttempts, error) {
+	a := &gophermart.LoginAttempts{}
+	var lastFailure, lockedUntil sql.NullTime
+	err := row.Scan(&a.Key, &a.Failures, &lastFailure, &lockedUntil)
+	if err != nil {
+		return nil, err
+	}
+	a.LastFailure = lastFailure.Time
+	a.LockedUntil = lockedUntil.Time
+
+	return a, nil
+}
+
+func (s *StorageDB) GetLoginAttempts(key string) (*gophermart.LoginAttempts, error) {
+	a, err := scanLoginAttempts(s.stmts["loginAttemptsGet"].QueryRowContext(s.ctx, key))
+	if err == sql.ErrNoRows {
+		return &gophermart.LoginAttempts{Key: key}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// ReserveLoginAttempt compares the row with seen as it was read, a missing
+// row is read as empty attempts and taken by the insert.
+func (s *StorageDB) ReserveLoginAttempt(seen *gophermart.LoginAttempts, at, resetBefore time.Time) (bool, error) {
+	res, err := s.stmts["loginAttemptsReserve"].ExecContext(s.ctx, seen.Key, at, resetBefore, seen.Failures,
+		nullTime(seen.LastFailure), nullTime(seen.LockedUntil))
+	if err != nil {
+		return false, fmt.Errorf("failed to reserve login attempt - %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to reserve login attempt - %w", err)
+	}
+
+	return n > 0, nil
+}
+
+func (s *StorageDB) ReleaseLoginAttempt(key string, reservedAt, lastFailure time.Time) error {
+	_, err := s.stmts["loginAttemptsRelease"].ExecContext(s.ctx, key, reservedAt, nullTime(lastFailure))
+	if err != nil {
+		return fmt.Errorf("failed to release login attempt - %w", err)
+	}
+
+	return nil
+}
+
+func (s *StorageDB) LockLogin(key string, until time.Time, minFailures uint32) (bool, error) {
+	res, err := s.stmts["loginAttemptsLock"].ExecContext(s.ctx, key, until, minFailures)
+	if err != nil {
+		return false, fmt.Errorf("failed to lock login - %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to lock login - %w", err)
+	}
+
+	return n > 0, nil
+}
+
+func (s *StorageDB) ClearLoginAttempts(key string) error {
+	_, err := s.stmts["loginAttemptsClear"].ExecContext(s.ctx, key)
+	if err != nil {
+		return fmt.Errorf("failed to clear login attempts - %w", err)
+	}
+
+	return nil
+}
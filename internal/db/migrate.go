@@ -0,0 +1,289 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	tableNameMigrations        = "schema_migrations"
+	queryCreateTableMigrations = `
+			CREATE TABLE IF NOT EXISTS ` + tableNameMigrations + ` (
+				version bigint PRIMARY KEY,
+				name varchar NOT NULL,
+				applied_at timestamptz NOT NULL
+			);
+		`
+	migrationsGetApplied = "SELECT version, applied_at FROM " + tableNameMigrations
+	migrationsInsert     = "INSERT INTO " + tableNameMigrations + " (version, name, applied_at) VALUES ($1, $2, $3)"
+	migrationsDelete     = "DELETE FROM " + tableNameMigrations + " WHERE version=$1"
+
+	// Any constant works as long as every replica uses the same one.
+	migrationsLockKey = 7243917253
+	migrationsLock    = "SELECT pg_advisory_lock($1)"
+	migrationsUnlock  = "SELECT pg_advisory_unlock($1)"
+)
+
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version uint64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+type Migrator struct {
+	db         *sql.DB
+	own        bool
+	migrations []Migration
+}
+
+// NewMigrator connects to the database on its own and does not touch any
+// table until asked, so it also works against an empty or broken schema.
+func NewMigrator(dsn string) (*Migrator, error) {
+	if dsn == "" {
+		return nil, fmt.Errorf("database DSN needed")
+	}
+
+	conn, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := newMigrator(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	m.own = true
+
+	return m, nil
+}
+
+func newMigrator(conn *sql.DB) (*Migrator, error) {
+	migrations, err := loadMigrations(migrationsFS, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load migrations - %w", err)
+	}
+
+	return &Migrator{
+		db:         conn,
+		migrations: migrations,
+	}, nil
+}
+
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	files, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[uint64]*Migration)
+	for _, f := range files {
+		match := migrationFileName.FindStringSubmatch(f.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected file name `%s`", f.Name())
+		}
+
+		version, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := fs.ReadFile(fsys, path.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: `%s` and `%s`", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have both up and down files", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+func (m *Migrator) Close() error {
+	if !m.own {
+		return nil
+	}
+	return m.db.Close()
+}
+
+// Up applies every pending migration in version order and returns the ones
+// it applied.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+
+	err := m.locked(ctx, func(conn *sql.Conn, applied map[uint64]time.Time) error {
+		for _, mg := range m.migrations {
+			if _, ok := applied[mg.Version]; ok {
+				continue
+			}
+
+			err := m.apply(ctx, conn, mg.Up, migrationsInsert, mg.Version, mg.Name, time.Now())
+			if err != nil {
+				return fmt.Errorf("migration %d_%s failed - %w", mg.Version, mg.Name, err)
+			}
+			log.Printf("[INFO] migration %d_%s applied", mg.Version, mg.Name)
+			done = append(done, mg)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// Down rolls back up to steps of the most recently applied migrations and
+// returns the ones it rolled back.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+
+	err := m.locked(ctx, func(conn *sql.Conn, applied map[uint64]time.Time) error {
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			mg := m.migrations[i]
+			if _, ok := applied[mg.Version]; !ok {
+				continue
+			}
+
+			err := m.apply(ctx, conn, mg.Down, migrationsDelete, mg.Version)
+			if err != nil {
+				return fmt.Errorf("rollback of %d_%s failed - %w", mg.Version, mg.Name, err)
+			}
+			log.Printf("[INFO] migration %d_%s rolled back", mg.Version, mg.Name)
+			done = append(done, mg)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+
+	err := m.locked(ctx, func(conn *sql.Conn, applied map[uint64]time.Time) error {
+		for _, mg := range m.migrations {
+			at, ok := applied[mg.Version]
+			statuses = append(statuses, MigrationStatus{
+				Migration: mg,
+				Applied:   ok,
+				AppliedAt: at,
+			})
+		}
+
+		return nil
+	})
+
+	return statuses, err
+}
+
+// locked runs fn on a single connection holding the migrations advisory lock,
+// so replicas starting at the same time apply every migration exactly once.
+func (m *Migrator) locked(ctx context.Context, fn func(*sql.Conn, map[uint64]time.Time) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, migrationsLock, migrationsLockKey)
+	if err != nil {
+		return fmt.Errorf("failed to acquire migrations lock - %w", err)
+	}
+	defer func() {
+		_, err := conn.ExecContext(context.Background(), migrationsUnlock, migrationsLockKey)
+		if err != nil {
+			log.Println("[ERROR] Failed to release migrations lock -", err)
+		}
+	}()
+
+	_, err = conn.ExecContext(ctx, queryCreateTableMigrations)
+	if err != nil {
+		return fmt.Errorf("failed to create `%s` table - %w", tableNameMigrations, err)
+	}
+
+	applied := make(map[uint64]time.Time)
+	rows, err := conn.QueryContext(ctx, migrationsGetApplied)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version uint64
+		var at time.Time
+		if err = rows.Scan(&version, &at); err != nil {
+			return err
+		}
+		applied[version] = at
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	return fn(conn, applied)
+}
+
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, query, record string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, record, args...)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
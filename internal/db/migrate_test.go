@@ -0,0 +1,51 @@
+package db
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations(migrationsFS, "migrations")
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	for i, m := range migrations {
+		assert.Equal(t, uint64(i+1), m.Version, "migration versions must have no gaps")
+		assert.NotEmpty(t, m.Up)
+		assert.NotEmpty(t, m.Down)
+	}
+
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+	}{
+		{
+			name: "missing down",
+			files: fstest.MapFS{
+				"m/0001_init.up.sql": {Data: []byte("SELECT 1;")},
+			},
+		},
+		{
+			name: "bad name",
+			files: fstest.MapFS{
+				"m/init.sql": {Data: []byte("SELECT 1;")},
+			},
+		},
+		{
+			name: "one version, two names",
+			files: fstest.MapFS{
+				"m/0001_init.up.sql":    {Data: []byte("SELECT 1;")},
+				"m/0001_other.down.sql": {Data: []byte("SELECT 1;")},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadMigrations(tt.files, "m")
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS ledger;
+DROP FUNCTION IF EXISTS ledger_immutable();
+DROP TABLE IF EXISTS withdrawals;
+DROP TABLE IF EXISTS balance;
+DROP TABLE IF EXISTS orders;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS users;
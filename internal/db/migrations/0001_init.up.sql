@@ -0,0 +1,74 @@
+CREATE TABLE IF NOT EXISTS users (
+	id serial PRIMARY KEY,
+	login varchar NOT NULL,
+	password bytea NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS sessions (
+	user_id bigint NOT NULL,
+	token varchar NOT NULL,
+	expiry time NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS orders (
+	id varchar NOT NULL UNIQUE PRIMARY KEY,
+	user_id bigint NOT NULL,
+	status char(256) NOT NULL,
+	accrual bigint,
+	uploaded_at timestamp NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS balance (
+	user_id bigint PRIMARY KEY,
+	current bigint NOT NULL,
+	withdrawn bigint NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS withdrawals (
+	order_id varchar NOT NULL UNIQUE PRIMARY KEY,
+	user_id bigint NOT NULL,
+	sum bigint NOT NULL,
+	processed_at timestamp NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS ledger (
+	id bigserial PRIMARY KEY,
+	tx_id varchar NOT NULL,
+	account varchar NOT NULL,
+	user_id bigint,
+	direction varchar(6) NOT NULL CHECK (direction IN ('CREDIT', 'DEBIT')),
+	amount bigint NOT NULL CHECK (amount >= 0),
+	kind varchar NOT NULL,
+	ref varchar NOT NULL,
+	created_at timestamptz NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS ledger_kind_ref_account_idx ON ledger (kind, ref, account);
+CREATE INDEX IF NOT EXISTS ledger_account_created_at_idx ON ledger (account, created_at);
+
+CREATE OR REPLACE FUNCTION ledger_immutable() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'ledger entries are immutable';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS ledger_immutable ON ledger;
+CREATE TRIGGER ledger_immutable BEFORE UPDATE OR DELETE ON ledger
+	FOR EACH ROW EXECUTE FUNCTION ledger_immutable();
+
+-- Databases created before the ledger existed get their history replayed from
+-- the processed orders and the withdrawals, one transaction per row.
+INSERT INTO ledger (tx_id, account, user_id, direction, amount, kind, ref, created_at)
+SELECT * FROM (
+	SELECT 'backfill-accrual-' || id, 'system:accrual', NULL::bigint, 'DEBIT', accrual, 'ACCRUAL', id, uploaded_at::timestamptz
+		FROM orders WHERE status = 'PROCESSED' AND accrual > 0
+	UNION ALL
+	SELECT 'backfill-accrual-' || id, 'user:' || user_id, user_id, 'CREDIT', accrual, 'ACCRUAL', id, uploaded_at::timestamptz
+		FROM orders WHERE status = 'PROCESSED' AND accrual > 0
+	UNION ALL
+	SELECT 'backfill-withdrawal-' || order_id, 'user:' || user_id, user_id, 'DEBIT', sum, 'WITHDRAWAL', order_id, processed_at::timestamptz
+		FROM withdrawals
+	UNION ALL
+	SELECT 'backfill-withdrawal-' || order_id, 'system:withdrawals', NULL::bigint, 'CREDIT', sum, 'WITHDRAWAL', order_id, processed_at::timestamptz
+		FROM withdrawals
+) AS history
+WHERE NOT EXISTS (SELECT 1 FROM ledger);
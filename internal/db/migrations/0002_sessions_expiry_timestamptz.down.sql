@@ -0,0 +1,2 @@
+ALTER TABLE sessions
+	ALTER COLUMN expiry TYPE time USING expiry::time;
@@ -0,0 +1,2 @@
+ALTER TABLE sessions
+	ALTER COLUMN expiry TYPE timestamptz USING (current_date + expiry)::timestamptz;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS withdrawals_user_id_idx;
+DROP INDEX IF EXISTS orders_user_id_idx;
+DROP INDEX IF EXISTS sessions_token_idx;
+DROP INDEX IF EXISTS users_login_idx;
@@ -0,0 +1,4 @@
+CREATE UNIQUE INDEX IF NOT EXISTS users_login_idx ON users (login);
+CREATE INDEX IF NOT EXISTS sessions_token_idx ON sessions (token);
+CREATE INDEX IF NOT EXISTS orders_user_id_idx ON orders (user_id, uploaded_at);
+CREATE INDEX IF NOT EXISTS withdrawals_user_id_idx ON withdrawals (user_id, processed_at);
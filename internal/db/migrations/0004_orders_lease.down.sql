@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS orders_pending_idx;
+
+ALTER TABLE orders
+	DROP COLUMN IF EXISTS lease_until,
+	DROP COLUMN IF EXISTS lease_owner;
@@ -0,0 +1,6 @@
+ALTER TABLE orders
+	ADD COLUMN IF NOT EXISTS lease_owner varchar,
+	ADD COLUMN IF NOT EXISTS lease_until timestamptz;
+
+CREATE INDEX IF NOT EXISTS orders_pending_idx ON orders (uploaded_at)
+	WHERE status IN ('NEW', 'PROCESSING');
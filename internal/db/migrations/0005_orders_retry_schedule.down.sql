@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS orders_parked_idx;
+DROP INDEX IF EXISTS orders_due_idx;
+CREATE INDEX IF NOT EXISTS orders_pending_idx ON orders (uploaded_at)
+	WHERE status IN ('NEW', 'PROCESSING');
+
+ALTER TABLE orders
+	DROP COLUMN IF EXISTS last_error,
+	DROP COLUMN IF EXISTS parked_at,
+	DROP COLUMN IF EXISTS next_attempt_at,
+	DROP COLUMN IF EXISTS attempts;
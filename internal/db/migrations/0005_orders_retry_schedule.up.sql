@@ -0,0 +1,11 @@
+ALTER TABLE orders
+	ADD COLUMN IF NOT EXISTS attempts integer NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS next_attempt_at timestamptz NOT NULL DEFAULT now(),
+	ADD COLUMN IF NOT EXISTS parked_at timestamptz,
+	ADD COLUMN IF NOT EXISTS last_error varchar;
+
+DROP INDEX IF EXISTS orders_pending_idx;
+CREATE INDEX IF NOT EXISTS orders_due_idx ON orders (next_attempt_at)
+	WHERE status IN ('NEW', 'PROCESSING') AND parked_at IS NULL;
+CREATE INDEX IF NOT EXISTS orders_parked_idx ON orders (parked_at)
+	WHERE parked_at IS NOT NULL;
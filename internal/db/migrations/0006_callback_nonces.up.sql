@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS callback_nonces (
+	nonce varchar PRIMARY KEY,
+	expires_at timestamptz NOT NULL
+);
+CREATE INDEX IF NOT EXISTS callback_nonces_expires_at_idx ON callback_nonces (expires_at);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+	user_id bigint NOT NULL,
+	key varchar(255) NOT NULL,
+	fingerprint varchar(64) NOT NULL,
+	status_code integer NOT NULL DEFAULT 0,
+	content_type varchar NOT NULL DEFAULT '',
+	body bytea,
+	created_at timestamptz NOT NULL,
+	expires_at timestamptz NOT NULL,
+	PRIMARY KEY (user_id, key)
+);
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
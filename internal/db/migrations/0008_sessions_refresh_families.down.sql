@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS sessions;
+
+CREATE TABLE sessions (
+	user_id bigint NOT NULL,
+	token varchar NOT NULL,
+	expiry timestamptz NOT NULL
+);
+CREATE INDEX IF NOT EXISTS sessions_token_idx ON sessions (token);
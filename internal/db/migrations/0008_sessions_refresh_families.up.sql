@@ -0,0 +1,13 @@
+-- Sessions used to be opaque 10 minute tokens; they are dropped, users log
+-- in again.
+DROP TABLE IF EXISTS sessions;
+
+CREATE TABLE sessions (
+	id varchar PRIMARY KEY,
+	user_id bigint NOT NULL,
+	generation bigint NOT NULL DEFAULT 0,
+	created_at timestamptz NOT NULL,
+	expiry timestamptz NOT NULL
+);
+CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions (user_id);
+CREATE INDEX IF NOT EXISTS sessions_expiry_idx ON sessions (expiry);
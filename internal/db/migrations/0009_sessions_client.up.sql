@@ -0,0 +1,7 @@
+ALTER TABLE sessions
+	ADD COLUMN IF NOT EXISTS last_seen_at timestamptz,
+	ADD COLUMN IF NOT EXISTS ip varchar NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS user_agent varchar NOT NULL DEFAULT '';
+
+UPDATE sessions SET last_seen_at = created_at WHERE last_seen_at IS NULL;
+ALTER TABLE sessions ALTER COLUMN last_seen_at SET NOT NULL;
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS recovery_codes;
+
+ALTER TABLE users
+	DROP COLUMN IF EXISTS totp_secret,
+	DROP COLUMN IF EXISTS totp_confirmed,
+	DROP COLUMN IF EXISTS totp_last_step;
@@ -0,0 +1,10 @@
+ALTER TABLE users
+	ADD COLUMN IF NOT EXISTS totp_secret varchar NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS totp_confirmed boolean NOT NULL DEFAULT false,
+	ADD COLUMN IF NOT EXISTS totp_last_step bigint NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+	user_id bigint NOT NULL,
+	code_hash varchar(64) NOT NULL,
+	PRIMARY KEY (user_id, code_hash)
+);
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS login_attempts (
+	key varchar NOT NULL PRIMARY KEY,
+	failures integer NOT NULL DEFAULT 0,
+	last_failure_at timestamptz,
+	locked_until timestamptz
+);
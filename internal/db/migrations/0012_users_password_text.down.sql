@@ -0,0 +1 @@
+ALTER TABLE users ALTER COLUMN password TYPE bytea USING convert_to(password, 'UTF8');
@@ -0,0 +1,3 @@
+-- Password hashes are self-describing strings now, e.g. $argon2id$... or
+-- $2a$08$... for the bcrypt hashes stored so far.
+ALTER TABLE users ALTER COLUMN password TYPE varchar USING convert_from(password, 'UTF8');
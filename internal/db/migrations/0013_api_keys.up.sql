@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+	id varchar NOT NULL PRIMARY KEY,
+	user_id bigint NOT NULL,
+	name varchar NOT NULL,
+	hash varchar(64) NOT NULL,
+	scopes varchar NOT NULL,
+	created_at timestamptz NOT NULL,
+	expires_at timestamptz,
+	last_used_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_user_id_idx ON api_keys (user_id);
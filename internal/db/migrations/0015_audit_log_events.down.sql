@@ -0,0 +1,16 @@
+DROP INDEX IF EXISTS audit_log_action_idx;
+DROP INDEX IF EXISTS audit_log_actor_id_idx;
+DROP INDEX IF EXISTS audit_log_created_at_idx;
+
+ALTER TABLE audit_log
+	DROP COLUMN IF EXISTS target,
+	DROP COLUMN IF EXISTS ip,
+	DROP COLUMN IF EXISTS request_id,
+	DROP COLUMN IF EXISTS before_value,
+	DROP COLUMN IF EXISTS after_value,
+	DROP COLUMN IF EXISTS prev_hash,
+	DROP COLUMN IF EXISTS hash;
+
+ALTER TABLE audit_log ALTER COLUMN details DROP DEFAULT;
+ALTER TABLE audit_log ALTER COLUMN details TYPE jsonb USING details::jsonb;
+ALTER TABLE audit_log ALTER COLUMN details SET DEFAULT '{}';
@@ -0,0 +1,16 @@
+-- Details are hashed as written, jsonb would normalise them.
+ALTER TABLE audit_log ALTER COLUMN details TYPE text USING details::text;
+ALTER TABLE audit_log ALTER COLUMN details SET DEFAULT '{}';
+
+ALTER TABLE audit_log
+	ADD COLUMN IF NOT EXISTS target varchar NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS ip varchar NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS request_id varchar NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS before_value text NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS after_value text NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS prev_hash varchar(64) NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS hash varchar(64) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS audit_log_action_idx ON audit_log (action);
+CREATE INDEX IF NOT EXISTS audit_log_actor_id_idx ON audit_log (actor_id);
+CREATE INDEX IF NOT EXISTS audit_log_created_at_idx ON audit_log (created_at);
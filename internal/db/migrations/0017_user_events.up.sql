@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS user_events (
+	id bigserial PRIMARY KEY,
+	user_id bigint NOT NULL,
+	type varchar NOT NULL,
+	data text NOT NULL,
+	created_at timestamptz NOT NULL
+);
+CREATE INDEX IF NOT EXISTS user_events_user_id_idx ON user_events (user_id, id);
+CREATE INDEX IF NOT EXISTS user_events_created_at_idx ON user_events (created_at);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS bulk_jobs (
+	id varchar PRIMARY KEY,
+	user_id bigint NOT NULL,
+	status varchar NOT NULL,
+	total integer NOT NULL,
+	processed integer NOT NULL DEFAULT 0,
+	results text NOT NULL,
+	error varchar NOT NULL DEFAULT '',
+	created_at timestamptz NOT NULL,
+	updated_at timestamptz NOT NULL
+);
+CREATE INDEX IF NOT EXISTS bulk_jobs_user_id_idx ON bulk_jobs (user_id);
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS withdrawals_user_id_sum_idx;
+DROP INDEX IF EXISTS withdrawals_user_id_processed_at_idx;
+CREATE INDEX IF NOT EXISTS withdrawals_user_id_processed_at_idx ON withdrawals (user_id, processed_at, order_id);
+CREATE INDEX IF NOT EXISTS withdrawals_user_id_sum_idx ON withdrawals (user_id, sum, order_id);
+
+DROP INDEX IF EXISTS orders_user_id_accrual_idx;
+DROP INDEX IF EXISTS orders_user_id_uploaded_at_idx;
+CREATE INDEX IF NOT EXISTS orders_user_id_uploaded_at_idx ON orders (user_id, uploaded_at, id);
+CREATE INDEX IF NOT EXISTS orders_user_id_accrual_idx ON orders (user_id, (COALESCE(accrual, 0)), id);
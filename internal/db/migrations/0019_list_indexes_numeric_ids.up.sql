@@ -0,0 +1,10 @@
+-- Lists break ties by the order number as a number, see listQuery.
+DROP INDEX IF EXISTS orders_user_id_uploaded_at_idx;
+DROP INDEX IF EXISTS orders_user_id_accrual_idx;
+CREATE INDEX IF NOT EXISTS orders_user_id_uploaded_at_idx ON orders (user_id, uploaded_at, (id::bigint));
+CREATE INDEX IF NOT EXISTS orders_user_id_accrual_idx ON orders (user_id, (COALESCE(accrual, 0)), (id::bigint));
+
+DROP INDEX IF EXISTS withdrawals_user_id_processed_at_idx;
+DROP INDEX IF EXISTS withdrawals_user_id_sum_idx;
+CREATE INDEX IF NOT EXISTS withdrawals_user_id_processed_at_idx ON withdrawals (user_id, processed_at, (order_id::bigint));
+CREATE INDEX IF NOT EXISTS withdrawals_user_id_sum_idx ON withdrawals (user_id, sum, (order_id::bigint));
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS bulk_jobs_unfinished_idx;
@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS bulk_jobs_unfinished_idx ON bulk_jobs (updated_at) WHERE status IN ('pending', 'running');
@@ -0,0 +1,59 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"time"
+)
+
+const (
+	tableNameNonces     = "callback_nonces"
+	noncesInsert        = "INSERT INTO " + tableNameNonces + " (nonce, expires_at) VALUES ($1, $2) ON CONFLICT (nonce) DO NOTHING"
+	noncesDeleteExpired = "DELETE FROM " + tableNameNonces + " WHERE expires_at < $1"
+)
+
+func (s *StorageDB) initNoncesStatements() error {
+	var err error
+	var stmt *sql.Stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, noncesInsert,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["noncesInsert"] = stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, noncesDeleteExpired,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["noncesDeleteExpired"] = stmt
+
+	return nil
+}
+
+func (s *StorageDB) AddNonce(nonce string, expiresAt time.Time) error {
+	_, err := s.stmts["noncesDeleteExpired"].ExecContext(s.ctx, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to delete expired nonces - %w", err)
+	}
+
+	res, err := s.stmts["noncesInsert"].ExecContext(s.ctx, nonce, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to add nonce - %w", err)
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return gophermart.ErrNonceReused
+	}
+
+	return nil
+}
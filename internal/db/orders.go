@@ -1,53 +1,59 @@
 package db
 
 import (
-	"context"
 	"database/sql"
 	"fmt"
 	"github.com/Osselnet/gophermart.git/internal/gophermart"
-	"log"
 	"strconv"
 	"time"
 )
 
 const (
 	tableNameOrders  = "orders"
-	queryCreateTable = `
-			CREATE TABLE IF NOT EXISTS ` + tableNameOrders + ` (
-				id varchar NOT NULL UNIQUE PRIMARY KEY,
-				user_id bigint NOT NULL,
-				status char(256) NOT NULL, 
-				accrual bigint,
-				uploaded_at timestamp NOT NULL
-			);
-		`
+	ordersColumns    = "id, user_id, status, accrual, uploaded_at, attempts, next_attempt_at, parked_at, last_error"
 	ordersInsert     = "INSERT INTO " + tableNameOrders + " (id, user_id, status, uploaded_at) VALUES ($1, $2, $3, $4)"
-	orderGetByID     = "SELECT * FROM " + tableNameOrders + " WHERE id=$1"
-	ordersUpdate     = "UPDATE " + tableNameOrders + " SET status = $2, accrual = $3 WHERE id = $1"
-	ordersGetByID    = "SELECT * FROM " + tableNameOrders + " WHERE id=$1"
-	ordersGetForUser = "SELECT * FROM " + tableNameOrders + " WHERE user_id=$1 order by uploaded_at"
-	ordersGetForPool = "SELECT * FROM " + tableNameOrders + " WHERE status='NEW' or status='PROCESSING' order by uploaded_at LIMIT $1"
+	orderGetByID     = "SELECT " + ordersColumns + " FROM " + tableNameOrders + " WHERE id=$1"
+	ordersGetByID    = "SELECT " + ordersColumns + " FROM " + tableNameOrders + " WHERE id=$1"
+	ordersGetForUser = "SELECT " + ordersColumns + " FROM " + tableNameOrders + " WHERE user_id=$1 order by uploaded_at"
+	ordersGetParked  = "SELECT " + ordersColumns + " FROM " + tableNameOrders + " WHERE parked_at IS NOT NULL order by parked_at LIMIT $1"
+	// Final orders are never touched again, so a late or repeated accrual
+	// response can't move an order back or credit it twice.
+	ordersUpdate = `
+			UPDATE ` + tableNameOrders + ` SET status = $2, accrual = $3, lease_owner = NULL, lease_until = NULL
+			WHERE id = $1 AND status NOT IN ('PROCESSED', 'INVALID')
+			RETURNING user_id
+		`
+	ordersReschedule = `
+			UPDATE ` + tableNameOrders + ` SET attempts = $2, next_attempt_at = $3, parked_at = $4, last_error = $5,
+				lease_owner = NULL, lease_until = NULL
+			WHERE id = $1 AND status NOT IN ('PROCESSED', 'INVALID')
+		`
+	ordersRequeue = `
+			UPDATE ` + tableNameOrders + ` SET attempts = 0, next_attempt_at = now(), parked_at = NULL, last_error = NULL,
+				lease_owner = NULL, lease_until = NULL
+			WHERE id = $1 AND status NOT IN ('PROCESSED', 'INVALID')
+		`
+	ordersCancelForUser = `
+			UPDATE ` + tableNameOrders + ` SET status = 'INVALID', parked_at = NULL, last_error = $2,
+				lease_owner = NULL, lease_until = NULL
+			WHERE user_id = $1 AND status IN ('NEW', 'PROCESSING')
+		`
+	// Rows locked by another replica are skipped instead of waited for, and a
+	// lease outlives its owner by at most the lease duration.
+	ordersLease = `
+			UPDATE ` + tableNameOrders + ` SET lease_owner = $1, lease_until = now() + $3 * interval '1 millisecond'
+			WHERE id IN (
+				SELECT id FROM ` + tableNameOrders + `
+				WHERE status IN ('NEW', 'PROCESSING') AND parked_at IS NULL AND next_attempt_at <= now()
+					AND (lease_until IS NULL OR lease_until < now())
+				ORDER BY next_attempt_at
+				LIMIT $2
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING ` + ordersColumns + `
+		`
 )
 
-func (s *StorageDB) initOrders(ctx context.Context) error {
-	_, err := s.db.ExecContext(ctx, "select * from "+tableNameOrders+";")
-	if err != nil {
-		_, err = s.db.ExecContext(ctx, queryCreateTable)
-		if err != nil {
-			return err
-		}
-
-		log.Printf("[DEBUG] table `%s` created", tableNameOrders)
-	}
-
-	err = s.initOrdersStatements()
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
 func (s *StorageDB) initOrdersStatements() error {
 	var err error
 	var stmt *sql.Stmt
@@ -93,16 +99,92 @@ func (s *StorageDB) initOrdersStatements() error {
 	s.stmts["ordersGetForUser"] = stmt
 
 	stmt, err = s.db.PrepareContext(
-		s.ctx, ordersGetForPool,
+		s.ctx, ordersLease,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["ordersLease"] = stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, ordersGetParked,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["ordersGetParked"] = stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, ordersReschedule,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["ordersReschedule"] = stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, ordersRequeue,
 	)
 	if err != nil {
 		return err
 	}
-	s.stmts["ordersGetForPool"] = stmt
+	s.stmts["ordersRequeue"] = stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, ordersCancelForUser,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["ordersCancelForUser"] = stmt
 
 	return nil
 }
 
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanOrder(row scanner) (*gophermart.Order, error) {
+	o := &gophermart.Order{}
+	date := new(string)
+	parkedAt := new(sql.NullTime)
+	lastError := new(sql.NullString)
+
+	err := row.Scan(&o.ID, &o.UserID, &o.Status, &o.Accrual, date, &o.Attempts, &o.NextAttemptAt, parkedAt, lastError)
+	if err != nil {
+		return nil, err
+	}
+
+	if parkedAt.Valid {
+		o.ParkedAt = parkedAt.Time
+	}
+	o.LastError = lastError.String
+
+	if o.UploadedAt, err = time.Parse(time.RFC3339, *date); err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
+
+func scanOrders(rows *sql.Rows) ([]*gophermart.Order, error) {
+	var orders []*gophermart.Order
+
+	for rows.Next() {
+		o, err := scanOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return orders, nil
+}
+
 func (s *StorageDB) AddOrder(o *gophermart.Order) error {
 	tx, err := s.db.Begin()
 	if err != nil {
@@ -113,12 +195,7 @@ func (s *StorageDB) AddOrder(o *gophermart.Order) error {
 	txInsert := tx.StmtContext(s.ctx, s.stmts["ordersInsert"])
 	txGetByID := tx.StmtContext(s.ctx, s.stmts["ordersGetByID"])
 
-	var order gophermart.Order
-	date := new(string)
-	accrual := new(sql.NullInt64)
-
-	row := txGetByID.QueryRowContext(s.ctx, strconv.Itoa(int(o.ID)))
-	err = row.Scan(&order.ID, &order.UserID, &order.Status, accrual, date)
+	_, err = scanOrder(txGetByID.QueryRowContext(s.ctx, strconv.Itoa(int(o.ID))))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			_, err = txInsert.ExecContext(s.ctx, strconv.Itoa(int(o.ID)), o.UserID, o.Status, o.UploadedAt)
@@ -139,100 +216,110 @@ func (s *StorageDB) AddOrder(o *gophermart.Order) error {
 }
 
 func (s *StorageDB) GetOrder(orderID uint64) (*gophermart.Order, error) {
-	o := &gophermart.Order{}
-	accrual := new(sql.NullInt64)
-	date := new(string)
-
-	row := s.stmts["orderGetByID"].QueryRowContext(s.ctx, strconv.Itoa(int(orderID)))
-	err := row.Scan(&o.ID, &o.UserID, &o.Status, accrual, date)
+	o, err := scanOrder(s.stmts["orderGetByID"].QueryRowContext(s.ctx, strconv.Itoa(int(orderID))))
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("order not found - %w", err)
+		return nil, fmt.Errorf("%w - %s", gophermart.ErrOrderNotFound, err)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get order - %w", err)
 	}
 
-	if accrual.Valid {
-		o.Accrual = uint64(accrual.Int64)
-	}
-
-	if o.UploadedAt, err = time.Parse(time.RFC3339, *date); err != nil {
-		return nil, err
-	}
-
 	return o, nil
 }
 
 func (s *StorageDB) GetUserOrders(id uint64) ([]*gophermart.Order, error) {
-	var orders []*gophermart.Order
-
 	rows, err := s.stmts["ordersGetForUser"].QueryContext(s.ctx, id)
 	if err != nil {
 		return nil, err
 	}
-	if rows.Err() != nil {
-		return nil, err
-	}
 	defer rows.Close()
 
-	for rows.Next() {
-		var bo gophermart.Order
-		accrual := new(sql.NullInt64)
-		date := new(string)
-
-		err = rows.Scan(&bo.ID, &bo.UserID, &bo.Status, accrual, date)
-		if err != nil {
-			return nil, err
-		}
+	return scanOrders(rows)
+}
 
-		if accrual.Valid {
-			bo.Accrual = uint64(accrual.Int64)
-		}
+func (s *StorageDB) LeaseOrders(owner string, limit uint32, ttl time.Duration) (map[uint64]*gophermart.Order, error) {
+	rows, err := s.stmts["ordersLease"].QueryContext(s.ctx, owner, limit, ttl.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-		if bo.UploadedAt, err = time.Parse(time.RFC3339, *date); err != nil {
-			return nil, err
-		}
+	leased, err := scanOrders(rows)
+	if err != nil {
+		return nil, err
+	}
 
-		orders = append(orders, &bo)
+	orders := make(map[uint64]*gophermart.Order, len(leased))
+	for _, o := range leased {
+		orders[o.ID] = o
 	}
 
 	return orders, nil
 }
 
-func (s *StorageDB) GetPullOrders(limit uint32) (map[uint64]*gophermart.Order, error) {
-	orders := make(map[uint64]*gophermart.Order)
+func (s *StorageDB) RescheduleOrder(o *gophermart.Order) error {
+	parkedAt := sql.NullTime{Time: o.ParkedAt, Valid: !o.ParkedAt.IsZero()}
+	lastError := sql.NullString{String: o.LastError, Valid: o.LastError != ""}
 
-	rows, err := s.stmts["ordersGetForPool"].QueryContext(s.ctx, limit)
+	res, err := s.stmts["ordersReschedule"].ExecContext(s.ctx, strconv.Itoa(int(o.ID)), o.Attempts, o.NextAttemptAt, parkedAt, lastError)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("failed to reschedule order - %w", err)
 	}
-	if rows.Err() != nil {
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return gophermart.ErrOrderFinalized
+	}
+
+	return nil
+}
+
+func (s *StorageDB) GetParkedOrders(limit uint32) ([]*gophermart.Order, error) {
+	rows, err := s.stmts["ordersGetParked"].QueryContext(s.ctx, limit)
+	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	for rows.Next() {
-		var bo gophermart.Order
-		accrual := new(sql.NullInt64)
-		date := new(string)
+	return scanOrders(rows)
+}
 
-		err = rows.Scan(&bo.ID, &bo.UserID, &bo.Status, accrual, date)
-		if err != nil {
-			return nil, err
-		}
+func (s *StorageDB) RequeueOrder(orderID uint64, e *gophermart.AuditEntry, chain bool) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-		if accrual.Valid {
-			bo.Accrual = uint64(accrual.Int64)
-		}
+	res, err := tx.StmtContext(s.ctx, s.stmts["ordersRequeue"]).ExecContext(s.ctx, strconv.Itoa(int(orderID)))
+	if err != nil {
+		return fmt.Errorf("failed to requeue order - %w", err)
+	}
 
-		if bo.UploadedAt, err = time.Parse(time.RFC3339, *date); err != nil {
-			return nil, err
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return gophermart.ErrOrderFinalized
+	}
+
+	if e != nil {
+		err = s.addAuditEntry(tx, e, chain)
+		if err != nil {
+			return err
 		}
+	}
 
-		orders[bo.ID] = &bo
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("requeue order transaction failed - %w", err)
 	}
 
-	return orders, nil
+	return nil
 }
 
 func (s *StorageDB) UpdateOrder(o *gophermart.Order) error {
@@ -244,23 +331,30 @@ func (s *StorageDB) UpdateOrder(o *gophermart.Order) error {
 
 	txUpdateOrder := tx.StmtContext(s.ctx, s.stmts["ordersUpdate"])
 	txUpdateBalance := tx.StmtContext(s.ctx, s.stmts["balanceUpdateCurrent"])
-	//txGetBalance := tx.StmtContext(s.ctx, s.stmts["balanceGet"])
 
-	if o.Status == gophermart.StatusProcessed {
-		_, err = txUpdateOrder.ExecContext(s.ctx, strconv.Itoa(int(o.ID)), o.Status, o.Accrual)
+	var userID uint64
+	row := txUpdateOrder.QueryRowContext(s.ctx, strconv.Itoa(int(o.ID)), o.Status, o.Accrual)
+	err = row.Scan(&userID)
+	if err == sql.ErrNoRows {
+		return gophermart.ErrOrderFinalized
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update order - %w", err)
+	}
+
+	if o.Status == gophermart.StatusProcessed && o.Accrual > 0 {
+		credited := *o
+		credited.UserID = userID
+
+		err = s.addLedgerEntries(tx, gophermart.NewAccrualEntries(&credited, time.Now()))
 		if err != nil {
-			return fmt.Errorf("failed to update order - %w", err)
+			return err
 		}
 
-		_, err = txUpdateBalance.ExecContext(s.ctx, o.UserID, o.Accrual)
+		_, err = txUpdateBalance.ExecContext(s.ctx, userID, o.Accrual)
 		if err != nil {
 			return fmt.Errorf("failed to update user balance - %w", err)
 		}
-	} else {
-		_, err = txUpdateOrder.ExecContext(s.ctx, strconv.Itoa(int(o.ID)), o.Status, o.Accrual)
-		if err != nil {
-			return fmt.Errorf("failed to update order - %w", err)
-		}
 	}
 
 	err = tx.Commit()
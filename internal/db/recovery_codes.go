@@ -0,0 +1,87 @@
+package db
+
+import (
+	"fmt"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+)
+
+const (
+	tableNameRecoveryCodes = "recovery_codes"
+	recoveryCodesInsert    = "INSERT INTO " + tableNameRecoveryCodes + " (user_id, code_hash) VALUES ($1, $2)"
+	recoveryCodesDeleteAll = "DELETE FROM " + tableNameRecoveryCodes + " WHERE user_id=$1"
+	recoveryCodesUse       = "DELETE FROM " + tableNameRecoveryCodes + " WHERE user_id=$1 AND code_hash=$2"
+)
+
+func (s *StorageDB) initRecoveryCodesStatements() error {
+	stmt, err := s.db.PrepareContext(
+		s.ctx, recoveryCodesInsert,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["recoveryCodesInsert"] = stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, recoveryCodesDeleteAll,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["recoveryCodesDeleteAll"] = stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, recoveryCodesUse,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["recoveryCodesUse"] = stmt
+
+	return nil
+}
+
+// SetRecoveryCodes replaces all the recovery codes of the user.
+func (s *StorageDB) SetRecoveryCodes(userID uint64, hashes []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.StmtContext(s.ctx, s.stmts["recoveryCodesDeleteAll"]).ExecContext(s.ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete recovery codes - %w", err)
+	}
+
+	txInsert := tx.StmtContext(s.ctx, s.stmts["recoveryCodesInsert"])
+	for _, h := range hashes {
+		_, err = txInsert.ExecContext(s.ctx, userID, h)
+		if err != nil {
+			return fmt.Errorf("failed to insert recovery code - %w", err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("set recovery codes transaction failed - %w", err)
+	}
+
+	return nil
+}
+
+func (s *StorageDB) UseRecoveryCode(userID uint64, hash string) error {
+	res, err := s.stmts["recoveryCodesUse"].ExecContext(s.ctx, userID, hash)
+	if err != nil {
+		return fmt.Errorf("failed to use recovery code - %w", err)
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return gophermart.ErrTOTPCodeInvalid
+	}
+
+	return nil
+}
@@ -1,76 +1,109 @@
 package db
 
 import (
-	"context"
 	"database/sql"
 	"fmt"
 	"github.com/Osselnet/gophermart.git/internal/gophermart"
-	"log"
+	"time"
 )
 
 const (
-	tableNameSessions        = "sessions"
-	queryCreateTableSessions = `
-			CREATE TABLE IF NOT EXISTS ` + tableNameSessions + ` (
-				user_id bigint NOT NULL,
-				token varchar NOT NULL, 
-				expiry time NOT NULL
-			);
-		`
-	sessionsInsert = "INSERT INTO " + tableNameSessions + " (user_id, token, expiry) VALUES ($1, $2, $3)"
-	sessionsGet    = "SELECT * FROM " + tableNameSessions + " WHERE token=$1"
-	sessionsDelete = "DELETE FROM " + tableNameSessions + " WHERE token=$1"
+	tableNameSessions = "sessions"
+	sessionsColumns   = "id, user_id, generation, created_at, expiry, last_seen_at, ip, user_agent"
+	sessionsInsert    = "INSERT INTO " + tableNameSessions + " (" + sessionsColumns + ") VALUES ($1, $2, $3, $4, $5, $6, $7, $8)"
+	sessionsGet       = "SELECT " + sessionsColumns + " FROM " + tableNameSessions + " WHERE id=$1"
+	sessionsGetByUser = "SELECT " + sessionsColumns + " FROM " + tableNameSessions + " WHERE user_id=$1 AND expiry > now() ORDER BY last_seen_at DESC"
+	sessionsDelete    = "DELETE FROM " + tableNameSessions + " WHERE id=$1"
+	sessionsDeleteAll = "DELETE FROM " + tableNameSessions + " WHERE user_id=$1 RETURNING id"
+	sessionsRotate    = "UPDATE " + tableNameSessions + " SET generation=generation+1, expiry=$3 WHERE id=$1 AND generation=$2"
+	sessionsTouch     = "UPDATE " + tableNameSessions + " SET ip=$2, user_agent=$3, last_seen_at=$4 WHERE id=$1"
+	sessionsReap      = "DELETE FROM " + tableNameSessions + " WHERE id IN (SELECT id FROM " + tableNameSessions +
+		" WHERE expiry < $1 ORDER BY expiry LIMIT $2 FOR UPDATE SKIP LOCKED) RETURNING id"
 )
 
-func (s *StorageDB) initSessions(ctx context.Context) error {
-	_, err := s.db.ExecContext(ctx, "select * from "+tableNameSessions+";")
+func (s *StorageDB) initSessionsStatements() error {
+	stmt, err := s.db.PrepareContext(
+		s.ctx, sessionsInsert,
+	)
 	if err != nil {
-		_, err = s.db.ExecContext(ctx, queryCreateTableSessions)
-		if err != nil {
-			return err
-		}
+		return err
+	}
+	s.stmts["sessionsInsert"] = stmt
 
-		log.Printf("[DEBUG] table `%s` created", tableNameSessions)
+	stmt, err = s.db.PrepareContext(
+		s.ctx, sessionsGet,
+	)
+	if err != nil {
+		return err
 	}
+	s.stmts["sessionsGet"] = stmt
 
-	err = s.initSessionsStatements()
+	stmt, err = s.db.PrepareContext(
+		s.ctx, sessionsDelete,
+	)
 	if err != nil {
 		return err
 	}
+	s.stmts["sessionsDelete"] = stmt
 
-	return nil
-}
+	stmt, err = s.db.PrepareContext(
+		s.ctx, sessionsRotate,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["sessionsRotate"] = stmt
 
-func (s *StorageDB) initSessionsStatements() error {
-	stmt, err := s.db.PrepareContext(
-		s.ctx, sessionsInsert,
+	stmt, err = s.db.PrepareContext(
+		s.ctx, sessionsTouch,
 	)
 	if err != nil {
 		return err
 	}
-	s.stmts["sessionsInsert"] = stmt
+	s.stmts["sessionsTouch"] = stmt
 
 	stmt, err = s.db.PrepareContext(
-		s.ctx, sessionsGet,
+		s.ctx, sessionsGetByUser,
 	)
 	if err != nil {
 		return err
 	}
-	s.stmts["sessionsGet"] = stmt
+	s.stmts["sessionsGetByUser"] = stmt
 
 	stmt, err = s.db.PrepareContext(
-		s.ctx, sessionsDelete,
+		s.ctx, sessionsDeleteAll,
 	)
 	if err != nil {
 		return err
 	}
-	s.stmts["sessionsDelete"] = stmt
+	s.stmts["sessionsDeleteAll"] = stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, sessionsReap,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["sessionsReap"] = stmt
 
 	return nil
 }
 
+func scanSession(row scanner) (*gophermart.Session, error) {
+	session := &gophermart.Session{}
+	err := row.Scan(&session.ID, &session.UserID, &session.Generation, &session.CreatedAt, &session.Expiry,
+		&session.LastSeenAt, &session.IP, &session.UserAgent)
+	if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
 func (s *StorageDB) AddSession(session *gophermart.Session) error {
-	_, err := s.stmts["sessionsInsert"].ExecContext(s.ctx, session.UserID, session.Token, session.Expiry)
+	_, err := s.stmts["sessionsInsert"].ExecContext(s.ctx,
+		session.ID, session.UserID, session.Generation, session.CreatedAt, session.Expiry,
+		session.LastSeenAt, session.IP, session.UserAgent)
 	if err != nil {
 		return err
 	}
@@ -78,10 +111,8 @@ func (s *StorageDB) AddSession(session *gophermart.Session) error {
 	return nil
 }
 
-func (s *StorageDB) GetSession(token string) (*gophermart.Session, error) {
-	session := &gophermart.Session{}
-	row := s.stmts["sessionsGet"].QueryRowContext(s.ctx, token)
-	err := row.Scan(&session.UserID, &session.Token, &session.Expiry)
+func (s *StorageDB) GetSession(id string) (*gophermart.Session, error) {
+	session, err := scanSession(s.stmts["sessionsGet"].QueryRowContext(s.ctx, id))
 	if err == sql.ErrNoRows {
 		return nil, gophermart.ErrSessionNotFound
 	}
@@ -92,8 +123,8 @@ func (s *StorageDB) GetSession(token string) (*gophermart.Session, error) {
 	return session, nil
 }
 
-func (s *StorageDB) DeleteSession(token string) error {
-	res, err := s.stmts["sessionsDelete"].ExecContext(s.ctx, token)
+func (s *StorageDB) DeleteSession(id string) error {
+	res, err := s.stmts["sessionsDelete"].ExecContext(s.ctx, id)
 	if err != nil {
 		return err
 	}
@@ -103,8 +134,95 @@ func (s *StorageDB) DeleteSession(token string) error {
 		return err
 	}
 	if rows == 0 {
-		return fmt.Errorf("session not found")
+		return gophermart.ErrSessionNotFound
 	}
 
 	return nil
 }
+
+func (s *StorageDB) RotateSession(id string, generation uint64, expiry time.Time) error {
+	res, err := s.stmts["sessionsRotate"].ExecContext(s.ctx, id, generation, expiry)
+	if err != nil {
+		return fmt.Errorf("failed to rotate session - %w", err)
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return gophermart.ErrSessionNotFound
+	}
+
+	return nil
+}
+
+func (s *StorageDB) TouchSession(id, ip, userAgent string, at time.Time) error {
+	res, err := s.stmts["sessionsTouch"].ExecContext(s.ctx, id, ip, userAgent, at)
+	if err != nil {
+		return fmt.Errorf("failed to touch session - %w", err)
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return gophermart.ErrSessionNotFound
+	}
+
+	return nil
+}
+
+func (s *StorageDB) GetUserSessions(userID uint64) ([]*gophermart.Session, error) {
+	rows, err := s.stmts["sessionsGetByUser"].QueryContext(s.ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user sessions - %w", err)
+	}
+	defer rows.Close()
+
+	var sns []*gophermart.Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sns = append(sns, session)
+	}
+
+	return sns, rows.Err()
+}
+
+func (s *StorageDB) DeleteUserSessions(userID uint64) ([]string, error) {
+	rows, err := s.stmts["sessionsDeleteAll"].QueryContext(s.ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete user sessions - %w", err)
+	}
+
+	return scanSessionIDs(rows)
+}
+
+func (s *StorageDB) DeleteExpiredSessions(before time.Time, limit uint32) ([]string, error) {
+	rows, err := s.stmts["sessionsReap"].QueryContext(s.ctx, before, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete expired sessions - %w", err)
+	}
+
+	return scanSessionIDs(rows)
+}
+
+func scanSessionIDs(rows *sql.Rows) ([]string, error) {
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		err := rows.Scan(&id)
+		if err != nil {
+			return ids, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
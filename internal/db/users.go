@@ -1,47 +1,28 @@
 package db
 
 import (
-	"context"
 	"database/sql"
 	"fmt"
 	"github.com/Osselnet/gophermart.git/internal/gophermart"
-	"log"
+	"strings"
+	"time"
 )
 
 const (
-	tableNameUsers        = "users"
-	queryCreateTableUsers = `
-			CREATE TABLE IF NOT EXISTS ` + tableNameUsers + ` (
-				id serial PRIMARY KEY,
-				login varchar NOT NULL, 
-				password bytea NOT NULL
-			);
-		`
-	usersInsert     = "INSERT INTO " + tableNameUsers + " (login, password) VALUES ($1, $2)"
-	usersGetByLogin = "SELECT * FROM " + tableNameUsers + " WHERE login=$1"
-	usersGetByID    = "SELECT * FROM " + tableNameUsers + " WHERE id=$1"
-	usersDelete     = "DELETE FROM " + tableNameUsers + " WHERE login=$1"
+	tableNameUsers   = "users"
+	usersColumns     = "id, login, role, password, totp_secret, totp_confirmed"
+	usersInsert      = "INSERT INTO " + tableNameUsers + " (login, password) VALUES ($1, $2)"
+	usersGetByLogin  = "SELECT " + usersColumns + " FROM " + tableNameUsers + " WHERE login=$1"
+	usersGetByID     = "SELECT " + usersColumns + " FROM " + tableNameUsers + " WHERE id=$1"
+	usersDelete      = "DELETE FROM " + tableNameUsers + " WHERE login=$1"
+	usersUpdatePass  = "UPDATE " + tableNameUsers + " SET password=$2 WHERE id=$1"
+	usersUpdateTOTP  = "UPDATE " + tableNameUsers + " SET totp_secret=$2, totp_confirmed=$3 WHERE id=$1"
+	usersUseTOTPStep = "UPDATE " + tableNameUsers + " SET totp_last_step=$2 WHERE id=$1 AND totp_last_step < $2"
+	usersUpdateRole  = "UPDATE " + tableNameUsers + " SET role=$2 WHERE id=$1"
+	usersSearch      = "SELECT " + usersColumns + " FROM " + tableNameUsers + " WHERE login ILIKE '%' || $1 || '%' ESCAPE '\\' OR id::text = $2 ORDER BY id LIMIT $3"
+	usersAnonymize   = "UPDATE " + tableNameUsers + " SET login=$2, password='', totp_secret='', totp_confirmed=false WHERE id=$1"
 )
 
-func (s *StorageDB) initUsers(ctx context.Context) error {
-	_, err := s.db.ExecContext(ctx, "select * from "+tableNameUsers+";")
-	if err != nil {
-		_, err = s.db.ExecContext(ctx, queryCreateTableUsers)
-		if err != nil {
-			return err
-		}
-
-		log.Printf("[DEBUG] table `%s` created", tableNameUsers)
-	}
-
-	err = s.initUsersStatements()
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
 func (s *StorageDB) initUsersStatements() error {
 	var err error
 	var stmt *sql.Stmt
@@ -78,9 +59,61 @@ func (s *StorageDB) initUsersStatements() error {
 	}
 	s.stmts["usersDelete"] = stmt
 
+	stmt, err = s.db.PrepareContext(
+		s.ctx, usersUpdatePass,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["usersUpdatePass"] = stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, usersUpdateTOTP,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["usersUpdateTOTP"] = stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, usersUseTOTPStep,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["usersUseTOTPStep"] = stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, usersAnonymize,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["usersAnonymize"] = stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, usersUpdateRole,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["usersUpdateRole"] = stmt
+
+	stmt, err = s.db.PrepareContext(
+		s.ctx, usersSearch,
+	)
+	if err != nil {
+		return err
+	}
+	s.stmts["usersSearch"] = stmt
+
 	return nil
 }
 
+func scanUser(row scanner, u *gophermart.User) error {
+	return row.Scan(&u.ID, &u.Login, &u.Role, &u.PasswordHash, &u.TOTPSecret, &u.TOTPConfirmed)
+}
+
 func (s *StorageDB) AddUser(u *gophermart.User) (uint64, error) {
 	tx, err := s.db.Begin()
 	if err != nil {
@@ -94,15 +127,15 @@ func (s *StorageDB) AddUser(u *gophermart.User) (uint64, error) {
 
 	row := txGet.QueryRowContext(s.ctx, u.Login)
 	blankUser := gophermart.User{}
-	err = row.Scan(&blankUser.ID, &blankUser.Login, &blankUser.Password)
+	err = scanUser(row, &blankUser)
 	if err == sql.ErrNoRows {
-		_, err = txInsert.ExecContext(s.ctx, u.Login, u.Password)
+		_, err = txInsert.ExecContext(s.ctx, u.Login, u.PasswordHash)
 		if err != nil {
 			return 0, err
 		}
 
 		row = txGet.QueryRowContext(s.ctx, u.Login)
-		err = row.Scan(&u.ID, &u.Login, &u.Password)
+		err = scanUser(row, u)
 		if err != nil {
 			return 0, err
 		}
@@ -148,7 +181,7 @@ func (s *StorageDB) GetUser(byKey interface{}) (*gophermart.User, error) {
 		return nil, fmt.Errorf("given type not implemented")
 	}
 
-	err = row.Scan(&u.ID, &u.Login, &u.Password)
+	err = scanUser(row, &u)
 	if err == sql.ErrNoRows {
 		return nil, gophermart.ErrUserNotFound
 	}
@@ -180,3 +213,187 @@ func (s *StorageDB) DeleteUser(login string) error {
 
 	return nil
 }
+
+func (s *StorageDB) UpdateUserPassword(userID uint64, hash string) error {
+	res, err := s.stmts["usersUpdatePass"].ExecContext(s.ctx, userID, hash)
+	if err != nil {
+		return fmt.Errorf("failed to update user password - %w", err)
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return gophermart.ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (s *StorageDB) AnonymizeUser(userID uint64, login string, forfeit bool) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	txGetBalance := tx.StmtContext(s.ctx, s.stmts["balanceGetForUpdate"])
+	txUpdateBalance := tx.StmtContext(s.ctx, s.stmts["balanceUpdate"])
+	txAnonymize := tx.StmtContext(s.ctx, s.stmts["usersAnonymize"])
+	txDeleteCodes := tx.StmtContext(s.ctx, s.stmts["recoveryCodesDeleteAll"])
+	txDeleteKeys := tx.StmtContext(s.ctx, s.stmts["apiKeysDeleteAll"])
+	txCancelOrders := tx.StmtContext(s.ctx, s.stmts["ordersCancelForUser"])
+
+	var balance gophermart.Balance
+	row := txGetBalance.QueryRowContext(s.ctx, userID)
+	err = row.Scan(&balance.UserID, &balance.Current, &balance.Withdrawn)
+	if err == sql.ErrNoRows {
+		return gophermart.ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get user balance - %w", err)
+	}
+
+	if balance.Current > 0 {
+		if !forfeit {
+			return gophermart.ErrBalanceNotEmpty
+		}
+
+		err = s.addLedgerEntries(tx, gophermart.NewForfeitEntries(userID, balance.Current, time.Now()))
+		if err != nil {
+			return err
+		}
+
+		_, err = txUpdateBalance.ExecContext(s.ctx, userID, gophermart.Money(0), balance.Withdrawn)
+		if err != nil {
+			return fmt.Errorf("failed to update user balance - %w", err)
+		}
+	}
+
+	res, err := txAnonymize.ExecContext(s.ctx, userID, login)
+	if err != nil {
+		return fmt.Errorf("failed to anonymize user - %w", err)
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return gophermart.ErrUserNotFound
+	}
+
+	_, err = txDeleteCodes.ExecContext(s.ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete recovery codes - %w", err)
+	}
+
+	_, err = txDeleteKeys.ExecContext(s.ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete API keys - %w", err)
+	}
+
+	_, err = txCancelOrders.ExecContext(s.ctx, userID, gophermart.OrderCancelledAccountDeleted)
+	if err != nil {
+		return fmt.Errorf("failed to cancel orders - %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("anonymize user transaction failed - %w", err)
+	}
+
+	return nil
+}
+
+func (s *StorageDB) UpdateUserTOTP(userID uint64, secret string, confirmed bool) error {
+	res, err := s.stmts["usersUpdateTOTP"].ExecContext(s.ctx, userID, secret, confirmed)
+	if err != nil {
+		return fmt.Errorf("failed to update user TOTP - %w", err)
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return gophermart.ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (s *StorageDB) UpdateUserRole(userID uint64, role string, e *gophermart.AuditEntry, chain bool) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.StmtContext(s.ctx, s.stmts["usersUpdateRole"]).ExecContext(s.ctx, userID, role)
+	if err != nil {
+		return fmt.Errorf("failed to update user role - %w", err)
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return gophermart.ErrUserNotFound
+	}
+
+	if e != nil {
+		err = s.addAuditEntry(tx, e, chain)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("update user role transaction failed - %w", err)
+	}
+
+	return nil
+}
+
+// likeEscaper makes LIKE wildcards in user input match literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func (s *StorageDB) SearchUsers(query string, limit uint32) ([]*gophermart.User, error) {
+	rows, err := s.stmts["usersSearch"].QueryContext(s.ctx, likeEscaper.Replace(query), query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search users - %w", err)
+	}
+	defer rows.Close()
+
+	var us []*gophermart.User
+	for rows.Next() {
+		u := &gophermart.User{}
+		err = scanUser(rows, u)
+		if err != nil {
+			return nil, err
+		}
+		us = append(us, u)
+	}
+
+	return us, rows.Err()
+}
+
+func (s *StorageDB) UseTOTPStep(userID uint64, step int64) error {
+	res, err := s.stmts["usersUseTOTPStep"].ExecContext(s.ctx, userID, step)
+	if err != nil {
+		return fmt.Errorf("failed to record TOTP step - %w", err)
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return gophermart.ErrTOTPCodeReused
+	}
+
+	return nil
+}
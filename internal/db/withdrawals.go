@@ -1,49 +1,20 @@
 package db
 
 import (
-	"context"
 	"database/sql"
 	"fmt"
 	"github.com/Osselnet/gophermart.git/internal/gophermart"
-	"log"
 	"strconv"
 	"time"
 )
 
 const (
-	tableNameWithdrawals        = "withdrawals"
-	queryCreateTableWithdrawals = `
-			CREATE TABLE IF NOT EXISTS ` + tableNameWithdrawals + ` (
-				order_id varchar NOT NULL UNIQUE PRIMARY KEY,
-				user_id bigint NOT NULL,
-				sum bigint NOT NULL,
-				processed_at timestamp NOT NULL
-			);
-		`
+	tableNameWithdrawals  = "withdrawals"
 	withdrawalsInsert     = "INSERT INTO " + tableNameWithdrawals + " (order_id, user_id, sum, processed_at) VALUES ($1, $2, $3, $4)"
 	withdrawalsGetByID    = "SELECT * FROM " + tableNameWithdrawals + " WHERE order_id=$1"
 	withdrawalsGetForUser = "SELECT * FROM " + tableNameWithdrawals + " WHERE user_id=$1 ORDER BY processed_at desc"
 )
 
-func (s *StorageDB) initWithdrawals(ctx context.Context) error {
-	_, err := s.db.ExecContext(ctx, "select * from "+tableNameWithdrawals+";")
-	if err != nil {
-		_, err = s.db.ExecContext(ctx, queryCreateTableWithdrawals)
-		if err != nil {
-			return err
-		}
-
-		log.Printf("[DEBUG] table `%s` created", tableNameWithdrawals)
-	}
-
-	err = s.initWithdrawalsStatements()
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
 func (s *StorageDB) initWithdrawalsStatements() error {
 	var err error
 	var stmt *sql.Stmt
@@ -84,7 +55,7 @@ func (s *StorageDB) AddWithdraw(withdraw *gophermart.Withdraw) error {
 
 	txGetByID := tx.StmtContext(s.ctx, s.stmts["withdrawalsGetByID"])
 	txInsertWithdrawal := tx.StmtContext(s.ctx, s.stmts["withdrawalsInsert"])
-	txGetBalance := tx.StmtContext(s.ctx, s.stmts["balanceGet"])
+	txGetBalance := tx.StmtContext(s.ctx, s.stmts["balanceGetForUpdate"])
 	txUpdateBalance := tx.StmtContext(s.ctx, s.stmts["balanceUpdate"])
 
 	var balance gophermart.Balance
@@ -113,7 +84,13 @@ func (s *StorageDB) AddWithdraw(withdraw *gophermart.Withdraw) error {
 	err = row.Scan(&bw.OrderID, &bw.UserID, &bw.Sum, date)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			_, err = txInsertWithdrawal.ExecContext(s.ctx, strconv.Itoa(int(withdraw.OrderID)), withdraw.UserID, withdraw.Sum, time.Now())
+			now := time.Now()
+			_, err = txInsertWithdrawal.ExecContext(s.ctx, strconv.Itoa(int(withdraw.OrderID)), withdraw.UserID, withdraw.Sum, now)
+			if err != nil {
+				return err
+			}
+
+			err = s.addLedgerEntries(tx, gophermart.NewWithdrawalEntries(withdraw, now))
 			if err != nil {
 				return err
 			}
@@ -0,0 +1,119 @@
+package gophermart
+
+import (
+	"fmt"
+	"github.com/Osselnet/gophermart.git/pkg/password"
+	"github.com/google/uuid"
+	"log"
+)
+
+// deletedLoginPrefix starts the logins of deleted accounts. The rest is
+// random, so the login of a deleted account can't be guessed.
+const deletedLoginPrefix = "deleted:"
+
+// ChangePassword replaces the password of the user after checking the old
+// one, and ends every session of the user but keepSessionID. The IDs of the
+// ended sessions are returned.
+func (g *GopherMart) ChangePassword(userID uint64, keepSessionID, oldPass, newPass string, client Client) ([]string, error) {
+	user, err := g.Users.Get(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = g.confirmPassword(user, oldPass, client)
+	if err != nil {
+		return nil, err
+	}
+
+	err = g.passwords.Policy.Check(newPass)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrPasswordWeak, err)
+	}
+
+	hash, err := password.Hash(newPass, g.passwords.Params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password - %w", err)
+	}
+
+	err = g.Users.SetPasswordHash(user, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := g.Sessions.RevokeOthers(userID, keepSessionID)
+	_ = g.Audit.Record(&AuditEntry{
+		Action:       AuditPasswordChange,
+		ActorID:      userID,
+		TargetUserID: userID,
+		Target:       auditTargetUser(userID),
+		Details:      auditJSON(map[string]int{"sessions_revoked": len(ids)}),
+	}, client)
+
+	return ids, err
+}
+
+// DeleteAccount anonymises the user and ends all of the user's sessions.
+// Orders, withdrawals and the ledger are kept for accounting, orders not
+// yet processed are cancelled as INVALID. A non-zero
+// balance is forfeited if forfeit is set, otherwise the deletion is refused
+// with ErrBalanceNotEmpty.
+func (g *GopherMart) DeleteAccount(userID uint64, pass string, forfeit bool, client Client) error {
+	user, err := g.Users.Get(userID)
+	if err != nil {
+		return err
+	}
+
+	err = g.confirmPassword(user, pass, client)
+	if err != nil {
+		return err
+	}
+
+	// Taken around the deletion, so concurrent changes may show up as well.
+	before, errBefore := g.Balances.Get(userID)
+
+	err = g.storage.AnonymizeUser(userID, deletedLoginPrefix+uuid.NewString(), forfeit)
+	if err != nil {
+		return err
+	}
+	g.Users.forget(user.Login)
+	g.publishInvalidation(invalidateUser, user.Login)
+
+	e := &AuditEntry{
+		Action:       AuditAccountDelete,
+		ActorID:      userID,
+		TargetUserID: userID,
+		Target:       auditTargetUser(userID),
+		Details:      auditJSON(map[string]bool{"forfeit_balance": forfeit}),
+	}
+	after, err := g.Balances.Get(userID)
+	if err == nil && errBefore == nil {
+		e.SetBalances(before, after)
+	}
+	_ = g.Audit.Record(e, client)
+
+	ids, err := g.Sessions.RevokeAll(userID)
+	if err != nil {
+		log.Printf("[ERROR] Failed to revoke sessions of deleted user %d - %v", userID, err)
+	}
+	log.Printf("[INFO] User %d deleted, %d sessions revoked", userID, len(ids))
+
+	return nil
+}
+
+// confirmPassword checks the password of a logged in user. Wrong passwords
+// count as failed logins.
+func (g *GopherMart) confirmPassword(user *User, pass string, client Client) error {
+	keys := loginAttemptsKeys(user.Login, client)
+	err := g.loginGuard.check(keys)
+	if err != nil {
+		return err
+	}
+
+	if !user.CheckPassword(pass) {
+		g.loginGuard.fail(keys, client)
+		return ErrInvalidPair
+	}
+	g.loginGuard.succeed(keys)
+
+	return nil
+}
@@ -0,0 +1,36 @@
+package gophermart
+
+import "time"
+
+// AccrualStatus describes how the service currently talks to the accrual
+// system.
+type AccrualStatus struct {
+	Breaker     string
+	RetryIn     time.Duration
+	Limit       uint32
+	Workers     int
+	RateLimit   float64
+	PausedUntil time.Time
+}
+
+type AccrualMonitor interface {
+	AccrualStatus() AccrualStatus
+}
+
+func (g *GopherMart) SetAccrualMonitor(m AccrualMonitor) {
+	g.accrual = m
+}
+
+func (g *GopherMart) AccrualStatus() (AccrualStatus, bool) {
+	if g.accrual == nil {
+		return AccrualStatus{}, false
+	}
+
+	return g.accrual.AccrualStatus(), true
+}
+
+// UseNonce remembers a callback nonce until expiresAt and fails with
+// ErrNonceReused if it has been seen before.
+func (g *GopherMart) UseNonce(nonce string, expiresAt time.Time) error {
+	return g.storage.AddNonce(nonce, expiresAt)
+}
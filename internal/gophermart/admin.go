@@ -0,0 +1,206 @@
+package gophermart
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultAdminSearchLimit = 50
+	MaxAdminSearchLimit     = 500
+)
+
+// Adjustment is a balance correction made by support staff.
+type Adjustment struct {
+	ID        string
+	UserID    uint64
+	AdminID   uint64
+	Direction string
+	Amount    Money
+	Reason    string
+	CreatedAt time.Time
+}
+
+// admin gives support staff access to the state of any user. Every method
+// takes the ID of the acting admin and writes an audit entry: reads before
+// the data is handed out, changes once they are made.
+type admin struct {
+	linker *GopherMart
+}
+
+func newAdmin(linker *GopherMart) *admin {
+	return &admin{linker: linker}
+}
+
+// audit records an admin action. Unlike other entries these are mandatory:
+// the action fails if its entry can't be written.
+func (a *admin) audit(actorID uint64, client Client, e *AuditEntry) error {
+	return a.linker.Audit.Record(a.entry(actorID, e), client)
+}
+
+// entry fills in the actor and the target of the entry.
+func (a *admin) entry(actorID uint64, e *AuditEntry) *AuditEntry {
+	e.ActorID = actorID
+	if e.Target == "" && e.TargetUserID != 0 {
+		e.Target = auditTargetUser(e.TargetUserID)
+	}
+
+	return e
+}
+
+func (a *admin) SearchUsers(actorID uint64, client Client, query string, limit uint32) ([]*User, error) {
+	if limit == 0 || limit > MaxAdminSearchLimit {
+		limit = DefaultAdminSearchLimit
+	}
+
+	err := a.audit(actorID, client, &AuditEntry{
+		Action:  AuditAdminSearchUsers,
+		Details: auditJSON(map[string]string{"query": query}),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return a.linker.storage.SearchUsers(query, limit)
+}
+
+func (a *admin) User(actorID, userID uint64, client Client) (*User, error) {
+	err := a.audit(actorID, client, &AuditEntry{Action: AuditAdminViewUser, TargetUserID: userID})
+	if err != nil {
+		return nil, err
+	}
+
+	return a.linker.storage.GetUser(userID)
+}
+
+func (a *admin) Orders(actorID, userID uint64, client Client) ([]*Order, error) {
+	err := a.audit(actorID, client, &AuditEntry{Action: AuditAdminViewOrders, TargetUserID: userID})
+	if err != nil {
+		return nil, err
+	}
+
+	return a.linker.Orders.GetUserOrders(userID)
+}
+
+func (a *admin) Withdrawals(actorID, userID uint64, client Client) ([]*Withdraw, error) {
+	err := a.audit(actorID, client, &AuditEntry{Action: AuditAdminViewWithdrawals, TargetUserID: userID})
+	if err != nil {
+		return nil, err
+	}
+
+	return a.linker.storage.GetUserWithdrawals(userID)
+}
+
+func (a *admin) Balance(actorID, userID uint64, client Client) (Balance, error) {
+	err := a.audit(actorID, client, &AuditEntry{Action: AuditAdminViewBalance, TargetUserID: userID})
+	if err != nil {
+		return Balance{}, err
+	}
+
+	return a.linker.Balances.Get(userID)
+}
+
+// BalanceAt rebuilds the balance of the user from the ledger entries created
+// before at.
+func (a *admin) BalanceAt(actorID, userID uint64, client Client, at time.Time) (Balance, error) {
+	err := a.audit(actorID, client, &AuditEntry{
+		Action:       AuditAdminViewBalance,
+		TargetUserID: userID,
+		Details:      auditJSON(map[string]string{"at": at.UTC().Format(time.RFC3339)}),
+	})
+	if err != nil {
+		return Balance{}, err
+	}
+
+	return a.linker.Balances.At(userID, at)
+}
+
+// Ledger returns the ledger entries of the user created before until.
+func (a *admin) Ledger(actorID, userID uint64, client Client, until time.Time) ([]*LedgerEntry, error) {
+	err := a.audit(actorID, client, &AuditEntry{
+		Action:       AuditAdminViewLedger,
+		TargetUserID: userID,
+		Details:      auditJSON(map[string]string{"until": until.UTC().Format(time.RFC3339)}),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return a.linker.Balances.Ledger(userID, until)
+}
+
+// VerifyBalance checks the stored balance of the user against the one
+// rebuilt from the ledger, ErrBalanceMismatch tells they differ.
+func (a *admin) VerifyBalance(actorID, userID uint64, client Client) error {
+	err := a.audit(actorID, client, &AuditEntry{Action: AuditAdminVerifyBalance, TargetUserID: userID})
+	if err != nil {
+		return err
+	}
+
+	return a.linker.Balances.Verify(userID)
+}
+
+// RequeueOrder puts a stuck order back into the accrual queue.
+func (a *admin) RequeueOrder(actorID, orderID uint64, client Client, reason string) error {
+	o, err := a.linker.Orders.Get(orderID)
+	if err != nil {
+		return fmt.Errorf("%w - %s", ErrOrderNotFound, err)
+	}
+
+	e := a.entry(actorID, &AuditEntry{
+		Action:       AuditAdminRequeueOrder,
+		TargetUserID: o.UserID,
+		Target:       auditTargetOrder(orderID),
+		Before:       auditJSON(&auditOrder{Status: strings.TrimSpace(o.Status), Accrual: o.Accrual}),
+		Details:      auditJSON(map[string]string{"reason": reason}),
+	})
+	a.linker.Audit.stamp(e, client)
+
+	return a.linker.storage.RequeueOrder(orderID, e, a.linker.Audit.chain)
+}
+
+// AdjustBalance credits or debits the user by hand. The reason is mandatory.
+func (a *admin) AdjustBalance(actorID, userID uint64, client Client, direction string, amount Money, reason string) (Balance, error) {
+	reason = strings.TrimSpace(reason)
+	switch {
+	case reason == "":
+		return Balance{}, fmt.Errorf("%w: reason is required", ErrAdjustmentInvalid)
+	case amount == 0:
+		return Balance{}, fmt.Errorf("%w: amount must be positive", ErrAdjustmentInvalid)
+	case direction != DirectionCredit && direction != DirectionDebit:
+		return Balance{}, fmt.Errorf("%w: direction must be %s or %s", ErrAdjustmentInvalid, DirectionCredit, DirectionDebit)
+	}
+
+	adj := &Adjustment{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		AdminID:   actorID,
+		Direction: direction,
+		Amount:    amount,
+		Reason:    reason,
+		CreatedAt: time.Now(),
+	}
+	// The reason is kept by the audit entry only, so it is written along
+	// with the ledger entries.
+	e := a.entry(actorID, &AuditEntry{
+		Action:       AuditAdminAdjustBalance,
+		TargetUserID: userID,
+		Details: auditJSON(map[string]interface{}{
+			"adjustment": adj.ID,
+			"direction":  direction,
+			"amount":     amount,
+			"reason":     reason,
+		}),
+	})
+	a.linker.Audit.stamp(e, client)
+
+	after, err := a.linker.storage.AdjustBalance(adj, e, a.linker.Audit.chain)
+	if err != nil {
+		return Balance{}, err
+	}
+	_ = a.linker.Events.PublishBalance(userID)
+
+	return after, nil
+}
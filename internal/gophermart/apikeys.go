@@ -0,0 +1,216 @@
+package gophermart
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	ScopeOrdersRead  = "orders:read"
+	ScopeOrdersWrite = "orders:write"
+	ScopeBalanceRead = "balance:read"
+	ScopeWithdraw    = "withdraw"
+
+	// APIKeyPrefix starts every API key, so keys can be told apart from
+	// access tokens and found by secret scanners.
+	APIKeyPrefix = "gmk_"
+
+	MaxAPIKeysPerUser = 20
+	maxAPIKeyName     = 64
+
+	// Last use is recorded at most this often to spare a write per request.
+	apiKeyTouchInterval = time.Minute
+)
+
+var Scopes = []string{ScopeOrdersRead, ScopeOrdersWrite, ScopeBalanceRead, ScopeWithdraw}
+
+// APIKey lets a machine client act for the user within Scopes. Only the hash
+// of the secret part is stored, the key itself is shown once on creation.
+type APIKey struct {
+	ID         string
+	UserID     uint64
+	Name       string
+	Hash       string
+	Scopes     []string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	LastUsedAt time.Time
+
+	// Set on freshly created keys only, never stored.
+	Key string
+}
+
+func (k *APIKey) IsExpired() bool {
+	return !k.ExpiresAt.IsZero() && !time.Now().Before(k.ExpiresAt)
+}
+
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+type apiKeys struct {
+	linker *GopherMart
+}
+
+func newAPIKeys(linker *GopherMart) *apiKeys {
+	return &apiKeys{linker: linker}
+}
+
+// Create issues a new key for the user. A zero expiresAt means the key does
+// not expire. The returned key has Key set.
+func (ak *apiKeys) Create(userID uint64, name string, scopes []string, expiresAt time.Time) (*APIKey, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxAPIKeyName {
+		return nil, fmt.Errorf("%w: name must be 1 to %d characters", ErrAPIKeyInvalid, maxAPIKeyName)
+	}
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is needed", ErrAPIKeyInvalid)
+	}
+	for _, s := range scopes {
+		if !isScope(s) {
+			return nil, fmt.Errorf("%w: unknown scope %q", ErrAPIKeyInvalid, s)
+		}
+	}
+	now := time.Now()
+	if !expiresAt.IsZero() && !expiresAt.After(now) {
+		return nil, fmt.Errorf("%w: expiry is in the past", ErrAPIKeyInvalid)
+	}
+
+	keys, err := ak.linker.storage.GetUserAPIKeys(userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) >= MaxAPIKeysPerUser {
+		return nil, ErrAPIKeyLimit
+	}
+
+	id, err := randomString(8, hex.EncodeToString)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomString(32, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &APIKey{
+		ID:        id,
+		UserID:    userID,
+		Name:      name,
+		Hash:      hashAPIKeySecret(secret),
+		Scopes:    uniqueScopes(scopes),
+		CreatedAt: now,
+		ExpiresAt: expiresAt,
+	}
+	err = ak.linker.storage.AddAPIKey(key)
+	if err != nil {
+		return nil, err
+	}
+	key.Key = APIKeyPrefix + id + "_" + secret
+	log.Printf("[INFO] API key %s created for user %d with scopes %s", id, userID, strings.Join(key.Scopes, ","))
+
+	return key, nil
+}
+
+func (ak *apiKeys) ListForUser(userID uint64) ([]*APIKey, error) {
+	return ak.linker.storage.GetUserAPIKeys(userID)
+}
+
+// Revoke deletes a key of the user. Keys of other users are reported as not
+// found.
+func (ak *apiKeys) Revoke(userID uint64, id string) error {
+	err := ak.linker.storage.DeleteAPIKey(userID, id)
+	if err != nil {
+		return err
+	}
+	log.Printf("[INFO] API key %s of user %d revoked", id, userID)
+
+	return nil
+}
+
+// Authenticate finds the key and checks its secret and expiry.
+func (ak *apiKeys) Authenticate(key string) (*APIKey, error) {
+	id, secret, ok := strings.Cut(strings.TrimPrefix(key, APIKeyPrefix), "_")
+	if !ok || !strings.HasPrefix(key, APIKeyPrefix) {
+		return nil, ErrAPIKeyNotFound
+	}
+
+	stored, err := ak.linker.storage.GetAPIKey(id)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(stored.Hash), []byte(hashAPIKeySecret(secret))) != 1 {
+		return nil, ErrAPIKeyNotFound
+	}
+	if stored.IsExpired() {
+		return nil, ErrAPIKeyExpired
+	}
+
+	now := time.Now()
+	if now.Sub(stored.LastUsedAt) >= apiKeyTouchInterval {
+		err = ak.linker.storage.TouchAPIKey(stored.ID, now)
+		if err != nil {
+			log.Printf("[ERROR] Failed to touch API key %s - %s\n", stored.ID, err)
+		}
+		stored.LastUsedAt = now
+	}
+
+	return stored, nil
+}
+
+// IsAPIKey tells API keys from access tokens.
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+func isScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+func uniqueScopes(scopes []string) []string {
+	var unique []string
+	for _, s := range Scopes {
+		for _, given := range scopes {
+			if given == s {
+				unique = append(unique, s)
+				break
+			}
+		}
+	}
+
+	return unique
+}
+
+func hashAPIKeySecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(n int, encode func([]byte) string) (string, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate random bytes - %w", err)
+	}
+
+	return encode(b), nil
+}
@@ -0,0 +1,275 @@
+package gophermart
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultAuditLimit = 100
+	MaxAuditLimit     = 1000
+
+	auditVerifyBatch = 1000
+	// Postgres keeps microseconds, entries are hashed as they are stored.
+	auditTimePrecision = time.Microsecond
+)
+
+const (
+	AuditUserRegister   = "user.register"
+	AuditLogin          = "user.login"
+	AuditLoginFailed    = "user.login.failed"
+	AuditLoginLocked    = "user.login.locked"
+	AuditLoginUnlocked  = "user.login.unlocked"
+	AuditLogout         = "user.logout"
+	AuditPasswordChange = "user.password.change"
+	AuditAccountDelete  = "user.delete"
+	AuditOrderUpload    = "order.upload"
+	AuditOrderStatus    = "order.status"
+	AuditWithdraw       = "balance.withdraw"
+	AuditAdminPrefix    = "admin."
+)
+
+const (
+	AuditAdminSearchUsers     = AuditAdminPrefix + "users.search"
+	AuditAdminViewUser        = AuditAdminPrefix + "user.view"
+	AuditAdminViewOrders      = AuditAdminPrefix + "orders.view"
+	AuditAdminViewWithdrawals = AuditAdminPrefix + "withdrawals.view"
+	AuditAdminViewBalance     = AuditAdminPrefix + "balance.view"
+	AuditAdminViewLedger      = AuditAdminPrefix + "ledger.view"
+	AuditAdminVerifyBalance   = AuditAdminPrefix + "balance.verify"
+	AuditAdminRequeueOrder    = AuditAdminPrefix + "order.requeue"
+	AuditAdminAdjustBalance   = AuditAdminPrefix + "balance.adjust"
+	AuditAdminGrantRole       = AuditAdminPrefix + "role.grant"
+)
+
+// AuditEntry records who did what to whom. ActorID is zero for the system,
+// e.g. the accrual queue, and for clients that are not signed in. Target
+// names the object acted on, e.g. "order:6767584380420". Before, After and
+// Details hold JSON objects, Before and After may be empty.
+//
+// Hash is set if the entry is chained: it covers the entry and PrevHash, the
+// hash of the entry appended before it.
+type AuditEntry struct {
+	ID           uint64
+	CreatedAt    time.Time
+	Action       string
+	ActorID      uint64
+	TargetUserID uint64
+	Target       string
+	IP           string
+	RequestID    string
+	Before       string
+	After        string
+	Details      string
+	PrevHash     string
+	Hash         string
+}
+
+// ComputeHash hashes the entry along with the hash of the previous one.
+func (e *AuditEntry) ComputeHash(prevHash string) string {
+	fields := []string{
+		prevHash,
+		e.CreatedAt.UTC().Format(time.RFC3339Nano),
+		e.Action,
+		fmt.Sprint(e.ActorID),
+		fmt.Sprint(e.TargetUserID),
+		e.Target,
+		e.IP,
+		e.RequestID,
+		e.Before,
+		e.After,
+		e.Details,
+	}
+	sum := sha256.Sum256([]byte(strings.Join(fields, "\x00")))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditFilter selects audit entries, zero fields match everything. Action
+// ending with a dot matches every action starting with it, e.g. "admin.".
+// Entries are returned latest first, BeforeID pages back in time.
+type AuditFilter struct {
+	Action       string
+	ActorID      uint64
+	TargetUserID uint64
+	Target       string
+	IP           string
+	RequestID    string
+	Since        time.Time
+	Until        time.Time
+	BeforeID     uint64
+	Limit        uint32
+}
+
+// Auditor writes the audit log. It is shared by GopherMart and the accrual
+// queue, so both chain their entries the same way.
+type Auditor struct {
+	storage Storer
+	chain   bool
+}
+
+type AuditConfig struct {
+	// HashChain links every new entry to the one before it by hash, so
+	// altered or removed entries can be told by Verify.
+	HashChain bool
+}
+
+func NewAuditor(st Storer, cfg AuditConfig) *Auditor {
+	return &Auditor{storage: st, chain: cfg.HashChain}
+}
+
+func (g *GopherMart) SetAuditConfig(cfg AuditConfig) {
+	g.Audit = NewAuditor(g.storage, cfg)
+}
+
+// Record appends the entry, filling in the time and the client. Failures
+// are logged and returned, callers that can go on without the entry may
+// ignore them.
+func (a *Auditor) Record(e *AuditEntry, client Client) error {
+	a.stamp(e, client)
+
+	err := a.storage.AddAuditEntry(e, a.chain)
+	if err != nil {
+		log.Printf("[SECURITY] Failed to write audit entry %s by user %d - %v", e.Action, e.ActorID, err)
+		return fmt.Errorf("failed to write audit entry - %w", err)
+	}
+
+	return nil
+}
+
+// stamp fills in the time and the client of the entry. Entries the storage
+// writes along with the change they record are stamped before it.
+func (a *Auditor) stamp(e *AuditEntry, client Client) {
+	e.CreatedAt = time.Now().Truncate(auditTimePrecision)
+	e.IP = client.IP
+	e.RequestID = client.RequestID
+	if e.Details == "" {
+		e.Details = "{}"
+	}
+}
+
+func (a *Auditor) Query(f AuditFilter) ([]*AuditEntry, error) {
+	if f.Limit == 0 || f.Limit > MaxAuditLimit {
+		f.Limit = DefaultAuditLimit
+	}
+
+	return a.storage.GetAuditEntries(f)
+}
+
+// Verify walks the whole log back in time and checks the hash of every
+// chained entry, and that every chained entry links to the one before it.
+// It returns the number of chained entries checked.
+func (a *Auditor) Verify() (int, error) {
+	var checked int
+	var newer *AuditEntry
+
+	f := AuditFilter{Limit: auditVerifyBatch}
+	for {
+		es, err := a.storage.GetAuditEntries(f)
+		if err != nil {
+			return checked, err
+		}
+
+		for _, e := range es {
+			if newer != nil && newer.Hash != "" && newer.PrevHash != e.Hash {
+				return checked, auditChainBroken(fmt.Sprintf("entry %d does not link to entry %d", newer.ID, e.ID))
+			}
+			if e.Hash != "" {
+				if e.ComputeHash(e.PrevHash) != e.Hash {
+					return checked, auditChainBroken(fmt.Sprintf("entry %d has been altered", e.ID))
+				}
+				checked++
+			}
+			newer = e
+		}
+
+		if len(es) < int(f.Limit) {
+			break
+		}
+		f.BeforeID = es[len(es)-1].ID
+	}
+
+	if newer != nil && newer.Hash != "" && newer.PrevHash != "" {
+		return checked, auditChainBroken(fmt.Sprintf("entry %d links to a missing entry", newer.ID))
+	}
+
+	return checked, nil
+}
+
+func auditChainBroken(reason string) error {
+	log.Printf("[SECURITY] Audit log hash chain is broken, %s", reason)
+	return fmt.Errorf("%w: %s", ErrAuditChainBroken, reason)
+}
+
+// auditJSON marshals before/after values and details of audit entries.
+func auditJSON(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("[ERROR] Failed to marshal audit value - %v", err)
+		return ""
+	}
+
+	return string(data)
+}
+
+type auditOrder struct {
+	Status  string `json:"status"`
+	Accrual Money  `json:"accrual"`
+}
+
+type auditBalance struct {
+	Current   Money `json:"current"`
+	Withdrawn Money `json:"withdrawn"`
+}
+
+// SetBalances sets Before and After of an entry recording a balance change.
+func (e *AuditEntry) SetBalances(before, after Balance) {
+	e.Before = auditJSON(&auditBalance{Current: before.Current, Withdrawn: before.Withdrawn})
+	e.After = auditJSON(&auditBalance{Current: after.Current, Withdrawn: after.Withdrawn})
+}
+
+// RecordOrderStatus records an accrual status change of the order.
+func (a *Auditor) RecordOrderStatus(before, after *Order) error {
+	return a.Record(&AuditEntry{
+		Action:       AuditOrderStatus,
+		TargetUserID: after.UserID,
+		Target:       auditTargetOrder(after.ID),
+		Before:       auditJSON(&auditOrder{Status: strings.TrimSpace(before.Status), Accrual: before.Accrual}),
+		After:        auditJSON(&auditOrder{Status: strings.TrimSpace(after.Status), Accrual: after.Accrual}),
+	}, Client{})
+}
+
+// recordLogin records a login attempt. user is nil if the login is unknown.
+func (g *GopherMart) recordLogin(login string, user *User, session *Session, loginErr error, client Client) {
+	e := &AuditEntry{Action: AuditLogin, Target: "login:" + login}
+	if user != nil {
+		e.TargetUserID = user.ID
+	}
+
+	if loginErr != nil {
+		e.Action = AuditLoginFailed
+		e.Details = auditJSON(map[string]string{"error": loginErr.Error()})
+	} else {
+		e.ActorID = user.ID
+		e.Details = auditJSON(map[string]string{"session": session.ID})
+	}
+
+	_ = g.Audit.Record(e, client)
+}
+
+func auditTargetUser(id uint64) string {
+	return fmt.Sprintf("user:%d", id)
+}
+
+func auditTargetOrder(id uint64) string {
+	return fmt.Sprintf("order:%d", id)
+}
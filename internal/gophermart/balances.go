@@ -1,14 +1,19 @@
 package gophermart
 
+import (
+	"fmt"
+	"time"
+)
+
 type Balance struct {
 	UserID    uint64
-	Current   uint64
-	Withdrawn uint64
+	Current   Money
+	Withdrawn Money
 }
 
 type BalanceProxy struct {
-	Current   float64 `json:"current"`
-	Withdrawn float64 `json:"withdrawn"`
+	Current   Money `json:"current"`
+	Withdrawn Money `json:"withdrawn"`
 }
 
 type balances struct {
@@ -24,3 +29,35 @@ func newBalance(linker *GopherMart) *balances {
 func (bs *balances) Get(userID uint64) (Balance, error) {
 	return bs.linker.storage.GetBalance(userID)
 }
+
+func (bs *balances) Ledger(userID uint64, until time.Time) ([]*LedgerEntry, error) {
+	return bs.linker.storage.GetLedgerEntries(userID, until)
+}
+
+func (bs *balances) At(userID uint64, at time.Time) (Balance, error) {
+	entries, err := bs.Ledger(userID, at)
+	if err != nil {
+		return Balance{}, err
+	}
+
+	return BalanceFromLedger(userID, entries)
+}
+
+func (bs *balances) Verify(userID uint64) error {
+	stored, err := bs.Get(userID)
+	if err != nil {
+		return err
+	}
+
+	rebuilt, err := bs.At(userID, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if stored.Current != rebuilt.Current || stored.Withdrawn != rebuilt.Withdrawn {
+		return fmt.Errorf("%w: stored %s/%s, ledger %s/%s", ErrBalanceMismatch,
+			stored.Current, stored.Withdrawn, rebuilt.Current, rebuilt.Withdrawn)
+	}
+
+	return nil
+}
@@ -0,0 +1,482 @@
+package gophermart
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Osselnet/gophermart.git/pkg/luhn"
+	"github.com/google/uuid"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	BulkFormatCSV    = "csv"
+	BulkFormatNDJSON = "ndjson"
+
+	DefaultBulkMaxOrders   = 10000
+	DefaultBulkSyncLimit   = 100
+	DefaultBulkResumeAfter = time.Minute
+
+	bulkChunkSize   = 500
+	bulkResumeBatch = 10
+)
+
+// Results of the order numbers of a bulk upload.
+const (
+	BulkAccepted       = "accepted"
+	BulkDuplicateOwn   = "duplicate-own"
+	BulkDuplicateOther = "duplicate-other"
+	BulkInvalid        = "invalid"
+)
+
+const (
+	BulkJobPending = "pending"
+	BulkJobRunning = "running"
+	BulkJobDone    = "done"
+	BulkJobFailed  = "failed"
+)
+
+// BulkResult is the outcome of one line of a bulk upload. Result is empty
+// until the line has been processed.
+type BulkResult struct {
+	Line   int    `json:"line"`
+	Number string `json:"number"`
+	Result string `json:"result,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// BulkJob uploads the order numbers of one request. Small uploads are done
+// before the response, larger ones are stored and run in the background, so
+// the client can poll them. Processed counts the lines done so far.
+type BulkJob struct {
+	ID        string
+	UserID    uint64
+	Status    string
+	Total     int
+	Processed int
+	Results   []BulkResult
+	Error     string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Summary counts the processed lines by result.
+func (j *BulkJob) Summary() map[string]int {
+	sum := map[string]int{BulkAccepted: 0, BulkDuplicateOwn: 0, BulkDuplicateOther: 0, BulkInvalid: 0}
+	for _, r := range j.Results {
+		if r.Result != "" {
+			sum[r.Result]++
+		}
+	}
+
+	return sum
+}
+
+type BulkConfig struct {
+	// MaxOrders limits the order numbers of one upload.
+	MaxOrders int
+	// SyncLimit is the largest upload answered right away, larger ones run
+	// as jobs.
+	SyncLimit int
+	// ResumeAfter is how long an unfinished job may go unsaved before
+	// ResumeBulkJobs takes it over. Running jobs are saved after every
+	// chunk, so only jobs of stopped or crashed servers go unsaved that long.
+	ResumeAfter time.Duration
+}
+
+func (g *GopherMart) SetBulkConfig(cfg BulkConfig) {
+	if cfg.MaxOrders <= 0 {
+		cfg.MaxOrders = DefaultBulkMaxOrders
+	}
+	if cfg.SyncLimit < 0 {
+		cfg.SyncLimit = DefaultBulkSyncLimit
+	}
+	if cfg.ResumeAfter <= 0 {
+		cfg.ResumeAfter = DefaultBulkResumeAfter
+	}
+	g.bulk = cfg
+}
+
+// errBulkStopped ends a job at shutdown. The job is left running with the
+// lines done so far, for ResumeBulkJobs to finish.
+var errBulkStopped = errors.New("bulk job stopped")
+
+// bulkRunner tracks the jobs running in the background.
+type bulkRunner struct {
+	mu      sync.Mutex
+	stopped bool
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func newBulkRunner() *bulkRunner {
+	return &bulkRunner{stop: make(chan struct{})}
+}
+
+// startBulk runs the stored job in the background, from the lines it has
+// processed on. After StopBulkJobs jobs are not started but left stored.
+func (g *GopherMart) startBulk(job *BulkJob, client Client) {
+	r := g.bulkRunner
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stopped {
+		return
+	}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		err := g.runBulk(job, client, true)
+		if errors.Is(err, errBulkStopped) {
+			log.Printf("[INFO] Bulk job %s stopped after %d of %d lines", job.ID, job.Processed, job.Total)
+			return
+		}
+		if err != nil {
+			log.Printf("[ERROR] Bulk job %s of user %d failed - %v", job.ID, job.UserID, err)
+		}
+	}()
+}
+
+// StopBulkJobs stops the background jobs after the chunk they are adding
+// and waits for them.
+func (g *GopherMart) StopBulkJobs() {
+	r := g.bulkRunner
+	r.mu.Lock()
+	if !r.stopped {
+		r.stopped = true
+		close(r.stop)
+	}
+	r.mu.Unlock()
+
+	r.wg.Wait()
+}
+
+// ResumeBulkJobs takes over the unfinished jobs of stopped or crashed
+// servers, right away and then every ResumeAfter until ctx is done.
+func (g *GopherMart) ResumeBulkJobs(ctx context.Context) {
+	ticker := time.NewTicker(g.bulk.ResumeAfter)
+	defer ticker.Stop()
+
+	for {
+		g.resumeBulkJobs()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (g *GopherMart) resumeBulkJobs() {
+	for {
+		now := time.Now()
+		jobs, err := g.storage.ClaimBulkJobs(now.Add(-g.bulk.ResumeAfter), now, bulkResumeBatch)
+		if err != nil {
+			log.Printf("[ERROR] Failed to claim unfinished bulk jobs - %v", err)
+			return
+		}
+
+		for _, job := range jobs {
+			log.Printf("[INFO] Resuming bulk job %s of user %d at line %d of %d", job.ID, job.UserID, job.Processed, job.Total)
+			g.startBulk(job, Client{})
+		}
+		if len(jobs) < bulkResumeBatch {
+			return
+		}
+	}
+}
+
+// ReadBulkOrders reads the order numbers of an upload, one per line. CSV
+// takes the first column and skips a "number" header, NDJSON takes objects
+// like {"number":"79927398713"}. Malformed NDJSON lines are kept as invalid
+// rather than failing the upload.
+func (g *GopherMart) ReadBulkOrders(r io.Reader, format string) ([]BulkResult, error) {
+	var lines []BulkResult
+	var err error
+
+	switch format {
+	case BulkFormatCSV:
+		lines, err = readBulkCSV(r, g.bulk.MaxOrders)
+	case BulkFormatNDJSON:
+		lines, err = readBulkNDJSON(r, g.bulk.MaxOrders)
+	default:
+		return nil, fmt.Errorf("%w: unknown format %s", ErrBulkInvalid, format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("%w: no order numbers", ErrBulkInvalid)
+	}
+
+	return lines, nil
+}
+
+func readBulkCSV(r io.Reader, max int) ([]BulkResult, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	cr.ReuseRecord = true
+
+	var lines []BulkResult
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return nil, fmt.Errorf("%w: %s", ErrBulkInvalid, err)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := cr.FieldPos(0)
+		number := strings.TrimSpace(rec[0])
+		if len(lines) == 0 && strings.EqualFold(number, "number") {
+			continue
+		}
+		if len(lines) == max {
+			return nil, fmt.Errorf("%w: up to %d order numbers", ErrBulkTooLarge, max)
+		}
+		lines = append(lines, BulkResult{Line: line, Number: number})
+	}
+
+	return lines, nil
+}
+
+func readBulkNDJSON(r io.Reader, max int) ([]BulkResult, error) {
+	sc := bufio.NewScanner(r)
+
+	var lines []BulkResult
+	for n := 1; sc.Scan(); n++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" {
+			continue
+		}
+		if len(lines) == max {
+			return nil, fmt.Errorf("%w: up to %d order numbers", ErrBulkTooLarge, max)
+		}
+
+		var v struct {
+			Number json.RawMessage `json:"number"`
+		}
+		err := json.Unmarshal([]byte(text), &v)
+		if err != nil || len(v.Number) == 0 {
+			lines = append(lines, BulkResult{Line: n, Result: BulkInvalid, Error: "line is not an object with a number"})
+			continue
+		}
+
+		// Numbers may come as JSON strings or as JSON numbers.
+		number := string(v.Number)
+		var s string
+		if json.Unmarshal(v.Number, &s) == nil {
+			number = s
+		}
+		lines = append(lines, BulkResult{Line: n, Number: strings.TrimSpace(number)})
+	}
+	if err := sc.Err(); errors.Is(err, bufio.ErrTooLong) {
+		return nil, fmt.Errorf("%w: %s", ErrBulkInvalid, err)
+	} else if err != nil {
+		return nil, err
+	}
+
+	return lines, nil
+}
+
+// PostOrdersBulk uploads the order numbers read by ReadBulkOrders. Uploads
+// up to the sync limit come back done, larger ones come back pending and
+// are followed with BulkJob.
+func (g *GopherMart) PostOrdersBulk(userID uint64, lines []BulkResult, client Client) (*BulkJob, error) {
+	if len(lines) > g.bulk.MaxOrders {
+		return nil, fmt.Errorf("%w: up to %d order numbers", ErrBulkTooLarge, g.bulk.MaxOrders)
+	}
+
+	now := time.Now()
+	job := &BulkJob{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		Status:    BulkJobRunning,
+		Total:     len(lines),
+		Results:   lines,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if len(lines) <= g.bulk.SyncLimit {
+		err := g.runBulk(job, client, false)
+		if err != nil {
+			return nil, err
+		}
+		return job, nil
+	}
+
+	job.Status = BulkJobPending
+	err := g.storage.AddBulkJob(job)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add bulk job - %w", err)
+	}
+
+	// The job runs on a copy, the caller keeps the pending one.
+	running := *job
+	running.Results = append([]BulkResult(nil), lines...)
+	g.startBulk(&running, client)
+
+	return job, nil
+}
+
+// BulkJob returns the upload job of the user.
+func (g *GopherMart) BulkJob(userID uint64, id string) (*BulkJob, error) {
+	job, err := g.storage.GetBulkJob(id)
+	if err != nil {
+		return nil, err
+	}
+	if job.UserID != userID {
+		return nil, ErrBulkJobNotFound
+	}
+
+	return job, nil
+}
+
+// runBulk processes the lines of the job chunk by chunk, each chunk is
+// added in one transaction. Stored jobs are saved after every chunk and
+// resume after the lines processed. Numbers of a chunk added before a crash
+// but not saved come out as duplicate-own when it is added again.
+func (g *GopherMart) runBulk(job *BulkJob, client Client, stored bool) error {
+	save := func() error {
+		if !stored {
+			return nil
+		}
+		job.UpdatedAt = time.Now()
+		return g.storage.UpdateBulkJob(job)
+	}
+
+	job.Status = BulkJobRunning
+	err := save()
+	if err != nil {
+		return fmt.Errorf("failed to save bulk job - %w", err)
+	}
+
+	seen := make(map[uint64]struct{})
+	for _, r := range job.Results[:job.Processed] {
+		if id, err := strconv.ParseUint(r.Number, 10, 64); err == nil && r.Result != BulkInvalid {
+			seen[id] = struct{}{}
+		}
+	}
+
+	for start := job.Processed; start < len(job.Results); start += bulkChunkSize {
+		if stored {
+			select {
+			case <-g.bulkRunner.stop:
+				return errBulkStopped
+			default:
+			}
+		}
+
+		end := start + bulkChunkSize
+		if end > len(job.Results) {
+			end = len(job.Results)
+		}
+
+		err = g.addBulkChunk(job.UserID, job.Results[start:end], seen, client)
+		if err != nil {
+			job.Status = BulkJobFailed
+			job.Error = err.Error()
+			if errSave := save(); errSave != nil {
+				log.Printf("[ERROR] Failed to save bulk job %s - %v", job.ID, errSave)
+			}
+			return err
+		}
+
+		job.Processed = end
+		if end == len(job.Results) {
+			job.Status = BulkJobDone
+		}
+		err = save()
+		if err != nil {
+			return fmt.Errorf("failed to save bulk job - %w", err)
+		}
+	}
+
+	// Jobs stopped after their last chunk have nothing left to add.
+	if job.Status != BulkJobDone {
+		job.Status = BulkJobDone
+		err = save()
+		if err != nil {
+			return fmt.Errorf("failed to save bulk job - %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (g *GopherMart) addBulkChunk(userID uint64, chunk []BulkResult, seen map[uint64]struct{}, client Client) error {
+	now := time.Now()
+	var ors []*Order
+	pending := make(map[uint64]*BulkResult)
+
+	for i := range chunk {
+		r := &chunk[i]
+		if r.Result != "" {
+			continue
+		}
+
+		id, err := strconv.ParseUint(r.Number, 10, 64)
+		if err != nil || !luhn.IsValid(r.Number) {
+			r.Result = BulkInvalid
+			r.Error = ErrOrderInvalidFormat.Error()
+			continue
+		}
+		if _, ok := seen[id]; ok {
+			r.Result = BulkDuplicateOwn
+			continue
+		}
+		seen[id] = struct{}{}
+
+		ors = append(ors, &Order{ID: id, UserID: userID, Status: StatusNew, UploadedAt: now})
+		pending[id] = r
+	}
+	if len(ors) == 0 {
+		return nil
+	}
+
+	owners, err := g.storage.AddOrders(ors)
+	if err != nil {
+		return fmt.Errorf("failed to add orders - %w", err)
+	}
+
+	for _, o := range ors {
+		r := pending[o.ID]
+		if owner, ok := owners[o.ID]; ok {
+			r.Result = BulkDuplicateOther
+			if owner == userID {
+				r.Result = BulkDuplicateOwn
+			}
+			continue
+		}
+		r.Result = BulkAccepted
+
+		_ = g.Audit.Record(&AuditEntry{
+			Action:       AuditOrderUpload,
+			ActorID:      userID,
+			TargetUserID: userID,
+			Target:       auditTargetOrder(o.ID),
+			After:        auditJSON(&auditOrder{Status: StatusNew}),
+		}, client)
+		_ = g.Events.PublishOrder(o)
+	}
+
+	return nil
+}
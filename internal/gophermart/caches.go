@@ -0,0 +1,151 @@
+package gophermart
+
+import (
+	"context"
+	"github.com/Osselnet/gophermart.git/pkg/cache"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultSessionCacheSize = 10000
+	DefaultUserCacheSize    = 10000
+	DefaultCacheTTL         = 5 * time.Minute
+
+	invalidateSession = "session:"
+	invalidateUser    = "user:"
+
+	maxInvalidationBackoff = 30 * time.Second
+
+	DefaultSessionReapInterval = 10 * time.Minute
+	DefaultSessionReapBatch    = 1000
+)
+
+type CacheConfig struct {
+	SessionSize int
+	UserSize    int
+	TTL         time.Duration
+}
+
+// CacheStats reports the users cached by login and by ID apart, the latter
+// are looked up by every authenticated request.
+type CacheStats struct {
+	Sessions  cache.Stats `json:"sessions"`
+	Users     cache.Stats `json:"users"`
+	UsersByID cache.Stats `json:"users_by_id"`
+}
+
+// SetCacheConfig replaces the sessions and users caches with empty ones of
+// the given size. Zero fields are set to their defaults.
+func (g *GopherMart) SetCacheConfig(cfg CacheConfig) {
+	if cfg.SessionSize <= 0 {
+		cfg.SessionSize = DefaultSessionCacheSize
+	}
+	if cfg.UserSize <= 0 {
+		cfg.UserSize = DefaultUserCacheSize
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultCacheTTL
+	}
+
+	g.caches = cfg
+	g.Users = newUsers(g, g.storage, cfg)
+	g.Sessions = newSessions(g, g.storage, cfg)
+}
+
+func (g *GopherMart) CacheStats() CacheStats {
+	return CacheStats{
+		Sessions:  g.Sessions.bySessionToken.Stats(),
+		Users:     g.Users.byLogin.Stats(),
+		UsersByID: g.Users.byID.Stats(),
+	}
+}
+
+func (g *GopherMart) publishInvalidation(kind, key string) {
+	err := g.storage.PublishInvalidation(kind + key)
+	if err != nil {
+		log.Printf("[ERROR] Failed to publish cache invalidation of %s%s - %v", kind, key, err)
+	}
+}
+
+func (g *GopherMart) invalidate(key string) {
+	switch {
+	case key == "":
+		g.Sessions.bySessionToken.Purge()
+		g.Users.byLogin.Purge()
+		g.Users.byID.Purge()
+	case strings.HasPrefix(key, invalidateSession):
+		g.Sessions.bySessionToken.Delete(strings.TrimPrefix(key, invalidateSession))
+	case strings.HasPrefix(key, invalidateUser):
+		g.Users.forget(strings.TrimPrefix(key, invalidateUser))
+	default:
+		log.Printf("[WARNING] Unknown cache invalidation %q", key)
+	}
+}
+
+// ListenInvalidations drops cached sessions and users deleted by other
+// replicas until ctx is done. Both caches are purged every time the
+// subscription is (re)established.
+func (g *GopherMart) ListenInvalidations(ctx context.Context) {
+	listen(ctx, "Cache invalidation", func(ctx context.Context) error {
+		return g.storage.SubscribeInvalidations(ctx, g.invalidate)
+	})
+}
+
+// listen keeps the subscription up until ctx is done, backing off between
+// attempts.
+func listen(ctx context.Context, name string, subscribe func(ctx context.Context) error) {
+	backoff := time.Second
+	for {
+		start := time.Now()
+		err := subscribe(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(start) > maxInvalidationBackoff {
+			backoff = time.Second
+		}
+		log.Printf("[ERROR] %s subscription lost, retrying in %v - %v", name, backoff, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxInvalidationBackoff {
+			backoff = maxInvalidationBackoff
+		}
+	}
+}
+
+// ReapSessions deletes expired sessions every interval, batch rows at a time,
+// until ctx is done.
+func (g *GopherMart) ReapSessions(ctx context.Context, interval time.Duration, batch uint32) {
+	if interval <= 0 {
+		interval = DefaultSessionReapInterval
+	}
+	if batch == 0 {
+		batch = DefaultSessionReapBatch
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		n, err := g.Sessions.Reap(batch)
+		if err != nil {
+			log.Printf("[ERROR] Failed to reap expired sessions - %v", err)
+		}
+		if n > 0 {
+			log.Printf("[DEBUG] Reaped %d expired sessions", n)
+		}
+	}
+}
@@ -6,15 +6,61 @@ var (
 	ErrLoginAlreadyTaken  = errors.New("login already taken")
 	ErrUserNotFound       = errors.New("user not found")
 	ErrInvalidPair        = errors.New("invalid pair: login/password")
+	ErrPasswordWeak       = errors.New("password does not meet the policy")
 	ErrUnauthorizedAccess = errors.New("unauthorized access detected: incident will be reported")
 	ErrSessionNotFound    = errors.New("session not found")
+	ErrTokenInvalid       = errors.New("invalid token")
+	ErrTokenExpired       = errors.New("token has expired")
+	ErrTokenReused        = errors.New("refresh token has already been used")
+	ErrLoginThrottled     = errors.New("too many failed logins, try again later")
+	ErrLoginLocked        = errors.New("login is locked after too many failed attempts")
+
+	ErrTOTPRequired       = errors.New("TOTP code required")
+	ErrTOTPCodeInvalid    = errors.New("invalid TOTP code")
+	ErrTOTPCodeReused     = errors.New("TOTP code has already been used")
+	ErrTOTPNotEnrolled    = errors.New("TOTP is not enrolled")
+	ErrTOTPAlreadyEnabled = errors.New("TOTP is already enabled")
+
+	ErrAPIKeyInvalid  = errors.New("invalid API key request")
+	ErrAPIKeyLimit    = errors.New("too many API keys")
+	ErrAPIKeyNotFound = errors.New("API key not found")
+	ErrAPIKeyExpired  = errors.New("API key has expired")
+	ErrScopeMissing   = errors.New("API key lacks the scope")
+
+	ErrRoleInvalid       = errors.New("unknown role")
+	ErrForbidden         = errors.New("forbidden")
+	ErrAdjustmentInvalid = errors.New("invalid balance adjustment")
+	ErrAuditChainBroken  = errors.New("audit log hash chain is broken")
 
 	ErrOrderAlreadyLoadedByUser        = errors.New("the order number has already been uploaded by this user")
 	ErrOrderAlreadyLoadedByAnotherUser = errors.New("the order number has already been uploaded by another user")
 	ErrOrderInvalidFormat              = errors.New("invalid order number format")
+	ErrOrderFinalized                  = errors.New("the order has already reached its final status")
+	ErrOrderNotFound                   = errors.New("order not found")
+
+	ErrListQueryInvalid = errors.New("invalid list query")
+	ErrCursorInvalid    = errors.New("invalid cursor")
+
+	ErrBulkInvalid     = errors.New("invalid bulk upload")
+	ErrBulkTooLarge    = errors.New("bulk upload has too many order numbers")
+	ErrBulkJobNotFound = errors.New("bulk upload job not found")
+
+	ErrStatementInvalid = errors.New("invalid statement request")
 
 	ErrTooManyRequests = errors.New("too many requests")
+	ErrCircuitOpen     = errors.New("accrual system circuit breaker is open")
 	ErrNoContent       = errors.New("no content")
+	ErrNonceReused     = errors.New("nonce has already been used")
+
+	ErrIdempotencyKeyExists   = errors.New("idempotency key has already been used")
+	ErrIdempotencyKeyNotFound = errors.New("idempotency key not found")
+
+	ErrMoneyInvalid   = errors.New("invalid amount of money")
+	ErrMoneyNegative  = errors.New("amount of money is negative")
+	ErrMoneyPrecision = errors.New("amount of money is more precise than kopecks")
+	ErrMoneyOverflow  = errors.New("amount of money is too large")
 
-	ErrNotEnoughFunds = errors.New("not enough funds on account")
+	ErrNotEnoughFunds  = errors.New("not enough funds on account")
+	ErrBalanceNotEmpty = errors.New("balance is not empty")
+	ErrBalanceMismatch = errors.New("balance does not match ledger")
 )
@@ -0,0 +1,183 @@
+package gophermart
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	EventOrder   = "order"
+	EventBalance = "balance"
+
+	DefaultEventRetention = 24 * time.Hour
+	MaxEventBatch         = 100
+
+	eventsPruneInterval = time.Hour
+	eventsPruneBatch    = 1000
+)
+
+// UserEvent tells a user about a change of one of their orders or of their
+// balance. Data holds an OrderProxy or a BalanceProxy as JSON. IDs grow, so
+// a client that has seen an event can resume after it.
+type UserEvent struct {
+	ID        uint64
+	UserID    uint64
+	Type      string
+	Data      string
+	CreatedAt time.Time
+}
+
+// Events stores user events and wakes the streams of the users they belong
+// to. Storage notifications carry events across replicas, events published
+// here wake local streams right away.
+type Events struct {
+	storage Storer
+
+	mu      sync.Mutex
+	streams map[uint64]map[chan struct{}]struct{}
+}
+
+func NewEvents(st Storer) *Events {
+	return &Events{
+		storage: st,
+		streams: make(map[uint64]map[chan struct{}]struct{}),
+	}
+}
+
+func (es *Events) publish(userID uint64, typ string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event - %w", err)
+	}
+
+	e := &UserEvent{UserID: userID, Type: typ, Data: string(data), CreatedAt: time.Now()}
+	err = es.storage.AddUserEvent(e)
+	if err != nil {
+		log.Printf("[ERROR] Failed to publish %s event for user %d - %v", typ, userID, err)
+		return fmt.Errorf("failed to publish event - %w", err)
+	}
+	es.wake(userID)
+
+	return nil
+}
+
+// PublishOrder tells the owner of the order about its status and accrual.
+func (es *Events) PublishOrder(o *Order) error {
+	return es.publish(o.UserID, EventOrder, &OrderProxy{
+		Number:     fmt.Sprint(o.ID),
+		Status:     strings.TrimSpace(o.Status),
+		Accrual:    o.Accrual,
+		UploadedAt: o.UploadedAt.Format(time.RFC3339),
+	})
+}
+
+// PublishBalance tells the user about their current balance.
+func (es *Events) PublishBalance(userID uint64) error {
+	b, err := es.storage.GetBalance(userID)
+	if err != nil {
+		return fmt.Errorf("failed to get balance - %w", err)
+	}
+
+	return es.publish(userID, EventBalance, &BalanceProxy{Current: b.Current, Withdrawn: b.Withdrawn})
+}
+
+// Since returns the events of the user after the event afterID, oldest
+// first, at most MaxEventBatch of them.
+func (es *Events) Since(userID, afterID uint64) ([]*UserEvent, error) {
+	return es.storage.GetUserEvents(userID, afterID, MaxEventBatch)
+}
+
+// Last returns the ID of the latest event of the user, zero if there is none.
+func (es *Events) Last(userID uint64) (uint64, error) {
+	return es.storage.GetLastUserEventID(userID)
+}
+
+// Subscribe returns a channel that receives a value whenever the user may
+// have new events, and a function that unsubscribes. Wake-ups are merged,
+// so the receiver should read every event since the last one it has seen.
+func (es *Events) Subscribe(userID uint64) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	es.mu.Lock()
+	if es.streams[userID] == nil {
+		es.streams[userID] = make(map[chan struct{}]struct{})
+	}
+	es.streams[userID][ch] = struct{}{}
+	es.mu.Unlock()
+
+	return ch, func() {
+		es.mu.Lock()
+		defer es.mu.Unlock()
+
+		delete(es.streams[userID], ch)
+		if len(es.streams[userID]) == 0 {
+			delete(es.streams, userID)
+		}
+	}
+}
+
+// wake signals the streams of the user, every stream if userID is zero.
+func (es *Events) wake(userID uint64) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	for id, chs := range es.streams {
+		if userID != 0 && id != userID {
+			continue
+		}
+		for ch := range chs {
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// ListenEvents wakes local streams on events published by other replicas
+// until ctx is done, resubscribing if the subscription is lost.
+func (g *GopherMart) ListenEvents(ctx context.Context) {
+	listen(ctx, "User events", func(ctx context.Context) error {
+		return g.storage.SubscribeUserEvents(ctx, g.Events.wake)
+	})
+}
+
+// PruneEvents deletes events older than retention every hour until ctx is
+// done. Streams can't resume from pruned events.
+func (g *GopherMart) PruneEvents(ctx context.Context, retention time.Duration) {
+	if retention <= 0 {
+		retention = DefaultEventRetention
+	}
+
+	ticker := time.NewTicker(eventsPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		var total int64
+		for {
+			n, err := g.storage.DeleteUserEventsBefore(time.Now().Add(-retention), eventsPruneBatch)
+			if err != nil {
+				log.Printf("[ERROR] Failed to prune user events - %v", err)
+				break
+			}
+			total += n
+			if n < eventsPruneBatch {
+				break
+			}
+		}
+		if total > 0 {
+			log.Printf("[DEBUG] Pruned %d user events", total)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package gophermart
 
 import (
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"log"
@@ -14,43 +15,121 @@ type Credentials struct {
 	Password string `json:"password"`
 }
 type GopherMart struct {
-	storage Storer
+	storage    Storer
+	accrual    AccrualMonitor
+	tokens     TokenConfig
+	caches     CacheConfig
+	totp       TOTPConfig
+	passwords  PasswordConfig
+	bulk       BulkConfig
+	bulkRunner *bulkRunner
+
+	loginGuard *loginGuard
 
 	Users       Users
 	Sessions    *sessions
 	Orders      *orders
 	Balances    *balances
 	Withdrawals *withdrawals
+
+	IdempotencyKeys *idempotencyKeys
+	APIKeys         *apiKeys
+	Admin           *admin
+	Audit           *Auditor
+	Events          *Events
 }
 
 func New(st Storer) *GopherMart {
 	gm := &GopherMart{
-		storage:  st,
-		Users:    newUsers(st),
-		Sessions: newSessions(st),
+		storage: st,
 	}
+	gm.SetCacheConfig(CacheConfig{})
+	gm.SetAuditConfig(AuditConfig{})
+	gm.SetBulkConfig(BulkConfig{SyncLimit: DefaultBulkSyncLimit})
+	gm.bulkRunner = newBulkRunner()
 	gm.Orders = newOrders(gm)
 	gm.Balances = newBalance(gm)
 	gm.Withdrawals = newWithdrawals(gm)
+	gm.IdempotencyKeys = newIdempotencyKeys(gm)
+	gm.APIKeys = newAPIKeys(gm)
+	gm.Admin = newAdmin(gm)
+	gm.Events = NewEvents(st)
+	gm.SetTokenConfig(TokenConfig{})
+	gm.SetTOTPConfig(TOTPConfig{})
+	gm.SetPasswordConfig(PasswordConfig{})
+	gm.SetLoginGuardConfig(LoginGuardConfig{FreeAttempts: DefaultLoginFreeAttempts})
 
 	return gm
 }
 
-func (g *GopherMart) Register(creds *Credentials) (*Session, error) {
+func (g *GopherMart) Register(creds *Credentials, client Client) (*Session, error) {
 	_, err := g.Users.Add(creds)
 	if err != nil {
 		return nil, err
 	}
 
-	session, err := g.Login(creds, "")
+	user, err := g.Users.Get(creds.Login)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := g.startSession(user, "", client)
 	if err != nil {
 		return nil, err
 	}
 
+	_ = g.Audit.Record(&AuditEntry{
+		Action:       AuditUserRegister,
+		ActorID:      user.ID,
+		TargetUserID: user.ID,
+		Target:       auditTargetUser(user.ID),
+		After:        auditJSON(map[string]string{"login": user.Login, "role": user.Role}),
+	}, client)
+
 	return session, nil
 }
 
-func (g *GopherMart) Login(creds *Credentials, oldToken string) (*Session, error) {
+// Login starts a new session. The session identified by oldToken, either
+// an access or a refresh token, is ended. Users with TOTP enabled get a
+// *TOTPRequiredError instead, and log in with LoginTOTP.
+func (g *GopherMart) Login(creds *Credentials, oldToken string, client Client) (*Session, error) {
+	keys := loginAttemptsKeys(creds.Login, client)
+	err := g.loginGuard.check(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := g.checkPassword(creds)
+	if isLoginFailure(err) {
+		g.loginGuard.fail(keys, client)
+		var known *User
+		if errors.Is(err, ErrInvalidPair) {
+			known, _ = g.Users.Get(creds.Login)
+		}
+		g.recordLogin(creds.Login, known, nil, err, client)
+	} else if err != nil {
+		g.loginGuard.release(keys)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if user.TOTPEnabled() {
+		g.loginGuard.release(keys)
+		return nil, g.totpChallenge(user)
+	}
+	g.loginGuard.succeed(keys)
+
+	session, err := g.startSession(user, oldToken, client)
+	if err != nil {
+		return nil, err
+	}
+	g.recordLogin(user.Login, user, session, nil, client)
+
+	return session, nil
+}
+
+func (g *GopherMart) checkPassword(creds *Credentials) (*User, error) {
 	user, err := g.Users.Get(creds.Login)
 	if err != nil {
 		return nil, err
@@ -60,36 +139,142 @@ func (g *GopherMart) Login(creds *Credentials, oldToken string) (*Session, error
 	if !check {
 		return nil, ErrInvalidPair
 	}
+	g.rehashPassword(user, creds.Password)
+
+	return user, nil
+}
 
+func (g *GopherMart) startSession(user *User, oldToken string, client Client) (*Session, error) {
+	var err error
 	if oldToken != "" {
-		err = g.Sessions.Delete(oldToken)
+		err = g.Logout(oldToken, client)
 		if err != nil {
 			log.Println("[ERROR]", err)
 		}
 	}
 
-	newToken := uuid.NewString()
-	expiresAt := time.Now().Add(600 * time.Second)
-
+	now := time.Now()
 	s := &Session{
-		UserID: user.ID,
-		Token:  newToken,
-		Expiry: expiresAt,
+		ID:         uuid.NewString(),
+		UserID:     user.ID,
+		CreatedAt:  now,
+		Expiry:     now.Add(g.tokens.RefreshTTL),
+		LastSeenAt: now,
+		IP:         client.IP,
+		UserAgent:  client.UserAgent,
 	}
 	err = g.Sessions.Add(s)
 	if err != nil {
 		return nil, err
 	}
 
+	err = g.issueTokens(s)
+	if err != nil {
+		return nil, err
+	}
+
 	return s, nil
 }
 
-func (g *GopherMart) Logout(token string) error {
-	return g.Sessions.Delete(token)
+// Refresh exchanges a refresh token for a new pair of tokens. A refresh token
+// may be used only once: presenting it again ends the whole session, as it
+// means that either the client or someone who stole the token is replaying it.
+func (g *GopherMart) Refresh(refreshToken string, client Client) (*Session, error) {
+	claims, userID, err := g.parseToken(refreshToken, tokenUseRefresh, true)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := g.Sessions.Load(claims.SessionID)
+	if err != nil {
+		return nil, fmt.Errorf("%w - %s", ErrSessionNotFound, err)
+	}
+	if s.UserID != userID || claims.Generation > s.Generation {
+		return nil, fmt.Errorf("%w - token does not match session", ErrTokenInvalid)
+	}
+	if claims.Generation < s.Generation {
+		return nil, g.revokeReused(s)
+	}
+
+	expiry := time.Now().Add(g.tokens.RefreshTTL)
+	err = g.Sessions.Rotate(s, expiry)
+	if errors.Is(err, ErrSessionNotFound) {
+		// Another request rotated the session from the same token first.
+		return nil, g.revokeReused(s)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rotated := *s
+	rotated.Generation++
+	rotated.Expiry = expiry
+	err = g.issueTokens(&rotated)
+	if err != nil {
+		return nil, err
+	}
+
+	err = g.Sessions.Touch(&rotated, client)
+	if err != nil {
+		log.Println("[ERROR] Failed to touch session -", err)
+	}
+
+	return &rotated, nil
+}
+
+func (g *GopherMart) revokeReused(s *Session) error {
+	log.Printf("[WARNING] Refresh token reuse detected, session %s of user %d revoked\n", s.ID, s.UserID)
+
+	err := g.Sessions.Delete(s.ID)
+	if err != nil && !errors.Is(err, ErrSessionNotFound) {
+		log.Println("[ERROR] Failed to revoke session -", err)
+	}
+
+	return ErrTokenReused
 }
 
-func (g *GopherMart) PostOrders(orderID, userID uint64) error {
-	return g.Orders.Add(orderID, userID)
+// Logout ends the session the token belongs to. Expired tokens are accepted.
+func (g *GopherMart) Logout(token string, client Client) error {
+	claims, userID, err := g.parseToken(token, "", false)
+	if err != nil {
+		return err
+	}
+
+	err = g.Sessions.Delete(claims.SessionID)
+	if err != nil {
+		return err
+	}
+
+	_ = g.Audit.Record(&AuditEntry{
+		Action:       AuditLogout,
+		ActorID:      userID,
+		TargetUserID: userID,
+		Target:       "session:" + claims.SessionID,
+	}, client)
+
+	return nil
+}
+
+func (g *GopherMart) PostOrders(orderID, userID uint64, client Client) error {
+	err := g.Orders.Add(orderID, userID)
+	if err != nil {
+		return err
+	}
+
+	_ = g.Audit.Record(&AuditEntry{
+		Action:       AuditOrderUpload,
+		ActorID:      userID,
+		TargetUserID: userID,
+		Target:       auditTargetOrder(orderID),
+		After:        auditJSON(&auditOrder{Status: StatusNew}),
+	}, client)
+
+	o, err := g.Orders.Get(orderID)
+	if err == nil {
+		_ = g.Events.PublishOrder(o)
+	}
+
+	return nil
 }
 
 func (g *GopherMart) GetOrders(userID uint64) ([]*OrderProxy, error) {
@@ -98,15 +283,13 @@ func (g *GopherMart) GetOrders(userID uint64) ([]*OrderProxy, error) {
 		return nil, err
 	}
 
-	layout := "2006-01-02T15:04:05-07:00"
-
 	orsPr := make([]*OrderProxy, 0)
 	for _, o := range ors {
 		po := &OrderProxy{
 			Number:     fmt.Sprint(o.ID),
 			Status:     strings.TrimSpace(o.Status),
-			Accrual:    float64(o.Accrual) / 100,
-			UploadedAt: o.UploadedAt.Format(layout),
+			Accrual:    o.Accrual,
+			UploadedAt: o.UploadedAt.Format(time.RFC3339),
 		}
 
 		orsPr = append(orsPr, po)
@@ -121,10 +304,19 @@ func (g *GopherMart) PostWithdraw(wpr *WithdrawProxy) error {
 		return ErrOrderInvalidFormat
 	}
 
+	if wpr.Sum == 0 {
+		return fmt.Errorf("%w: withdrawal sum must be positive", ErrMoneyInvalid)
+	}
+
+	err = g.checkWithdrawTOTP(wpr.UserID, wpr.Sum, wpr.TOTPCode, wpr.Client)
+	if err != nil {
+		return err
+	}
+
 	withdraw := &Withdraw{
 		OrderID: uint64(orderID),
 		UserID:  wpr.UserID,
-		Sum:     uint64(wpr.Sum * 100),
+		Sum:     wpr.Sum,
 	}
 
 	err = g.Withdrawals.Add(withdraw)
@@ -132,6 +324,22 @@ func (g *GopherMart) PostWithdraw(wpr *WithdrawProxy) error {
 		return err
 	}
 
+	e := &AuditEntry{
+		Action:       AuditWithdraw,
+		ActorID:      wpr.UserID,
+		TargetUserID: wpr.UserID,
+		Target:       auditTargetOrder(withdraw.OrderID),
+		Details:      auditJSON(map[string]Money{"sum": withdraw.Sum}),
+	}
+	after, err := g.Balances.Get(wpr.UserID)
+	if err == nil {
+		// Taken after the fact, so concurrent changes may show up as well.
+		e.Before = auditJSON(&auditBalance{Current: after.Current + withdraw.Sum, Withdrawn: after.Withdrawn - withdraw.Sum})
+		e.After = auditJSON(&auditBalance{Current: after.Current, Withdrawn: after.Withdrawn})
+	}
+	_ = g.Audit.Record(e, wpr.Client)
+	_ = g.Events.PublishBalance(wpr.UserID)
+
 	return nil
 }
 
@@ -145,7 +353,7 @@ func (g *GopherMart) GetWithdrawals(userID uint64) ([]*WithdrawProxy, error) {
 	for _, v := range wds {
 		wpr := &WithdrawProxy{
 			Order:       fmt.Sprint(v.OrderID),
-			Sum:         float64(v.Sum) / 100,
+			Sum:         v.Sum,
 			ProcessedAt: v.ProcessedAt.Format(time.RFC3339),
 		}
 		wdsPr = append(wdsPr, wpr)
@@ -161,8 +369,8 @@ func (g *GopherMart) GetBalance(userID uint64) (*BalanceProxy, error) {
 	}
 
 	blPr := &BalanceProxy{
-		Current:   float64(bl.Current) / 100,
-		Withdrawn: float64(bl.Withdrawn) / 100,
+		Current:   bl.Current,
+		Withdrawn: bl.Withdrawn,
 	}
 
 	return blPr, nil
@@ -0,0 +1,98 @@
+package gophermart
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+const (
+	DefaultIdempotencyRetention = 24 * time.Hour
+
+	idempotencyPruneInterval = time.Hour
+	idempotencyPruneBatch    = 1000
+)
+
+// IdempotencyKey remembers the response given to a request sent with an
+// Idempotency-Key header. StatusCode is zero while the first request with
+// the key is still being handled.
+type IdempotencyKey struct {
+	UserID      uint64
+	Key         string
+	Fingerprint string
+	StatusCode  int
+	ContentType string
+	Body        []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
+
+type idempotencyKeys struct {
+	linker    *GopherMart
+	retention time.Duration
+}
+
+func newIdempotencyKeys(linker *GopherMart) *idempotencyKeys {
+	return &idempotencyKeys{
+		linker:    linker,
+		retention: DefaultIdempotencyRetention,
+	}
+}
+
+func (ik *idempotencyKeys) SetRetention(d time.Duration) {
+	ik.retention = d
+}
+
+// Reserve claims the key for a new request. If the key is already claimed
+// the stored record is returned along with ErrIdempotencyKeyExists.
+func (ik *idempotencyKeys) Reserve(userID uint64, key, fingerprint string) (*IdempotencyKey, error) {
+	now := time.Now()
+
+	return ik.linker.storage.AddIdempotencyKey(&IdempotencyKey{
+		UserID:      userID,
+		Key:         key,
+		Fingerprint: fingerprint,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(ik.retention),
+	})
+}
+
+func (ik *idempotencyKeys) Save(k *IdempotencyKey) error {
+	return ik.linker.storage.SaveIdempotencyKey(k)
+}
+
+// Release frees the key so the request can be retried, e.g. after it failed
+// with an internal error.
+func (ik *idempotencyKeys) Release(userID uint64, key string) error {
+	return ik.linker.storage.DeleteIdempotencyKey(userID, key)
+}
+
+// PruneIdempotencyKeys deletes expired keys every hour until ctx is done.
+func (g *GopherMart) PruneIdempotencyKeys(ctx context.Context) {
+	ticker := time.NewTicker(idempotencyPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		var total int64
+		for {
+			n, err := g.storage.DeleteIdempotencyKeysBefore(time.Now(), idempotencyPruneBatch)
+			if err != nil {
+				log.Printf("[ERROR] Failed to prune idempotency keys - %v", err)
+				break
+			}
+			total += n
+			if n < idempotencyPruneBatch {
+				break
+			}
+		}
+		if total > 0 {
+			log.Printf("[DEBUG] Pruned %d idempotency keys", total)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package gophermart
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	DirectionCredit = "CREDIT"
+	DirectionDebit  = "DEBIT"
+
+	EntryKindAccrual    = "ACCRUAL"
+	EntryKindWithdrawal = "WITHDRAWAL"
+	EntryKindForfeit    = "FORFEIT"
+	EntryKindAdjustment = "ADJUSTMENT"
+
+	AccountAccrual     = "system:accrual"
+	AccountWithdrawals = "system:withdrawals"
+	AccountForfeited   = "system:forfeited"
+	AccountAdjustments = "system:adjustments"
+)
+
+// LedgerEntry is one immutable leg of a ledger transaction. Every transaction
+// consists of a debit and a credit of the same amount sharing a TxID, so the
+// sum over all entries of a transaction is always zero.
+type LedgerEntry struct {
+	ID        uint64
+	TxID      string
+	Account   string
+	UserID    uint64
+	Direction string
+	Amount    Money
+	Kind      string
+	Ref       string
+	CreatedAt time.Time
+}
+
+func UserAccount(userID uint64) string {
+	return fmt.Sprintf("user:%d", userID)
+}
+
+func NewAccrualEntries(o *Order, at time.Time) []*LedgerEntry {
+	return newTransfer(AccountAccrual, 0, UserAccount(o.UserID), o.UserID, o.Accrual, EntryKindAccrual, fmt.Sprint(o.ID), at)
+}
+
+func NewWithdrawalEntries(w *Withdraw, at time.Time) []*LedgerEntry {
+	return newTransfer(UserAccount(w.UserID), w.UserID, AccountWithdrawals, 0, w.Sum, EntryKindWithdrawal, fmt.Sprint(w.OrderID), at)
+}
+
+// NewForfeitEntries move what is left on the account of a deleted user.
+func NewForfeitEntries(userID uint64, amount Money, at time.Time) []*LedgerEntry {
+	return newTransfer(UserAccount(userID), userID, AccountForfeited, 0, amount, EntryKindForfeit, fmt.Sprint(userID), at)
+}
+
+// NewAdjustmentEntries credit or debit the user by hand, the other side is
+// AccountAdjustments.
+func NewAdjustmentEntries(adj *Adjustment, at time.Time) []*LedgerEntry {
+	if adj.Direction == DirectionDebit {
+		return newTransfer(UserAccount(adj.UserID), adj.UserID, AccountAdjustments, 0, adj.Amount, EntryKindAdjustment, adj.ID, at)
+	}
+
+	return newTransfer(AccountAdjustments, 0, UserAccount(adj.UserID), adj.UserID, adj.Amount, EntryKindAdjustment, adj.ID, at)
+}
+
+func newTransfer(from string, fromUser uint64, to string, toUser uint64, amount Money, kind, ref string, at time.Time) []*LedgerEntry {
+	txID := uuid.NewString()
+
+	return []*LedgerEntry{
+		{
+			TxID:      txID,
+			Account:   from,
+			UserID:    fromUser,
+			Direction: DirectionDebit,
+			Amount:    amount,
+			Kind:      kind,
+			Ref:       ref,
+			CreatedAt: at,
+		},
+		{
+			TxID:      txID,
+			Account:   to,
+			UserID:    toUser,
+			Direction: DirectionCredit,
+			Amount:    amount,
+			Kind:      kind,
+			Ref:       ref,
+			CreatedAt: at,
+		},
+	}
+}
+
+// BalanceFromLedger rebuilds the balance of a user from the entries posted to
+// the user's account. Entries of other accounts are ignored.
+func BalanceFromLedger(userID uint64, entries []*LedgerEntry) (Balance, error) {
+	b := Balance{UserID: userID}
+	account := UserAccount(userID)
+
+	var credit, debit Money
+	var err error
+	for _, e := range entries {
+		if e.Account != account {
+			continue
+		}
+
+		switch e.Direction {
+		case DirectionCredit:
+			credit, err = credit.Add(e.Amount)
+		case DirectionDebit:
+			debit, err = debit.Add(e.Amount)
+			if err == nil && e.Kind == EntryKindWithdrawal {
+				b.Withdrawn, err = b.Withdrawn.Add(e.Amount)
+			}
+		default:
+			return b, fmt.Errorf("ledger entry %d has unknown direction %q", e.ID, e.Direction)
+		}
+		if err != nil {
+			return b, fmt.Errorf("ledger of user %d - %w", userID, err)
+		}
+	}
+
+	if debit > credit {
+		return b, fmt.Errorf("ledger of user %d is overdrawn by %s", userID, debit-credit)
+	}
+	b.Current = credit - debit
+
+	return b, nil
+}
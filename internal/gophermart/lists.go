@@ -0,0 +1,223 @@
+package gophermart
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultPageLimit = 100
+	MaxPageLimit     = 1000
+)
+
+// Sort orders of the lists, the minus prefix sorts descending. Items with
+// equal keys are sorted by order number.
+const (
+	SortUploadedAt      = "uploaded_at"
+	SortUploadedAtDesc  = "-uploaded_at"
+	SortAccrual         = "accrual"
+	SortAccrualDesc     = "-accrual"
+	SortProcessedAt     = "processed_at"
+	SortProcessedAtDesc = "-processed_at"
+	SortSum             = "sum"
+	SortSumDesc         = "-sum"
+)
+
+var (
+	OrderSorts      = []string{SortUploadedAt, SortUploadedAtDesc, SortAccrual, SortAccrualDesc}
+	WithdrawalSorts = []string{SortProcessedAt, SortProcessedAtDesc, SortSum, SortSumDesc}
+)
+
+// ListQuery selects a page of the orders or the withdrawals of a user. From,
+// To, MinAmount and MaxAmount bound uploaded_at and accrual of orders,
+// processed_at and sum of withdrawals; zero values are unbounded. Statuses
+// only apply to orders.
+type ListQuery struct {
+	UserID    uint64
+	Statuses  []string
+	From      time.Time
+	To        time.Time
+	MinAmount Money
+	MaxAmount Money
+	Sort      string
+	After     *Cursor
+	Limit     uint32
+}
+
+// Cursor is the position of the last item of a page: its sort key, time in
+// nanoseconds or amount, and its order number.
+type Cursor struct {
+	Sort    string
+	Key     int64
+	OrderID uint64
+}
+
+func (c *Cursor) String() string {
+	s := fmt.Sprintf("%s|%d|%d", c.Sort, c.Key, c.OrderID)
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+// Time is the key of cursors of time sorted lists.
+func (c *Cursor) Time() time.Time {
+	return time.Unix(0, c.Key).UTC()
+}
+
+func ParseCursor(s string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrCursorInvalid
+	}
+
+	parts := strings.Split(string(data), "|")
+	if len(parts) != 3 {
+		return nil, ErrCursorInvalid
+	}
+	key, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, ErrCursorInvalid
+	}
+	orderID, err := strconv.ParseUint(parts[2], 10, 64)
+	if err != nil {
+		return nil, ErrCursorInvalid
+	}
+
+	return &Cursor{Sort: parts[0], Key: key, OrderID: orderID}, nil
+}
+
+// IsDesc reports whether the sort order is descending.
+func IsDesc(sort string) bool {
+	return strings.HasPrefix(sort, "-")
+}
+
+// check fills in the defaults and validates the query against the sorts of
+// the list.
+func (q *ListQuery) check(sorts []string) error {
+	if q.Sort == "" {
+		q.Sort = sorts[0]
+	}
+	if !containsString(sorts, q.Sort) {
+		return fmt.Errorf("%w: sort must be one of %s", ErrListQueryInvalid, strings.Join(sorts, ", "))
+	}
+	if q.After != nil && q.After.Sort != q.Sort {
+		return fmt.Errorf("%w: cursor belongs to another sort order", ErrCursorInvalid)
+	}
+
+	if q.Limit == 0 {
+		q.Limit = DefaultPageLimit
+	}
+	if q.Limit > MaxPageLimit {
+		return fmt.Errorf("%w: limit must be up to %d", ErrListQueryInvalid, MaxPageLimit)
+	}
+
+	for i, status := range q.Statuses {
+		q.Statuses[i] = strings.ToUpper(status)
+		if !IsValidStatus(q.Statuses[i]) {
+			return fmt.Errorf("%w: unknown status %s", ErrListQueryInvalid, status)
+		}
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && !q.From.Before(q.To) {
+		return fmt.Errorf("%w: from must be before to", ErrListQueryInvalid)
+	}
+	if q.MaxAmount != 0 && q.MinAmount > q.MaxAmount {
+		return fmt.Errorf("%w: min must not exceed max", ErrListQueryInvalid)
+	}
+
+	return nil
+}
+
+func containsString(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ListOrders returns a page of the orders of the user along with the cursor
+// of the next page, empty on the last one.
+func (g *GopherMart) ListOrders(q ListQuery) ([]*OrderProxy, string, error) {
+	err := q.check(OrderSorts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	limit := q.Limit
+	q.Limit++
+	ors, err := g.storage.FindUserOrders(q)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to find orders - %w", err)
+	}
+
+	var next string
+	if uint32(len(ors)) > limit {
+		ors = ors[:limit]
+		last := ors[limit-1]
+		c := &Cursor{Sort: q.Sort, Key: last.UploadedAt.UnixNano(), OrderID: last.ID}
+		if q.Sort == SortAccrual || q.Sort == SortAccrualDesc {
+			c.Key = int64(last.Accrual)
+		}
+		next = c.String()
+	}
+
+	orsPr := make([]*OrderProxy, 0, len(ors))
+	for _, o := range ors {
+		orsPr = append(orsPr, &OrderProxy{
+			Number:     fmt.Sprint(o.ID),
+			Status:     strings.TrimSpace(o.Status),
+			Accrual:    o.Accrual,
+			UploadedAt: o.UploadedAt.Format(time.RFC3339),
+		})
+	}
+
+	return orsPr, next, nil
+}
+
+// ListWithdrawals returns a page of the withdrawals of the user along with
+// the cursor of the next page, empty on the last one.
+func (g *GopherMart) ListWithdrawals(q ListQuery) ([]*WithdrawProxy, string, error) {
+	if len(q.Statuses) != 0 {
+		return nil, "", fmt.Errorf("%w: withdrawals have no status", ErrListQueryInvalid)
+	}
+	// Withdrawals have always been listed latest first.
+	if q.Sort == "" {
+		q.Sort = SortProcessedAtDesc
+	}
+	err := q.check(WithdrawalSorts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	limit := q.Limit
+	q.Limit++
+	wds, err := g.storage.FindUserWithdrawals(q)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to find withdrawals - %w", err)
+	}
+
+	var next string
+	if uint32(len(wds)) > limit {
+		wds = wds[:limit]
+		last := wds[limit-1]
+		c := &Cursor{Sort: q.Sort, Key: last.ProcessedAt.UnixNano(), OrderID: last.OrderID}
+		if q.Sort == SortSum || q.Sort == SortSumDesc {
+			c.Key = int64(last.Sum)
+		}
+		next = c.String()
+	}
+
+	wdsPr := make([]*WithdrawProxy, 0, len(wds))
+	for _, v := range wds {
+		wdsPr = append(wdsPr, &WithdrawProxy{
+			Order:       fmt.Sprint(v.OrderID),
+			Sum:         v.Sum,
+			ProcessedAt: v.ProcessedAt.Format(time.RFC3339),
+		})
+	}
+
+	return wdsPr, next, nil
+}
@@ -0,0 +1,261 @@
+package gophermart
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultLoginWindow       = 15 * time.Minute
+	DefaultLoginFreeAttempts = 3
+	DefaultLoginBaseDelay    = time.Second
+	DefaultLoginMaxDelay     = 30 * time.Second
+	DefaultLoginLockAfter    = 10
+	DefaultLoginLockAfterIP  = 100
+	DefaultLoginLockFor      = 15 * time.Minute
+
+	loginAttemptsByLogin = "login:"
+	loginAttemptsByIP    = "ip:"
+)
+
+// LoginGuardConfig limits failed logins per login and per client IP. After
+// FreeAttempts failures every next attempt has to wait twice as long as the
+// previous one, starting from BaseDelay up to MaxDelay. Failures older than
+// Window are forgotten.
+type LoginGuardConfig struct {
+	Window       time.Duration
+	FreeAttempts uint32
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	LockAfter    uint32
+	LockAfterIP  uint32
+	LockFor      time.Duration
+}
+
+// LoginAttempts are the recent failed logins for a login or an IP.
+type LoginAttempts struct {
+	Key         string
+	Failures    uint32
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// LoginThrottledError is returned by Login, LoginTOTP and large withdrawals
+// when the attempt is refused without checking the credentials.
+type LoginThrottledError struct {
+	Until  time.Time
+	Locked bool
+}
+
+func (e *LoginThrottledError) Error() string {
+	if e.Locked {
+		return fmt.Sprintf("%s until %s", ErrLoginLocked, e.Until.Format(time.RFC3339))
+	}
+
+	return fmt.Sprintf("%s until %s", ErrLoginThrottled, e.Until.Format(time.RFC3339))
+}
+
+func (e *LoginThrottledError) Unwrap() error {
+	if e.Locked {
+		return ErrLoginLocked
+	}
+
+	return ErrLoginThrottled
+}
+
+type loginGuard struct {
+	linker *GopherMart
+	cfg    LoginGuardConfig
+}
+
+func (g *GopherMart) SetLoginGuardConfig(cfg LoginGuardConfig) {
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultLoginWindow
+	}
+	if cfg.BaseDelay <= 0 {
+		cfg.BaseDelay = DefaultLoginBaseDelay
+	}
+	if cfg.MaxDelay < cfg.BaseDelay {
+		cfg.MaxDelay = DefaultLoginMaxDelay
+	}
+	if cfg.LockAfter == 0 {
+		cfg.LockAfter = DefaultLoginLockAfter
+	}
+	if cfg.LockAfterIP == 0 {
+		cfg.LockAfterIP = DefaultLoginLockAfterIP
+	}
+	if cfg.LockFor <= 0 {
+		cfg.LockFor = DefaultLoginLockFor
+	}
+
+	g.loginGuard = &loginGuard{linker: g, cfg: cfg}
+}
+
+// Unlock clears the failed logins and the lockout of the login.
+func (g *GopherMart) Unlock(login string) error {
+	return g.loginGuard.unlock(loginAttemptsByLogin + login)
+}
+
+// UnlockIP clears the failed logins and the lockout of the client IP.
+func (g *GopherMart) UnlockIP(ip string) error {
+	return g.loginGuard.unlock(loginAttemptsByIP + ip)
+}
+
+// loginKey is a key of the attempts of a login. check keeps the time it
+// reserved the attempt at and the last failure before, so release can put
+// the failure window back as it was.
+type loginKey struct {
+	name        string
+	reservedAt  time.Time
+	lastFailure time.Time
+}
+
+func loginAttemptsKeys(login string, client Client) []*loginKey {
+	keys := []*loginKey{{name: loginAttemptsByLogin + login}}
+	if client.IP != "" {
+		keys = append(keys, &loginKey{name: loginAttemptsByIP + client.IP})
+	}
+
+	return keys
+}
+
+// check refuses the attempt if any of the keys is locked or has to wait.
+// Otherwise it reserves the attempt for every key: it is counted as a
+// failure until succeed or release gives it back, so parallel guesses can't
+// all pass before the first of them fails.
+func (lg *loginGuard) check(keys []*loginKey) error {
+	for i, key := range keys {
+		err := lg.reserve(key)
+		if err != nil {
+			lg.release(keys[:i])
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (lg *loginGuard) reserve(key *loginKey) error {
+	for {
+		// The database keeps microseconds, release finds the reservation by
+		// its time.
+		now := time.Now().Truncate(time.Microsecond)
+		a, err := lg.linker.storage.GetLoginAttempts(key.name)
+		if err != nil {
+			return fmt.Errorf("failed to get login attempts - %w", err)
+		}
+
+		if now.Before(a.LockedUntil) {
+			return &LoginThrottledError{Until: a.LockedUntil, Locked: true}
+		}
+		if now.Sub(a.LastFailure) < lg.cfg.Window {
+			if until := a.LastFailure.Add(lg.delay(a.Failures)); now.Before(until) {
+				return &LoginThrottledError{Until: until}
+			}
+		}
+
+		ok, err := lg.linker.storage.ReserveLoginAttempt(a, now, now.Add(-lg.cfg.Window))
+		if err != nil {
+			return fmt.Errorf("failed to reserve login attempt - %w", err)
+		}
+		if ok {
+			key.reservedAt = now
+			key.lastFailure = a.LastFailure
+			return nil
+		}
+		// Another attempt got in between, check again with its failure.
+	}
+}
+
+func (lg *loginGuard) delay(failures uint32) time.Duration {
+	if failures <= lg.cfg.FreeAttempts {
+		return 0
+	}
+
+	d := lg.cfg.BaseDelay
+	for i := lg.cfg.FreeAttempts + 1; i < failures && d < lg.cfg.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > lg.cfg.MaxDelay {
+		d = lg.cfg.MaxDelay
+	}
+
+	return d
+}
+
+// fail keeps the attempts reserved by check as failures and locks the keys
+// that reached their limit.
+func (lg *loginGuard) fail(keys []*loginKey, client Client) {
+	now := time.Now()
+	for _, k := range keys {
+		key := k.name
+		limit := lg.cfg.LockAfter
+		if strings.HasPrefix(key, loginAttemptsByIP) {
+			limit = lg.cfg.LockAfterIP
+		}
+
+		until := now.Add(lg.cfg.LockFor)
+		locked, err := lg.linker.storage.LockLogin(key, until, limit)
+		if err != nil {
+			log.Printf("[ERROR] Failed to lock %s - %v", key, err)
+			continue
+		}
+		if !locked {
+			continue
+		}
+		log.Printf("[SECURITY] %s locked until %s after %d failed logins", key, until.Format(time.RFC3339), limit)
+		_ = lg.linker.Audit.Record(&AuditEntry{
+			Action:  AuditLoginLocked,
+			Target:  key,
+			Details: auditJSON(map[string]string{"until": until.Format(time.RFC3339)}),
+		}, client)
+	}
+}
+
+// release gives back the attempts reserved by check, for attempts that
+// failed for other reasons than wrong credentials. The last failure is put
+// back too, or every good attempt would move the failure window forward.
+func (lg *loginGuard) release(keys []*loginKey) {
+	for _, key := range keys {
+		err := lg.linker.storage.ReleaseLoginAttempt(key.name, key.reservedAt, key.lastFailure)
+		if err != nil {
+			log.Printf("[ERROR] Failed to release login attempt of %s - %v", key.name, err)
+		}
+	}
+}
+
+// succeed forgets the failures of the login. Failures of the IP are kept, or
+// an attacker could reset them by logging into an account of their own,
+// only the attempt reserved for it is given back.
+func (lg *loginGuard) succeed(keys []*loginKey) {
+	for _, key := range keys {
+		if !strings.HasPrefix(key.name, loginAttemptsByLogin) {
+			lg.release([]*loginKey{key})
+			continue
+		}
+
+		err := lg.linker.storage.ClearLoginAttempts(key.name)
+		if err != nil {
+			log.Printf("[ERROR] Failed to clear failed logins of %s - %v", key.name, err)
+		}
+	}
+}
+
+func (lg *loginGuard) unlock(key string) error {
+	err := lg.linker.storage.ClearLoginAttempts(key)
+	if err != nil {
+		return err
+	}
+	log.Printf("[SECURITY] %s unlocked", key)
+
+	return lg.linker.Audit.Record(&AuditEntry{Action: AuditLoginUnlocked, Target: key}, Client{})
+}
+
+// isLoginFailure tells whether the error means the credentials were wrong.
+func isLoginFailure(err error) bool {
+	return errors.Is(err, ErrInvalidPair) || errors.Is(err, ErrUserNotFound) ||
+		errors.Is(err, ErrTOTPCodeInvalid) || errors.Is(err, ErrTOTPCodeReused)
+}
@@ -0,0 +1,144 @@
+package gophermart
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount in kopecks. It never exceeds MaxMoney, so it always fits
+// a Postgres bigint column.
+type Money uint64
+
+const MaxMoney Money = math.MaxInt64
+
+var moneyFormat = regexp.MustCompile(`^(\d+)(?:\.(\d+))?(?:[eE]([+-]?\d+))?$`)
+
+// ParseMoney parses a non-negative decimal amount with at most two
+// fractional digits, e.g. "729.98" or "5e2". Trailing zeros past the second
+// fractional digit are allowed.
+func ParseMoney(s string) (Money, error) {
+	if strings.HasPrefix(s, "-") {
+		return 0, fmt.Errorf("%w: %s", ErrMoneyNegative, s)
+	}
+
+	match := moneyFormat.FindStringSubmatch(s)
+	if match == nil {
+		return 0, fmt.Errorf("%w: %q", ErrMoneyInvalid, s)
+	}
+
+	digits := strings.TrimLeft(match[1]+match[2], "0")
+	if digits == "" {
+		return 0, nil
+	}
+
+	exp := 0
+	if match[3] != "" {
+		var err error
+		exp, err = strconv.Atoi(match[3])
+		if err != nil || exp > 100 || exp < -100 {
+			return 0, fmt.Errorf("%w: %s", ErrMoneyInvalid, s)
+		}
+	}
+
+	// Number of digits after the decimal point once the exponent is applied.
+	places := len(match[2]) - exp
+	if places > 2 {
+		cut := len(digits) - (places - 2)
+		if cut < 0 || strings.TrimRight(digits[cut:], "0") != "" {
+			return 0, fmt.Errorf("%w: %s", ErrMoneyPrecision, s)
+		}
+		digits = digits[:cut]
+	} else {
+		digits += strings.Repeat("0", 2-places)
+	}
+
+	if digits == "" {
+		return 0, nil
+	}
+
+	v, err := strconv.ParseUint(digits, 10, 64)
+	if err != nil || Money(v) > MaxMoney {
+		return 0, fmt.Errorf("%w: %s", ErrMoneyOverflow, s)
+	}
+
+	return Money(v), nil
+}
+
+func (m Money) String() string {
+	whole, cents := uint64(m)/100, uint64(m)%100
+
+	switch {
+	case cents == 0:
+		return strconv.FormatUint(whole, 10)
+	case cents%10 == 0:
+		return fmt.Sprintf("%d.%d", whole, cents/10)
+	default:
+		return fmt.Sprintf("%d.%02d", whole, cents)
+	}
+}
+
+func (m Money) Add(o Money) (Money, error) {
+	if m > MaxMoney-o {
+		return 0, fmt.Errorf("%w: %s + %s", ErrMoneyOverflow, m, o)
+	}
+
+	return m + o, nil
+}
+
+func (m Money) Sub(o Money) (Money, error) {
+	if o > m {
+		return 0, fmt.Errorf("%w: %s - %s", ErrMoneyNegative, m, o)
+	}
+
+	return m - o, nil
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepts JSON numbers only, the exact decimal text is parsed
+// without going through float64.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if string(data) == "null" {
+		return nil
+	}
+
+	v, err := ParseMoney(string(data))
+	if err != nil {
+		return err
+	}
+	*m = v
+
+	return nil
+}
+
+func (m Money) Value() (driver.Value, error) {
+	if m > MaxMoney {
+		return nil, fmt.Errorf("%w: %d kopecks", ErrMoneyOverflow, uint64(m))
+	}
+
+	return int64(m), nil
+}
+
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case int64:
+		if v < 0 {
+			return fmt.Errorf("%w: %d kopecks", ErrMoneyNegative, v)
+		}
+		*m = Money(v)
+	case nil:
+		*m = 0
+	default:
+		return fmt.Errorf("%w: can't scan %T", ErrMoneyInvalid, src)
+	}
+
+	return nil
+}
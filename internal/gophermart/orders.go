@@ -14,6 +14,10 @@ const (
 	StatusProcessed  = "PROCESSED"
 )
 
+// OrderCancelledAccountDeleted is the last error of the orders cancelled
+// when their account was deleted.
+const OrderCancelledAccountDeleted = "account deleted"
+
 func IsValidStatus(status string) bool {
 	switch status {
 	case StatusNew:
@@ -31,15 +35,22 @@ type Order struct {
 	ID         uint64
 	UserID     uint64
 	Status     string
-	Accrual    uint64
+	Accrual    Money
 	UploadedAt time.Time
+
+	// Accrual polling schedule. An order with non-zero ParkedAt is no longer
+	// polled until an operator requeues it.
+	Attempts      uint32
+	NextAttemptAt time.Time
+	ParkedAt      time.Time
+	LastError     string
 }
 
 type OrderProxy struct {
-	Number     string  `json:"number"`
-	Status     string  `json:"status"`
-	Accrual    float64 `json:"accrual,omitempty"`
-	UploadedAt string  `json:"uploaded_at"`
+	Number     string `json:"number"`
+	Status     string `json:"status"`
+	Accrual    Money  `json:"accrual,omitempty"`
+	UploadedAt string `json:"uploaded_at"`
 }
 
 func (op *OrderProxy) String() string {
@@ -101,3 +112,13 @@ func (os *orders) GetUserOrders(userID uint64) ([]*Order, error) {
 
 	return ors, nil
 }
+
+func (os *orders) Parked(limit uint32) ([]*Order, error) {
+	return os.linker.storage.GetParkedOrders(limit)
+}
+
+// Requeue puts a parked order back into the queue on behalf of the
+// operator, recorded as done by the system.
+func (os *orders) Requeue(orderID uint64) error {
+	return os.linker.Admin.RequeueOrder(0, orderID, Client{}, "")
+}
@@ -0,0 +1,46 @@
+package gophermart
+
+import (
+	"github.com/Osselnet/gophermart.git/pkg/password"
+	"log"
+)
+
+type PasswordConfig struct {
+	Params password.Params
+	Policy password.Policy
+}
+
+// SetPasswordConfig sets how new passwords are checked and hashed. Zero
+// Params or Policy are replaced with the package password defaults.
+func (g *GopherMart) SetPasswordConfig(cfg PasswordConfig) {
+	if cfg.Params == (password.Params{}) {
+		cfg.Params = password.DefaultParams
+	}
+	if cfg.Policy == (password.Policy{}) {
+		cfg.Policy = password.DefaultPolicy
+	}
+
+	g.passwords = cfg
+}
+
+// rehashPassword upgrades the hash of a password that has just been verified
+// if it was made with other settings than the current ones. Failures are only
+// logged, the old hash keeps working.
+func (g *GopherMart) rehashPassword(user *User, pass string) {
+	if !password.NeedsRehash(user.PasswordHash, g.passwords.Params) {
+		return
+	}
+
+	hash, err := password.Hash(pass, g.passwords.Params)
+	if err != nil {
+		log.Printf("[ERROR] Failed to rehash password of user %d - %v", user.ID, err)
+		return
+	}
+
+	err = g.Users.SetPasswordHash(user, hash)
+	if err != nil {
+		log.Printf("[ERROR] Failed to save rehashed password of user %d - %v", user.ID, err)
+		return
+	}
+	log.Printf("[DEBUG] Password hash of user %d upgraded to %s", user.ID, g.passwords.Params.Algorithm)
+}
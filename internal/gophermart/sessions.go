@@ -1,27 +1,54 @@
 package gophermart
 
 import (
+	"errors"
 	"fmt"
-	"sync"
+	"github.com/Osselnet/gophermart.git/pkg/cache"
 	"time"
 )
 
+// Session is a login of a user. Its refresh tokens are numbered by Generation:
+// only the latest one may be exchanged for new tokens.
 type Session struct {
-	UserID uint64
-	Token  string
-	Expiry time.Time
+	ID         string
+	UserID     uint64
+	Generation uint64
+	CreatedAt  time.Time
+	Expiry     time.Time
+	LastSeenAt time.Time
+	IP         string
+	UserAgent  string
+
+	// Set on freshly issued sessions and on sessions taken from a request
+	// context, never stored.
+	Token        string
+	TokenExpiry  time.Time
+	RefreshToken string
+}
+
+// Client describes where a request came from.
+type Client struct {
+	IP        string
+	UserAgent string
+	// RequestID ties audit entries to the request logs.
+	RequestID string
 }
 
+// LastSeenAt is stored at most once per sessionTouchInterval, so that
+// authenticated requests don't write to the storage every time.
+const sessionTouchInterval = time.Minute
+
 type sessions struct {
-	mu             sync.RWMutex
+	linker         *GopherMart
 	storage        Storer
-	bySessionToken map[string]*Session
+	bySessionToken *cache.Cache[string, *Session]
 }
 
-func newSessions(st Storer) *sessions {
+func newSessions(linker *GopherMart, st Storer, cfg CacheConfig) *sessions {
 	return &sessions{
+		linker:         linker,
 		storage:        st,
-		bySessionToken: make(map[string]*Session),
+		bySessionToken: cache.New[string, *Session](cfg.SessionSize, cfg.TTL),
 	}
 }
 
@@ -30,9 +57,7 @@ func (s Session) IsExpired() bool {
 }
 
 func (sns *sessions) Add(session *Session) error {
-	sns.mu.RLock()
-	_, ok := sns.bySessionToken[session.Token]
-	sns.mu.RUnlock()
+	_, ok := sns.bySessionToken.Get(session.ID)
 	if ok {
 		return fmt.Errorf("session already exists")
 	}
@@ -42,41 +67,156 @@ func (sns *sessions) Add(session *Session) error {
 		return err
 	}
 
-	sns.mu.Lock()
-	sns.bySessionToken[session.Token] = session
-	sns.mu.Unlock()
+	sns.bySessionToken.Set(session.ID, session)
 
 	return nil
 }
 
-func (sns *sessions) Get(token string) (*Session, error) {
-	var err error
+func (sns *sessions) Get(id string) (*Session, error) {
+	session, ok := sns.bySessionToken.Get(id)
+	if ok {
+		return session, nil
+	}
 
-	sns.mu.RLock()
-	session, ok := sns.bySessionToken[token]
-	sns.mu.RUnlock()
-	if !ok {
-		session, err = sns.storage.GetSession(token)
-		if err != nil {
-			return nil, fmt.Errorf("token session not found - %w", err)
-		}
-		sns.mu.Lock()
-		sns.bySessionToken[session.Token] = session
-		sns.mu.Unlock()
+	return sns.Load(id)
+}
+
+// Load reads the session from the storage bypassing the cache, e.g. when its
+// generation may have been moved by another replica.
+func (sns *sessions) Load(id string) (*Session, error) {
+	session, err := sns.storage.GetSession(id)
+	if err != nil {
+		return nil, fmt.Errorf("session not found - %w", err)
 	}
 
+	sns.bySessionToken.Set(session.ID, session)
+
 	return session, nil
 }
 
-func (sns *sessions) Delete(token string) error {
-	sns.mu.Lock()
-	delete(sns.bySessionToken, token)
-	sns.mu.Unlock()
+// Rotate moves the session to the next generation. It fails with
+// ErrSessionNotFound if the session is gone or was already rotated from
+// the given generation.
+func (sns *sessions) Rotate(session *Session, expiry time.Time) error {
+	err := sns.storage.RotateSession(session.ID, session.Generation, expiry)
+	if err != nil {
+		sns.bySessionToken.Delete(session.ID)
+		return err
+	}
+
+	rotated := *session
+	rotated.Generation++
+	rotated.Expiry = expiry
+	sns.bySessionToken.Set(session.ID, &rotated)
+
+	return nil
+}
+
+// Touch records that the session has just been used by the client.
+func (sns *sessions) Touch(session *Session, client Client) error {
+	now := time.Now()
+	if now.Sub(session.LastSeenAt) < sessionTouchInterval && session.IP == client.IP && session.UserAgent == client.UserAgent {
+		return nil
+	}
+
+	err := sns.storage.TouchSession(session.ID, client.IP, client.UserAgent, now)
+	if err != nil {
+		return err
+	}
+
+	touched := *session
+	touched.Token, touched.TokenExpiry, touched.RefreshToken = "", time.Time{}, ""
+	touched.LastSeenAt = now
+	touched.IP = client.IP
+	touched.UserAgent = client.UserAgent
+	sns.bySessionToken.Set(session.ID, &touched)
+
+	return nil
+}
+
+func (sns *sessions) ListForUser(userID uint64) ([]*Session, error) {
+	return sns.storage.GetUserSessions(userID)
+}
+
+// Revoke ends a session of the user. Sessions of other users are reported as
+// not found.
+func (sns *sessions) Revoke(userID uint64, id string) error {
+	session, err := sns.Load(id)
+	if err != nil || session.UserID != userID {
+		return ErrSessionNotFound
+	}
+
+	return sns.Delete(id)
+}
+
+// RevokeAll ends every session of the user and returns their IDs.
+func (sns *sessions) RevokeAll(userID uint64) ([]string, error) {
+	ids, err := sns.storage.DeleteUserSessions(userID)
+
+	sns.bySessionToken.DeleteFunc(func(_ string, session *Session) bool {
+		return session.UserID == userID
+	})
+	for _, id := range ids {
+		sns.bySessionToken.Delete(id)
+		sns.linker.publishInvalidation(invalidateSession, id)
+	}
 
-	err := sns.storage.DeleteSession(token)
+	return ids, err
+}
+
+func (sns *sessions) Delete(id string) error {
+	sns.bySessionToken.Delete(id)
+
+	err := sns.storage.DeleteSession(id)
 	if err != nil {
 		return err
 	}
 
+	sns.linker.publishInvalidation(invalidateSession, id)
+
 	return nil
 }
+
+// RevokeOthers ends every session of the user except keep.
+func (sns *sessions) RevokeOthers(userID uint64, keep string) ([]string, error) {
+	list, err := sns.ListForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, session := range list {
+		if session.ID == keep {
+			continue
+		}
+		err = sns.Delete(session.ID)
+		if errors.Is(err, ErrSessionNotFound) {
+			continue
+		}
+		if err != nil {
+			return ids, err
+		}
+		ids = append(ids, session.ID)
+	}
+
+	return ids, nil
+}
+
+// Reap deletes expired sessions in batches of at most batch sessions and
+// returns how many were deleted.
+func (sns *sessions) Reap(batch uint32) (int, error) {
+	var total int
+	for {
+		ids, err := sns.storage.DeleteExpiredSessions(time.Now(), batch)
+		for _, id := range ids {
+			sns.bySessionToken.Delete(id)
+		}
+		total += len(ids)
+		if err != nil {
+			return total, err
+		}
+		if uint32(len(ids)) < batch {
+			return total, nil
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package gophermart
+
+import (
+	"fmt"
+	"time"
+)
+
+const statementBatch = 1000
+
+// StatementQuery selects the movements of the balance of the user created
+// in [From, To). Zero To is now, zero From is the start of the month of To.
+type StatementQuery struct {
+	UserID uint64
+	From   time.Time
+	To     time.Time
+}
+
+// StatementLine is one movement of the balance. Ref is the order number of
+// accruals and withdrawals, the ID of adjustments. Balance is the running
+// balance after the movement.
+type StatementLine struct {
+	Date    time.Time
+	Kind    string
+	Ref     string
+	Credit  Money
+	Debit   Money
+	Balance Money
+}
+
+type StatementTotals struct {
+	Opening Money
+	Credits Money
+	Debits  Money
+	Closing Money
+}
+
+// StatementWriter renders a statement line by line as it is read.
+type StatementWriter interface {
+	Open(q StatementQuery, opening Money) error
+	Line(l *StatementLine) error
+	Close(t StatementTotals) error
+}
+
+// Statement reads the ledger of the user in batches and writes the
+// statement: the opening balance, every accrual, withdrawal and adjustment
+// with the running balance, and the totals.
+func (g *GopherMart) Statement(q StatementQuery, sw StatementWriter) error {
+	if q.To.IsZero() {
+		q.To = time.Now()
+	}
+	if q.From.IsZero() {
+		y, m, _ := q.To.Date()
+		q.From = time.Date(y, m, 1, 0, 0, 0, 0, q.To.Location())
+	}
+	if !q.From.Before(q.To) {
+		return fmt.Errorf("%w: from must be before to", ErrStatementInvalid)
+	}
+
+	credits, debits, err := g.storage.GetLedgerTotals(q.UserID, q.From)
+	if err != nil {
+		return fmt.Errorf("failed to get opening balance - %w", err)
+	}
+	opening, err := credits.Sub(debits)
+	if err != nil {
+		return fmt.Errorf("ledger of user %d is overdrawn - %w", q.UserID, err)
+	}
+
+	err = sw.Open(q, opening)
+	if err != nil {
+		return err
+	}
+
+	t := StatementTotals{Opening: opening, Closing: opening}
+	afterAt, afterID := q.From, uint64(0)
+	for {
+		es, err := g.storage.GetLedgerPage(q.UserID, afterAt, afterID, q.To, statementBatch)
+		if err != nil {
+			return fmt.Errorf("failed to get ledger entries - %w", err)
+		}
+
+		for _, e := range es {
+			l := &StatementLine{Date: e.CreatedAt, Kind: e.Kind, Ref: e.Ref}
+			switch e.Direction {
+			case DirectionCredit:
+				l.Credit = e.Amount
+				t.Credits, err = t.Credits.Add(e.Amount)
+				if err == nil {
+					t.Closing, err = t.Closing.Add(e.Amount)
+				}
+			case DirectionDebit:
+				l.Debit = e.Amount
+				t.Debits, err = t.Debits.Add(e.Amount)
+				if err == nil {
+					t.Closing, err = t.Closing.Sub(e.Amount)
+				}
+			default:
+				err = fmt.Errorf("ledger entry %d has unknown direction %q", e.ID, e.Direction)
+			}
+			if err != nil {
+				return fmt.Errorf("ledger of user %d - %w", q.UserID, err)
+			}
+			l.Balance = t.Closing
+
+			err = sw.Line(l)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(es) < statementBatch {
+			break
+		}
+		afterAt, afterID = es[len(es)-1].CreatedAt, es[len(es)-1].ID
+	}
+
+	return sw.Close(t)
+}
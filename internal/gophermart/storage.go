@@ -1,22 +1,145 @@
 package gophermart
 
+import (
+	"context"
+	"time"
+)
+
 type Storer interface {
 	AddUser(*User) (uint64, error)
 	GetUser(interface{}) (*User, error)
 	DeleteUser(string) error
+	UpdateUserPassword(userID uint64, hash string) error
+	// AnonymizeUser renames the user to login and wipes the credentials. It
+	// fails with ErrBalanceNotEmpty unless the balance is zero or forfeit is
+	// set, in which case the balance is moved to AccountForfeited. API keys
+	// of the user are deleted and orders still waiting for accrual are
+	// cancelled, so no accrual is credited to the account afterwards.
+	AnonymizeUser(userID uint64, login string, forfeit bool) error
+	UpdateUserTOTP(userID uint64, secret string, confirmed bool) error
+	// UpdateUserRole grants the role and appends e to the audit log in the
+	// same transaction, as AddAuditEntry does.
+	UpdateUserRole(userID uint64, role string, e *AuditEntry, chain bool) error
+	// SearchUsers finds users whose login contains query, ignoring case, or
+	// whose ID is query.
+	SearchUsers(query string, limit uint32) ([]*User, error)
+	// UseTOTPStep records the time step of an accepted code. It fails with
+	// ErrTOTPCodeReused unless step is later than any recorded before.
+	UseTOTPStep(userID uint64, step int64) error
+	SetRecoveryCodes(userID uint64, hashes []string) error
+	UseRecoveryCode(userID uint64, hash string) error
+
+	// GetLoginAttempts returns empty attempts for keys never seen before.
+	GetLoginAttempts(key string) (*LoginAttempts, error)
+	// ReserveLoginAttempt counts a failure at the given time, starting over
+	// if the previous failure happened before resetBefore, unless the key
+	// has changed since seen was read. It tells whether it was counted.
+	ReserveLoginAttempt(seen *LoginAttempts, at, resetBefore time.Time) (bool, error)
+	// ReleaseLoginAttempt takes back a failure counted by ReserveLoginAttempt
+	// at reservedAt. The last failure goes back to lastFailure unless another
+	// failure was counted since.
+	ReleaseLoginAttempt(key string, reservedAt, lastFailure time.Time) error
+	// LockLogin locks the key and starts its count over if it has at least
+	// minFailures failures. It tells whether the key was locked.
+	LockLogin(key string, until time.Time, minFailures uint32) (bool, error)
+	ClearLoginAttempts(key string) error
+
+	AddAPIKey(*APIKey) error
+	GetAPIKey(id string) (*APIKey, error)
+	GetUserAPIKeys(userID uint64) ([]*APIKey, error)
+	DeleteAPIKey(userID uint64, id string) error
+	TouchAPIKey(id string, at time.Time) error
 
 	AddSession(*Session) error
 	GetSession(string) (*Session, error)
 	DeleteSession(string) error
+	RotateSession(id string, generation uint64, expiry time.Time) error
+	TouchSession(id, ip, userAgent string, at time.Time) error
+	GetUserSessions(userID uint64) ([]*Session, error)
+	DeleteUserSessions(userID uint64) ([]string, error)
+	DeleteExpiredSessions(before time.Time, limit uint32) ([]string, error)
+
+	// PublishInvalidation tells every replica to drop the cached entry. Once
+	// SubscribeInvalidations is listening it calls fn with an empty key, since
+	// anything published before then was missed.
+	PublishInvalidation(key string) error
+	SubscribeInvalidations(ctx context.Context, fn func(key string)) error
 
 	AddOrder(*Order) error
+	// AddOrders adds the orders in one transaction, skipping those uploaded
+	// before. It returns the owners of the skipped ones by order number.
+	AddOrders(ors []*Order) (map[uint64]uint64, error)
 	GetOrder(orderID uint64) (*Order, error)
-	GetPullOrders(uint32) (map[uint64]*Order, error)
+	LeaseOrders(owner string, limit uint32, ttl time.Duration) (map[uint64]*Order, error)
 	GetUserOrders(userID uint64) ([]*Order, error)
+	// FindUserOrders returns up to q.Limit orders of q.UserID matching the
+	// query, sorted by q.Sort and starting after q.After if it is set.
+	FindUserOrders(q ListQuery) ([]*Order, error)
 	UpdateOrder(*Order) error
+	RescheduleOrder(*Order) error
+	GetParkedOrders(limit uint32) ([]*Order, error)
+	// RequeueOrder puts the order back into the queue and, unless e is nil,
+	// appends e to the audit log in the same transaction.
+	RequeueOrder(orderID uint64, e *AuditEntry, chain bool) error
 
 	GetBalance(userID uint64) (Balance, error)
 	AddWithdraw(*Withdraw) error
 	GetUserWithdrawals(userID uint64) ([]*Withdraw, error)
+	FindUserWithdrawals(q ListQuery) ([]*Withdraw, error)
 	GetOrderWithdrawals(orderID uint64) (*Withdraw, error)
+
+	// AdjustBalance posts the adjustment to the ledger and the balance. A
+	// debit fails with ErrNotEnoughFunds if it exceeds the current balance.
+	// Unless e is nil, it is appended to the audit log in the same
+	// transaction, with the balance before and after set by SetBalances.
+	AdjustBalance(adj *Adjustment, e *AuditEntry, chain bool) (Balance, error)
+	// GetLedgerEntries returns the entries of the account of the user
+	// created before until, like GetLedgerPage and GetLedgerTotals.
+	GetLedgerEntries(userID uint64, until time.Time) ([]*LedgerEntry, error)
+	// GetLedgerPage returns up to limit entries of the account of the user
+	// created before until, ordered like GetLedgerEntries and starting after
+	// the entry created at afterAt with afterID, or any entry at afterAt if
+	// afterID is zero.
+	GetLedgerPage(userID uint64, afterAt time.Time, afterID uint64, until time.Time, limit uint32) ([]*LedgerEntry, error)
+	// GetLedgerTotals sums the credits and the debits of the account of the
+	// user created before the given time.
+	GetLedgerTotals(userID uint64, before time.Time) (credits, debits Money, err error)
+
+	// AddUserEvent stores the event, setting its ID, and notifies the
+	// subscribers of every replica.
+	AddUserEvent(e *UserEvent) error
+	// GetUserEvents returns up to limit events of the user with IDs above
+	// afterID, oldest first.
+	GetUserEvents(userID, afterID uint64, limit uint32) ([]*UserEvent, error)
+	GetLastUserEventID(userID uint64) (uint64, error)
+	DeleteUserEventsBefore(before time.Time, limit uint32) (int64, error)
+	// SubscribeUserEvents calls fn with the user of every new event until ctx
+	// is done or the subscription breaks. It calls fn with zero, any user,
+	// once subscribed, as events may have been missed until then.
+	SubscribeUserEvents(ctx context.Context, fn func(userID uint64)) error
+
+	AddBulkJob(j *BulkJob) error
+	UpdateBulkJob(j *BulkJob) error
+	GetBulkJob(id string) (*BulkJob, error)
+	// ClaimBulkJobs returns up to limit pending or running jobs last saved
+	// before staleBefore and marks them saved at now, so they are claimed
+	// once.
+	ClaimBulkJobs(staleBefore, now time.Time, limit uint32) ([]*BulkJob, error)
+
+	AddNonce(nonce string, expiresAt time.Time) error
+
+	// AddIdempotencyKey takes over a stored key that expired by
+	// k.CreatedAt, expired keys are otherwise left to
+	// DeleteIdempotencyKeysBefore.
+	AddIdempotencyKey(k *IdempotencyKey) (*IdempotencyKey, error)
+	SaveIdempotencyKey(k *IdempotencyKey) error
+	DeleteIdempotencyKey(userID uint64, key string) error
+	DeleteIdempotencyKeysBefore(before time.Time, limit uint32) (int64, error)
+
+	// AddAuditEntry appends to the audit log, entries are never changed. If
+	// chain is set, the entry is linked to the latest one with
+	// AuditEntry.ComputeHash, one entry at a time.
+	AddAuditEntry(e *AuditEntry, chain bool) error
+	// GetAuditEntries returns the latest entries first.
+	GetAuditEntries(f AuditFilter) ([]*AuditEntry, error)
 }
@@ -0,0 +1,129 @@
+package gophermart
+
+import (
+	"fmt"
+	"github.com/Osselnet/gophermart.git/pkg/jwt"
+	"log"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultAccessTokenTTL  = 15 * time.Minute
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+
+	tokenUseAccess  = "access"
+	tokenUseRefresh = "refresh"
+)
+
+type TokenConfig struct {
+	Keys       *jwt.Keyring
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+}
+
+type tokenClaims struct {
+	Subject    string `json:"sub"`
+	SessionID  string `json:"sid"`
+	Use        string `json:"use"`
+	Generation uint64 `json:"gen,omitempty"`
+	IssuedAt   int64  `json:"iat"`
+	ExpiresAt  int64  `json:"exp"`
+}
+
+func (g *GopherMart) SetTokenConfig(cfg TokenConfig) {
+	if cfg.Keys == nil {
+		cfg.Keys = jwt.RandomKeyring()
+	}
+	if cfg.AccessTTL <= 0 {
+		cfg.AccessTTL = DefaultAccessTokenTTL
+	}
+	if cfg.RefreshTTL <= 0 {
+		cfg.RefreshTTL = DefaultRefreshTokenTTL
+	}
+
+	g.tokens = cfg
+}
+
+// issueTokens signs a new access token and a refresh token of the current
+// generation for the session.
+func (g *GopherMart) issueTokens(s *Session) error {
+	now := time.Now()
+	s.TokenExpiry = now.Add(g.tokens.AccessTTL)
+
+	var err error
+	s.Token, err = g.tokens.Keys.Sign(&tokenClaims{
+		Subject:   strconv.FormatUint(s.UserID, 10),
+		SessionID: s.ID,
+		Use:       tokenUseAccess,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: s.TokenExpiry.Unix(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to sign access token - %w", err)
+	}
+
+	s.RefreshToken, err = g.tokens.Keys.Sign(&tokenClaims{
+		Subject:    strconv.FormatUint(s.UserID, 10),
+		SessionID:  s.ID,
+		Use:        tokenUseRefresh,
+		Generation: s.Generation,
+		IssuedAt:   now.Unix(),
+		ExpiresAt:  s.Expiry.Unix(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to sign refresh token - %w", err)
+	}
+
+	return nil
+}
+
+// parseToken verifies the token signature. Expiry is checked only if
+// checkExpiry is set, so that expired tokens still identify their session.
+func (g *GopherMart) parseToken(token, use string, checkExpiry bool) (*tokenClaims, uint64, error) {
+	claims := &tokenClaims{}
+	err := g.tokens.Keys.Verify(token, claims)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w - %s", ErrTokenInvalid, err)
+	}
+
+	if use != "" && claims.Use != use {
+		return nil, 0, fmt.Errorf("%w - %s token expected", ErrTokenInvalid, use)
+	}
+
+	userID, err := strconv.ParseUint(claims.Subject, 10, 64)
+	if err != nil || claims.SessionID == "" {
+		return nil, 0, fmt.Errorf("%w - bad claims", ErrTokenInvalid)
+	}
+
+	if checkExpiry && time.Now().Unix() >= claims.ExpiresAt {
+		return nil, 0, ErrTokenExpired
+	}
+
+	return claims, userID, nil
+}
+
+// Authenticate checks an access token and that its session hasn't been
+// revoked. Sessions are looked up through the sessions cache.
+func (g *GopherMart) Authenticate(token string, client Client) (*Session, error) {
+	claims, userID, err := g.parseToken(token, tokenUseAccess, true)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := g.Sessions.Get(claims.SessionID)
+	if err != nil || stored.UserID != userID || stored.IsExpired() {
+		return nil, ErrSessionNotFound
+	}
+
+	err = g.Sessions.Touch(stored, client)
+	if err != nil {
+		log.Printf("[ERROR] Failed to touch session %s - %s\n", stored.ID, err)
+	}
+
+	session := *stored
+	session.Token = token
+	session.TokenExpiry = time.Unix(claims.ExpiresAt, 0)
+
+	return &session, nil
+}
@@ -0,0 +1,325 @@
+package gophermart
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"fmt"
+	"github.com/Osselnet/gophermart.git/pkg/totp"
+	"github.com/google/uuid"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultTOTPIssuer       = "Gophermart"
+	DefaultTOTPChallengeTTL = 5 * time.Minute
+
+	tokenUseTOTP = "totp"
+
+	recoveryCodesCount = 10
+	// totpSkew is the number of time steps a code is accepted before and
+	// after its own, to allow for clock drift of the user's device.
+	totpSkew = 1
+)
+
+type TOTPConfig struct {
+	Issuer string
+	// Withdrawals of more than WithdrawThreshold by users with TOTP enabled
+	// need a fresh code.
+	WithdrawThreshold Money
+	ChallengeTTL      time.Duration
+}
+
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// TOTPRequiredError is returned by Login for users with TOTP enabled. The
+// login is finished by LoginTOTP with the challenge and a code.
+type TOTPRequiredError struct {
+	Challenge string
+	Expiry    time.Time
+}
+
+func (e *TOTPRequiredError) Error() string {
+	return ErrTOTPRequired.Error()
+}
+
+func (e *TOTPRequiredError) Unwrap() error {
+	return ErrTOTPRequired
+}
+
+func (g *GopherMart) SetTOTPConfig(cfg TOTPConfig) {
+	if cfg.Issuer == "" {
+		cfg.Issuer = DefaultTOTPIssuer
+	}
+	if cfg.ChallengeTTL <= 0 {
+		cfg.ChallengeTTL = DefaultTOTPChallengeTTL
+	}
+
+	g.totp = cfg
+}
+
+// EnrollTOTP generates a new secret for the user. It has no effect on logins
+// until it is confirmed with a code by ConfirmTOTP.
+func (g *GopherMart) EnrollTOTP(userID uint64) (*TOTPEnrollment, error) {
+	user, err := g.Users.Get(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled() {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate TOTP secret - %w", err)
+	}
+
+	err = g.Users.SetTOTP(user, secret, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TOTPEnrollment{
+		Secret: secret,
+		URI:    totp.URI(g.totp.Issuer, user.Login, secret),
+	}, nil
+}
+
+// ConfirmTOTP enables TOTP once the user proves the secret made it to their
+// authenticator, and returns new recovery codes. They are shown only once.
+// Wrong codes count as failed logins.
+func (g *GopherMart) ConfirmTOTP(userID uint64, code string, client Client) ([]string, error) {
+	user, err := g.Users.Get(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrTOTPNotEnrolled
+	}
+	if user.TOTPConfirmed {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+
+	err = g.guardCode(user, client, func() error {
+		return g.checkTOTP(user, code)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	codes, err := g.resetRecoveryCodes(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = g.Users.SetTOTP(user, user.TOTPSecret, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// DisableTOTP turns the second factor off after checking the password and
+// the code, which is either a TOTP code or a recovery code. Both are checked
+// as one login, so a stolen session can't guess them faster than at login
+// and the right password doesn't forget the wrong codes.
+func (g *GopherMart) DisableTOTP(userID uint64, pass, code string, client Client) error {
+	user, err := g.Users.Get(userID)
+	if err != nil {
+		return err
+	}
+	if !user.TOTPEnabled() {
+		return ErrTOTPNotEnrolled
+	}
+
+	err = g.guardCode(user, client, func() error {
+		if !user.CheckPassword(pass) {
+			return ErrInvalidPair
+		}
+		return g.checkSecondFactor(user, code)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = g.Users.SetTOTP(user, "", false)
+	if err != nil {
+		return err
+	}
+
+	return g.storage.SetRecoveryCodes(user.ID, nil)
+}
+
+// LoginTOTP finishes a login started by Login for a user with TOTP enabled.
+// The code is either a TOTP code or an unused recovery code.
+func (g *GopherMart) LoginTOTP(challenge, code, oldToken string, client Client) (*Session, error) {
+	_, userID, err := g.parseToken(challenge, tokenUseTOTP, true)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := g.Users.Get(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.TOTPEnabled() {
+		return nil, fmt.Errorf("%w - TOTP is not enabled", ErrTokenInvalid)
+	}
+
+	keys := loginAttemptsKeys(user.Login, client)
+	err = g.loginGuard.check(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	err = g.checkSecondFactor(user, code)
+	if isLoginFailure(err) {
+		g.loginGuard.fail(keys, client)
+		g.recordLogin(user.Login, user, nil, err, client)
+	} else if err != nil {
+		g.loginGuard.release(keys)
+	}
+	if err != nil {
+		return nil, err
+	}
+	g.loginGuard.succeed(keys)
+
+	session, err := g.startSession(user, oldToken, client)
+	if err != nil {
+		return nil, err
+	}
+	g.recordLogin(user.Login, user, session, nil, client)
+
+	return session, nil
+}
+
+func (g *GopherMart) totpChallenge(user *User) error {
+	now := time.Now()
+	e := &TOTPRequiredError{Expiry: now.Add(g.totp.ChallengeTTL)}
+
+	var err error
+	e.Challenge, err = g.tokens.Keys.Sign(&tokenClaims{
+		Subject:   strconv.FormatUint(user.ID, 10),
+		SessionID: uuid.NewString(),
+		Use:       tokenUseTOTP,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: e.Expiry.Unix(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to sign TOTP challenge - %w", err)
+	}
+
+	return e
+}
+
+// checkWithdrawTOTP requires a TOTP code for large withdrawals of users with
+// TOTP enabled. Recovery codes are not accepted here. Wrong codes count as
+// failed logins of the user, so they can't be guessed faster than at login.
+func (g *GopherMart) checkWithdrawTOTP(userID uint64, sum Money, code string, client Client) error {
+	if sum <= g.totp.WithdrawThreshold {
+		return nil
+	}
+
+	user, err := g.Users.Get(userID)
+	if err != nil {
+		return err
+	}
+	if !user.TOTPEnabled() {
+		return nil
+	}
+	if code == "" {
+		return ErrTOTPRequired
+	}
+
+	return g.guardCode(user, client, func() error {
+		return g.checkTOTP(user, code)
+	})
+}
+
+// guardCode runs check of a code sent by a logged in user as a login of the
+// user, so the code can't be guessed faster than at login.
+func (g *GopherMart) guardCode(user *User, client Client, check func() error) error {
+	keys := loginAttemptsKeys(user.Login, client)
+	err := g.loginGuard.check(keys)
+	if err != nil {
+		return err
+	}
+
+	err = check()
+	if isLoginFailure(err) {
+		g.loginGuard.fail(keys, client)
+	} else if err != nil {
+		g.loginGuard.release(keys)
+	}
+	if err != nil {
+		return err
+	}
+	g.loginGuard.succeed(keys)
+
+	return nil
+}
+
+func (g *GopherMart) checkSecondFactor(user *User, code string) error {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return ErrTOTPRequired
+	}
+	if len(code) == totp.Digits {
+		return g.checkTOTP(user, code)
+	}
+
+	err := g.storage.UseRecoveryCode(user.ID, hashRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+	log.Printf("[INFO] Recovery code used by user %d\n", user.ID)
+
+	return nil
+}
+
+// checkTOTP accepts every code at most once, even within its time step.
+func (g *GopherMart) checkTOTP(user *User, code string) error {
+	step, ok := totp.Validate(user.TOTPSecret, strings.TrimSpace(code), time.Now(), totpSkew)
+	if !ok {
+		return ErrTOTPCodeInvalid
+	}
+
+	return g.storage.UseTOTPStep(user.ID, step)
+}
+
+func (g *GopherMart) resetRecoveryCodes(userID uint64) ([]string, error) {
+	codes := make([]string, recoveryCodesCount)
+	hashes := make([]string, recoveryCodesCount)
+	for i := range codes {
+		b := make([]byte, 5)
+		_, err := rand.Read(b)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code - %w", err)
+		}
+		s := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+		codes[i] = s[:4] + "-" + s[4:]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+
+	err := g.storage.SetRecoveryCodes(userID, hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(code))
+
+	return hex.EncodeToString(sum[:])
+}
@@ -2,64 +2,84 @@ package gophermart
 
 import (
 	"fmt"
-	"golang.org/x/crypto/bcrypt"
-	"sync"
+	"github.com/Osselnet/gophermart.git/pkg/cache"
+	"github.com/Osselnet/gophermart.git/pkg/password"
+	"log"
+)
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
 )
 
 type User struct {
-	ID       uint64
-	Login    string
-	Password []byte
+	ID    uint64
+	Login string
+	Role  string
+	// PasswordHash records the algorithm and its parameters along with the
+	// hash, see package password.
+	PasswordHash string
+
+	// TOTPSecret is set on enrollment, the second factor is required only
+	// once the enrollment is confirmed.
+	TOTPSecret    string
+	TOTPConfirmed bool
+}
+
+func (u *User) TOTPEnabled() bool {
+	return u.TOTPSecret != "" && u.TOTPConfirmed
+}
+
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
 }
 
-func (u *User) CheckPassword(password string) bool {
-	if err := bcrypt.CompareHashAndPassword(u.Password, []byte(password)); err != nil {
+func (u *User) CheckPassword(pass string) bool {
+	ok, err := password.Verify(pass, u.PasswordHash)
+	if err != nil {
+		log.Printf("[ERROR] Failed to verify password of user %d - %v", u.ID, err)
 		return false
 	}
 
-	return true
+	return ok
 }
 
 type Users struct {
-	mu      sync.RWMutex
+	linker  *GopherMart
 	storage Storer
-	byLogin map[string]*User
-	byID    map[uint64]*User
+	byLogin *cache.Cache[string, *User]
+	byID    *cache.Cache[uint64, *User]
 }
 
-func newUsers(st Storer) Users {
+func newUsers(linker *GopherMart, st Storer, cfg CacheConfig) Users {
 	return Users{
+		linker:  linker,
 		storage: st,
-		byLogin: make(map[string]*User),
-		byID:    make(map[uint64]*User),
-	}
-}
-
-func HashPass(password string) ([]byte, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 8)
-	if err != nil {
-		return nil, err
+		byLogin: cache.New[string, *User](cfg.UserSize, cfg.TTL),
+		byID:    cache.New[uint64, *User](cfg.UserSize, cfg.TTL),
 	}
-
-	return hashedPassword, nil
 }
 
 func (urs *Users) Add(creds *Credentials) (uint64, error) {
-	urs.mu.RLock()
-	_, ok := urs.byLogin[creds.Login]
-	urs.mu.RUnlock()
+	_, ok := urs.byLogin.Get(creds.Login)
 	if ok {
 		return 0, ErrLoginAlreadyTaken
 	}
 
-	hashedPassword, err := HashPass(creds.Password)
+	err := urs.linker.passwords.Policy.Check(creds.Password)
 	if err != nil {
-		return 0, err
+		return 0, fmt.Errorf("%w: %s", ErrPasswordWeak, err)
+	}
+
+	hash, err := password.Hash(creds.Password, urs.linker.passwords.Params)
+	if err != nil {
+		return 0, fmt.Errorf("failed to hash password - %w", err)
 	}
 
 	u := &User{
-		Login:    creds.Login,
-		Password: hashedPassword,
+		Login:        creds.Login,
+		Role:         RoleUser,
+		PasswordHash: hash,
 	}
 
 	id, err := urs.storage.AddUser(u)
@@ -68,10 +88,8 @@ func (urs *Users) Add(creds *Credentials) (uint64, error) {
 	}
 	u.ID = id
 
-	urs.mu.Lock()
-	urs.byLogin[u.Login] = u
-	urs.byID[u.ID] = u
-	urs.mu.Unlock()
+	urs.byLogin.Set(u.Login, u)
+	urs.byID.Set(u.ID, u)
 
 	return u.ID, nil
 }
@@ -81,41 +99,98 @@ func (urs *Users) Get(byKey interface{}) (*User, error) {
 	var u *User
 	var ok bool
 
-	urs.mu.RLock()
 	switch key := byKey.(type) {
 	case string:
-		u, ok = urs.byLogin[key]
+		u, ok = urs.byLogin.Get(key)
 	case uint64:
-		u, ok = urs.byID[key]
+		u, ok = urs.byID.Get(key)
 	default:
-		urs.mu.RUnlock()
 		return nil, fmt.Errorf("given type not implemented")
 	}
-	urs.mu.RUnlock()
 
 	if !ok {
 		u, err = urs.storage.GetUser(byKey)
 		if err != nil {
 			return nil, err
 		}
-		urs.mu.Lock()
-		urs.byLogin[u.Login] = u
-		urs.byID[u.ID] = u
-		urs.mu.Unlock()
+		urs.byLogin.Set(u.Login, u)
+		urs.byID.Set(u.ID, u)
 	}
 
 	return u, nil
 }
 
 func (urs *Users) Delete(login string) error {
-	urs.mu.Lock()
-	delete(urs.byLogin, login)
-	urs.mu.Unlock()
+	urs.forget(login)
 
 	err := urs.storage.DeleteUser(login)
 	if err != nil {
 		return err
 	}
 
+	urs.linker.publishInvalidation(invalidateUser, login)
+
 	return nil
 }
+
+// SetPasswordHash replaces the password hash of the user on every replica.
+func (urs *Users) SetPasswordHash(u *User, hash string) error {
+	err := urs.storage.UpdateUserPassword(u.ID, hash)
+	if err != nil {
+		return err
+	}
+
+	urs.forget(u.Login)
+	urs.linker.publishInvalidation(invalidateUser, u.Login)
+
+	return nil
+}
+
+// SetTOTP updates the TOTP secret of the user on every replica.
+func (urs *Users) SetTOTP(u *User, secret string, confirmed bool) error {
+	err := urs.storage.UpdateUserTOTP(u.ID, secret, confirmed)
+	if err != nil {
+		return err
+	}
+
+	urs.forget(u.Login)
+	urs.linker.publishInvalidation(invalidateUser, u.Login)
+
+	return nil
+}
+
+// SetRole grants the role to the user on every replica. Grants are done by
+// the operator and audited as done by the system.
+func (urs *Users) SetRole(u *User, role string) error {
+	if role != RoleUser && role != RoleAdmin {
+		return fmt.Errorf("%w: %q", ErrRoleInvalid, role)
+	}
+
+	e := &AuditEntry{
+		Action:       AuditAdminGrantRole,
+		TargetUserID: u.ID,
+		Target:       auditTargetUser(u.ID),
+		Before:       auditJSON(map[string]string{"role": u.Role}),
+		After:        auditJSON(map[string]string{"role": role}),
+	}
+	urs.linker.Audit.stamp(e, Client{})
+
+	err := urs.storage.UpdateUserRole(u.ID, role, e, urs.linker.Audit.chain)
+	if err != nil {
+		return err
+	}
+
+	urs.forget(u.Login)
+	urs.linker.publishInvalidation(invalidateUser, u.Login)
+	log.Printf("[SECURITY] User %d is now %s", u.ID, role)
+
+	return nil
+}
+
+// forget drops the user from the caches.
+func (urs *Users) forget(login string) {
+	urs.byLogin.Delete(login)
+	urs.byID.DeleteFunc(func(_ uint64, u *User) bool {
+		return u.Login == login
+	})
+}
@@ -10,15 +10,17 @@ import (
 type Withdraw struct {
 	OrderID     uint64
 	UserID      uint64
-	Sum         uint64
+	Sum         Money
 	ProcessedAt time.Time
 }
 
 type WithdrawProxy struct {
-	Order       string  `json:"order"`
-	Sum         float64 `json:"sum"`
-	UserID      uint64  `json:"-"`
-	ProcessedAt string  `json:"processed_at"`
+	Order       string `json:"order"`
+	Sum         Money  `json:"sum"`
+	UserID      uint64 `json:"-"`
+	Client      Client `json:"-"`
+	TOTPCode    string `json:"-"`
+	ProcessedAt string `json:"processed_at"`
 }
 
 type withdrawals struct {
@@ -0,0 +1,1444 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StorageMem keeps all the data in process memory. It follows the same rules
+// as the Postgres storage and is meant for tests and local runs without a
+// database.
+type StorageMem struct {
+	mu sync.RWMutex
+
+	lastUserID  uint64
+	lastEntryID uint64
+	lastAuditID uint64
+	lastEventID uint64
+
+	users       map[uint64]*gophermart.User
+	userLogins  map[string]uint64
+	totpSteps   map[uint64]int64
+	recovery    map[uint64]map[string]struct{}
+	apiKeys     map[string]*gophermart.APIKey
+	sessions    map[string]*gophermart.Session
+	orders      map[uint64]*gophermart.Order
+	leases      map[uint64]lease
+	balances    map[uint64]*gophermart.Balance
+	withdrawals map[uint64]*gophermart.Withdraw
+	ledger      []*gophermart.LedgerEntry
+	posted      map[string]struct{}
+	nonces      map[string]time.Time
+	idempotency map[string]*gophermart.IdempotencyKey
+	logins      map[string]*gophermart.LoginAttempts
+	audit       []*gophermart.AuditEntry
+	events      []*gophermart.UserEvent
+	bulkJobs    map[string]*gophermart.BulkJob
+
+	lastSubscriberID uint64
+	subscribers      map[uint64]func(key string)
+	eventSubscribers map[uint64]func(userID uint64)
+}
+
+type lease struct {
+	owner string
+	until time.Time
+}
+
+func New() *StorageMem {
+	return &StorageMem{
+		users:       make(map[uint64]*gophermart.User),
+		userLogins:  make(map[string]uint64),
+		totpSteps:   make(map[uint64]int64),
+		recovery:    make(map[uint64]map[string]struct{}),
+		apiKeys:     make(map[string]*gophermart.APIKey),
+		sessions:    make(map[string]*gophermart.Session),
+		orders:      make(map[uint64]*gophermart.Order),
+		leases:      make(map[uint64]lease),
+		balances:    make(map[uint64]*gophermart.Balance),
+		withdrawals: make(map[uint64]*gophermart.Withdraw),
+		posted:      make(map[string]struct{}),
+		nonces:      make(map[string]time.Time),
+		idempotency: make(map[string]*gophermart.IdempotencyKey),
+		logins:      make(map[string]*gophermart.LoginAttempts),
+		bulkJobs:    make(map[string]*gophermart.BulkJob),
+		subscribers: make(map[uint64]func(key string)),
+
+		eventSubscribers: make(map[uint64]func(userID uint64)),
+	}
+}
+
+func (s *StorageMem) AddUser(u *gophermart.User) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.userLogins[u.Login]; ok {
+		return 0, gophermart.ErrLoginAlreadyTaken
+	}
+
+	s.lastUserID++
+	u.ID = s.lastUserID
+
+	if u.Role == "" {
+		u.Role = gophermart.RoleUser
+	}
+	stored := *u
+	s.users[u.ID] = &stored
+	s.userLogins[u.Login] = u.ID
+	s.balances[u.ID] = &gophermart.Balance{UserID: u.ID}
+
+	return u.ID, nil
+}
+
+func (s *StorageMem) GetUser(byKey interface{}) (*gophermart.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var id uint64
+	switch key := byKey.(type) {
+	case string:
+		id = s.userLogins[key]
+	case uint64:
+		id = key
+	default:
+		return nil, fmt.Errorf("given type not implemented")
+	}
+
+	u, ok := s.users[id]
+	if !ok {
+		return nil, gophermart.ErrUserNotFound
+	}
+	user := *u
+
+	return &user, nil
+}
+
+func (s *StorageMem) DeleteUser(login string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, ok := s.userLogins[login]
+	if !ok {
+		return fmt.Errorf("user not found")
+	}
+	delete(s.userLogins, login)
+	delete(s.users, id)
+	delete(s.totpSteps, id)
+	delete(s.recovery, id)
+
+	return nil
+}
+
+func (s *StorageMem) UpdateUserPassword(userID uint64, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return gophermart.ErrUserNotFound
+	}
+	u.PasswordHash = hash
+
+	return nil
+}
+
+func (s *StorageMem) AnonymizeUser(userID uint64, login string, forfeit bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return gophermart.ErrUserNotFound
+	}
+	b, ok := s.balances[userID]
+	if !ok {
+		return fmt.Errorf("user balance not found")
+	}
+	if _, ok = s.userLogins[login]; ok {
+		return gophermart.ErrLoginAlreadyTaken
+	}
+
+	if b.Current > 0 {
+		if !forfeit {
+			return gophermart.ErrBalanceNotEmpty
+		}
+		err := s.addLedgerEntries(gophermart.NewForfeitEntries(userID, b.Current, time.Now()))
+		if err != nil {
+			return err
+		}
+		b.Current = 0
+	}
+
+	delete(s.userLogins, u.Login)
+	s.userLogins[login] = userID
+	u.Login = login
+	u.PasswordHash = ""
+	u.TOTPSecret = ""
+	u.TOTPConfirmed = false
+	delete(s.totpSteps, userID)
+	delete(s.recovery, userID)
+	for id, k := range s.apiKeys {
+		if k.UserID == userID {
+			delete(s.apiKeys, id)
+		}
+	}
+	for id, o := range s.orders {
+		if o.UserID != userID || (o.Status != gophermart.StatusNew && o.Status != gophermart.StatusProcessing) {
+			continue
+		}
+		o.Status = gophermart.StatusInvalid
+		o.ParkedAt = time.Time{}
+		o.LastError = gophermart.OrderCancelledAccountDeleted
+		delete(s.leases, id)
+	}
+
+	return nil
+}
+
+func (s *StorageMem) UpdateUserTOTP(userID uint64, secret string, confirmed bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return gophermart.ErrUserNotFound
+	}
+	u.TOTPSecret = secret
+	u.TOTPConfirmed = confirmed
+
+	return nil
+}
+
+func (s *StorageMem) UpdateUserRole(userID uint64, role string, e *gophermart.AuditEntry, chain bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return gophermart.ErrUserNotFound
+	}
+	u.Role = role
+	if e != nil {
+		s.addAuditEntry(e, chain)
+	}
+
+	return nil
+}
+
+func (s *StorageMem) SearchUsers(query string, limit uint32) ([]*gophermart.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	query = strings.ToLower(query)
+	var us []*gophermart.User
+	for _, u := range s.users {
+		if strings.Contains(strings.ToLower(u.Login), query) || strconv.FormatUint(u.ID, 10) == query {
+			user := *u
+			us = append(us, &user)
+		}
+	}
+	sort.Slice(us, func(i, j int) bool {
+		return us[i].ID < us[j].ID
+	})
+	if uint32(len(us)) > limit {
+		us = us[:limit]
+	}
+
+	return us, nil
+}
+
+func (s *StorageMem) UseTOTPStep(userID uint64, step int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userID]; !ok {
+		return gophermart.ErrUserNotFound
+	}
+	if step <= s.totpSteps[userID] {
+		return gophermart.ErrTOTPCodeReused
+	}
+	s.totpSteps[userID] = step
+
+	return nil
+}
+
+func (s *StorageMem) SetRecoveryCodes(userID uint64, hashes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	codes := make(map[string]struct{}, len(hashes))
+	for _, h := range hashes {
+		codes[h] = struct{}{}
+	}
+	s.recovery[userID] = codes
+
+	return nil
+}
+
+func (s *StorageMem) UseRecoveryCode(userID uint64, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.recovery[userID][hash]; !ok {
+		return gophermart.ErrTOTPCodeInvalid
+	}
+	delete(s.recovery[userID], hash)
+
+	return nil
+}
+
+func (s *StorageMem) GetLoginAttempts(key string) (*gophermart.LoginAttempts, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	a, ok := s.logins[key]
+	if !ok {
+		return &gophermart.LoginAttempts{Key: key}, nil
+	}
+	attempts := *a
+
+	return &attempts, nil
+}
+
+func (s *StorageMem) ReserveLoginAttempt(seen *gophermart.LoginAttempts, at, resetBefore time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.logins[seen.Key]
+	if !ok {
+		a = &gophermart.LoginAttempts{Key: seen.Key}
+	}
+	if a.Failures != seen.Failures || !a.LastFailure.Equal(seen.LastFailure) || !a.LockedUntil.Equal(seen.LockedUntil) {
+		return false, nil
+	}
+	s.logins[seen.Key] = a
+
+	if a.LastFailure.Before(resetBefore) {
+		a.Failures = 0
+	}
+	a.Failures++
+	a.LastFailure = at
+
+	return true, nil
+}
+
+func (s *StorageMem) ReleaseLoginAttempt(key string, reservedAt, lastFailure time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.logins[key]
+	if ok && a.Failures > 0 {
+		a.Failures--
+		if a.LastFailure.Equal(reservedAt) {
+			a.LastFailure = lastFailure
+		}
+	}
+
+	return nil
+}
+
+func (s *StorageMem) LockLogin(key string, until time.Time, minFailures uint32) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.logins[key]
+	if !ok || a.Failures < minFailures {
+		return false, nil
+	}
+	a.Failures = 0
+	a.LockedUntil = until
+
+	return true, nil
+}
+
+func (s *StorageMem) ClearLoginAttempts(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.logins, key)
+
+	return nil
+}
+
+func (s *StorageMem) AddAPIKey(k *gophermart.APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[k.UserID]; !ok {
+		return gophermart.ErrUserNotFound
+	}
+	if _, ok := s.apiKeys[k.ID]; ok {
+		return fmt.Errorf("API key %s already exists", k.ID)
+	}
+	stored := *k
+	stored.Scopes = append([]string(nil), k.Scopes...)
+	stored.Key = ""
+	s.apiKeys[k.ID] = &stored
+
+	return nil
+}
+
+func (s *StorageMem) GetAPIKey(id string) (*gophermart.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	k, ok := s.apiKeys[id]
+	if !ok {
+		return nil, gophermart.ErrAPIKeyNotFound
+	}
+	key := *k
+
+	return &key, nil
+}
+
+func (s *StorageMem) GetUserAPIKeys(userID uint64) ([]*gophermart.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var keys []*gophermart.APIKey
+	for _, k := range s.apiKeys {
+		if k.UserID == userID {
+			key := *k
+			keys = append(keys, &key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.After(keys[j].CreatedAt)
+	})
+
+	return keys, nil
+}
+
+func (s *StorageMem) DeleteAPIKey(userID uint64, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k, ok := s.apiKeys[id]
+	if !ok || k.UserID != userID {
+		return gophermart.ErrAPIKeyNotFound
+	}
+	delete(s.apiKeys, id)
+
+	return nil
+}
+
+func (s *StorageMem) TouchAPIKey(id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k, ok := s.apiKeys[id]
+	if !ok {
+		return gophermart.ErrAPIKeyNotFound
+	}
+	k.LastUsedAt = at
+
+	return nil
+}
+
+func (s *StorageMem) AddSession(session *gophermart.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sessions[session.ID]; ok {
+		return fmt.Errorf("session already exists")
+	}
+
+	stored := gophermart.Session{
+		ID:         session.ID,
+		UserID:     session.UserID,
+		Generation: session.Generation,
+		CreatedAt:  session.CreatedAt,
+		Expiry:     session.Expiry,
+		LastSeenAt: session.LastSeenAt,
+		IP:         session.IP,
+		UserAgent:  session.UserAgent,
+	}
+	s.sessions[session.ID] = &stored
+
+	return nil
+}
+
+func (s *StorageMem) GetSession(id string) (*gophermart.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil, gophermart.ErrSessionNotFound
+	}
+	sn := *session
+
+	return &sn, nil
+}
+
+func (s *StorageMem) DeleteSession(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sessions[id]; !ok {
+		return gophermart.ErrSessionNotFound
+	}
+	delete(s.sessions, id)
+
+	return nil
+}
+
+func (s *StorageMem) RotateSession(id string, generation uint64, expiry time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok || session.Generation != generation {
+		return gophermart.ErrSessionNotFound
+	}
+	session.Generation++
+	session.Expiry = expiry
+
+	return nil
+}
+
+func (s *StorageMem) TouchSession(id, ip, userAgent string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return gophermart.ErrSessionNotFound
+	}
+	session.IP = ip
+	session.UserAgent = userAgent
+	session.LastSeenAt = at
+
+	return nil
+}
+
+func (s *StorageMem) GetUserSessions(userID uint64) ([]*gophermart.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	var sns []*gophermart.Session
+	for _, session := range s.sessions {
+		if session.UserID == userID && session.Expiry.After(now) {
+			sn := *session
+			sns = append(sns, &sn)
+		}
+	}
+	sort.Slice(sns, func(i, j int) bool {
+		return sns[i].LastSeenAt.After(sns[j].LastSeenAt)
+	})
+
+	return sns, nil
+}
+
+func (s *StorageMem) DeleteUserSessions(userID uint64) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ids []string
+	for id, session := range s.sessions {
+		if session.UserID == userID {
+			ids = append(ids, id)
+			delete(s.sessions, id)
+		}
+	}
+
+	return ids, nil
+}
+
+func (s *StorageMem) DeleteExpiredSessions(before time.Time, limit uint32) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ids []string
+	for id, session := range s.sessions {
+		if uint32(len(ids)) == limit {
+			break
+		}
+		if session.Expiry.Before(before) {
+			ids = append(ids, id)
+			delete(s.sessions, id)
+		}
+	}
+
+	return ids, nil
+}
+
+// PublishInvalidation calls the subscribers of every GopherMart sharing this
+// storage, which makes them behave like replicas.
+func (s *StorageMem) PublishInvalidation(key string) error {
+	s.mu.RLock()
+	fns := make([]func(string), 0, len(s.subscribers))
+	for _, fn := range s.subscribers {
+		fns = append(fns, fn)
+	}
+	s.mu.RUnlock()
+
+	for _, fn := range fns {
+		fn(key)
+	}
+
+	return nil
+}
+
+func (s *StorageMem) SubscribeInvalidations(ctx context.Context, fn func(key string)) error {
+	s.mu.Lock()
+	s.lastSubscriberID++
+	id := s.lastSubscriberID
+	s.subscribers[id] = fn
+	s.mu.Unlock()
+
+	fn("")
+	<-ctx.Done()
+
+	s.mu.Lock()
+	delete(s.subscribers, id)
+	s.mu.Unlock()
+
+	return ctx.Err()
+}
+
+func (s *StorageMem) AddOrder(o *gophermart.Order) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.orders[o.ID]; ok {
+		return gophermart.ErrOrderAlreadyLoadedByAnotherUser
+	}
+
+	stored := *o
+	stored.NextAttemptAt = time.Now()
+	s.orders[o.ID] = &stored
+
+	return nil
+}
+
+func (s *StorageMem) AddOrders(ors []*gophermart.Order) (map[uint64]uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	owners := make(map[uint64]uint64)
+	for _, o := range ors {
+		if stored, ok := s.orders[o.ID]; ok {
+			owners[o.ID] = stored.UserID
+			continue
+		}
+
+		stored := *o
+		stored.NextAttemptAt = time.Now()
+		s.orders[o.ID] = &stored
+	}
+
+	return owners, nil
+}
+
+func (s *StorageMem) GetOrder(orderID uint64) (*gophermart.Order, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	o, ok := s.orders[orderID]
+	if !ok {
+		return nil, gophermart.ErrOrderNotFound
+	}
+	order := *o
+
+	return &order, nil
+}
+
+func (s *StorageMem) LeaseOrders(owner string, limit uint32, ttl time.Duration) (map[uint64]*gophermart.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	var pending []*gophermart.Order
+	for _, o := range s.orders {
+		if o.Status != gophermart.StatusNew && o.Status != gophermart.StatusProcessing {
+			continue
+		}
+		if !o.ParkedAt.IsZero() || o.NextAttemptAt.After(now) {
+			continue
+		}
+		if l, ok := s.leases[o.ID]; ok && l.until.After(now) {
+			continue
+		}
+		pending = append(pending, o)
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].NextAttemptAt.Before(pending[j].NextAttemptAt)
+	})
+
+	orders := make(map[uint64]*gophermart.Order)
+	for _, o := range pending {
+		if uint32(len(orders)) >= limit {
+			break
+		}
+		s.leases[o.ID] = lease{owner: owner, until: now.Add(ttl)}
+		order := *o
+		orders[o.ID] = &order
+	}
+
+	return orders, nil
+}
+
+func (s *StorageMem) GetUserOrders(userID uint64) ([]*gophermart.Order, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var orders []*gophermart.Order
+	for _, o := range s.orders {
+		if o.UserID == userID {
+			order := *o
+			orders = append(orders, &order)
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool {
+		return orders[i].UploadedAt.Before(orders[j].UploadedAt)
+	})
+
+	return orders, nil
+}
+
+func (s *StorageMem) UpdateOrder(o *gophermart.Order) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.orders[o.ID]
+	if !ok {
+		return fmt.Errorf("failed to update order - order not found")
+	}
+	if stored.Status == gophermart.StatusProcessed || stored.Status == gophermart.StatusInvalid {
+		return gophermart.ErrOrderFinalized
+	}
+
+	if o.Status == gophermart.StatusProcessed && o.Accrual > 0 {
+		b, ok := s.balances[stored.UserID]
+		if !ok {
+			return fmt.Errorf("failed to update user balance - user balance not found")
+		}
+
+		current, err := b.Current.Add(o.Accrual)
+		if err != nil {
+			return fmt.Errorf("failed to update user balance - %w", err)
+		}
+
+		credited := *stored
+		credited.Accrual = o.Accrual
+		err = s.addLedgerEntries(gophermart.NewAccrualEntries(&credited, time.Now()))
+		if err != nil {
+			return err
+		}
+		b.Current = current
+	}
+
+	stored.Status = o.Status
+	stored.Accrual = o.Accrual
+	delete(s.leases, o.ID)
+
+	return nil
+}
+
+func (s *StorageMem) RescheduleOrder(o *gophermart.Order) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.orders[o.ID]
+	if !ok {
+		return fmt.Errorf("failed to reschedule order - order not found")
+	}
+	if stored.Status == gophermart.StatusProcessed || stored.Status == gophermart.StatusInvalid {
+		return gophermart.ErrOrderFinalized
+	}
+
+	stored.Attempts = o.Attempts
+	stored.NextAttemptAt = o.NextAttemptAt
+	stored.ParkedAt = o.ParkedAt
+	stored.LastError = o.LastError
+	delete(s.leases, o.ID)
+
+	return nil
+}
+
+func (s *StorageMem) GetParkedOrders(limit uint32) ([]*gophermart.Order, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var parked []*gophermart.Order
+	for _, o := range s.orders {
+		if !o.ParkedAt.IsZero() {
+			order := *o
+			parked = append(parked, &order)
+		}
+	}
+	sort.Slice(parked, func(i, j int) bool {
+		return parked[i].ParkedAt.Before(parked[j].ParkedAt)
+	})
+	if uint32(len(parked)) > limit {
+		parked = parked[:limit]
+	}
+
+	return parked, nil
+}
+
+func (s *StorageMem) RequeueOrder(orderID uint64, e *gophermart.AuditEntry, chain bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.orders[orderID]
+	if !ok {
+		return fmt.Errorf("failed to requeue order - order not found")
+	}
+	if stored.Status == gophermart.StatusProcessed || stored.Status == gophermart.StatusInvalid {
+		return gophermart.ErrOrderFinalized
+	}
+
+	stored.Attempts = 0
+	stored.NextAttemptAt = time.Now()
+	stored.ParkedAt = time.Time{}
+	stored.LastError = ""
+	delete(s.leases, orderID)
+	if e != nil {
+		s.addAuditEntry(e, chain)
+	}
+
+	return nil
+}
+
+func (s *StorageMem) GetBalance(userID uint64) (gophermart.Balance, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	b, ok := s.balances[userID]
+	if !ok {
+		return gophermart.Balance{}, fmt.Errorf("user balance not found")
+	}
+
+	return *b, nil
+}
+
+func (s *StorageMem) AddWithdraw(withdraw *gophermart.Withdraw) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.balances[withdraw.UserID]
+	if !ok {
+		return fmt.Errorf("user balance not found")
+	}
+	if b.Current < withdraw.Sum {
+		return gophermart.ErrNotEnoughFunds
+	}
+	if _, ok = s.withdrawals[withdraw.OrderID]; ok {
+		return fmt.Errorf("withdraw already recorded by another user")
+	}
+
+	withdrawn, err := b.Withdrawn.Add(withdraw.Sum)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	err = s.addLedgerEntries(gophermart.NewWithdrawalEntries(withdraw, now))
+	if err != nil {
+		return err
+	}
+
+	stored := *withdraw
+	stored.ProcessedAt = now
+	s.withdrawals[withdraw.OrderID] = &stored
+
+	b.Current -= withdraw.Sum
+	b.Withdrawn = withdrawn
+
+	return nil
+}
+
+func (s *StorageMem) GetUserWithdrawals(userID uint64) ([]*gophermart.Withdraw, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var ws []*gophermart.Withdraw
+	for _, w := range s.withdrawals {
+		if w.UserID == userID {
+			withdraw := *w
+			ws = append(ws, &withdraw)
+		}
+	}
+	sort.Slice(ws, func(i, j int) bool {
+		return ws[i].ProcessedAt.After(ws[j].ProcessedAt)
+	})
+
+	return ws, nil
+}
+
+func (s *StorageMem) GetOrderWithdrawals(orderID uint64) (*gophermart.Withdraw, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	w, ok := s.withdrawals[orderID]
+	if !ok {
+		return nil, fmt.Errorf("order not found")
+	}
+	withdraw := *w
+
+	return &withdraw, nil
+}
+
+func (s *StorageMem) AdjustBalance(adj *gophermart.Adjustment, e *gophermart.AuditEntry, chain bool) (gophermart.Balance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.balances[adj.UserID]
+	if !ok {
+		return gophermart.Balance{}, gophermart.ErrUserNotFound
+	}
+
+	current := b.Current
+	var err error
+	if adj.Direction == gophermart.DirectionDebit {
+		if current < adj.Amount {
+			return gophermart.Balance{}, gophermart.ErrNotEnoughFunds
+		}
+		current -= adj.Amount
+	} else {
+		current, err = current.Add(adj.Amount)
+		if err != nil {
+			return gophermart.Balance{}, err
+		}
+	}
+
+	err = s.addLedgerEntries(gophermart.NewAdjustmentEntries(adj, adj.CreatedAt))
+	if err != nil {
+		return gophermart.Balance{}, err
+	}
+	before := *b
+	b.Current = current
+	if e != nil {
+		e.SetBalances(before, *b)
+		s.addAuditEntry(e, chain)
+	}
+
+	return *b, nil
+}
+
+func (s *StorageMem) GetLedgerEntries(userID uint64, until time.Time) ([]*gophermart.LedgerEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	account := gophermart.UserAccount(userID)
+
+	var entries []*gophermart.LedgerEntry
+	for _, e := range s.ledger {
+		if e.Account == account && e.CreatedAt.Before(until) {
+			entry := *e
+			entries = append(entries, &entry)
+		}
+	}
+
+	return entries, nil
+}
+
+func (s *StorageMem) GetLedgerPage(userID uint64, afterAt time.Time, afterID uint64, until time.Time, limit uint32) ([]*gophermart.LedgerEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	account := gophermart.UserAccount(userID)
+
+	var entries []*gophermart.LedgerEntry
+	for _, e := range s.ledger {
+		if e.Account != account || !e.CreatedAt.Before(until) || e.CreatedAt.Before(afterAt) ||
+			(e.CreatedAt.Equal(afterAt) && e.ID <= afterID) {
+			continue
+		}
+		entry := *e
+		entries = append(entries, &entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].CreatedAt.Equal(entries[j].CreatedAt) {
+			return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+		}
+		return entries[i].ID < entries[j].ID
+	})
+	if uint32(len(entries)) > limit {
+		entries = entries[:limit]
+	}
+
+	return entries, nil
+}
+
+func (s *StorageMem) GetLedgerTotals(userID uint64, before time.Time) (gophermart.Money, gophermart.Money, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	account := gophermart.UserAccount(userID)
+
+	var credits, debits gophermart.Money
+	var err error
+	for _, e := range s.ledger {
+		if e.Account != account || !e.CreatedAt.Before(before) {
+			continue
+		}
+		if e.Direction == gophermart.DirectionCredit {
+			credits, err = credits.Add(e.Amount)
+		} else {
+			debits, err = debits.Add(e.Amount)
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	return credits, debits, nil
+}
+
+func (s *StorageMem) addLedgerEntries(entries []*gophermart.LedgerEntry) error {
+	for _, e := range entries {
+		if _, ok := s.posted[e.Kind+"/"+e.Ref+"/"+e.Account]; ok {
+			return fmt.Errorf("failed to insert ledger entry - %s %s already posted to %s", e.Kind, e.Ref, e.Account)
+		}
+	}
+
+	for _, e := range entries {
+		s.posted[e.Kind+"/"+e.Ref+"/"+e.Account] = struct{}{}
+		s.lastEntryID++
+		e.ID = s.lastEntryID
+		s.ledger = append(s.ledger, e)
+	}
+
+	return nil
+}
+
+func copyBulkJob(j *gophermart.BulkJob) *gophermart.BulkJob {
+	c := *j
+	c.Results = append([]gophermart.BulkResult(nil), j.Results...)
+
+	return &c
+}
+
+func (s *StorageMem) AddBulkJob(j *gophermart.BulkJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.bulkJobs[j.ID] = copyBulkJob(j)
+
+	return nil
+}
+
+func (s *StorageMem) UpdateBulkJob(j *gophermart.BulkJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.bulkJobs[j.ID]; !ok {
+		return gophermart.ErrBulkJobNotFound
+	}
+	s.bulkJobs[j.ID] = copyBulkJob(j)
+
+	return nil
+}
+
+func (s *StorageMem) GetBulkJob(id string) (*gophermart.BulkJob, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	j, ok := s.bulkJobs[id]
+	if !ok {
+		return nil, gophermart.ErrBulkJobNotFound
+	}
+
+	return copyBulkJob(j), nil
+}
+
+func (s *StorageMem) ClaimBulkJobs(staleBefore, now time.Time, limit uint32) ([]*gophermart.BulkJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var jobs []*gophermart.BulkJob
+	for _, j := range s.bulkJobs {
+		if j.Status != gophermart.BulkJobPending && j.Status != gophermart.BulkJobRunning || !j.UpdatedAt.Before(staleBefore) {
+			continue
+		}
+		jobs = append(jobs, j)
+	}
+	sort.Slice(jobs, func(i, k int) bool {
+		return jobs[i].UpdatedAt.Before(jobs[k].UpdatedAt)
+	})
+	if uint32(len(jobs)) > limit {
+		jobs = jobs[:limit]
+	}
+
+	claimed := make([]*gophermart.BulkJob, 0, len(jobs))
+	for _, j := range jobs {
+		j.UpdatedAt = now
+		claimed = append(claimed, copyBulkJob(j))
+	}
+
+	return claimed, nil
+}
+
+func (s *StorageMem) AddNonce(nonce string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for n, exp := range s.nonces {
+		if exp.Before(now) {
+			delete(s.nonces, n)
+		}
+	}
+
+	if _, ok := s.nonces[nonce]; ok {
+		return gophermart.ErrNonceReused
+	}
+	s.nonces[nonce] = expiresAt
+
+	return nil
+}
+
+func idempotencyID(userID uint64, key string) string {
+	return fmt.Sprintf("%d/%s", userID, key)
+}
+
+func (s *StorageMem) AddIdempotencyKey(k *gophermart.IdempotencyKey) (*gophermart.IdempotencyKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := idempotencyID(k.UserID, k.Key)
+	if stored, ok := s.idempotency[id]; ok && stored.ExpiresAt.After(k.CreatedAt) {
+		found := *stored
+		return &found, gophermart.ErrIdempotencyKeyExists
+	}
+
+	stored := *k
+	s.idempotency[id] = &stored
+
+	return k, nil
+}
+
+func (s *StorageMem) SaveIdempotencyKey(k *gophermart.IdempotencyKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := idempotencyID(k.UserID, k.Key)
+	if _, ok := s.idempotency[id]; !ok {
+		return gophermart.ErrIdempotencyKeyNotFound
+	}
+
+	stored := *k
+	s.idempotency[id] = &stored
+
+	return nil
+}
+
+func (s *StorageMem) DeleteIdempotencyKey(userID uint64, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.idempotency, idempotencyID(userID, key))
+
+	return nil
+}
+
+func (s *StorageMem) DeleteIdempotencyKeysBefore(before time.Time, limit uint32) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	for id, k := range s.idempotency {
+		if n == int64(limit) {
+			break
+		}
+		if !k.ExpiresAt.After(before) {
+			delete(s.idempotency, id)
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+func (s *StorageMem) AddAuditEntry(e *gophermart.AuditEntry, chain bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.addAuditEntry(e, chain)
+
+	return nil
+}
+
+// addAuditEntry appends the entry, the caller holds the lock.
+func (s *StorageMem) addAuditEntry(e *gophermart.AuditEntry, chain bool) {
+	if chain {
+		e.PrevHash = ""
+		if len(s.audit) > 0 {
+			e.PrevHash = s.audit[len(s.audit)-1].Hash
+		}
+		e.Hash = e.ComputeHash(e.PrevHash)
+	}
+
+	s.lastAuditID++
+	e.ID = s.lastAuditID
+	stored := *e
+	s.audit = append(s.audit, &stored)
+}
+
+func (s *StorageMem) GetAuditEntries(f gophermart.AuditFilter) ([]*gophermart.AuditEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var es []*gophermart.AuditEntry
+	for i := len(s.audit) - 1; i >= 0 && uint32(len(es)) < f.Limit; i-- {
+		e := s.audit[i]
+		if !auditEntryMatches(e, f) {
+			continue
+		}
+		entry := *e
+		es = append(es, &entry)
+	}
+
+	return es, nil
+}
+
+func auditEntryMatches(e *gophermart.AuditEntry, f gophermart.AuditFilter) bool {
+	switch {
+	case f.Action != "" && e.Action != f.Action && !(strings.HasSuffix(f.Action, ".") && strings.HasPrefix(e.Action, f.Action)):
+		return false
+	case f.ActorID != 0 && e.ActorID != f.ActorID:
+		return false
+	case f.TargetUserID != 0 && e.TargetUserID != f.TargetUserID:
+		return false
+	case f.Target != "" && e.Target != f.Target:
+		return false
+	case f.IP != "" && e.IP != f.IP:
+		return false
+	case f.RequestID != "" && e.RequestID != f.RequestID:
+		return false
+	case !f.Since.IsZero() && e.CreatedAt.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !e.CreatedAt.Before(f.Until):
+		return false
+	case f.BeforeID != 0 && e.ID >= f.BeforeID:
+		return false
+	}
+
+	return true
+}
+
+// listItem is what the lists filter and sort orders and withdrawals by.
+type listItem struct {
+	orderID uint64
+	status  string
+	at      time.Time
+	amount  gophermart.Money
+}
+
+func (it listItem) key(sort string) int64 {
+	if strings.HasSuffix(sort, "_at") {
+		return it.at.UnixNano()
+	}
+
+	return int64(it.amount)
+}
+
+// compare orders the items ascending by the sort key and order number.
+func (it listItem) compare(key int64, orderID uint64, sort string) int {
+	k := it.key(sort)
+	switch {
+	case k < key:
+		return -1
+	case k > key:
+		return 1
+	case it.orderID < orderID:
+		return -1
+	case it.orderID > orderID:
+		return 1
+	}
+
+	return 0
+}
+
+func (it listItem) less(o listItem, sort string) bool {
+	c := it.compare(o.key(sort), o.orderID, sort)
+	if gophermart.IsDesc(sort) {
+		return c > 0
+	}
+
+	return c < 0
+}
+
+func (it listItem) matches(q gophermart.ListQuery) bool {
+	switch {
+	case len(q.Statuses) != 0 && !containsString(q.Statuses, strings.TrimSpace(it.status)):
+		return false
+	case !q.From.IsZero() && it.at.Before(q.From):
+		return false
+	case !q.To.IsZero() && !it.at.Before(q.To):
+		return false
+	case q.MinAmount != 0 && it.amount < q.MinAmount:
+		return false
+	case q.MaxAmount != 0 && it.amount > q.MaxAmount:
+		return false
+	case q.After == nil:
+		return true
+	}
+
+	c := it.compare(q.After.Key, q.After.OrderID, q.Sort)
+	if gophermart.IsDesc(q.Sort) {
+		return c < 0
+	}
+
+	return c > 0
+}
+
+func containsString(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *StorageMem) FindUserOrders(q gophermart.ListQuery) ([]*gophermart.Order, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var orders []*gophermart.Order
+	for _, o := range s.orders {
+		if o.UserID == q.UserID && orderListItem(o).matches(q) {
+			order := *o
+			orders = append(orders, &order)
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool {
+		return orderListItem(orders[i]).less(orderListItem(orders[j]), q.Sort)
+	})
+	if uint32(len(orders)) > q.Limit {
+		orders = orders[:q.Limit]
+	}
+
+	return orders, nil
+}
+
+func orderListItem(o *gophermart.Order) listItem {
+	return listItem{orderID: o.ID, status: o.Status, at: o.UploadedAt, amount: o.Accrual}
+}
+
+func (s *StorageMem) FindUserWithdrawals(q gophermart.ListQuery) ([]*gophermart.Withdraw, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var ws []*gophermart.Withdraw
+	for _, w := range s.withdrawals {
+		if w.UserID == q.UserID && withdrawListItem(w).matches(q) {
+			withdraw := *w
+			ws = append(ws, &withdraw)
+		}
+	}
+	sort.Slice(ws, func(i, j int) bool {
+		return withdrawListItem(ws[i]).less(withdrawListItem(ws[j]), q.Sort)
+	})
+	if uint32(len(ws)) > q.Limit {
+		ws = ws[:q.Limit]
+	}
+
+	return ws, nil
+}
+
+func withdrawListItem(w *gophermart.Withdraw) listItem {
+	return listItem{orderID: w.OrderID, at: w.ProcessedAt, amount: w.Sum}
+}
+
+func (s *StorageMem) AddUserEvent(e *gophermart.UserEvent) error {
+	s.mu.Lock()
+	s.lastEventID++
+	e.ID = s.lastEventID
+	stored := *e
+	s.events = append(s.events, &stored)
+
+	fns := make([]func(uint64), 0, len(s.eventSubscribers))
+	for _, fn := range s.eventSubscribers {
+		fns = append(fns, fn)
+	}
+	s.mu.Unlock()
+
+	for _, fn := range fns {
+		fn(e.UserID)
+	}
+
+	return nil
+}
+
+func (s *StorageMem) GetUserEvents(userID, afterID uint64, limit uint32) ([]*gophermart.UserEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var es []*gophermart.UserEvent
+	for _, e := range s.events {
+		if uint32(len(es)) >= limit {
+			break
+		}
+		if e.UserID == userID && e.ID > afterID {
+			event := *e
+			es = append(es, &event)
+		}
+	}
+
+	return es, nil
+}
+
+func (s *StorageMem) GetLastUserEventID(userID uint64) (uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for i := len(s.events) - 1; i >= 0; i-- {
+		if s.events[i].UserID == userID {
+			return s.events[i].ID, nil
+		}
+	}
+
+	return 0, nil
+}
+
+func (s *StorageMem) DeleteUserEventsBefore(before time.Time, limit uint32) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	kept := s.events[:0]
+	for _, e := range s.events {
+		if n < int64(limit) && e.CreatedAt.Before(before) {
+			n++
+			continue
+		}
+		kept = append(kept, e)
+	}
+	s.events = kept
+
+	return n, nil
+}
+
+// SubscribeUserEvents calls fn on events added by every GopherMart sharing
+// this storage.
+func (s *StorageMem) SubscribeUserEvents(ctx context.Context, fn func(userID uint64)) error {
+	s.mu.Lock()
+	s.lastSubscriberID++
+	id := s.lastSubscriberID
+	s.eventSubscribers[id] = fn
+	s.mu.Unlock()
+
+	fn(0)
+	<-ctx.Done()
+
+	s.mu.Lock()
+	delete(s.eventSubscribers, id)
+	s.mu.Unlock()
+
+	return ctx.Err()
+}
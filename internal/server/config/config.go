@@ -4,12 +4,66 @@ import (
 	"flag"
 	"github.com/caarlos0/env"
 	"log"
+	"time"
 )
 
 type Config struct {
 	Addr                 string `env:"RUN_ADDRESS"`
 	DatabaseURI          string `env:"DATABASE_URI"`
 	AccrualSystemAddress string `env:"ACCRUAL_SYSTEM_ADDRESS"`
+
+	AccrualRetryBase   time.Duration `env:"ACCRUAL_RETRY_BASE"`
+	AccrualRetryMax    time.Duration `env:"ACCRUAL_RETRY_MAX"`
+	AccrualMaxAttempts uint          `env:"ACCRUAL_MAX_ATTEMPTS"`
+	AccrualMaxOrderAge time.Duration `env:"ACCRUAL_MAX_ORDER_AGE"`
+
+	AccrualWorkers          int           `env:"ACCRUAL_WORKERS"`
+	AccrualRateLimit        float64       `env:"ACCRUAL_RATE_LIMIT"`
+	AccrualBreakerThreshold uint          `env:"ACCRUAL_BREAKER_THRESHOLD"`
+	AccrualBreakerCooldown  time.Duration `env:"ACCRUAL_BREAKER_COOLDOWN"`
+
+	AccrualCallbackSecret string        `env:"ACCRUAL_CALLBACK_SECRET"`
+	AccrualCallbackWindow time.Duration `env:"ACCRUAL_CALLBACK_WINDOW"`
+
+	IdempotencyRetention time.Duration `env:"IDEMPOTENCY_RETENTION"`
+
+	TokenKeys       string        `env:"TOKEN_KEYS"`
+	AccessTokenTTL  time.Duration `env:"ACCESS_TOKEN_TTL"`
+	RefreshTokenTTL time.Duration `env:"REFRESH_TOKEN_TTL"`
+
+	SessionCacheSize    int           `env:"SESSION_CACHE_SIZE"`
+	UserCacheSize       int           `env:"USER_CACHE_SIZE"`
+	CacheTTL            time.Duration `env:"CACHE_TTL"`
+	SessionReapInterval time.Duration `env:"SESSION_REAP_INTERVAL"`
+	SessionReapBatch    uint          `env:"SESSION_REAP_BATCH"`
+
+	TOTPIssuer            string        `env:"TOTP_ISSUER"`
+	TOTPWithdrawThreshold string        `env:"TOTP_WITHDRAW_THRESHOLD"`
+	TOTPChallengeTTL      time.Duration `env:"TOTP_CHALLENGE_TTL"`
+
+	LoginWindow       time.Duration `env:"LOGIN_WINDOW"`
+	LoginFreeAttempts uint          `env:"LOGIN_FREE_ATTEMPTS"`
+	LoginBaseDelay    time.Duration `env:"LOGIN_BASE_DELAY"`
+	LoginMaxDelay     time.Duration `env:"LOGIN_MAX_DELAY"`
+	LoginLockAfter    uint          `env:"LOGIN_LOCK_AFTER"`
+	LoginLockAfterIP  uint          `env:"LOGIN_LOCK_AFTER_IP"`
+	LoginLockFor      time.Duration `env:"LOGIN_LOCK_FOR"`
+
+	PasswordHash      string `env:"PASSWORD_HASH"`
+	Argon2Memory      uint   `env:"ARGON2_MEMORY"`
+	Argon2Time        uint   `env:"ARGON2_TIME"`
+	Argon2Threads     uint   `env:"ARGON2_THREADS"`
+	BcryptCost        int    `env:"BCRYPT_COST"`
+	PasswordMinLength int    `env:"PASSWORD_MIN_LENGTH"`
+	PasswordMaxLength int    `env:"PASSWORD_MAX_LENGTH"`
+
+	AuditHashChain bool `env:"AUDIT_HASH_CHAIN"`
+
+	EventRetention time.Duration `env:"EVENT_RETENTION"`
+
+	BulkMaxOrders   int           `env:"BULK_MAX_ORDERS"`
+	BulkSyncLimit   int           `env:"BULK_SYNC_LIMIT"`
+	BulkResumeAfter time.Duration `env:"BULK_RESUME_AFTER"`
 }
 
 func ParseConfig() (Config, error) {
@@ -17,6 +71,47 @@ func ParseConfig() (Config, error) {
 	flag.StringVar(&cfg.Addr, "a", ":8080", "Service run address")
 	flag.StringVar(&cfg.DatabaseURI, "d", "", "Postgres URI")
 	flag.StringVar(&cfg.AccrualSystemAddress, "r", "http://localhost:8081", "Accrual system address")
+	flag.DurationVar(&cfg.AccrualRetryBase, "accrual-retry-base", time.Second, "Delay before the second accrual poll of an order")
+	flag.DurationVar(&cfg.AccrualRetryMax, "accrual-retry-max", time.Hour, "Maximum delay between accrual polls of an order")
+	flag.UintVar(&cfg.AccrualMaxAttempts, "accrual-max-attempts", 30, "Accrual polls before an order is parked, 0 for no limit")
+	flag.DurationVar(&cfg.AccrualMaxOrderAge, "accrual-max-order-age", 7*24*time.Hour, "Order age after which it is parked, 0 for no limit")
+	flag.IntVar(&cfg.AccrualWorkers, "accrual-workers", 10, "Concurrent requests to the accrual system")
+	flag.Float64Var(&cfg.AccrualRateLimit, "accrual-rate-limit", 0, "Requests per second to the accrual system, 0 until it asks to slow down")
+	flag.UintVar(&cfg.AccrualBreakerThreshold, "accrual-breaker-threshold", 5, "Consecutive accrual failures that open the circuit breaker")
+	flag.DurationVar(&cfg.AccrualBreakerCooldown, "accrual-breaker-cooldown", 30*time.Second, "Time the circuit breaker stays open before a probe")
+	flag.StringVar(&cfg.AccrualCallbackSecret, "accrual-callback-secret", "", "Secret the accrual system signs callbacks with, callbacks are disabled if empty")
+	flag.DurationVar(&cfg.AccrualCallbackWindow, "accrual-callback-window", 5*time.Minute, "Maximum clock difference accepted for accrual callbacks")
+	flag.DurationVar(&cfg.IdempotencyRetention, "idempotency-retention", 24*time.Hour, "Time responses to requests with an Idempotency-Key are kept")
+	flag.StringVar(&cfg.TokenKeys, "token-keys", "", "Token signing keys as kid:secret,kid:secret, the first one signs; random if empty")
+	flag.DurationVar(&cfg.AccessTokenTTL, "access-token-ttl", 15*time.Minute, "Access token lifetime")
+	flag.DurationVar(&cfg.RefreshTokenTTL, "refresh-token-ttl", 30*24*time.Hour, "Session lifetime, extended by every refresh")
+	flag.IntVar(&cfg.SessionCacheSize, "session-cache-size", 10000, "Sessions kept in memory")
+	flag.IntVar(&cfg.UserCacheSize, "user-cache-size", 10000, "Users kept in memory")
+	flag.DurationVar(&cfg.CacheTTL, "cache-ttl", 5*time.Minute, "Time a cached session or user is trusted")
+	flag.DurationVar(&cfg.SessionReapInterval, "session-reap-interval", 10*time.Minute, "Interval between deletions of expired sessions")
+	flag.UintVar(&cfg.SessionReapBatch, "session-reap-batch", 1000, "Expired sessions deleted per statement")
+	flag.StringVar(&cfg.TOTPIssuer, "totp-issuer", "Gophermart", "Issuer shown by authenticator apps")
+	flag.StringVar(&cfg.TOTPWithdrawThreshold, "totp-withdraw-threshold", "0", "Withdrawals above this sum need a TOTP code from users with TOTP enabled")
+	flag.DurationVar(&cfg.TOTPChallengeTTL, "totp-challenge-ttl", 5*time.Minute, "Time to enter the TOTP code after the password")
+	flag.DurationVar(&cfg.LoginWindow, "login-window", 15*time.Minute, "Time failed logins are remembered")
+	flag.UintVar(&cfg.LoginFreeAttempts, "login-free-attempts", 3, "Failed logins before attempts are delayed")
+	flag.DurationVar(&cfg.LoginBaseDelay, "login-base-delay", time.Second, "First delay between failed logins, doubled every next failure")
+	flag.DurationVar(&cfg.LoginMaxDelay, "login-max-delay", 30*time.Second, "Maximum delay between failed logins")
+	flag.UintVar(&cfg.LoginLockAfter, "login-lock-after", 10, "Failed logins that lock a login")
+	flag.UintVar(&cfg.LoginLockAfterIP, "login-lock-after-ip", 100, "Failed logins that lock a client IP")
+	flag.DurationVar(&cfg.LoginLockFor, "login-lock-for", 15*time.Minute, "Lockout duration")
+	flag.StringVar(&cfg.PasswordHash, "password-hash", "argon2id", "Algorithm of new password hashes, argon2id or bcrypt")
+	flag.UintVar(&cfg.Argon2Memory, "argon2-memory", 19*1024, "Argon2id memory in KiB")
+	flag.UintVar(&cfg.Argon2Time, "argon2-time", 2, "Argon2id iterations")
+	flag.UintVar(&cfg.Argon2Threads, "argon2-threads", 1, "Argon2id parallelism")
+	flag.IntVar(&cfg.BcryptCost, "bcrypt-cost", 10, "Bcrypt cost")
+	flag.IntVar(&cfg.PasswordMinLength, "password-min-length", 8, "Minimum password length in characters")
+	flag.IntVar(&cfg.PasswordMaxLength, "password-max-length", 72, "Maximum password length in bytes, bcrypt ignores anything past 72")
+	flag.BoolVar(&cfg.AuditHashChain, "audit-hash-chain", false, "Chain audit log entries by hash to make tampering evident")
+	flag.DurationVar(&cfg.EventRetention, "event-retention", 24*time.Hour, "Time order and balance events are kept for streams to resume from")
+	flag.IntVar(&cfg.BulkMaxOrders, "bulk-max-orders", 10000, "Maximum order numbers in one bulk upload")
+	flag.IntVar(&cfg.BulkSyncLimit, "bulk-sync-limit", 100, "Largest bulk upload answered right away, larger ones run as jobs")
+	flag.DurationVar(&cfg.BulkResumeAfter, "bulk-resume-after", time.Minute, "Time an unfinished bulk job may go unsaved before it is resumed")
 	flag.Parse()
 
 	err := env.Parse(cfg)
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/Osselnet/gophermart.git/internal/server/middleware/auth"
+	"net/http"
+)
+
+type passwordChangeRequest struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
+
+type accountDeleteRequest struct {
+	Password       string `json:"password"`
+	ForfeitBalance bool   `json:"forfeit_balance"`
+}
+
+func (h *handler) changePassword(w http.ResponseWriter, r *http.Request) {
+	c := h.getSessionFromReqContext(r)
+	if c == nil {
+		return
+	}
+
+	var req passwordChangeRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.error(w, r, fmt.Errorf("failed to unmarshal body - %w", err), http.StatusBadRequest)
+		return
+	}
+
+	ids, err := h.gm.ChangePassword(c.UserID, c.ID, req.OldPassword, req.NewPassword, auth.ClientFromRequest(r))
+	if err != nil {
+		if h.accountError(w, r, err) {
+			return
+		}
+		if errors.Is(err, gophermart.ErrPasswordWeak) {
+			h.error(w, r, err, http.StatusUnprocessableEntity)
+			return
+		}
+		h.error(w, r, fmt.Errorf("failed to change password - %w", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	h.log(r, LogLvlInfo, fmt.Sprintf("password of user %d changed, %d other sessions revoked", c.UserID, len(ids)))
+}
+
+func (h *handler) deleteAccount(w http.ResponseWriter, r *http.Request) {
+	c := h.getSessionFromReqContext(r)
+	if c == nil {
+		return
+	}
+
+	var req accountDeleteRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.error(w, r, fmt.Errorf("failed to unmarshal body - %w", err), http.StatusBadRequest)
+		return
+	}
+
+	err = h.gm.DeleteAccount(c.UserID, req.Password, req.ForfeitBalance, auth.ClientFromRequest(r))
+	if err != nil {
+		if h.accountError(w, r, err) {
+			return
+		}
+		if errors.Is(err, gophermart.ErrBalanceNotEmpty) {
+			h.error(w, r, fmt.Errorf("%w, set forfeit_balance to delete the account anyway", err), http.StatusConflict)
+			return
+		}
+		h.error(w, r, fmt.Errorf("failed to delete account - %w", err), http.StatusInternalServerError)
+		return
+	}
+
+	h.clearAuthCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+	h.log(r, LogLvlInfo, fmt.Sprintf("user %d deleted", c.UserID))
+}
+
+// accountError answers the errors of a password confirmation. A wrong password
+// is 403 rather than 401, the session itself is still valid.
+func (h *handler) accountError(w http.ResponseWriter, r *http.Request, err error) bool {
+	if h.loginThrottled(w, r, err) {
+		return true
+	}
+	if errors.Is(err, gophermart.ErrInvalidPair) {
+		h.error(w, r, err, http.StatusForbidden)
+		return true
+	}
+
+	return false
+}
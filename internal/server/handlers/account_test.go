@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/Osselnet/gophermart.git/internal/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAccount(t *testing.T) {
+	gm := gophermart.New(memory.New())
+	h := New(gm)
+
+	creds := &gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}
+	phone, err := gm.Register(creds, gophermart.Client{})
+	require.NoError(t, err)
+	laptop, err := gm.Login(creds, "", gophermart.Client{})
+	require.NoError(t, err)
+
+	send := func(method, url, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", ContentTypeApplicationJSON)
+		w := httptest.NewRecorder()
+		h.GetRouter().ServeHTTP(w, req)
+		return w
+	}
+
+	w := send(http.MethodPost, "/api/user/password", phone.Token, `{"old_password":"wrongPass","new_password":"N3wPassw0rd"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = send(http.MethodPost, "/api/user/password", phone.Token, `{"old_password":"Passw0rd33","new_password":"short"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	w = send(http.MethodPost, "/api/user/password", phone.Token, `{"old_password":"Passw0rd33","new_password":"N3wPassw0rd"}`)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	assert.Equal(t, http.StatusOK, send(http.MethodGet, "/api/user/welcome", phone.Token, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, send(http.MethodGet, "/api/user/welcome", laptop.Token, "").Code,
+		"other sessions are revoked")
+
+	w = send(http.MethodDelete, "/api/user", phone.Token, `{"password":"Passw0rd33"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code, "old password no longer works")
+	w = send(http.MethodDelete, "/api/user", phone.Token, `{"password":"N3wPassw0rd"}`)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, http.StatusUnauthorized, send(http.MethodGet, "/api/user/welcome", phone.Token, "").Code)
+}
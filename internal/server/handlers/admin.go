@@ -0,0 +1,524 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/Osselnet/gophermart.git/internal/server/middleware/auth"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type adminUserProxy struct {
+	ID          uint64 `json:"id"`
+	Login       string `json:"login"`
+	Role        string `json:"role"`
+	TOTPEnabled bool   `json:"totp_enabled"`
+}
+
+// adminOrderProxy shows the polling state as well, so staff can tell why an
+// order is stuck.
+type adminOrderProxy struct {
+	Number        string           `json:"number"`
+	Status        string           `json:"status"`
+	Accrual       gophermart.Money `json:"accrual,omitempty"`
+	UploadedAt    string           `json:"uploaded_at"`
+	Attempts      uint32           `json:"attempts"`
+	NextAttemptAt string           `json:"next_attempt_at,omitempty"`
+	ParkedAt      string           `json:"parked_at,omitempty"`
+	LastError     string           `json:"last_error,omitempty"`
+}
+
+type adminBalanceProxy struct {
+	Current   gophermart.Money `json:"current"`
+	Withdrawn gophermart.Money `json:"withdrawn"`
+}
+
+type ledgerEntryProxy struct {
+	ID        uint64           `json:"id"`
+	TxID      string           `json:"tx_id"`
+	Direction string           `json:"direction"`
+	Amount    gophermart.Money `json:"amount"`
+	Kind      string           `json:"kind"`
+	Ref       string           `json:"ref"`
+	CreatedAt string           `json:"created_at"`
+}
+
+type adjustmentRequest struct {
+	Direction string           `json:"direction"`
+	Amount    gophermart.Money `json:"amount"`
+	Reason    string           `json:"reason"`
+}
+
+type requeueRequest struct {
+	Reason string `json:"reason"`
+}
+
+type auditEntryProxy struct {
+	ID           uint64          `json:"id"`
+	CreatedAt    string          `json:"created_at"`
+	ActorID      uint64          `json:"actor_id"`
+	Action       string          `json:"action"`
+	TargetUserID uint64          `json:"target_user_id,omitempty"`
+	Target       string          `json:"target,omitempty"`
+	IP           string          `json:"ip,omitempty"`
+	RequestID    string          `json:"request_id,omitempty"`
+	Before       json.RawMessage `json:"before,omitempty"`
+	After        json.RawMessage `json:"after,omitempty"`
+	Details      json.RawMessage `json:"details"`
+	PrevHash     string          `json:"prev_hash,omitempty"`
+	Hash         string          `json:"hash,omitempty"`
+}
+
+type auditVerifyProxy struct {
+	Checked int `json:"checked"`
+}
+
+func newAdminUserProxy(u *gophermart.User) *adminUserProxy {
+	return &adminUserProxy{ID: u.ID, Login: u.Login, Role: u.Role, TOTPEnabled: u.TOTPEnabled()}
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.Format(time.RFC3339)
+}
+
+func (h *handler) adminSearchUsers(w http.ResponseWriter, r *http.Request) {
+	c := h.getSessionFromReqContext(r)
+	if c == nil {
+		return
+	}
+
+	limit, err := queryLimit(r)
+	if err != nil {
+		h.error(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	us, err := h.gm.Admin.SearchUsers(c.UserID, auth.ClientFromRequest(r), r.URL.Query().Get("q"), limit)
+	if err != nil {
+		h.error(w, r, fmt.Errorf("failed to search users - %w", err), http.StatusInternalServerError)
+		return
+	}
+
+	uPr := make([]*adminUserProxy, 0, len(us))
+	for _, u := range us {
+		uPr = append(uPr, newAdminUserProxy(u))
+	}
+
+	h.writeJSON(w, r, http.StatusOK, uPr)
+}
+
+func (h *handler) adminGetUser(w http.ResponseWriter, r *http.Request) {
+	c := h.getSessionFromReqContext(r)
+	if c == nil {
+		return
+	}
+	userID, ok := h.userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	u, err := h.gm.Admin.User(c.UserID, userID, auth.ClientFromRequest(r))
+	if errors.Is(err, gophermart.ErrUserNotFound) {
+		h.error(w, r, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.error(w, r, fmt.Errorf("failed to get user - %w", err), http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSON(w, r, http.StatusOK, newAdminUserProxy(u))
+}
+
+func (h *handler) adminGetOrders(w http.ResponseWriter, r *http.Request) {
+	c := h.getSessionFromReqContext(r)
+	if c == nil {
+		return
+	}
+	userID, ok := h.userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	ors, err := h.gm.Admin.Orders(c.UserID, userID, auth.ClientFromRequest(r))
+	if err != nil {
+		h.error(w, r, fmt.Errorf("failed to get orders - %w", err), http.StatusInternalServerError)
+		return
+	}
+
+	oPr := make([]*adminOrderProxy, 0, len(ors))
+	for _, o := range ors {
+		oPr = append(oPr, &adminOrderProxy{
+			Number:        fmt.Sprint(o.ID),
+			Status:        strings.TrimSpace(o.Status),
+			Accrual:       o.Accrual,
+			UploadedAt:    formatTime(o.UploadedAt),
+			Attempts:      o.Attempts,
+			NextAttemptAt: formatTime(o.NextAttemptAt),
+			ParkedAt:      formatTime(o.ParkedAt),
+			LastError:     o.LastError,
+		})
+	}
+
+	h.writeJSON(w, r, http.StatusOK, oPr)
+}
+
+func (h *handler) adminGetWithdrawals(w http.ResponseWriter, r *http.Request) {
+	c := h.getSessionFromReqContext(r)
+	if c == nil {
+		return
+	}
+	userID, ok := h.userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	ws, err := h.gm.Admin.Withdrawals(c.UserID, userID, auth.ClientFromRequest(r))
+	if err != nil {
+		h.error(w, r, fmt.Errorf("failed to get withdrawals - %w", err), http.StatusInternalServerError)
+		return
+	}
+
+	wPr := make([]*gophermart.WithdrawProxy, 0, len(ws))
+	for _, v := range ws {
+		wPr = append(wPr, &gophermart.WithdrawProxy{
+			Order:       fmt.Sprint(v.OrderID),
+			Sum:         v.Sum,
+			ProcessedAt: formatTime(v.ProcessedAt),
+		})
+	}
+
+	h.writeJSON(w, r, http.StatusOK, wPr)
+}
+
+func (h *handler) adminGetBalance(w http.ResponseWriter, r *http.Request) {
+	c := h.getSessionFromReqContext(r)
+	if c == nil {
+		return
+	}
+	userID, ok := h.userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	// With at the balance is rebuilt from the ledger as it was then.
+	var b gophermart.Balance
+	at, err := queryTime(r, "at")
+	if err != nil {
+		h.error(w, r, err, http.StatusBadRequest)
+		return
+	}
+	if at.IsZero() {
+		b, err = h.gm.Admin.Balance(c.UserID, userID, auth.ClientFromRequest(r))
+	} else {
+		b, err = h.gm.Admin.BalanceAt(c.UserID, userID, auth.ClientFromRequest(r), at)
+	}
+	if err != nil {
+		h.error(w, r, fmt.Errorf("failed to get balance - %w", err), http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSON(w, r, http.StatusOK, &adminBalanceProxy{Current: b.Current, Withdrawn: b.Withdrawn})
+}
+
+// adminVerifyBalance answers 409 if the stored balance differs from the one
+// rebuilt from the ledger.
+func (h *handler) adminVerifyBalance(w http.ResponseWriter, r *http.Request) {
+	c := h.getSessionFromReqContext(r)
+	if c == nil {
+		return
+	}
+	userID, ok := h.userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.gm.Admin.VerifyBalance(c.UserID, userID, auth.ClientFromRequest(r))
+	if errors.Is(err, gophermart.ErrBalanceMismatch) {
+		h.error(w, r, err, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		h.error(w, r, fmt.Errorf("failed to verify balance - %w", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// adminGetLedger lists the ledger entries of the user, up to until if set.
+func (h *handler) adminGetLedger(w http.ResponseWriter, r *http.Request) {
+	c := h.getSessionFromReqContext(r)
+	if c == nil {
+		return
+	}
+	userID, ok := h.userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	until, err := queryTime(r, "until")
+	if err != nil {
+		h.error(w, r, err, http.StatusBadRequest)
+		return
+	}
+	if until.IsZero() {
+		until = time.Now()
+	}
+
+	es, err := h.gm.Admin.Ledger(c.UserID, userID, auth.ClientFromRequest(r), until)
+	if err != nil {
+		h.error(w, r, fmt.Errorf("failed to get ledger - %w", err), http.StatusInternalServerError)
+		return
+	}
+
+	ePr := make([]*ledgerEntryProxy, 0, len(es))
+	for _, e := range es {
+		ePr = append(ePr, &ledgerEntryProxy{
+			ID:        e.ID,
+			TxID:      e.TxID,
+			Direction: e.Direction,
+			Amount:    e.Amount,
+			Kind:      e.Kind,
+			Ref:       e.Ref,
+			CreatedAt: formatTime(e.CreatedAt),
+		})
+	}
+
+	h.writeJSON(w, r, http.StatusOK, ePr)
+}
+
+func (h *handler) adminPostAdjustment(w http.ResponseWriter, r *http.Request) {
+	c := h.getSessionFromReqContext(r)
+	if c == nil {
+		return
+	}
+	userID, ok := h.userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	var req adjustmentRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.error(w, r, fmt.Errorf("failed to unmarshal body - %w", err), http.StatusBadRequest)
+		return
+	}
+
+	b, err := h.gm.Admin.AdjustBalance(c.UserID, userID, auth.ClientFromRequest(r), strings.ToUpper(req.Direction), req.Amount, req.Reason)
+	switch {
+	case errors.Is(err, gophermart.ErrAdjustmentInvalid):
+		h.error(w, r, err, http.StatusUnprocessableEntity)
+	case errors.Is(err, gophermart.ErrNotEnoughFunds):
+		h.error(w, r, err, http.StatusConflict)
+	case errors.Is(err, gophermart.ErrUserNotFound):
+		h.error(w, r, err, http.StatusNotFound)
+	case err != nil:
+		h.error(w, r, fmt.Errorf("failed to adjust balance - %w", err), http.StatusInternalServerError)
+	default:
+		h.writeJSON(w, r, http.StatusOK, &adminBalanceProxy{Current: b.Current, Withdrawn: b.Withdrawn})
+		h.log(r, LogLvlInfo, fmt.Sprintf("balance of user %d adjusted by admin %d", userID, c.UserID))
+	}
+}
+
+func (h *handler) adminRequeueOrder(w http.ResponseWriter, r *http.Request) {
+	c := h.getSessionFromReqContext(r)
+	if c == nil {
+		return
+	}
+
+	orderID, err := strconv.ParseUint(chi.URLParam(r, "number"), 10, 64)
+	if err != nil {
+		h.error(w, r, gophermart.ErrOrderInvalidFormat, http.StatusBadRequest)
+		return
+	}
+
+	var req requeueRequest
+	if r.ContentLength != 0 {
+		err = json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			h.error(w, r, fmt.Errorf("failed to unmarshal body - %w", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	err = h.gm.Admin.RequeueOrder(c.UserID, orderID, auth.ClientFromRequest(r), req.Reason)
+	switch {
+	case errors.Is(err, gophermart.ErrOrderNotFound):
+		h.error(w, r, err, http.StatusNotFound)
+	case errors.Is(err, gophermart.ErrOrderFinalized):
+		h.error(w, r, err, http.StatusConflict)
+	case err != nil:
+		h.error(w, r, fmt.Errorf("failed to requeue order - %w", err), http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+		h.log(r, LogLvlInfo, fmt.Sprintf("order %d requeued by admin %d", orderID, c.UserID))
+	}
+}
+
+func (h *handler) adminGetAudit(w http.ResponseWriter, r *http.Request) {
+	f, err := auditFilter(r)
+	if err != nil {
+		h.error(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	es, err := h.gm.Audit.Query(f)
+	if err != nil {
+		h.error(w, r, fmt.Errorf("failed to get audit log - %w", err), http.StatusInternalServerError)
+		return
+	}
+
+	ePr := make([]*auditEntryProxy, 0, len(es))
+	for _, e := range es {
+		ePr = append(ePr, &auditEntryProxy{
+			ID:           e.ID,
+			CreatedAt:    formatTime(e.CreatedAt),
+			ActorID:      e.ActorID,
+			Action:       e.Action,
+			TargetUserID: e.TargetUserID,
+			Target:       e.Target,
+			IP:           e.IP,
+			RequestID:    e.RequestID,
+			Before:       rawJSON(e.Before),
+			After:        rawJSON(e.After),
+			Details:      json.RawMessage(e.Details),
+			PrevHash:     e.PrevHash,
+			Hash:         e.Hash,
+		})
+	}
+
+	h.writeJSON(w, r, http.StatusOK, ePr)
+}
+
+func (h *handler) adminVerifyAudit(w http.ResponseWriter, r *http.Request) {
+	n, err := h.gm.Audit.Verify()
+	if errors.Is(err, gophermart.ErrAuditChainBroken) {
+		h.error(w, r, err, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		h.error(w, r, fmt.Errorf("failed to verify audit log - %w", err), http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSON(w, r, http.StatusOK, &auditVerifyProxy{Checked: n})
+}
+
+// auditFilter reads the audit log filter from the query string. Times are
+// RFC 3339, before_id pages back from the ID of the last entry received.
+func auditFilter(r *http.Request) (gophermart.AuditFilter, error) {
+	q := r.URL.Query()
+	f := gophermart.AuditFilter{
+		Action:    q.Get("action"),
+		Target:    q.Get("target"),
+		IP:        q.Get("ip"),
+		RequestID: q.Get("request_id"),
+	}
+
+	ids := []struct {
+		name string
+		v    *uint64
+	}{
+		{"actor", &f.ActorID},
+		{"target_user", &f.TargetUserID},
+		{"before_id", &f.BeforeID},
+	}
+	for _, id := range ids {
+		s := q.Get(id.name)
+		if s == "" {
+			continue
+		}
+		v, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return f, fmt.Errorf("invalid %s - %w", id.name, err)
+		}
+		*id.v = v
+	}
+
+	times := []struct {
+		name string
+		v    *time.Time
+	}{
+		{"since", &f.Since},
+		{"until", &f.Until},
+	}
+	for _, t := range times {
+		s := q.Get(t.name)
+		if s == "" {
+			continue
+		}
+		v, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return f, fmt.Errorf("invalid %s - %w", t.name, err)
+		}
+		*t.v = v
+	}
+
+	s := q.Get("limit")
+	if s != "" {
+		limit, err := strconv.ParseUint(s, 10, 32)
+		if err != nil || limit > gophermart.MaxAuditLimit {
+			return f, fmt.Errorf("limit must be a number up to %d", gophermart.MaxAuditLimit)
+		}
+		f.Limit = uint32(limit)
+	}
+
+	return f, nil
+}
+
+func rawJSON(s string) json.RawMessage {
+	if s == "" {
+		return nil
+	}
+
+	return json.RawMessage(s)
+}
+
+func (h *handler) userIDParam(w http.ResponseWriter, r *http.Request) (uint64, bool) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		h.error(w, r, fmt.Errorf("invalid user ID - %w", err), http.StatusBadRequest)
+		return 0, false
+	}
+
+	return id, true
+}
+
+// queryTime reads an RFC 3339 time from the query string, zero if unset.
+func queryTime(r *http.Request, name string) (time.Time, error) {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s - %w", name, err)
+	}
+
+	return t, nil
+}
+
+func queryLimit(r *http.Request) (uint32, error) {
+	s := r.URL.Query().Get("limit")
+	if s == "" {
+		return 0, nil
+	}
+
+	limit, err := strconv.ParseUint(s, 10, 32)
+	if err != nil || limit > gophermart.MaxAdminSearchLimit {
+		return 0, fmt.Errorf("limit must be a number up to %d", gophermart.MaxAdminSearchLimit)
+	}
+
+	return uint32(limit), nil
+}
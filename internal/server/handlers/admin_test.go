@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/Osselnet/gophermart.git/internal/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdmin(t *testing.T) {
+	gm := gophermart.New(memory.New())
+	h := New(gm)
+
+	staff, err := gm.Register(&gophermart.Credentials{Login: "support", Password: "Passw0rd33"}, gophermart.Client{})
+	require.NoError(t, err)
+	customer, err := gm.Register(&gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}, gophermart.Client{})
+	require.NoError(t, err)
+
+	send := func(method, url, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", ContentTypeApplicationJSON)
+		w := httptest.NewRecorder()
+		h.GetRouter().ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusForbidden, send(http.MethodGet, "/api/admin/users?q=test", staff.Token, "").Code)
+
+	u, err := gm.Users.Get(staff.UserID)
+	require.NoError(t, err)
+	require.NoError(t, gm.Users.SetRole(u, gophermart.RoleAdmin))
+
+	key, err := gm.APIKeys.Create(staff.UserID, "script", gophermart.Scopes, time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, send(http.MethodGet, "/api/admin/users?q=test", key.Key, "").Code,
+		"API keys never get admin rights")
+
+	w := send(http.MethodGet, "/api/admin/users?q=test", staff.Token, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var users []adminUserProxy
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &users))
+	require.Len(t, users, 1)
+	assert.Equal(t, customer.UserID, users[0].ID)
+
+	userURL := fmt.Sprintf("/api/admin/users/%d", customer.UserID)
+	assert.Equal(t, http.StatusOK, send(http.MethodGet, userURL, staff.Token, "").Code)
+	assert.Equal(t, http.StatusNotFound, send(http.MethodGet, "/api/admin/users/999", staff.Token, "").Code)
+
+	w = send(http.MethodPost, userURL+"/adjustments", staff.Token, `{"direction":"credit","amount":100}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code, "reason is mandatory")
+	w = send(http.MethodPost, userURL+"/adjustments", staff.Token, `{"direction":"credit","amount":100,"reason":"goodwill"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"current":100,"withdrawn":0}`, w.Body.String())
+
+	w = send(http.MethodGet, userURL+"/balance", staff.Token, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"current":100,"withdrawn":0}`, w.Body.String())
+
+	require.NoError(t, gm.PostOrders(6767584380420, customer.UserID, gophermart.Client{}))
+	w = send(http.MethodGet, userURL+"/orders", staff.Token, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"attempts":0`)
+	assert.Equal(t, http.StatusNoContent, send(http.MethodPost, "/api/admin/orders/6767584380420/requeue", staff.Token, `{"reason":"stuck"}`).Code)
+	assert.Equal(t, http.StatusNotFound, send(http.MethodPost, "/api/admin/orders/303653406/requeue", staff.Token, "").Code)
+
+	assert.Equal(t, http.StatusOK, send(http.MethodGet, userURL+"/withdrawals", staff.Token, "").Code)
+
+	w = send(http.MethodGet, "/api/admin/audit?limit=3", staff.Token, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var entries []auditEntryProxy
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &entries))
+	require.Len(t, entries, 3)
+	assert.Equal(t, gophermart.AuditAdminViewWithdrawals, entries[0].Action)
+	assert.Equal(t, gophermart.AuditAdminRequeueOrder, entries[1].Action)
+	assert.Equal(t, "order:6767584380420", entries[1].Target)
+	assert.JSONEq(t, `{"status":"NEW","accrual":0}`, string(entries[1].Before))
+	assert.JSONEq(t, `{"reason":"stuck"}`, string(entries[1].Details))
+	assert.Equal(t, "192.0.2.1", entries[1].IP)
+	assert.NotEmpty(t, entries[1].RequestID)
+
+	w = send(http.MethodGet, "/api/admin/audit?action=admin.&target_user=2&limit=1", staff.Token, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &entries))
+	require.Len(t, entries, 1)
+	assert.Equal(t, gophermart.AuditAdminViewWithdrawals, entries[0].Action)
+	assert.Equal(t, http.StatusBadRequest, send(http.MethodGet, "/api/admin/audit?since=yesterday", staff.Token, "").Code)
+
+	w = send(http.MethodGet, userURL+"/ledger", staff.Token, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var ledger []ledgerEntryProxy
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &ledger))
+	require.Len(t, ledger, 1)
+	assert.Equal(t, gophermart.EntryKindAdjustment, ledger[0].Kind)
+	assert.Contains(t, w.Body.String(), `"amount":100`)
+
+	past := url.QueryEscape(time.Now().Add(-time.Hour).Format(time.RFC3339))
+	w = send(http.MethodGet, userURL+"/balance?at="+past, staff.Token, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"current":0,"withdrawn":0}`, w.Body.String(), "balance before the adjustment")
+	assert.Equal(t, http.StatusBadRequest, send(http.MethodGet, userURL+"/balance?at=yesterday", staff.Token, "").Code)
+	assert.Equal(t, http.StatusNoContent, send(http.MethodGet, userURL+"/balance/verify", staff.Token, "").Code)
+
+	w = send(http.MethodGet, "/api/admin/audit/verify", staff.Token, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"checked":0}`, w.Body.String(), "entries are not chained by default")
+}
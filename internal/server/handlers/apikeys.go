@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"time"
+)
+
+type apiKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type apiKeyProxy struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Scopes     []string `json:"scopes"`
+	CreatedAt  string   `json:"created_at"`
+	ExpiresAt  string   `json:"expires_at,omitempty"`
+	LastUsedAt string   `json:"last_used_at,omitempty"`
+	// Key is only sent once, in the response to the creation.
+	Key string `json:"key,omitempty"`
+}
+
+func newAPIKeyProxy(k *gophermart.APIKey) *apiKeyProxy {
+	p := &apiKeyProxy{
+		ID:        k.ID,
+		Name:      k.Name,
+		Scopes:    k.Scopes,
+		CreatedAt: k.CreatedAt.Format(time.RFC3339),
+		Key:       k.Key,
+	}
+	if !k.ExpiresAt.IsZero() {
+		p.ExpiresAt = k.ExpiresAt.Format(time.RFC3339)
+	}
+	if !k.LastUsedAt.IsZero() {
+		p.LastUsedAt = k.LastUsedAt.Format(time.RFC3339)
+	}
+
+	return p
+}
+
+func (h *handler) getAPIKeys(w http.ResponseWriter, r *http.Request) {
+	c := h.getSessionFromReqContext(r)
+	if c == nil {
+		return
+	}
+
+	keys, err := h.gm.APIKeys.ListForUser(c.UserID)
+	if err != nil {
+		h.error(w, r, fmt.Errorf("failed to get API keys - %w", err), http.StatusInternalServerError)
+		return
+	}
+
+	kPr := make([]*apiKeyProxy, 0, len(keys))
+	for _, k := range keys {
+		kPr = append(kPr, newAPIKeyProxy(k))
+	}
+
+	h.writeJSON(w, r, http.StatusOK, kPr)
+}
+
+func (h *handler) postAPIKey(w http.ResponseWriter, r *http.Request) {
+	c := h.getSessionFromReqContext(r)
+	if c == nil {
+		return
+	}
+
+	var req apiKeyRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.error(w, r, fmt.Errorf("failed to unmarshal body - %w", err), http.StatusBadRequest)
+		return
+	}
+
+	var expiresAt time.Time
+	if req.ExpiresAt != nil {
+		expiresAt = *req.ExpiresAt
+	}
+
+	key, err := h.gm.APIKeys.Create(c.UserID, req.Name, req.Scopes, expiresAt)
+	if errors.Is(err, gophermart.ErrAPIKeyInvalid) {
+		h.error(w, r, err, http.StatusUnprocessableEntity)
+		return
+	}
+	if errors.Is(err, gophermart.ErrAPIKeyLimit) {
+		h.error(w, r, err, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		h.error(w, r, fmt.Errorf("failed to create API key - %w", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	h.writeJSON(w, r, http.StatusCreated, newAPIKeyProxy(key))
+	h.log(r, LogLvlInfo, fmt.Sprintf("API key %s created for user %d", key.ID, c.UserID))
+}
+
+func (h *handler) deleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	c := h.getSessionFromReqContext(r)
+	if c == nil {
+		return
+	}
+
+	err := h.gm.APIKeys.Revoke(c.UserID, chi.URLParam(r, "id"))
+	if errors.Is(err, gophermart.ErrAPIKeyNotFound) {
+		h.error(w, r, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.error(w, r, fmt.Errorf("failed to revoke API key - %w", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/Osselnet/gophermart.git/internal/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAPIKeys(t *testing.T) {
+	gm := gophermart.New(memory.New())
+	h := New(gm)
+
+	session, err := gm.Register(&gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}, gophermart.Client{})
+	require.NoError(t, err)
+
+	send := func(method, url, token, contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		h.GetRouter().ServeHTTP(w, req)
+		return w
+	}
+
+	w := send(http.MethodPost, "/api/user/api-keys", session.Token, ContentTypeApplicationJSON, `{"name":"erp","scopes":["root"]}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	w = send(http.MethodPost, "/api/user/api-keys", session.Token, ContentTypeApplicationJSON, `{"name":"erp","scopes":["orders:write"]}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var created apiKeyProxy
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	require.NotEmpty(t, created.Key)
+
+	w = send(http.MethodPost, "/api/user/orders", created.Key, "text/plain", "6767584380420")
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	w = send(http.MethodGet, "/api/user/balance", created.Key, "", "")
+	assert.Equal(t, http.StatusForbidden, w.Code, "key lacks balance:read")
+	assert.Contains(t, w.Header().Get("WWW-Authenticate"), `scope="balance:read"`)
+	w = send(http.MethodGet, "/api/user/api-keys", created.Key, "", "")
+	assert.Equal(t, http.StatusForbidden, w.Code, "keys can't manage keys")
+	w = send(http.MethodPost, "/api/user/password", created.Key, ContentTypeApplicationJSON, `{"old_password":"Passw0rd33","new_password":"N3wPassw0rd"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = send(http.MethodGet, "/api/user/balance", session.Token, "", "")
+	assert.Equal(t, http.StatusOK, w.Code, "sessions are not limited by scopes")
+
+	w = send(http.MethodGet, "/api/user/api-keys", session.Token, "", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var list []apiKeyProxy
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list, 1)
+	assert.Equal(t, created.ID, list[0].ID)
+	assert.Empty(t, list[0].Key, "the key is shown once")
+	assert.NotEmpty(t, list[0].LastUsedAt)
+
+	w = send(http.MethodDelete, "/api/user/api-keys/"+created.ID, session.Token, "", "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = send(http.MethodPost, "/api/user/orders", created.Key, "text/plain", "303653406")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = send(http.MethodDelete, "/api/user/api-keys/"+created.ID, session.Token, "", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/Osselnet/gophermart.git/internal/server/middleware/auth"
+	"github.com/go-chi/chi/v5"
+	"mime"
+	"net/http"
+	"time"
+)
+
+const (
+	ContentTypeTextCSV = "text/csv"
+	ContentTypeNDJSON  = "application/x-ndjson"
+
+	maxBulkBodySize = 8 << 20
+)
+
+type bulkJobProxy struct {
+	ID        string                  `json:"id,omitempty"`
+	Status    string                  `json:"status"`
+	Total     int                     `json:"total"`
+	Processed int                     `json:"processed"`
+	Summary   map[string]int          `json:"summary"`
+	Results   []gophermart.BulkResult `json:"results,omitempty"`
+	Error     string                  `json:"error,omitempty"`
+	StatusURL string                  `json:"status_url,omitempty"`
+	CreatedAt string                  `json:"created_at"`
+	UpdatedAt string                  `json:"updated_at"`
+}
+
+// newBulkJobProxy shows the results once the job is over. Jobs that are not
+// stored, those answered right away, have no ID to poll.
+func newBulkJobProxy(j *gophermart.BulkJob, stored bool) *bulkJobProxy {
+	p := &bulkJobProxy{
+		Status:    j.Status,
+		Total:     j.Total,
+		Processed: j.Processed,
+		Summary:   j.Summary(),
+		Error:     j.Error,
+		CreatedAt: j.CreatedAt.Format(time.RFC3339),
+		UpdatedAt: j.UpdatedAt.Format(time.RFC3339),
+	}
+	if j.Status == gophermart.BulkJobDone || j.Status == gophermart.BulkJobFailed {
+		p.Results = j.Results
+	}
+	if stored {
+		p.ID = j.ID
+		p.StatusURL = "/api/user/orders/bulk/" + j.ID
+	}
+
+	return p
+}
+
+func bulkFormat(contentType string) (string, error) {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err == nil {
+		switch mt {
+		case ContentTypeTextCSV:
+			return gophermart.BulkFormatCSV, nil
+		case ContentTypeNDJSON:
+			return gophermart.BulkFormatNDJSON, nil
+		}
+	}
+
+	return "", fmt.Errorf("wrong content type, %s or %s needed", ContentTypeTextCSV, ContentTypeNDJSON)
+}
+
+// postOrdersBulk uploads many order numbers at once. Small uploads are
+// answered with the result of every line, larger ones with 202 and a job
+// to poll at the Location.
+func (h *handler) postOrdersBulk(w http.ResponseWriter, r *http.Request) {
+	format, err := bulkFormat(r.Header.Get("Content-Type"))
+	if err != nil {
+		h.error(w, r, err, http.StatusBadRequest)
+		return
+	}
+	c := h.getSessionFromReqContext(r)
+	if c == nil {
+		return
+	}
+
+	defer r.Body.Close()
+	lines, err := h.gm.ReadBulkOrders(http.MaxBytesReader(w, r.Body, maxBulkBodySize), format)
+	var maxBytesErr *http.MaxBytesError
+	if errors.Is(err, gophermart.ErrBulkTooLarge) || errors.As(err, &maxBytesErr) {
+		h.error(w, r, err, http.StatusRequestEntityTooLarge)
+		return
+	}
+	if errors.Is(err, gophermart.ErrBulkInvalid) {
+		h.error(w, r, err, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.error(w, r, fmt.Errorf("failed to read request body - %w", err), http.StatusInternalServerError)
+		return
+	}
+
+	job, err := h.gm.PostOrdersBulk(c.UserID, lines, auth.ClientFromRequest(r))
+	if err != nil {
+		h.error(w, r, fmt.Errorf("failed to upload orders - %w", err), http.StatusInternalServerError)
+		return
+	}
+
+	if job.Status == gophermart.BulkJobPending {
+		p := newBulkJobProxy(job, true)
+		w.Header().Set("Location", p.StatusURL)
+		h.writeJSON(w, r, http.StatusAccepted, p)
+		h.log(r, LogLvlInfo, fmt.Sprintf("bulk upload job %s of %d orders has been started", job.ID, job.Total))
+		return
+	}
+
+	h.writeJSON(w, r, http.StatusOK, newBulkJobProxy(job, false))
+	h.log(r, LogLvlInfo, fmt.Sprintf("bulk upload of %d orders is done", job.Total))
+}
+
+func (h *handler) getOrdersBulk(w http.ResponseWriter, r *http.Request) {
+	c := h.getSessionFromReqContext(r)
+	if c == nil {
+		return
+	}
+
+	job, err := h.gm.BulkJob(c.UserID, chi.URLParam(r, "id"))
+	if errors.Is(err, gophermart.ErrBulkJobNotFound) {
+		h.error(w, r, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.error(w, r, fmt.Errorf("failed to get bulk upload job - %w", err), http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSON(w, r, http.StatusOK, newBulkJobProxy(job, true))
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/Osselnet/gophermart.git/internal/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOrdersBulk(t *testing.T) {
+	gm := gophermart.New(memory.New())
+	gm.SetBulkConfig(gophermart.BulkConfig{MaxOrders: 5, SyncLimit: 2})
+	h := New(gm)
+
+	session, err := gm.Register(&gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}, gophermart.Client{})
+	require.NoError(t, err)
+
+	send := func(method, url, contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: session.Token})
+		w := httptest.NewRecorder()
+		h.GetRouter().ServeHTTP(w, req)
+		return w
+	}
+
+	w := send(http.MethodPost, "/api/user/orders/bulk", "text/csv; charset=utf-8", "79927398713\n12345678900\n")
+	require.Equal(t, http.StatusOK, w.Code)
+	var job bulkJobProxy
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+	assert.Equal(t, gophermart.BulkJobDone, job.Status)
+	assert.Empty(t, job.ID)
+	require.Len(t, job.Results, 2)
+	assert.Equal(t, gophermart.BulkResult{Line: 1, Number: "79927398713", Result: gophermart.BulkAccepted}, job.Results[0])
+	assert.Equal(t, gophermart.BulkInvalid, job.Results[1].Result)
+
+	w = send(http.MethodPost, "/api/user/orders/bulk", ContentTypeNDJSON,
+		`{"number":"79927398713"}`+"\n"+`{"number":"6767584380420"}`+"\n"+`{"number":"12345678903"}`+"\n")
+	require.Equal(t, http.StatusAccepted, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+	assert.Equal(t, gophermart.BulkJobPending, job.Status)
+	assert.Equal(t, "/api/user/orders/bulk/"+job.ID, w.Header().Get("Location"))
+	assert.Equal(t, job.StatusURL, w.Header().Get("Location"))
+
+	require.Eventually(t, func() bool {
+		w = send(http.MethodGet, job.StatusURL, "", "")
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+		return job.Status == gophermart.BulkJobDone
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, map[string]int{
+		gophermart.BulkAccepted:       2,
+		gophermart.BulkDuplicateOwn:   1,
+		gophermart.BulkDuplicateOther: 0,
+		gophermart.BulkInvalid:        0,
+	}, job.Summary)
+	assert.Len(t, job.Results, 3)
+
+	assert.Equal(t, http.StatusNotFound, send(http.MethodGet, "/api/user/orders/bulk/unknown", "", "").Code)
+	assert.Equal(t, http.StatusBadRequest, send(http.MethodPost, "/api/user/orders/bulk", ContentTypeTextPlain, "79927398713").Code)
+	assert.Equal(t, http.StatusBadRequest, send(http.MethodPost, "/api/user/orders/bulk", ContentTypeTextCSV, "").Code)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, send(http.MethodPost, "/api/user/orders/bulk", ContentTypeTextCSV, "1\n2\n3\n4\n5\n6\n").Code)
+}
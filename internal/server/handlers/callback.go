@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Osselnet/gophermart.git/internal/client"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/Osselnet/gophermart.git/internal/server/middleware/signature"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type AccrualApplier interface {
+	Apply(order *gophermart.Order, ao *client.AccrualOrder) error
+}
+
+// EnableAccrualCallback mounts the endpoint the accrual system pushes order
+// updates to. Requests must be signed with secret, see signature.Verify.
+func (h *handler) EnableAccrualCallback(secret []byte, window time.Duration, applier AccrualApplier) {
+	h.applier = applier
+
+	h.router.Group(func(r chi.Router) {
+		r.Use(signature.Verify(secret, window, h.gm))
+		r.Post("/api/internal/accrual/callback", h.accrualCallback)
+	})
+}
+
+func (h *handler) accrualCallback(w http.ResponseWriter, r *http.Request) {
+	ao := &client.AccrualOrder{}
+	err := json.NewDecoder(r.Body).Decode(ao)
+	if err != nil {
+		h.error(w, r, fmt.Errorf("failed to decode JSON - %w", err), http.StatusBadRequest)
+		return
+	}
+
+	orderID, err := strconv.ParseUint(ao.Order, 10, 64)
+	if err != nil {
+		h.error(w, r, fmt.Errorf("%s - %w", gophermart.ErrOrderInvalidFormat, err), http.StatusBadRequest)
+		return
+	}
+
+	order, err := h.gm.Orders.Get(orderID)
+	if errors.Is(err, gophermart.ErrOrderNotFound) {
+		h.error(w, r, gophermart.ErrOrderNotFound, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	err = h.applier.Apply(order, ao)
+	if errors.Is(err, client.ErrAccrualNotApplied) {
+		h.log(r, LogLvlInfo, fmt.Sprintf("callback for order %d ignored - %s", orderID, err))
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if err != nil {
+		h.error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	h.log(r, LogLvlInfo, fmt.Sprintf("order %d updated by callback, status %s", orderID, ao.Status))
+	w.WriteHeader(http.StatusOK)
+}
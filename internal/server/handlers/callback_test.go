@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"bytes"
+	"github.com/Osselnet/gophermart.git/internal/client"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/Osselnet/gophermart.git/internal/memory"
+	"github.com/Osselnet/gophermart.git/internal/server/middleware/signature"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestAccrualCallback(t *testing.T) {
+	secret := []byte("secret")
+	st := memory.New()
+	gm := gophermart.New(st)
+	session, err := gm.Register(&gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}, gophermart.Client{})
+	require.NoError(t, err)
+	require.NoError(t, gm.PostOrders(6767584380420, session.UserID, gophermart.Client{}))
+
+	h := New(gm)
+	h.EnableAccrualCallback(secret, time.Minute, client.NewQueue(st, client.Config{}))
+
+	send := func(body string, ts int64, nonce string, key []byte) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/internal/accrual/callback", bytes.NewBufferString(body))
+		req.Header.Set(signature.HeaderTimestamp, strconv.FormatInt(ts, 10))
+		req.Header.Set(signature.HeaderNonce, nonce)
+		req.Header.Set(signature.HeaderSignature, signature.Sign(key, ts, nonce, []byte(body)))
+		w := httptest.NewRecorder()
+		h.GetRouter().ServeHTTP(w, req)
+		return w.Code
+	}
+
+	now := time.Now().Unix()
+	processed := `{"order":"6767584380420","status":"PROCESSED","accrual":729.98}`
+
+	assert.Equal(t, http.StatusUnauthorized, send(processed, now, "n1", []byte("wrong")), "bad signature")
+	assert.Equal(t, http.StatusUnauthorized, send(processed, now-120, "n2", secret), "stale timestamp")
+	assert.Equal(t, http.StatusNotFound, send(`{"order":"79927398713","status":"PROCESSED"}`, now, "n3", secret))
+
+	assert.Equal(t, http.StatusOK, send(processed, now, "n4", secret))
+	assert.Equal(t, http.StatusConflict, send(processed, now, "n4", secret), "replayed nonce")
+	assert.Equal(t, http.StatusOK, send(processed, now, "n5", secret), "duplicate delivery is idempotent")
+
+	o, err := st.GetOrder(6767584380420)
+	require.NoError(t, err)
+	assert.Equal(t, gophermart.StatusProcessed, o.Status)
+	assert.Equal(t, gophermart.Money(72998), o.Accrual)
+
+	b, err := st.GetBalance(session.UserID)
+	require.NoError(t, err)
+	assert.Equal(t, gophermart.Money(72998), b.Current, "accrual must be credited once")
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/Osselnet/gophermart.git/internal/server/middleware/auth"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	ContentTypeEventStream = "text/event-stream"
+	HeaderLastEventID      = "Last-Event-ID"
+
+	// Streams end before the write timeout of the server. Browsers reconnect
+	// after eventStreamRetry and resume after the last event they got.
+	DefaultEventStreamDuration = 8 * time.Second
+	eventStreamRetry           = time.Second
+)
+
+// getOrderEvents streams order and balance events of the user as Server-Sent
+// Events. Without Last-Event-ID, or the last_event_id parameter for clients
+// that can't set headers, only new events are sent.
+func (h *handler) getOrderEvents(w http.ResponseWriter, r *http.Request) {
+	c := h.getSessionFromReqContext(r)
+	if c == nil {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		h.error(w, r, fmt.Errorf("streaming is not supported"), http.StatusInternalServerError)
+		return
+	}
+
+	s := r.Header.Get(HeaderLastEventID)
+	if s == "" {
+		s = r.URL.Query().Get("last_event_id")
+	}
+	var lastID uint64
+	var err error
+	if s != "" {
+		lastID, err = strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			h.error(w, r, fmt.Errorf("invalid last event ID - %w", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Subscribed first, so nothing published in between is missed.
+	wake, unsubscribe := h.gm.Events.Subscribe(c.UserID)
+	defer unsubscribe()
+
+	if s == "" {
+		lastID, err = h.gm.Events.Last(c.UserID)
+		if err != nil {
+			h.error(w, r, fmt.Errorf("failed to get last event - %w", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	key := auth.APIKeyFromContext(r.Context())
+	balance := key == nil || key.HasScope(gophermart.ScopeBalanceRead)
+
+	w.Header().Set("Content-Type", ContentTypeEventStream)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", eventStreamRetry.Milliseconds())
+	flusher.Flush()
+
+	end := time.NewTimer(h.eventStreamDuration)
+	defer end.Stop()
+
+	for {
+		es, err := h.gm.Events.Since(c.UserID, lastID)
+		if err != nil {
+			h.log(r, LogLvlError, fmt.Sprintf("failed to get events - %v", err))
+			return
+		}
+		for _, e := range es {
+			lastID = e.ID
+			if e.Type == gophermart.EventBalance && !balance {
+				continue
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, e.Data)
+		}
+		if len(es) != 0 {
+			flusher.Flush()
+		}
+		if len(es) == gophermart.MaxEventBatch {
+			continue
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-end.C:
+			return
+		case <-wake:
+		}
+	}
+}
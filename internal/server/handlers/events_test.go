@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/Osselnet/gophermart.git/internal/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOrderEvents(t *testing.T) {
+	st := memory.New()
+	gm := gophermart.New(st)
+	h := New(gm)
+	h.eventStreamDuration = 300 * time.Millisecond
+
+	session, err := gm.Register(&gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}, gophermart.Client{})
+	require.NoError(t, err)
+	require.NoError(t, gm.PostOrders(6767584380420, session.UserID, gophermart.Client{}))
+
+	stream := func(lastEventID string, during func()) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/user/orders/events", nil)
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: session.Token})
+		if lastEventID != "" {
+			req.Header.Set(HeaderLastEventID, lastEventID)
+		}
+		w := httptest.NewRecorder()
+		done := make(chan struct{})
+		go func() {
+			h.GetRouter().ServeHTTP(w, req)
+			close(done)
+		}()
+		if during != nil {
+			time.Sleep(50 * time.Millisecond)
+			during()
+		}
+		<-done
+		return w
+	}
+	ids := regexp.MustCompile(`(?m)^id: (\d+)$`)
+
+	w := stream("", func() {
+		order, err := st.GetOrder(6767584380420)
+		require.NoError(t, err)
+		order.Status = gophermart.StatusProcessing
+		require.NoError(t, st.UpdateOrder(order))
+		require.NoError(t, gm.Events.PublishOrder(order))
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, ContentTypeEventStream, w.Header().Get("Content-Type"))
+	body := w.Body.String()
+	assert.True(t, strings.HasPrefix(body, "retry: 1000\n\n"))
+	assert.NotContains(t, body, `"status":"NEW"`, "only new events without Last-Event-ID")
+	assert.Contains(t, body, "event: order\ndata: {\"number\":\"6767584380420\",\"status\":\"PROCESSING\"")
+	assert.Len(t, ids.FindAllStringSubmatch(body, -1), 1)
+
+	w = stream("0", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	got := ids.FindAllStringSubmatch(w.Body.String(), -1)
+	require.Len(t, got, 2, "resumed from the start")
+	assert.Contains(t, w.Body.String(), `"status":"NEW"`)
+
+	w = stream(got[0][1], nil)
+	assert.Len(t, ids.FindAllStringSubmatch(w.Body.String(), -1), 1, "resumed after the first event")
+
+	assert.Equal(t, http.StatusBadRequest, stream("last", nil).Code)
+}
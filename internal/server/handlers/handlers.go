@@ -5,10 +5,13 @@ import (
 	"fmt"
 	"github.com/Osselnet/gophermart.git/internal/gophermart"
 	"github.com/Osselnet/gophermart.git/internal/server/middleware/auth"
+	"github.com/Osselnet/gophermart.git/internal/server/middleware/idempotency"
+	"github.com/Osselnet/gophermart.git/internal/server/middleware/openapi"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"log"
 	"net/http"
+	"time"
 )
 
 const (
@@ -22,14 +25,25 @@ const (
 )
 
 type handler struct {
-	router chi.Router
-	gm     *gophermart.GopherMart
+	router  chi.Router
+	gm      *gophermart.GopherMart
+	applier AccrualApplier
+
+	eventStreamDuration time.Duration
 }
 
 func New(gm *gophermart.GopherMart) *handler {
+	spec, err := openapi.Load()
+	if err != nil {
+		// The document is embedded, TestOpenAPIRoutes keeps it loadable.
+		panic(err)
+	}
+
 	h := &handler{
 		router: chi.NewRouter(),
 		gm:     gm,
+
+		eventStreamDuration: DefaultEventStreamDuration,
 	}
 
 	h.router.Use(middleware.Compress(3, "gzip"))
@@ -38,25 +52,75 @@ func New(gm *gophermart.GopherMart) *handler {
 	h.router.Use(middleware.Logger)
 	h.router.Use(middleware.Recoverer)
 
+	// Requests are validated after authentication, so requests without
+	// credentials get 401 whatever they send.
+	validate := openapi.Validate(spec, h.error)
+
+	h.router.Get("/api/health", h.health)
+	h.router.Get("/api/openapi.json", h.openAPI)
+
 	h.router.Route("/api/user", func(r chi.Router) {
-		r.Post("/register", h.register)
-		r.Post("/login", h.login)
+		r.With(validate).Post("/register", h.register)
+		r.With(validate).Post("/login", h.login)
+		r.With(validate).Post("/login/totp", h.loginTOTP)
+		r.Post("/refresh", h.refresh)
 		r.Get("/logout", h.logout)
 
 		r.Group(func(r chi.Router) {
 			r.Use(auth.AuthCheck(gm))
+			r.Use(validate)
 
 			r.Get("/welcome", h.welcome)
 
-			r.Post("/orders", h.postOrders)
-			r.Get("/orders", h.getOrders)
+			r.With(auth.RequireScope(gophermart.ScopeOrdersWrite), idempotency.Keys(gm.IdempotencyKeys)).Post("/orders", h.postOrders)
+			r.With(auth.RequireScope(gophermart.ScopeOrdersRead)).Get("/orders", h.getOrders)
+			r.With(auth.RequireScope(gophermart.ScopeOrdersRead)).Get("/orders/events", h.getOrderEvents)
+			r.With(auth.RequireScope(gophermart.ScopeOrdersWrite), idempotency.Keys(gm.IdempotencyKeys)).Post("/orders/bulk", h.postOrdersBulk)
+			r.With(auth.RequireScope(gophermart.ScopeOrdersRead)).Get("/orders/bulk/{id}", h.getOrdersBulk)
+
+			r.With(auth.RequireScope(gophermart.ScopeBalanceRead)).Get("/balance", h.getBalance)
+			r.With(auth.RequireScope(gophermart.ScopeWithdraw), idempotency.Keys(gm.IdempotencyKeys)).Post("/balance/withdraw", h.postWithdraw)
+			r.With(auth.RequireScope(gophermart.ScopeBalanceRead)).Get("/withdrawals", h.getWithdrawals)
+			r.With(auth.RequireScope(gophermart.ScopeBalanceRead)).Get("/statement", h.getStatement)
 
-			r.Get("/balance", h.getBalance)
-			r.Post("/balance/withdraw", h.postWithdraw)
-			r.Get("/withdrawals", h.getWithdrawals)
+			r.Group(func(r chi.Router) {
+				r.Use(auth.SessionOnly)
+
+				r.Delete("/", h.deleteAccount)
+				r.Post("/password", h.changePassword)
+
+				r.Get("/sessions", h.getSessions)
+				r.Delete("/sessions/{id}", h.deleteSession)
+				r.Post("/sessions/revoke-all", h.revokeAllSessions)
+
+				r.Post("/totp", h.enrollTOTP)
+				r.Post("/totp/confirm", h.confirmTOTP)
+				r.Delete("/totp", h.disableTOTP)
+
+				r.Get("/api-keys", h.getAPIKeys)
+				r.Post("/api-keys", h.postAPIKey)
+				r.Delete("/api-keys/{id}", h.deleteAPIKey)
+			})
 		})
 	})
 
+	h.router.Route("/api/admin", func(r chi.Router) {
+		r.Use(auth.AuthCheck(gm))
+		r.Use(auth.RequireRole(gm, gophermart.RoleAdmin))
+
+		r.Get("/users", h.adminSearchUsers)
+		r.Get("/users/{id}", h.adminGetUser)
+		r.Get("/users/{id}/orders", h.adminGetOrders)
+		r.Get("/users/{id}/withdrawals", h.adminGetWithdrawals)
+		r.Get("/users/{id}/balance", h.adminGetBalance)
+		r.Get("/users/{id}/balance/verify", h.adminVerifyBalance)
+		r.Get("/users/{id}/ledger", h.adminGetLedger)
+		r.Post("/users/{id}/adjustments", h.adminPostAdjustment)
+		r.Post("/orders/{number}/requeue", h.adminRequeueOrder)
+		r.Get("/audit", h.adminGetAudit)
+		r.Get("/audit/verify", h.adminVerifyAudit)
+	})
+
 	return h
 }
 
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"net/http"
+	"time"
+)
+
+type accrualHealth struct {
+	Breaker     string  `json:"breaker"`
+	RetryIn     float64 `json:"retry_in_seconds"`
+	BatchLimit  uint32  `json:"batch_limit"`
+	Workers     int     `json:"workers"`
+	RateLimit   float64 `json:"rate_limit_per_second,omitempty"`
+	PausedUntil string  `json:"paused_until,omitempty"`
+}
+
+type health struct {
+	Status  string                `json:"status"`
+	Accrual *accrualHealth        `json:"accrual,omitempty"`
+	Caches  gophermart.CacheStats `json:"caches"`
+}
+
+func (h *handler) health(w http.ResponseWriter, r *http.Request) {
+	hl := health{Status: "ok", Caches: h.gm.CacheStats()}
+
+	if st, ok := h.gm.AccrualStatus(); ok {
+		hl.Accrual = &accrualHealth{
+			Breaker:    st.Breaker,
+			RetryIn:    st.RetryIn.Seconds(),
+			BatchLimit: st.Limit,
+			Workers:    st.Workers,
+			RateLimit:  st.RateLimit,
+		}
+		if st.PausedUntil.After(time.Now()) {
+			hl.Accrual.PausedUntil = st.PausedUntil.Format(time.RFC3339)
+		}
+		if st.Breaker != "closed" {
+			hl.Status = "degraded"
+		}
+	}
+
+	body, err := json.Marshal(&hl)
+	if err != nil {
+		h.error(w, r, fmt.Errorf("failed to marshal JSON - %w", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", ContentTypeApplicationJSON)
+	w.Write(body)
+}
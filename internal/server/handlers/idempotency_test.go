@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/Osselnet/gophermart.git/internal/memory"
+	"github.com/Osselnet/gophermart.git/internal/server/middleware/auth"
+	"github.com/Osselnet/gophermart.git/internal/server/middleware/idempotency"
+	"github.com/Osselnet/gophermart.git/pkg/totp"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyKey(t *testing.T) {
+	st := memory.New()
+	gm := gophermart.New(st)
+	h := New(gm)
+
+	session, err := gm.Register(&gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}, gophermart.Client{})
+	require.NoError(t, err)
+	require.NoError(t, gm.PostOrders(6767584380420, session.UserID, gophermart.Client{}))
+	order, err := st.GetOrder(6767584380420)
+	require.NoError(t, err)
+	order.Status = gophermart.StatusProcessed
+	order.Accrual = 100000
+	require.NoError(t, st.UpdateOrder(order))
+
+	send := func(url, contentType, body, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, url, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", contentType)
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: session.Token})
+		if key != "" {
+			req.Header.Set(idempotency.HeaderKey, key)
+		}
+		w := httptest.NewRecorder()
+		h.GetRouter().ServeHTTP(w, req)
+		return w
+	}
+
+	const withdraw = `{"order":"2377225624","sum":751}`
+	w := send("/api/user/balance/withdraw", ContentTypeApplicationJSON, withdraw, "key-1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get(idempotency.HeaderReplayed))
+
+	w = send("/api/user/balance/withdraw", ContentTypeApplicationJSON, withdraw, "key-1")
+	assert.Equal(t, http.StatusOK, w.Code, "retry gets the original response")
+	assert.Equal(t, "true", w.Header().Get(idempotency.HeaderReplayed))
+
+	w = send("/api/user/balance/withdraw", ContentTypeApplicationJSON, `{"order":"2377225624","sum":752}`, "key-1")
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code, "key reused for another request")
+
+	b, err := st.GetBalance(session.UserID)
+	require.NoError(t, err)
+	assert.Equal(t, gophermart.Money(75100), b.Withdrawn, "withdrawal must be made once")
+
+	w = send("/api/user/orders", ContentTypeTextPlain, "79927398713", "key-2")
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	w = send("/api/user/orders", ContentTypeTextPlain, "79927398713", "key-2")
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, "true", w.Header().Get(idempotency.HeaderReplayed))
+
+	w = send("/api/user/orders", ContentTypeTextPlain, "79927398713", "")
+	assert.Equal(t, http.StatusOK, w.Code, "requests without a key are not replayed")
+
+	w = send("/api/user/orders", ContentTypeTextPlain, "79927398713", "key-3")
+	assert.Equal(t, http.StatusOK, w.Code, "keys are independent")
+}
+
+func TestIdempotencyKeyThrottled(t *testing.T) {
+	st := memory.New()
+	gm := gophermart.New(st)
+	gm.SetTOTPConfig(gophermart.TOTPConfig{WithdrawThreshold: 100})
+	gm.SetLoginGuardConfig(gophermart.LoginGuardConfig{FreeAttempts: 100, LockAfter: 1})
+	h := New(gm)
+
+	session, err := gm.Register(&gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}, gophermart.Client{})
+	require.NoError(t, err)
+	enrollment, err := gm.EnrollTOTP(session.UserID)
+	require.NoError(t, err)
+	code, err := totp.Code(enrollment.Secret, time.Now())
+	require.NoError(t, err)
+	_, err = gm.ConfirmTOTP(session.UserID, code, gophermart.Client{})
+	require.NoError(t, err)
+
+	_, err = gm.Login(&gophermart.Credentials{Login: "testov", Password: "guess"}, "", gophermart.Client{})
+	require.ErrorIs(t, err, gophermart.ErrInvalidPair)
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/user/balance/withdraw", bytes.NewBufferString(`{"order":"2377225624","sum":5}`))
+		req.Header.Set("Content-Type", ContentTypeApplicationJSON)
+		req.Header.Set(HeaderTOTPCode, "000000")
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: session.Token})
+		req.Header.Set(idempotency.HeaderKey, "key-1")
+		w := httptest.NewRecorder()
+		h.GetRouter().ServeHTTP(w, req)
+		return w
+	}
+
+	w := send()
+	require.Equal(t, http.StatusTooManyRequests, w.Code, w.Body.String())
+
+	require.NoError(t, gm.Unlock("testov"))
+	w = send()
+	assert.Empty(t, w.Header().Get(idempotency.HeaderReplayed), "throttled requests are not replayed")
+	assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+}
+
+func TestIdempotencyKeyPanic(t *testing.T) {
+	gm := gophermart.New(memory.New())
+	session, err := gm.Register(&gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}, gophermart.Client{})
+	require.NoError(t, err)
+
+	calls := 0
+	h := middleware.Recoverer(idempotency.Keys(gm.IdempotencyKeys)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			panic("boom")
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})))
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/user/orders", bytes.NewBufferString("79927398713"))
+		req = req.WithContext(context.WithValue(req.Context(), auth.SessionKey{}, session))
+		req.Header.Set(idempotency.HeaderKey, "key-1")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusInternalServerError, send().Code)
+	assert.Equal(t, http.StatusAccepted, send().Code, "the key of a panicked request is released")
+	assert.Equal(t, 2, calls)
+}
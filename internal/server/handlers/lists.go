@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseListQuery reads the page, the filters and the sort order of a list
+// from the query string. Times are RFC 3339, amounts are decimal and
+// statuses are comma separated.
+func parseListQuery(r *http.Request, userID uint64) (gophermart.ListQuery, error) {
+	q := r.URL.Query()
+	lq := gophermart.ListQuery{UserID: userID, Sort: q.Get("sort")}
+
+	var err error
+	if s := q.Get("limit"); s != "" {
+		limit, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return lq, fmt.Errorf("%w: limit must be a number", gophermart.ErrListQueryInvalid)
+		}
+		lq.Limit = uint32(limit)
+	}
+	if s := q.Get("cursor"); s != "" {
+		lq.After, err = gophermart.ParseCursor(s)
+		if err != nil {
+			return lq, err
+		}
+	}
+	if s := q.Get("status"); s != "" {
+		lq.Statuses = strings.Split(s, ",")
+	}
+
+	times := []struct {
+		name string
+		v    *time.Time
+	}{
+		{"from", &lq.From},
+		{"to", &lq.To},
+	}
+	for _, t := range times {
+		s := q.Get(t.name)
+		if s == "" {
+			continue
+		}
+		*t.v, err = time.Parse(time.RFC3339, s)
+		if err != nil {
+			return lq, fmt.Errorf("%w: %s must be an RFC 3339 time", gophermart.ErrListQueryInvalid, t.name)
+		}
+	}
+
+	amounts := []struct {
+		name string
+		v    *gophermart.Money
+	}{
+		{"min", &lq.MinAmount},
+		{"max", &lq.MaxAmount},
+	}
+	for _, a := range amounts {
+		s := q.Get(a.name)
+		if s == "" {
+			continue
+		}
+		*a.v, err = gophermart.ParseMoney(s)
+		if err != nil {
+			return lq, fmt.Errorf("%w: %s - %s", gophermart.ErrListQueryInvalid, a.name, err)
+		}
+	}
+
+	return lq, nil
+}
+
+func isListQueryError(err error) bool {
+	return errors.Is(err, gophermart.ErrListQueryInvalid) || errors.Is(err, gophermart.ErrCursorInvalid)
+}
+
+// setNextLink points the Link header at the next page, the request with the
+// cursor replaced.
+func setNextLink(w http.ResponseWriter, r *http.Request, next string) {
+	if next == "" {
+		return
+	}
+
+	q := r.URL.Query()
+	q.Set("cursor", next)
+	w.Header().Set("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, r.URL.Path, q.Encode()))
+}
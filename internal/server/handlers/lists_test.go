@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/Osselnet/gophermart.git/internal/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestListPagination(t *testing.T) {
+	st := memory.New()
+	gm := gophermart.New(st)
+	h := New(gm)
+
+	session, err := gm.Register(&gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}, gophermart.Client{})
+	require.NoError(t, err)
+	start := time.Now().Add(-time.Hour)
+	for i := uint64(1); i <= 3; i++ {
+		require.NoError(t, st.AddOrder(&gophermart.Order{ID: i, UserID: session.UserID, Status: gophermart.StatusNew,
+			UploadedAt: start.Add(time.Duration(i) * time.Minute)}))
+	}
+
+	send := func(url string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: session.Token})
+		w := httptest.NewRecorder()
+		h.GetRouter().ServeHTTP(w, req)
+		return w
+	}
+
+	w := send("/api/user/orders?limit=2&status=new")
+	require.Equal(t, http.StatusOK, w.Code)
+	var ors []gophermart.OrderProxy
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &ors))
+	require.Len(t, ors, 2)
+	assert.Equal(t, "1", ors[0].Number)
+
+	link := regexp.MustCompile(`^<(/api/user/orders\?[^>]+)>; rel="next"$`).FindStringSubmatch(w.Header().Get("Link"))
+	require.Len(t, link, 2)
+	assert.Contains(t, link[1], "status=new", "filters are kept")
+
+	w = send(link[1])
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &ors))
+	require.Len(t, ors, 1)
+	assert.Equal(t, "3", ors[0].Number)
+	assert.Empty(t, w.Header().Get("Link"), "last page")
+
+	assert.Equal(t, http.StatusNoContent, send("/api/user/orders?status=processed").Code)
+	assert.Equal(t, http.StatusBadRequest, send("/api/user/orders?cursor=garbage").Code)
+	assert.Equal(t, http.StatusBadRequest, send("/api/user/orders?sort=sum").Code)
+	assert.Equal(t, http.StatusBadRequest, send("/api/user/orders?from=yesterday").Code)
+	assert.Equal(t, http.StatusBadRequest, send("/api/user/withdrawals?min=-1").Code)
+	assert.Equal(t, http.StatusNoContent, send("/api/user/withdrawals?sort=-sum").Code)
+}
@@ -5,19 +5,15 @@ import (
 	"errors"
 	"fmt"
 	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/Osselnet/gophermart.git/internal/server/middleware/auth"
 	"io"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 )
 
 func (h *handler) register(w http.ResponseWriter, r *http.Request) {
-	ct := r.Header.Get("Content-Type")
-	if ct != ContentTypeApplicationJSON {
-		err := fmt.Errorf("wrong content type, JSON needed")
-		h.error(w, r, err, http.StatusBadRequest)
-		return
-	}
-
 	reqBody, err := io.ReadAll(r.Body)
 	if err != nil {
 		h.error(w, r, fmt.Errorf("failed to read request body - %w", err), http.StatusInternalServerError)
@@ -32,13 +28,17 @@ func (h *handler) register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	session, err := h.gm.Register(&creds)
+	session, err := h.gm.Register(&creds, auth.ClientFromRequest(r))
 	if err != nil {
 		msg := "failed to register new user"
 		if errors.Is(err, gophermart.ErrLoginAlreadyTaken) {
 			h.error(w, r, fmt.Errorf("%s - %w", msg, err), http.StatusConflict)
 			return
 		}
+		if errors.Is(err, gophermart.ErrPasswordWeak) {
+			h.error(w, r, fmt.Errorf("%s - %w", msg, err), http.StatusUnprocessableEntity)
+			return
+		}
 		h.error(w, r, fmt.Errorf("%s - %w", msg, err), http.StatusInternalServerError)
 		return
 	}
@@ -47,11 +47,7 @@ func (h *handler) register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:    "session_token",
-		Value:   session.Token,
-		Expires: session.Expiry,
-	})
+	h.setAuthCookies(w, session)
 
 	msg := fmt.Sprintf("session for user `%s` successfully created", creds.Login)
 	h.log(r, LogLvlDebug, msg)
@@ -65,14 +61,21 @@ func (h *handler) login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var sessionToken string
-	c, err := r.Cookie("session_token")
-	if err == nil {
-		sessionToken = c.Value
+	oldToken := refreshToken(r)
+	if oldToken == "" {
+		oldToken = auth.AccessToken(r)
 	}
 
-	session, err := h.gm.Login(creds, sessionToken)
+	session, err := h.gm.Login(creds, oldToken, auth.ClientFromRequest(r))
 	if err != nil {
+		var totpErr *gophermart.TOTPRequiredError
+		if errors.As(err, &totpErr) {
+			h.totpRequired(w, r, totpErr)
+			return
+		}
+		if h.loginThrottled(w, r, err) {
+			return
+		}
 		if errors.Is(err, gophermart.ErrInvalidPair) || errors.Is(err, gophermart.ErrUserNotFound) {
 			h.error(w, r, gophermart.ErrInvalidPair, http.StatusUnauthorized)
 			return
@@ -85,39 +88,115 @@ func (h *handler) login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:    "session_token",
-		Value:   session.Token,
-		Expires: session.Expiry,
-	})
+	h.setAuthCookies(w, session)
 	msg := fmt.Sprintf("session for user `%s` successfully created", creds.Login)
 	h.log(r, LogLvlDebug, msg)
 }
 
-func (h *handler) logout(w http.ResponseWriter, r *http.Request) {
-	c, err := r.Cookie("session_token")
+func (h *handler) refresh(w http.ResponseWriter, r *http.Request) {
+	token := refreshToken(r)
+	if token == "" {
+		h.error(w, r, gophermart.ErrUnauthorizedAccess, http.StatusUnauthorized)
+		return
+	}
+
+	session, err := h.gm.Refresh(token, auth.ClientFromRequest(r))
 	if err != nil {
-		if err == http.ErrNoCookie {
-			h.error(w, r, gophermart.ErrUnauthorizedAccess, http.StatusUnauthorized)
+		if errors.Is(err, gophermart.ErrTokenReused) {
+			h.log(r, LogLvlWarning, "refresh token reused, session revoked")
+			h.clearAuthCookies(w)
+		}
+		if errors.Is(err, gophermart.ErrTokenInvalid) || errors.Is(err, gophermart.ErrTokenExpired) ||
+			errors.Is(err, gophermart.ErrTokenReused) || errors.Is(err, gophermart.ErrSessionNotFound) {
+			h.error(w, r, err, http.StatusUnauthorized)
 			return
 		}
-		h.error(w, r, err, http.StatusBadRequest)
+		h.error(w, r, err, http.StatusInternalServerError)
 		return
 	}
 
-	err = h.gm.Logout(c.Value)
+	h.setAuthCookies(w, session)
+	h.log(r, LogLvlDebug, fmt.Sprintf("session %s refreshed", session.ID))
+}
+
+func (h *handler) logout(w http.ResponseWriter, r *http.Request) {
+	token := refreshToken(r)
+	if token == "" {
+		token = auth.AccessToken(r)
+	}
+	if token == "" {
+		h.error(w, r, gophermart.ErrUnauthorizedAccess, http.StatusUnauthorized)
+		return
+	}
+
+	err := h.gm.Logout(token, auth.ClientFromRequest(r))
 	if err != nil {
 		h.log(r, LogLvlError, fmt.Sprintf("failed to delete session - %s", err))
 	}
 
+	h.clearAuthCookies(w)
+	h.log(r, LogLvlDebug, "logout")
+}
+
+// loginThrottled answers 429 with Retry-After if the login was refused by the
+// brute-force protection.
+func (h *handler) loginThrottled(w http.ResponseWriter, r *http.Request, err error) bool {
+	var throttled *gophermart.LoginThrottledError
+	if !errors.As(err, &throttled) {
+		return false
+	}
+
+	retryAfter := int(math.Ceil(time.Until(throttled.Until).Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	h.error(w, r, err, http.StatusTooManyRequests)
+
+	return true
+}
+
+func refreshToken(r *http.Request) string {
+	c, err := r.Cookie(auth.CookieRefreshToken)
+	if err != nil {
+		return ""
+	}
+
+	return c.Value
+}
+
+func (h *handler) setAuthCookies(w http.ResponseWriter, session *gophermart.Session) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     auth.CookieAccessToken,
+		Value:    session.Token,
+		Path:     "/",
+		Expires:  session.TokenExpiry,
+		HttpOnly: true,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     auth.CookieRefreshToken,
+		Value:    session.RefreshToken,
+		Path:     "/api/user",
+		Expires:  session.Expiry,
+		HttpOnly: true,
+	})
+}
+
+func (h *handler) clearAuthCookies(w http.ResponseWriter) {
 	http.SetCookie(w, &http.Cookie{
-		Name:    "session_token",
+		Name:    auth.CookieAccessToken,
 		Value:   "",
+		Path:    "/",
 		Expires: time.Now(),
+		MaxAge:  -1,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:    auth.CookieRefreshToken,
+		Value:   "",
+		Path:    "/api/user",
+		Expires: time.Now(),
+		MaxAge:  -1,
 	})
-
-	msg := fmt.Sprintf("logout session %s", c.Value)
-	h.log(r, LogLvlDebug, msg)
 }
 
 func (h *handler) welcome(w http.ResponseWriter, r *http.Request) {
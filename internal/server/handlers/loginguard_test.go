@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/Osselnet/gophermart.git/internal/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoginThrottled(t *testing.T) {
+	gm := gophermart.New(memory.New())
+	gm.SetLoginGuardConfig(gophermart.LoginGuardConfig{FreeAttempts: 1, BaseDelay: time.Minute, MaxDelay: time.Hour})
+	h := New(gm)
+
+	_, err := gm.Register(&gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}, gophermart.Client{})
+	require.NoError(t, err)
+
+	login := func(password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/user/login",
+			strings.NewReader(`{"login":"testov","password":"`+password+`"}`))
+		req.Header.Set("Content-Type", ContentTypeApplicationJSON)
+		w := httptest.NewRecorder()
+		h.GetRouter().ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, login("wrong").Code)
+	assert.Equal(t, http.StatusUnauthorized, login("wrong").Code)
+
+	w := login("Passw0rd33")
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After"))
+	require.NoError(t, err)
+	assert.InDelta(t, 60, retryAfter, 5)
+}
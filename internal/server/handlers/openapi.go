@@ -0,0 +1,13 @@
+package handlers
+
+import (
+	"github.com/Osselnet/gophermart.git/internal/server/middleware/openapi"
+	"net/http"
+)
+
+// openAPI serves the OpenAPI document the requests to /api/user are
+// checked against.
+func (h *handler) openAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", ContentTypeApplicationJSON)
+	w.Write(openapi.Document())
+}
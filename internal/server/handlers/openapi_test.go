@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/Osselnet/gophermart.git/internal/memory"
+	"github.com/Osselnet/gophermart.git/internal/server/middleware/openapi"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// TestOpenAPIRoutes fails when a route of /api/user is added to the router
+// but not to the document, or the other way round.
+func TestOpenAPIRoutes(t *testing.T) {
+	spec, err := openapi.Load()
+	require.NoError(t, err)
+
+	var routes []openapi.Route
+	err = chi.Walk(New(gophermart.New(memory.New())).GetRouter(),
+		func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+			if route != "/api/user" && !strings.HasPrefix(route, "/api/user/") {
+				return nil
+			}
+			// The account itself is routed as "/" of /api/user.
+			routes = append(routes, openapi.Route{Method: method, Path: strings.TrimSuffix(route, "/")})
+			return nil
+		})
+	require.NoError(t, err)
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+
+	assert.Equal(t, spec.Routes(), routes, "routes of handlers.New and openapi.json differ")
+}
+
+func TestOpenAPI(t *testing.T) {
+	gm := gophermart.New(memory.New())
+	h := New(gm)
+
+	session, err := gm.Register(&gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}, gophermart.Client{})
+	require.NoError(t, err)
+
+	send := func(method, url, contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: session.Token})
+		w := httptest.NewRecorder()
+		h.GetRouter().ServeHTTP(w, req)
+		return w
+	}
+
+	w := send(http.MethodGet, "/api/openapi.json", "", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	assert.Equal(t, "3.0.3", doc["openapi"])
+
+	// Bodies that pass are put back for the handler.
+	w = send(http.MethodPost, "/api/user/register", "application/json; charset=utf-8", `{"login":"other","password":"Passw0rd33"}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// Requests without credentials are refused before they are validated.
+	req := httptest.NewRequest(http.MethodPost, "/api/user/balance/withdraw", strings.NewReader(`{"order":"2377225624","sum":"1"}`))
+	req.Header.Set("Content-Type", ContentTypeApplicationJSON)
+	w = httptest.NewRecorder()
+	h.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code, w.Body.String())
+
+	for _, tc := range []struct {
+		name        string
+		method      string
+		url         string
+		contentType string
+		body        string
+		code        int
+		msg         string
+	}{
+		{"wrong content type", http.MethodPost, "/api/user/register", ContentTypeTextPlain, `{"login":"a","password":"b"}`,
+			http.StatusBadRequest, "wrong content type, application/json needed"},
+		{"wrong type of field", http.MethodPost, "/api/user/register", ContentTypeApplicationJSON, `{"login":1,"password":"b"}`,
+			http.StatusBadRequest, "field login must be a string"},
+		{"missing field", http.MethodPost, "/api/user/login", ContentTypeApplicationJSON, `{"login":"a"}`,
+			http.StatusBadRequest, "field password is required"},
+		{"not an object", http.MethodPost, "/api/user/login", ContentTypeApplicationJSON, `["a"]`,
+			http.StatusBadRequest, "request body must be an object"},
+		{"data after the body", http.MethodPost, "/api/user/login", ContentTypeApplicationJSON, `{"login":"a","password":"b"} {}`,
+			http.StatusBadRequest, "not valid JSON"},
+		{"missing body", http.MethodPost, "/api/user/orders", ContentTypeTextPlain, "",
+			http.StatusBadRequest, "request body is required"},
+		{"sum as string", http.MethodPost, "/api/user/balance/withdraw", ContentTypeApplicationJSON, `{"order":"2377225624","sum":"1"}`,
+			http.StatusBadRequest, "field sum must be a number"},
+		{"nested field", http.MethodPost, "/api/user/api-keys", ContentTypeApplicationJSON, `{"name":"erp","scopes":["withdraw",1]}`,
+			http.StatusBadRequest, "field scopes[1] must be a string"},
+		{"bad time", http.MethodPost, "/api/user/api-keys", ContentTypeApplicationJSON, `{"name":"erp","scopes":[],"expires_at":"soon"}`,
+			http.StatusBadRequest, "field expires_at must be an RFC 3339 time"},
+		{"integer parameter", http.MethodGet, "/api/user/orders?limit=ten", "", "",
+			http.StatusBadRequest, "query parameter limit must be an integer"},
+		{"parameter limit", http.MethodGet, "/api/user/orders?limit=1001", "", "",
+			http.StatusBadRequest, "query parameter limit must be at most 1000"},
+		{"enum parameter", http.MethodGet, "/api/user/withdrawals?sort=accrual", "", "",
+			http.StatusBadRequest, "query parameter sort must be one of"},
+		{"empty parameter", http.MethodGet, "/api/user/orders?limit=", "", "",
+			http.StatusNoContent, ""},
+		{"body of an operation without one", http.MethodGet, "/api/user/balance", ContentTypeApplicationJSON, "garbage",
+			http.StatusOK, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := send(tc.method, tc.url, tc.contentType, tc.body)
+			assert.Equal(t, tc.code, w.Code, w.Body.String())
+			assert.Contains(t, w.Body.String(), tc.msg)
+		})
+	}
+}
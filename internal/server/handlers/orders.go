@@ -5,20 +5,13 @@ import (
 	"errors"
 	"fmt"
 	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/Osselnet/gophermart.git/internal/server/middleware/auth"
 	"io"
 	"net/http"
 	"strconv"
 )
 
 func (h *handler) postOrders(w http.ResponseWriter, r *http.Request) {
-	var err error
-
-	ct := r.Header.Get("Content-Type")
-	if ct != ContentTypeTextPlain {
-		err = fmt.Errorf("wrong content type, %s needed", ContentTypeTextPlain)
-		h.error(w, r, err, http.StatusBadRequest)
-		return
-	}
 	c := h.getSessionFromReqContext(r)
 	if c == nil {
 		return
@@ -43,7 +36,7 @@ func (h *handler) postOrders(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.gm.PostOrders(uint64(orderID), u.ID)
+	err = h.gm.PostOrders(uint64(orderID), u.ID, auth.ClientFromRequest(r))
 	if err != nil {
 		if errors.Is(err, gophermart.ErrOrderAlreadyLoadedByUser) {
 			w.WriteHeader(http.StatusOK)
@@ -84,9 +77,17 @@ func (h *handler) getOrders(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID := u.ID
+	lq, err := parseListQuery(r, u.ID)
+	if err != nil {
+		h.error(w, r, err, http.StatusBadRequest)
+		return
+	}
 
-	proxyOrders, err := h.gm.GetOrders(userID)
+	proxyOrders, next, err := h.gm.ListOrders(lq)
+	if isListQueryError(err) {
+		h.error(w, r, err, http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		h.error(w, r, fmt.Errorf("failed to get all orders - %w", err), http.StatusInternalServerError)
 		return
@@ -103,6 +104,7 @@ func (h *handler) getOrders(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setNextLink(w, r, next)
 	w.Header().Set("Content-Type", ContentTypeApplicationJSON)
 	w.Write(body)
 }
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"time"
+)
+
+type sessionProxy struct {
+	ID         string `json:"id"`
+	CreatedAt  string `json:"created_at"`
+	LastSeenAt string `json:"last_seen_at"`
+	IP         string `json:"ip"`
+	UserAgent  string `json:"user_agent"`
+	Current    bool   `json:"current"`
+}
+
+func (h *handler) getSessions(w http.ResponseWriter, r *http.Request) {
+	c := h.getSessionFromReqContext(r)
+	if c == nil {
+		return
+	}
+
+	sns, err := h.gm.Sessions.ListForUser(c.UserID)
+	if err != nil {
+		h.error(w, r, fmt.Errorf("failed to get sessions - %w", err), http.StatusInternalServerError)
+		return
+	}
+
+	sPr := make([]*sessionProxy, 0, len(sns))
+	for _, s := range sns {
+		sPr = append(sPr, &sessionProxy{
+			ID:         s.ID,
+			CreatedAt:  s.CreatedAt.Format(time.RFC3339),
+			LastSeenAt: s.LastSeenAt.Format(time.RFC3339),
+			IP:         s.IP,
+			UserAgent:  s.UserAgent,
+			Current:    s.ID == c.ID,
+		})
+	}
+
+	body, err := json.Marshal(&sPr)
+	if err != nil {
+		h.error(w, r, fmt.Errorf("failed to marshal JSON - %w", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", ContentTypeApplicationJSON)
+	w.Write(body)
+}
+
+func (h *handler) deleteSession(w http.ResponseWriter, r *http.Request) {
+	c := h.getSessionFromReqContext(r)
+	if c == nil {
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	err := h.gm.Sessions.Revoke(c.UserID, id)
+	if errors.Is(err, gophermart.ErrSessionNotFound) {
+		h.error(w, r, gophermart.ErrSessionNotFound, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.error(w, r, fmt.Errorf("failed to revoke session - %w", err), http.StatusInternalServerError)
+		return
+	}
+
+	if id == c.ID {
+		h.clearAuthCookies(w)
+	}
+	w.WriteHeader(http.StatusNoContent)
+	h.log(r, LogLvlInfo, fmt.Sprintf("session %s of user %d revoked", id, c.UserID))
+}
+
+func (h *handler) revokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	c := h.getSessionFromReqContext(r)
+	if c == nil {
+		return
+	}
+
+	ids, err := h.gm.Sessions.RevokeAll(c.UserID)
+	if err != nil {
+		h.error(w, r, fmt.Errorf("failed to revoke sessions - %w", err), http.StatusInternalServerError)
+		return
+	}
+
+	h.clearAuthCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+	h.log(r, LogLvlInfo, fmt.Sprintf("%d sessions of user %d revoked", len(ids), c.UserID))
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/Osselnet/gophermart.git/internal/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSessions(t *testing.T) {
+	gm := gophermart.New(memory.New())
+	h := New(gm)
+
+	creds := &gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}
+	phone, err := gm.Register(creds, gophermart.Client{IP: "192.0.2.10", UserAgent: "phone"})
+	require.NoError(t, err)
+	laptop, err := gm.Login(creds, "", gophermart.Client{IP: "192.0.2.20", UserAgent: "laptop"})
+	require.NoError(t, err)
+
+	send := func(method, url, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("X-Real-IP", "192.0.2.30")
+		req.Header.Set("User-Agent", "phone")
+		w := httptest.NewRecorder()
+		h.GetRouter().ServeHTTP(w, req)
+		return w
+	}
+
+	w := send(http.MethodGet, "/api/user/sessions", phone.Token)
+	require.Equal(t, http.StatusOK, w.Code)
+	var list []sessionProxy
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list, 2)
+	for _, s := range list {
+		switch s.ID {
+		case phone.ID:
+			assert.True(t, s.Current)
+			assert.Equal(t, "192.0.2.30", s.IP, "address is taken from the latest request")
+		case laptop.ID:
+			assert.False(t, s.Current)
+			assert.Equal(t, "192.0.2.20", s.IP)
+			assert.Equal(t, "laptop", s.UserAgent)
+		default:
+			t.Errorf("unexpected session %s", s.ID)
+		}
+	}
+
+	assert.Equal(t, http.StatusOK, send(http.MethodGet, "/api/user/welcome", laptop.Token).Code)
+	assert.Equal(t, http.StatusNoContent, send(http.MethodDelete, "/api/user/sessions/"+laptop.ID, phone.Token).Code)
+	assert.Equal(t, http.StatusUnauthorized, send(http.MethodGet, "/api/user/welcome", laptop.Token).Code, "revoked at once")
+	assert.Equal(t, http.StatusNotFound, send(http.MethodDelete, "/api/user/sessions/"+laptop.ID, phone.Token).Code)
+
+	other, err := gm.Register(&gophermart.Credentials{Login: "other", Password: "Passw0rd33"}, gophermart.Client{})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, send(http.MethodDelete, "/api/user/sessions/"+other.ID, phone.Token).Code,
+		"sessions of other users can't be revoked")
+
+	assert.Equal(t, http.StatusNoContent, send(http.MethodPost, "/api/user/sessions/revoke-all", phone.Token).Code)
+	assert.Equal(t, http.StatusUnauthorized, send(http.MethodGet, "/api/user/welcome", phone.Token).Code)
+	assert.Equal(t, http.StatusOK, send(http.MethodGet, "/api/user/welcome", other.Token).Code)
+}
@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/Osselnet/gophermart.git/pkg/pdf"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	ContentTypePDF = "application/pdf"
+
+	statementDate = "2006-01-02"
+	// statementRefWidth fits order numbers, adjustment IDs are cut in PDF.
+	statementRefWidth = 24
+)
+
+// statementStream sends the headers once the statement is known to be
+// valid, nothing has been written to w before.
+type statementStream struct {
+	w           http.ResponseWriter
+	contentType string
+	ext         string
+	started     bool
+}
+
+func (s *statementStream) start(q gophermart.StatementQuery) {
+	s.w.Header().Set("Content-Type", s.contentType)
+	s.w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="statement-%s-%s.%s"`,
+		q.From.UTC().Format(statementDate), q.To.UTC().Format(statementDate), s.ext))
+	s.w.WriteHeader(http.StatusOK)
+	s.started = true
+}
+
+func statementKind(kind string) string {
+	return strings.ToLower(kind)
+}
+
+type statementCSV struct {
+	*statementStream
+	cw *csv.Writer
+}
+
+func (s *statementCSV) Open(q gophermart.StatementQuery, opening gophermart.Money) error {
+	s.start(q)
+	s.cw = csv.NewWriter(s.w)
+	_ = s.cw.Write([]string{"date", "type", "reference", "credit", "debit", "balance"})
+	_ = s.cw.Write([]string{q.From.UTC().Format(time.RFC3339), "opening_balance", "", "", "", opening.String()})
+
+	return s.cw.Error()
+}
+
+func (s *statementCSV) Line(l *gophermart.StatementLine) error {
+	var credit, debit string
+	if l.Credit != 0 {
+		credit = l.Credit.String()
+	}
+	if l.Debit != 0 {
+		debit = l.Debit.String()
+	}
+
+	return s.cw.Write([]string{l.Date.UTC().Format(time.RFC3339), statementKind(l.Kind), l.Ref, credit, debit, l.Balance.String()})
+}
+
+func (s *statementCSV) Close(t gophermart.StatementTotals) error {
+	_ = s.cw.Write([]string{"", "closing_balance", "", t.Credits.String(), t.Debits.String(), t.Closing.String()})
+	s.cw.Flush()
+
+	return s.cw.Error()
+}
+
+type statementLineJSON struct {
+	Date      string           `json:"date"`
+	Type      string           `json:"type"`
+	Reference string           `json:"reference"`
+	Credit    gophermart.Money `json:"credit,omitempty"`
+	Debit     gophermart.Money `json:"debit,omitempty"`
+	Balance   gophermart.Money `json:"balance"`
+}
+
+// statementJSON writes one object, entries are written as they come and
+// the totals follow them.
+type statementJSON struct {
+	*statementStream
+	bw    *bufio.Writer
+	lines int
+}
+
+func (s *statementJSON) Open(q gophermart.StatementQuery, opening gophermart.Money) error {
+	s.start(q)
+	s.bw = bufio.NewWriter(s.w)
+	_, err := fmt.Fprintf(s.bw, `{"from":%q,"to":%q,"opening_balance":%s,"entries":[`,
+		q.From.UTC().Format(time.RFC3339), q.To.UTC().Format(time.RFC3339), opening)
+
+	return err
+}
+
+func (s *statementJSON) Line(l *gophermart.StatementLine) error {
+	data, err := json.Marshal(&statementLineJSON{
+		Date:      l.Date.UTC().Format(time.RFC3339),
+		Type:      statementKind(l.Kind),
+		Reference: l.Ref,
+		Credit:    l.Credit,
+		Debit:     l.Debit,
+		Balance:   l.Balance,
+	})
+	if err != nil {
+		return err
+	}
+
+	if s.lines > 0 {
+		s.bw.WriteByte(',')
+	}
+	s.lines++
+	_, err = s.bw.Write(data)
+
+	return err
+}
+
+func (s *statementJSON) Close(t gophermart.StatementTotals) error {
+	_, err := fmt.Fprintf(s.bw, `],"credits":%s,"debits":%s,"closing_balance":%s}`, t.Credits, t.Debits, t.Closing)
+	if err != nil {
+		return err
+	}
+
+	return s.bw.Flush()
+}
+
+type statementPDF struct {
+	*statementStream
+	p *pdf.Writer
+}
+
+const statementPDFRow = "%-16s %-10s %-24s %11s %11s %12s"
+
+func (s *statementPDF) Open(q gophermart.StatementQuery, opening gophermart.Money) error {
+	s.start(q)
+	s.p = pdf.New(s.w)
+
+	s.p.Line("Account statement", true)
+	s.p.Line(fmt.Sprintf("Period: %s - %s", q.From.UTC().Format(time.RFC3339), q.To.UTC().Format(time.RFC3339)), false)
+	s.p.Line(fmt.Sprintf("Opening balance: %s", opening), false)
+	s.p.Space()
+
+	header := func() {
+		s.p.Line(fmt.Sprintf(statementPDFRow, "Date", "Type", "Reference", "Credit", "Debit", "Balance"), true)
+	}
+	header()
+	s.p.SetHeader(header)
+
+	return nil
+}
+
+func (s *statementPDF) Line(l *gophermart.StatementLine) error {
+	var credit, debit string
+	if l.Credit != 0 {
+		credit = l.Credit.String()
+	}
+	if l.Debit != 0 {
+		debit = l.Debit.String()
+	}
+	ref := l.Ref
+	if len(ref) > statementRefWidth {
+		ref = ref[:statementRefWidth]
+	}
+
+	s.p.Line(fmt.Sprintf(statementPDFRow, l.Date.UTC().Format("2006-01-02 15:04"), statementKind(l.Kind), ref,
+		credit, debit, l.Balance), false)
+
+	return nil
+}
+
+func (s *statementPDF) Close(t gophermart.StatementTotals) error {
+	s.p.SetHeader(nil)
+	s.p.Space()
+	s.p.Line(fmt.Sprintf(statementPDFRow, "", "Total", "", t.Credits, t.Debits, ""), true)
+	s.p.Line(fmt.Sprintf("Closing balance: %s", t.Closing), true)
+
+	return s.p.Close()
+}
+
+// parseStatementTime takes RFC 3339 times and dates, dates are midnight UTC.
+func parseStatementTime(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, s)
+	if err == nil {
+		return t, nil
+	}
+
+	return time.Parse(statementDate, s)
+}
+
+// getStatement streams the statement of the user for [from, to) as JSON,
+// CSV or PDF, the current month by default.
+func (h *handler) getStatement(w http.ResponseWriter, r *http.Request) {
+	c := h.getSessionFromReqContext(r)
+	if c == nil {
+		return
+	}
+
+	q := gophermart.StatementQuery{UserID: c.UserID}
+	var err error
+	for name, v := range map[string]*time.Time{"from": &q.From, "to": &q.To} {
+		s := r.URL.Query().Get(name)
+		if s == "" {
+			continue
+		}
+		*v, err = parseStatementTime(s)
+		if err != nil {
+			h.error(w, r, fmt.Errorf("%s must be a date or an RFC 3339 time", name), http.StatusBadRequest)
+			return
+		}
+	}
+
+	stream := &statementStream{w: w, contentType: ContentTypeApplicationJSON, ext: "json"}
+	var sw gophermart.StatementWriter
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+		sw = &statementJSON{statementStream: stream}
+	case "csv":
+		stream.contentType, stream.ext = ContentTypeTextCSV, "csv"
+		sw = &statementCSV{statementStream: stream}
+	case "pdf":
+		stream.contentType, stream.ext = ContentTypePDF, "pdf"
+		sw = &statementPDF{statementStream: stream}
+	default:
+		h.error(w, r, fmt.Errorf("unknown format %s, json, csv or pdf needed", format), http.StatusBadRequest)
+		return
+	}
+
+	err = h.gm.Statement(q, sw)
+	if err != nil && stream.started {
+		// The status has been sent, the client gets a cut statement.
+		h.log(r, LogLvlError, fmt.Sprintf("failed to write statement - %s", err))
+		return
+	}
+	if errors.Is(err, gophermart.ErrStatementInvalid) {
+		h.error(w, r, err, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.error(w, r, fmt.Errorf("failed to write statement - %w", err), http.StatusInternalServerError)
+	}
+}
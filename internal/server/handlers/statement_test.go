@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/Osselnet/gophermart.git/internal/memory"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStatement(t *testing.T) {
+	st := memory.New()
+	gm := gophermart.New(st)
+	h := New(gm)
+
+	session, err := gm.Register(&gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}, gophermart.Client{})
+	require.NoError(t, err)
+	at := time.Date(2026, time.September, 10, 12, 0, 0, 0, time.UTC)
+	for _, adj := range []struct {
+		direction string
+		amount    gophermart.Money
+		at        time.Time
+	}{
+		{gophermart.DirectionCredit, 10000, at.AddDate(0, -1, 0)},
+		{gophermart.DirectionCredit, 2550, at},
+		{gophermart.DirectionDebit, 1000, at.Add(time.Hour)},
+	} {
+		_, err = st.AdjustBalance(&gophermart.Adjustment{ID: uuid.NewString(), UserID: session.UserID, Direction: adj.direction,
+			Amount: adj.amount, Reason: "test", CreatedAt: adj.at}, nil, false)
+		require.NoError(t, err)
+	}
+
+	send := func(url string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: session.Token})
+		w := httptest.NewRecorder()
+		h.GetRouter().ServeHTTP(w, req)
+		return w
+	}
+
+	w := send("/api/user/statement?from=2026-09-01&to=2026-10-01")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, ContentTypeApplicationJSON, w.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="statement-2026-09-01-2026-10-01.json"`, w.Header().Get("Content-Disposition"))
+	var statement struct {
+		OpeningBalance gophermart.Money    `json:"opening_balance"`
+		Entries        []statementLineJSON `json:"entries"`
+		Credits        gophermart.Money    `json:"credits"`
+		Debits         gophermart.Money    `json:"debits"`
+		ClosingBalance gophermart.Money    `json:"closing_balance"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &statement))
+	assert.Equal(t, gophermart.Money(10000), statement.OpeningBalance)
+	require.Len(t, statement.Entries, 2)
+	assert.Equal(t, "2026-09-10T12:00:00Z", statement.Entries[0].Date)
+	assert.Equal(t, "adjustment", statement.Entries[0].Type)
+	assert.Equal(t, gophermart.Money(12550), statement.Entries[0].Balance)
+	assert.Equal(t, gophermart.Money(1000), statement.Entries[1].Debit)
+	assert.Equal(t, gophermart.Money(11550), statement.ClosingBalance)
+
+	w = send("/api/user/statement?from=2026-09-01&to=2026-10-01&format=csv")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, ContentTypeTextCSV, w.Header().Get("Content-Type"))
+	rows, err := csv.NewReader(w.Body).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 5)
+	assert.Equal(t, []string{"2026-09-01T00:00:00Z", "opening_balance", "", "", "", "100"}, rows[1])
+	assert.Equal(t, "125.5", rows[2][5])
+	assert.Equal(t, []string{"", "closing_balance", "", "25.5", "10", "115.5"}, rows[4])
+
+	w = send("/api/user/statement?from=2026-09-01&to=2026-10-01&format=pdf")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, ContentTypePDF, w.Header().Get("Content-Type"))
+	assert.True(t, bytes.HasPrefix(w.Body.Bytes(), []byte("%PDF-")))
+
+	w = send("/api/user/statement?from=2026-10-01&to=2026-11-01")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &statement))
+	assert.Empty(t, statement.Entries)
+	assert.Equal(t, gophermart.Money(11550), statement.OpeningBalance)
+
+	assert.Equal(t, http.StatusBadRequest, send("/api/user/statement?format=xls").Code)
+	assert.Equal(t, http.StatusBadRequest, send("/api/user/statement?from=yesterday").Code)
+	assert.Equal(t, http.StatusBadRequest, send("/api/user/statement?from=2026-10-01&to=2026-09-01").Code)
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/Osselnet/gophermart.git/internal/server/middleware/auth"
+	"net/http"
+	"time"
+)
+
+const (
+	// HeaderTOTPCode carries the code for requests that need a second factor.
+	HeaderTOTPCode = "X-TOTP-Code"
+	// HeaderTOTP is set to "required" on responses refused for lack of a code.
+	HeaderTOTP = "X-TOTP"
+)
+
+type totpChallenge struct {
+	Challenge string `json:"challenge"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+type totpCode struct {
+	Challenge string `json:"challenge,omitempty"`
+	Code      string `json:"code"`
+}
+
+type totpDisableRequest struct {
+	Password string `json:"password"`
+}
+
+type recoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func isTOTPError(err error) bool {
+	return errors.Is(err, gophermart.ErrTOTPRequired) || errors.Is(err, gophermart.ErrTOTPCodeInvalid) ||
+		errors.Is(err, gophermart.ErrTOTPCodeReused)
+}
+
+func (h *handler) writeJSON(w http.ResponseWriter, r *http.Request, code int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		h.error(w, r, fmt.Errorf("failed to marshal JSON - %w", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", ContentTypeApplicationJSON)
+	w.WriteHeader(code)
+	w.Write(body)
+}
+
+// totpRequired answers the first step of a login of a user with TOTP enabled.
+func (h *handler) totpRequired(w http.ResponseWriter, r *http.Request, e *gophermart.TOTPRequiredError) {
+	w.Header().Set(HeaderTOTP, "required")
+	h.writeJSON(w, r, http.StatusUnauthorized, &totpChallenge{
+		Challenge: e.Challenge,
+		ExpiresAt: e.Expiry.Format(time.RFC3339),
+	})
+}
+
+func (h *handler) loginTOTP(w http.ResponseWriter, r *http.Request) {
+	var req totpCode
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.error(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	oldToken := refreshToken(r)
+	if oldToken == "" {
+		oldToken = auth.AccessToken(r)
+	}
+
+	session, err := h.gm.LoginTOTP(req.Challenge, req.Code, oldToken, auth.ClientFromRequest(r))
+	if err != nil {
+		if h.loginThrottled(w, r, err) {
+			return
+		}
+		if isTOTPError(err) || errors.Is(err, gophermart.ErrTokenInvalid) || errors.Is(err, gophermart.ErrTokenExpired) ||
+			errors.Is(err, gophermart.ErrUserNotFound) {
+			h.error(w, r, err, http.StatusUnauthorized)
+			return
+		}
+		h.error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	h.setAuthCookies(w, session)
+	h.log(r, LogLvlDebug, fmt.Sprintf("session for user %d successfully created with TOTP", session.UserID))
+}
+
+func (h *handler) enrollTOTP(w http.ResponseWriter, r *http.Request) {
+	c := h.getSessionFromReqContext(r)
+	if c == nil {
+		return
+	}
+
+	enrollment, err := h.gm.EnrollTOTP(c.UserID)
+	if errors.Is(err, gophermart.ErrTOTPAlreadyEnabled) {
+		h.error(w, r, err, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		h.error(w, r, fmt.Errorf("failed to enroll TOTP - %w", err), http.StatusInternalServerError)
+		return
+	}
+
+	h.writeJSON(w, r, http.StatusOK, enrollment)
+}
+
+func (h *handler) confirmTOTP(w http.ResponseWriter, r *http.Request) {
+	c := h.getSessionFromReqContext(r)
+	if c == nil {
+		return
+	}
+
+	var req totpCode
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.error(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	codes, err := h.gm.ConfirmTOTP(c.UserID, req.Code, auth.ClientFromRequest(r))
+	if err != nil {
+		if h.loginThrottled(w, r, err) {
+			return
+		}
+		switch {
+		case isTOTPError(err):
+			h.error(w, r, err, http.StatusForbidden)
+		case errors.Is(err, gophermart.ErrTOTPNotEnrolled), errors.Is(err, gophermart.ErrTOTPAlreadyEnabled):
+			h.error(w, r, err, http.StatusConflict)
+		default:
+			h.error(w, r, fmt.Errorf("failed to confirm TOTP - %w", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.writeJSON(w, r, http.StatusOK, &recoveryCodes{RecoveryCodes: codes})
+	h.log(r, LogLvlInfo, fmt.Sprintf("TOTP enabled for user %d", c.UserID))
+}
+
+func (h *handler) disableTOTP(w http.ResponseWriter, r *http.Request) {
+	c := h.getSessionFromReqContext(r)
+	if c == nil {
+		return
+	}
+
+	var req totpDisableRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.error(w, r, fmt.Errorf("failed to unmarshal body - %w", err), http.StatusBadRequest)
+		return
+	}
+
+	err = h.gm.DisableTOTP(c.UserID, req.Password, r.Header.Get(HeaderTOTPCode), auth.ClientFromRequest(r))
+	if err != nil {
+		if h.accountError(w, r, err) {
+			return
+		}
+		switch {
+		case isTOTPError(err):
+			w.Header().Set(HeaderTOTP, "required")
+			h.error(w, r, err, http.StatusForbidden)
+		case errors.Is(err, gophermart.ErrTOTPNotEnrolled):
+			h.error(w, r, err, http.StatusConflict)
+		default:
+			h.error(w, r, fmt.Errorf("failed to disable TOTP - %w", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	h.log(r, LogLvlInfo, fmt.Sprintf("TOTP disabled for user %d", c.UserID))
+}
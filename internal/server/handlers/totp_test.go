@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/Osselnet/gophermart.git/internal/memory"
+	"github.com/Osselnet/gophermart.git/internal/server/middleware/auth"
+	"github.com/Osselnet/gophermart.git/pkg/totp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTP(t *testing.T) {
+	gm := gophermart.New(memory.New())
+	h := New(gm)
+
+	creds := &gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}
+	session, err := gm.Register(creds, gophermart.Client{})
+	require.NoError(t, err)
+
+	send := func(method, url, body string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Content-Type", ContentTypeApplicationJSON)
+		req.Header.Set("Authorization", "Bearer "+session.Token)
+		for k, v := range header {
+			req.Header.Set(k, v[0])
+		}
+		w := httptest.NewRecorder()
+		h.GetRouter().ServeHTTP(w, req)
+		return w
+	}
+	code := func(secret string, offset int) string {
+		c, err := totp.Code(secret, time.Now().Add(time.Duration(offset)*totp.Period))
+		require.NoError(t, err)
+		return c
+	}
+
+	w := send(http.MethodPost, "/api/user/totp", "", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var enrollment gophermart.TOTPEnrollment
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &enrollment))
+	assert.True(t, strings.HasPrefix(enrollment.URI, "otpauth://totp/Gophermart:testov?"), enrollment.URI)
+
+	w = send(http.MethodPost, "/api/user/totp/confirm", `{"code":"000000"}`, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = send(http.MethodPost, "/api/user/totp/confirm", `{"code":"`+code(enrollment.Secret, -1)+`"}`, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var codes recoveryCodes
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &codes))
+	assert.Len(t, codes.RecoveryCodes, 10)
+
+	w = send(http.MethodPost, "/api/user/login", `{"login":"testov","password":"Passw0rd33"}`, nil)
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "required", w.Header().Get(HeaderTOTP))
+	assert.Empty(t, w.Result().Cookies(), "no session before the second step")
+	var challenge totpChallenge
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &challenge))
+
+	w = send(http.MethodPost, "/api/user/login/totp", `{"challenge":"`+challenge.Challenge+`","code":"000000"}`, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = send(http.MethodPost, "/api/user/login/totp", `{"challenge":"`+challenge.Challenge+`","code":"`+code(enrollment.Secret, 0)+`"}`, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusUnauthorized, send(http.MethodGet, "/api/user/welcome", "", nil).Code,
+		"the session of the request is ended by the login")
+	for _, c := range w.Result().Cookies() {
+		if c.Name == auth.CookieAccessToken {
+			session.Token = c.Value
+		}
+	}
+
+	w = send(http.MethodPost, "/api/user/balance/withdraw", `{"order":"2377225624","sum":1}`, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, "required", w.Header().Get(HeaderTOTP))
+
+	w = send(http.MethodDelete, "/api/user/totp", `{"password":"wrong"}`, http.Header{HeaderTOTPCode: {codes.RecoveryCodes[0]}})
+	assert.Equal(t, http.StatusForbidden, w.Code, "the password is needed too")
+	w = send(http.MethodDelete, "/api/user/totp", `{"password":"Passw0rd33"}`, http.Header{HeaderTOTPCode: {codes.RecoveryCodes[0]}})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = send(http.MethodPost, "/api/user/login", `{"login":"testov","password":"Passw0rd33"}`, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
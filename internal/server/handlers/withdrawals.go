@@ -5,20 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/Osselnet/gophermart.git/internal/server/middleware/auth"
 	"io"
 	"net/http"
 )
 
 func (h *handler) postWithdraw(w http.ResponseWriter, r *http.Request) {
-	var err error
-
-	ct := r.Header.Get("Content-Type")
-	if ct != ContentTypeApplicationJSON {
-		err = fmt.Errorf("wrong content type, %s needed", ContentTypeApplicationJSON)
-		h.error(w, r, err, http.StatusBadRequest)
-		return
-	}
-
 	c := h.getSessionFromReqContext(r)
 	if c == nil {
 		return
@@ -40,13 +32,29 @@ func (h *handler) postWithdraw(w http.ResponseWriter, r *http.Request) {
 	wpr := &gophermart.WithdrawProxy{}
 	err = json.Unmarshal(reqBody, &wpr)
 	if err != nil {
+		if isMoneyError(err) {
+			h.error(w, r, err, http.StatusUnprocessableEntity)
+			return
+		}
 		h.error(w, r, fmt.Errorf("failed to unmarshal body - %w", err), http.StatusBadRequest)
 		return
 	}
 
 	wpr.UserID = u.ID
+	wpr.TOTPCode = r.Header.Get(HeaderTOTPCode)
+	wpr.Client = auth.ClientFromRequest(r)
 	err = h.gm.PostWithdraw(wpr)
 	if err != nil {
+		if h.loginThrottled(w, r, err) {
+			return
+		}
+
+		if isTOTPError(err) {
+			w.Header().Set(HeaderTOTP, "required")
+			h.error(w, r, err, http.StatusForbidden)
+			return
+		}
+
 		if errors.Is(err, gophermart.ErrNotEnoughFunds) {
 			h.error(w, r, gophermart.ErrNotEnoughFunds, http.StatusPaymentRequired)
 			return
@@ -57,6 +65,11 @@ func (h *handler) postWithdraw(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		if isMoneyError(err) {
+			h.error(w, r, err, http.StatusUnprocessableEntity)
+			return
+		}
+
 		h.error(w, r, err, http.StatusInternalServerError)
 		return
 	}
@@ -80,16 +93,26 @@ func (h *handler) getWithdrawals(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	wsPr, err := h.gm.GetWithdrawals(u.ID)
+	lq, err := parseListQuery(r, u.ID)
 	if err != nil {
-		if errors.Is(err, gophermart.ErrNoContent) {
-			h.error(w, r, gophermart.ErrNoContent, http.StatusNoContent)
+		h.error(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	wsPr, next, err := h.gm.ListWithdrawals(lq)
+	if err != nil {
+		if isListQueryError(err) {
+			h.error(w, r, err, http.StatusBadRequest)
 			return
 		}
 
 		h.error(w, r, err, http.StatusInternalServerError)
 		return
 	}
+	if len(wsPr) == 0 {
+		h.error(w, r, gophermart.ErrNoContent, http.StatusNoContent)
+		return
+	}
 
 	body, err := json.Marshal(&wsPr)
 	if err != nil {
@@ -97,6 +120,14 @@ func (h *handler) getWithdrawals(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setNextLink(w, r, next)
 	w.Header().Set("Content-Type", ContentTypeApplicationJSON)
 	w.Write(body)
 }
+
+func isMoneyError(err error) bool {
+	return errors.Is(err, gophermart.ErrMoneyInvalid) ||
+		errors.Is(err, gophermart.ErrMoneyNegative) ||
+		errors.Is(err, gophermart.ErrMoneyPrecision) ||
+		errors.Is(err, gophermart.ErrMoneyOverflow)
+}
@@ -2,39 +2,160 @@ package auth
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/go-chi/chi/v5/middleware"
+	"log"
+	"net"
 	"net/http"
+	"strings"
+)
+
+const (
+	CookieAccessToken  = "session_token"
+	CookieRefreshToken = "refresh_token"
 )
 
 type SessionKey struct{}
 
+type APIKeyKey struct{}
+
+// AccessToken takes the access token from the Authorization header or, if
+// there is none, from the session cookie.
+func AccessToken(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		return strings.TrimPrefix(h, "Bearer ")
+	}
+
+	c, err := r.Cookie(CookieAccessToken)
+	if err != nil {
+		return ""
+	}
+
+	return c.Value
+}
+
+// ClientFromRequest describes the client of r. It relies on middleware.RealIP
+// having put the client address into RemoteAddr.
+func ClientFromRequest(r *http.Request) gophermart.Client {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+
+	return gophermart.Client{IP: ip, UserAgent: r.UserAgent(), RequestID: middleware.GetReqID(r.Context())}
+}
+
 func AuthCheck(gm *gophermart.GopherMart) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			c, err := r.Cookie("session_token")
-			if err != nil {
-				if err == http.ErrNoCookie {
-					http.Error(w, gophermart.ErrUnauthorizedAccess.Error(), http.StatusUnauthorized)
-					return
-				}
-				http.Error(w, err.Error(), http.StatusBadRequest)
+			token := AccessToken(r)
+			if token == "" {
+				http.Error(w, gophermart.ErrUnauthorizedAccess.Error(), http.StatusUnauthorized)
+				return
+			}
+			if gophermart.IsAPIKey(token) {
+				apiKeyCheck(gm, token, next, w, r)
 				return
 			}
-			sessionToken := c.Value
 
-			session, err := gm.Sessions.Get(sessionToken)
+			session, err := gm.Authenticate(token, ClientFromRequest(r))
+			if errors.Is(err, gophermart.ErrTokenExpired) {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token", error_description="token has expired"`)
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			if errors.Is(err, gophermart.ErrSessionNotFound) {
+				http.Error(w, "session has been revoked", http.StatusUnauthorized)
+				return
+			}
 			if err != nil {
-				http.Error(w, "session token is not present", http.StatusUnauthorized)
+				http.Error(w, "access token is invalid", http.StatusUnauthorized)
 				return
 			}
 
-			if session.IsExpired() {
-				gm.Sessions.Delete(sessionToken)
-				http.Error(w, "session has expired", http.StatusUnauthorized)
+			r = r.WithContext(context.WithValue(r.Context(), SessionKey{}, session))
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// apiKeyCheck authenticates a machine client. Handlers get a session that
+// carries the user ID only, the key itself is put into the context as well.
+func apiKeyCheck(gm *gophermart.GopherMart, token string, next http.Handler, w http.ResponseWriter, r *http.Request) {
+	key, err := gm.APIKeys.Authenticate(token)
+	if errors.Is(err, gophermart.ErrAPIKeyExpired) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token", error_description="API key has expired"`)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, "API key is invalid", http.StatusUnauthorized)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), APIKeyKey{}, key)
+	ctx = context.WithValue(ctx, SessionKey{}, &gophermart.Session{UserID: key.UserID})
+
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// APIKeyFromContext returns the key the request was authenticated with, nil
+// for requests authenticated with a session.
+func APIKeyFromContext(ctx context.Context) *gophermart.APIKey {
+	key, _ := ctx.Value(APIKeyKey{}).(*gophermart.APIKey)
+	return key
+}
+
+// RequireScope lets requests made with an API key through only if the key
+// has the scope. Sessions are not limited by scopes.
+func RequireScope(scope string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := APIKeyFromContext(r.Context())
+			if key != nil && !key.HasScope(scope) {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, scope))
+				http.Error(w, fmt.Sprintf("%s: %s", gophermart.ErrScopeMissing, scope), http.StatusForbidden)
 				return
 			}
 
-			r = r.WithContext(context.WithValue(r.Context(), SessionKey{}, session))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// SessionOnly refuses requests made with an API key, e.g. to account
+// management.
+func SessionOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if APIKeyFromContext(r.Context()) != nil {
+			http.Error(w, "API keys are not allowed here, sign in instead", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireRole lets through users with the role only. It must follow
+// AuthCheck, requests made with an API key are refused whatever the role.
+func RequireRole(gm *gophermart.GopherMart, role string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session, ok := r.Context().Value(SessionKey{}).(*gophermart.Session)
+			if !ok || APIKeyFromContext(r.Context()) != nil {
+				http.Error(w, gophermart.ErrForbidden.Error(), http.StatusForbidden)
+				return
+			}
+
+			user, err := gm.Users.Get(session.UserID)
+			if err != nil || user.Role != role {
+				log.Printf("[SECURITY] User %d denied %s %s, role %s needed", session.UserID, r.Method, r.URL.Path, role)
+				http.Error(w, gophermart.ErrForbidden.Error(), http.StatusForbidden)
+				return
+			}
 
 			next.ServeHTTP(w, r)
 		})
@@ -0,0 +1,157 @@
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/Osselnet/gophermart.git/internal/server/middleware/auth"
+	"io"
+	"log"
+	"net/http"
+)
+
+const (
+	HeaderKey      = "Idempotency-Key"
+	HeaderReplayed = "Idempotent-Replayed"
+
+	maxKeySize = 255
+)
+
+type Store interface {
+	Reserve(userID uint64, key, fingerprint string) (*gophermart.IdempotencyKey, error)
+	Save(k *gophermart.IdempotencyKey) error
+	Release(userID uint64, key string) error
+}
+
+// Fingerprint identifies a request by its method, path and body, so a key
+// reused for a different request can be told apart from a retry.
+func Fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	h.Write(body)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Keys makes requests carrying the Idempotency-Key header safe to retry: the
+// response to the first request is stored and given back to every retry with
+// the same key and body. Requests without the header pass through untouched.
+// It must run after auth.AuthCheck, keys are scoped per user.
+func Keys(store Store) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(HeaderKey)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxKeySize {
+				http.Error(w, "idempotency key is too long", http.StatusBadRequest)
+				return
+			}
+
+			session, ok := r.Context().Value(auth.SessionKey{}).(*gophermart.Session)
+			if !ok {
+				http.Error(w, gophermart.ErrUnauthorizedAccess.Error(), http.StatusUnauthorized)
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			fingerprint := Fingerprint(r, body)
+
+			stored, err := store.Reserve(session.UserID, key, fingerprint)
+			if errors.Is(err, gophermart.ErrIdempotencyKeyExists) {
+				replay(w, stored, fingerprint)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			release := func() {
+				err := store.Release(session.UserID, key)
+				if err != nil {
+					log.Printf("[ERROR] Failed to release idempotency key %q - %s\n", key, err)
+				}
+			}
+			// A panic is answered by the recoverer further up, the key must
+			// not stay in progress until it expires.
+			defer func() {
+				if p := recover(); p != nil {
+					release()
+					panic(p)
+				}
+			}()
+
+			rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+
+			// Failures, requests refused for missing credentials, e.g. a
+			// TOTP code, and throttled requests may be retried with the same
+			// key.
+			if rec.status >= http.StatusInternalServerError || rec.status == http.StatusUnauthorized ||
+				rec.status == http.StatusForbidden || rec.status == http.StatusTooManyRequests {
+				release()
+				return
+			}
+
+			stored.StatusCode = rec.status
+			stored.ContentType = rec.Header().Get("Content-Type")
+			stored.Body = rec.body.Bytes()
+			err = store.Save(stored)
+			if err != nil {
+				log.Printf("[ERROR] Failed to save idempotency key %q - %s\n", key, err)
+			}
+		})
+	}
+}
+
+func replay(w http.ResponseWriter, stored *gophermart.IdempotencyKey, fingerprint string) {
+	if stored.Fingerprint != fingerprint {
+		http.Error(w, "idempotency key has already been used for another request", http.StatusUnprocessableEntity)
+		return
+	}
+
+	if stored.StatusCode == 0 {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "request with this idempotency key is still in progress", http.StatusConflict)
+		return
+	}
+
+	if stored.ContentType != "" {
+		w.Header().Set("Content-Type", stored.ContentType)
+	}
+	w.Header().Set(HeaderReplayed, "true")
+	w.WriteHeader(stored.StatusCode)
+	w.Write(stored.Body)
+}
+
+type recorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	r.body.Write(b)
+
+	return r.ResponseWriter.Write(b)
+}
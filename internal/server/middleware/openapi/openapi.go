@@ -0,0 +1,361 @@
+// Package openapi holds the OpenAPI 3 document of the user API and checks
+// requests against it before they reach the handlers. Only the parts of
+// OpenAPI the document uses are supported: path, query and header
+// parameters, request bodies by media type, $ref to components and schemas
+// made of type, format, enum, pattern, length and value limits, required,
+// properties, additionalProperties and items.
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+//go:embed openapi.json
+var document []byte
+
+// Document returns the OpenAPI document as served to clients.
+func Document() []byte {
+	return document
+}
+
+type Spec struct {
+	Paths      map[string]*PathItem `json:"paths"`
+	Components struct {
+		Parameters map[string]*Parameter `json:"parameters"`
+		Schemas    map[string]*Schema    `json:"schemas"`
+	} `json:"components"`
+
+	routes []*route
+}
+
+type PathItem struct {
+	Parameters []*Parameter `json:"parameters"`
+	Get        *Operation   `json:"get"`
+	Post       *Operation   `json:"post"`
+	Put        *Operation   `json:"put"`
+	Patch      *Operation   `json:"patch"`
+	Delete     *Operation   `json:"delete"`
+}
+
+func (p *PathItem) operations() map[string]*Operation {
+	ops := map[string]*Operation{
+		http.MethodGet:    p.Get,
+		http.MethodPost:   p.Post,
+		http.MethodPut:    p.Put,
+		http.MethodPatch:  p.Patch,
+		http.MethodDelete: p.Delete,
+	}
+	for method, op := range ops {
+		if op == nil {
+			delete(ops, method)
+		}
+	}
+
+	return ops
+}
+
+type Operation struct {
+	OperationID string       `json:"operationId"`
+	Parameters  []*Parameter `json:"parameters"`
+	RequestBody *RequestBody `json:"requestBody"`
+}
+
+type Parameter struct {
+	Ref      string  `json:"$ref"`
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Format               string             `json:"format"`
+	Enum                 []string           `json:"enum"`
+	Pattern              string             `json:"pattern"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+	Nullable             bool               `json:"nullable"`
+	Required             []string           `json:"required"`
+	Properties           map[string]*Schema `json:"properties"`
+	AdditionalProperties json.RawMessage    `json:"additionalProperties"`
+	Items                *Schema            `json:"items"`
+
+	pattern *regexp.Regexp
+	// closed objects take no properties but the listed ones, additional
+	// checks the others if set.
+	closed     bool
+	additional *Schema
+}
+
+// Route is an operation of the document, Path is the template with
+// parameters in braces as chi writes them.
+type Route struct {
+	Method string
+	Path   string
+}
+
+type route struct {
+	Route
+	segments []string
+	params   int
+	op       *Operation
+	// parameters of the path item and of the operation, the latter win.
+	parameters []*Parameter
+}
+
+// Load parses the embedded document.
+func Load() (*Spec, error) {
+	return Parse(document)
+}
+
+// Parse reads an OpenAPI document and resolves its references. A document
+// using parts of OpenAPI this package can't check is an error, so it never
+// silently lets requests through.
+func Parse(data []byte) (*Spec, error) {
+	s := new(Spec)
+	err := json.Unmarshal(data, s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal OpenAPI document - %w", err)
+	}
+
+	for path, item := range s.Paths {
+		if !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("path %s must start with a slash", path)
+		}
+		for method, op := range item.operations() {
+			r := &route{
+				Route:    Route{Method: method, Path: path},
+				segments: splitPath(path),
+				op:       op,
+			}
+			for _, seg := range r.segments {
+				if isParam(seg) {
+					r.params++
+				}
+			}
+
+			byName := make(map[string]*Parameter)
+			var names []string
+			for _, p := range append(append([]*Parameter(nil), item.Parameters...), op.Parameters...) {
+				p, err = s.parameter(p)
+				if err != nil {
+					return nil, fmt.Errorf("%s %s - %w", method, path, err)
+				}
+				key := p.In + " " + p.Name
+				if _, ok := byName[key]; !ok {
+					names = append(names, key)
+				}
+				byName[key] = p
+			}
+			for _, key := range names {
+				r.parameters = append(r.parameters, byName[key])
+			}
+
+			if op.RequestBody != nil {
+				for mt, m := range op.RequestBody.Content {
+					if m.Schema == nil {
+						continue
+					}
+					m.Schema, err = s.resolve(m.Schema)
+					if err != nil {
+						return nil, fmt.Errorf("%s %s, body %s - %w", method, path, mt, err)
+					}
+				}
+			}
+
+			s.routes = append(s.routes, r)
+		}
+	}
+
+	// Literal segments are tried before parameters, as chi does.
+	sort.Slice(s.routes, func(i, j int) bool {
+		if s.routes[i].params != s.routes[j].params {
+			return s.routes[i].params < s.routes[j].params
+		}
+		return s.routes[i].Path < s.routes[j].Path
+	})
+
+	return s, nil
+}
+
+func (s *Spec) parameter(p *Parameter) (*Parameter, error) {
+	if p.Ref != "" {
+		name := strings.TrimPrefix(p.Ref, "#/components/parameters/")
+		ref, ok := s.Components.Parameters[name]
+		if !ok || name == p.Ref {
+			return nil, fmt.Errorf("unknown parameter %s", p.Ref)
+		}
+		p = ref
+	}
+
+	switch p.In {
+	case "path", "query", "header":
+	default:
+		return nil, fmt.Errorf("parameter %s in %q is not supported", p.Name, p.In)
+	}
+	if p.Schema == nil {
+		return nil, fmt.Errorf("parameter %s has no schema", p.Name)
+	}
+
+	var err error
+	p.Schema, err = s.resolve(p.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("parameter %s - %w", p.Name, err)
+	}
+
+	return p, nil
+}
+
+// resolveIn replaces references with the schemas they point at and compiles
+// the patterns. Components may be resolved more than once, which is cheap.
+func (s *Schema) resolveIn(spec *Spec, depth int) (*Schema, error) {
+	if depth > 32 {
+		return nil, fmt.Errorf("schemas are nested too deep")
+	}
+
+	sc := s
+	if sc.Ref != "" {
+		name := strings.TrimPrefix(sc.Ref, "#/components/schemas/")
+		ref, ok := spec.Components.Schemas[name]
+		if !ok || name == sc.Ref {
+			return nil, fmt.Errorf("unknown schema %s", sc.Ref)
+		}
+		sc = ref
+	}
+
+	switch sc.Type {
+	case "", "object", "array", "string", "number", "integer", "boolean":
+	default:
+		return nil, fmt.Errorf("type %q is not supported", sc.Type)
+	}
+	switch sc.Format {
+	case "", "date-time", "date", "binary":
+	default:
+		return nil, fmt.Errorf("format %q is not supported", sc.Format)
+	}
+
+	var err error
+	if sc.Pattern != "" && sc.pattern == nil {
+		sc.pattern, err = regexp.Compile(sc.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("bad pattern - %w", err)
+		}
+	}
+
+	for name, p := range sc.Properties {
+		sc.Properties[name], err = p.resolveIn(spec, depth+1)
+		if err != nil {
+			return nil, fmt.Errorf("%s - %w", name, err)
+		}
+	}
+	if sc.Items != nil {
+		sc.Items, err = sc.Items.resolveIn(spec, depth+1)
+		if err != nil {
+			return nil, fmt.Errorf("items - %w", err)
+		}
+	}
+
+	switch add := strings.TrimSpace(string(sc.AdditionalProperties)); {
+	case add == "" || add == "true":
+	case add == "false":
+		sc.closed = true
+	default:
+		var a Schema
+		err = json.Unmarshal(sc.AdditionalProperties, &a)
+		if err != nil {
+			return nil, fmt.Errorf("bad additionalProperties - %w", err)
+		}
+		sc.additional, err = a.resolveIn(spec, depth+1)
+		if err != nil {
+			return nil, fmt.Errorf("additionalProperties - %w", err)
+		}
+	}
+
+	return sc, nil
+}
+
+func (s *Spec) resolve(sc *Schema) (*Schema, error) {
+	return sc.resolveIn(s, 0)
+}
+
+// Routes returns every operation of the document, sorted.
+func (s *Spec) Routes() []Route {
+	routes := make([]Route, 0, len(s.routes))
+	for _, r := range s.routes {
+		routes = append(routes, r.Route)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+
+	return routes
+}
+
+// find returns the route of the request and the values of its path
+// parameters, nil if the document doesn't describe it.
+func (s *Spec) find(method, path string) (*route, map[string]string) {
+	segments := splitPath(path)
+
+	for _, r := range s.routes {
+		if r.Method != method || len(r.segments) != len(segments) {
+			continue
+		}
+
+		var params map[string]string
+		matched := true
+		for i, seg := range r.segments {
+			if isParam(seg) {
+				if params == nil {
+					params = make(map[string]string)
+				}
+				params[strings.Trim(seg, "{}")] = segments[i]
+				continue
+			}
+			if seg != segments[i] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return r, params
+		}
+	}
+
+	return nil, nil
+}
+
+// splitPath splits a path into its segments, a trailing slash is ignored.
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+
+	return strings.Split(path, "/")
+}
+
+func isParam(seg string) bool {
+	return strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}")
+}
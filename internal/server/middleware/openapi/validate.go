@@ -0,0 +1,338 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// MaxJSONBodySize limits JSON bodies read for validation, larger ones get
+// 413 before the handler runs.
+const MaxJSONBodySize = 1 << 20
+
+// ErrorFunc writes the response to a request the document doesn't allow.
+type ErrorFunc func(w http.ResponseWriter, r *http.Request, err error, statusCode int)
+
+// Validate checks the parameters and the body of every request the document
+// describes, the rest pass through untouched. Requests that don't match get
+// 400 through onError. JSON bodies are read, checked and put back, so
+// handlers and later middlewares read them as sent.
+func Validate(s *Spec, onError ErrorFunc) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rt, pathParams := s.find(r.Method, r.URL.Path)
+			if rt == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			err := checkParameters(rt, r, pathParams)
+			if err != nil {
+				onError(w, r, err, http.StatusBadRequest)
+				return
+			}
+
+			code, err := checkBody(rt, r)
+			if err != nil {
+				onError(w, r, err, code)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func checkParameters(rt *route, r *http.Request, pathParams map[string]string) error {
+	query := r.URL.Query()
+
+	for _, p := range rt.parameters {
+		var value string
+		var ok bool
+		switch p.In {
+		case "path":
+			value, ok = pathParams[p.Name]
+		case "query":
+			ok = query.Has(p.Name)
+			value = query.Get(p.Name)
+		case "header":
+			value = r.Header.Get(p.Name)
+			ok = value != ""
+		}
+
+		if !ok {
+			if p.Required {
+				return fmt.Errorf("%s parameter %s is required", p.In, p.Name)
+			}
+			continue
+		}
+		// Empty query parameters are taken as missing by the handlers.
+		if value == "" && p.In == "query" && !p.Required {
+			continue
+		}
+
+		v, err := paramValue(p.Schema, value)
+		if err == nil {
+			err = p.Schema.check(v, "")
+		}
+		if err != nil {
+			return fmt.Errorf("%s parameter %s %w", p.In, p.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// paramValue converts a parameter to the JSON value its schema checks.
+func paramValue(sc *Schema, s string) (interface{}, error) {
+	switch sc.Type {
+	case "integer":
+		_, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, errors.New("must be an integer")
+		}
+		return json.Number(s), nil
+	case "number":
+		_, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, errors.New("must be a number")
+		}
+		return json.Number(s), nil
+	case "boolean":
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, errors.New("must be true or false")
+		}
+		return b, nil
+	}
+
+	return s, nil
+}
+
+// checkBody checks the media type of the body and, for JSON, the body
+// itself. It returns the status code to answer with on error.
+func checkBody(rt *route, r *http.Request) (int, error) {
+	rb := rt.op.RequestBody
+	if rb == nil {
+		return 0, nil
+	}
+	if r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0 {
+		if rb.Required {
+			return http.StatusBadRequest, errors.New("request body is required")
+		}
+		return 0, nil
+	}
+
+	types := make([]string, 0, len(rb.Content))
+	for mt := range rb.Content {
+		types = append(types, mt)
+	}
+	sort.Strings(types)
+
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	m, ok := rb.Content[mt]
+	if err != nil || !ok {
+		return http.StatusBadRequest, fmt.Errorf("wrong content type, %s needed", strings.Join(types, " or "))
+	}
+	if m.Schema == nil || !isJSON(mt) {
+		return 0, nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, MaxJSONBodySize+1))
+	r.Body.Close()
+	if err != nil {
+		return http.StatusBadRequest, fmt.Errorf("failed to read request body - %w", err)
+	}
+	if len(data) > MaxJSONBodySize {
+		return http.StatusRequestEntityTooLarge, fmt.Errorf("request body is larger than %d bytes", MaxJSONBodySize)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(data))
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	err = dec.Decode(&v)
+	if err == nil {
+		if _, errTok := dec.Token(); errTok != io.EOF {
+			err = errors.New("data after the JSON value")
+		}
+	}
+	if err != nil {
+		return http.StatusBadRequest, fmt.Errorf("request body is not valid JSON - %w", err)
+	}
+
+	err = m.Schema.check(v, "")
+	if err != nil {
+		return http.StatusBadRequest, fmt.Errorf("request body %w", err)
+	}
+
+	return 0, nil
+}
+
+func isJSON(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// check checks the JSON value v decoded with UseNumber. at is the path of v
+// in the body, empty for the body or parameter itself. Errors read after
+// the name of what is checked, e.g. "must be a string".
+func (sc *Schema) check(v interface{}, at string) error {
+	where := func(format string, a ...interface{}) error {
+		msg := fmt.Sprintf(format, a...)
+		if at == "" {
+			return errors.New(msg)
+		}
+		return fmt.Errorf("field %s %s", at, msg)
+	}
+
+	if v == nil {
+		if sc.Nullable || sc.Type == "" {
+			return nil
+		}
+		return where("must not be null")
+	}
+
+	switch sc.Type {
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return where("must be an object")
+		}
+		return sc.checkObject(obj, at)
+	case "array":
+		arr, ok := v.([]interface{})
+		if !ok {
+			return where("must be an array")
+		}
+		if sc.Items == nil {
+			return nil
+		}
+		for i, item := range arr {
+			err := sc.Items.check(item, fmt.Sprintf("%s[%d]", at, i))
+			if err != nil {
+				return err
+			}
+		}
+	case "string":
+		s, ok := v.(string)
+		if !ok {
+			return where("must be a string")
+		}
+		return sc.checkString(s, where)
+	case "number", "integer":
+		n, ok := v.(json.Number)
+		if !ok {
+			return where("must be a number")
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return where("must be a number")
+		}
+		if sc.Type == "integer" {
+			if _, err := n.Int64(); err != nil {
+				return where("must be an integer")
+			}
+		}
+		if sc.Minimum != nil && f < *sc.Minimum {
+			return where("must be at least %v", *sc.Minimum)
+		}
+		if sc.Maximum != nil && f > *sc.Maximum {
+			return where("must be at most %v", *sc.Maximum)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return where("must be true or false")
+		}
+	}
+
+	return nil
+}
+
+func (sc *Schema) checkObject(obj map[string]interface{}, at string) error {
+	field := func(name string) string {
+		if at == "" {
+			return name
+		}
+		return at + "." + name
+	}
+
+	for _, name := range sc.Required {
+		if _, ok := obj[name]; !ok {
+			return fmt.Errorf("field %s is required", field(name))
+		}
+	}
+
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		p, ok := sc.Properties[name]
+		if !ok {
+			if sc.closed {
+				return fmt.Errorf("field %s is not allowed", field(name))
+			}
+			p = sc.additional
+		}
+		if p == nil {
+			continue
+		}
+
+		err := p.check(obj[name], field(name))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (sc *Schema) checkString(s string, where func(format string, a ...interface{}) error) error {
+	if len(sc.Enum) > 0 {
+		found := false
+		for _, e := range sc.Enum {
+			if s == e {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return where("must be one of %s", strings.Join(sc.Enum, ", "))
+		}
+	}
+
+	n := utf8.RuneCountInString(s)
+	if sc.MinLength != nil && n < *sc.MinLength {
+		return where("must be at least %d characters long", *sc.MinLength)
+	}
+	if sc.MaxLength != nil && n > *sc.MaxLength {
+		return where("must be at most %d characters long", *sc.MaxLength)
+	}
+	if sc.pattern != nil && !sc.pattern.MatchString(s) {
+		return where("must match %s", sc.Pattern)
+	}
+
+	switch sc.Format {
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339, s); err != nil {
+			return where("must be an RFC 3339 time")
+		}
+	case "date":
+		if _, err := time.Parse("2006-01-02", s); err != nil {
+			return where("must be a date")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package signature
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HeaderTimestamp = "X-Accrual-Timestamp"
+	HeaderNonce     = "X-Accrual-Nonce"
+	HeaderSignature = "X-Accrual-Signature"
+
+	prefix       = "sha256="
+	maxBodySize  = 1 << 20
+	maxNonceSize = 128
+)
+
+type NonceStore interface {
+	UseNonce(nonce string, expiresAt time.Time) error
+}
+
+// Sign returns the signature header value for a request sent at timestamp
+// with nonce: HMAC-SHA256 of "timestamp.nonce.body".
+func Sign(secret []byte, timestamp int64, nonce string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write([]byte(nonce))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return prefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify lets through only requests signed with secret and sent no more than
+// window ago. Every nonce is accepted once, it is remembered for as long as a
+// request carrying it could still pass the time check.
+func Verify(secret []byte, window time.Duration, nonces NonceStore) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ts, err := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+			if err != nil {
+				http.Error(w, "bad timestamp", http.StatusUnauthorized)
+				return
+			}
+
+			sent := time.Unix(ts, 0)
+			now := time.Now()
+			if sent.Before(now.Add(-window)) || sent.After(now.Add(window)) {
+				http.Error(w, "timestamp is out of the allowed window", http.StatusUnauthorized)
+				return
+			}
+
+			nonce := r.Header.Get(HeaderNonce)
+			if nonce == "" || len(nonce) > maxNonceSize {
+				http.Error(w, "bad nonce", http.StatusUnauthorized)
+				return
+			}
+
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if len(body) > maxBodySize {
+				http.Error(w, "request body is too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+
+			got := strings.ToLower(r.Header.Get(HeaderSignature))
+			want := Sign(secret, ts, nonce, body)
+			if !hmac.Equal([]byte(got), []byte(want)) {
+				http.Error(w, "bad signature", http.StatusUnauthorized)
+				return
+			}
+
+			err = nonces.UseNonce(nonce, sent.Add(window))
+			if errors.Is(err, gophermart.ErrNonceReused) {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
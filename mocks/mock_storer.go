@@ -5,7 +5,9 @@
 package mocks
 
 import (
+	context "context"
 	reflect "reflect"
+	time "time"
 
 	gophermart "github.com/Osselnet/gophermart.git/internal/gophermart"
 	gomock "github.com/golang/mock/gomock"
@@ -34,6 +36,77 @@ func (m *MockStorer) EXPECT() *MockStorerMockRecorder {
 	return m.recorder
 }
 
+// AddAPIKey mocks base method.
+func (m *MockStorer) AddAPIKey(arg0 *gophermart.APIKey) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddAPIKey", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddAPIKey indicates an expected call of AddAPIKey.
+func (mr *MockStorerMockRecorder) AddAPIKey(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddAPIKey", reflect.TypeOf((*MockStorer)(nil).AddAPIKey), arg0)
+}
+
+// AddAuditEntry mocks base method.
+func (m *MockStorer) AddAuditEntry(arg0 *gophermart.AuditEntry, arg1 bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddAuditEntry", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddAuditEntry indicates an expected call of AddAuditEntry.
+func (mr *MockStorerMockRecorder) AddAuditEntry(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddAuditEntry", reflect.TypeOf((*MockStorer)(nil).AddAuditEntry), arg0, arg1)
+}
+
+// AddBulkJob mocks base method.
+func (m *MockStorer) AddBulkJob(arg0 *gophermart.BulkJob) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddBulkJob", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddBulkJob indicates an expected call of AddBulkJob.
+func (mr *MockStorerMockRecorder) AddBulkJob(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddBulkJob", reflect.TypeOf((*MockStorer)(nil).AddBulkJob), arg0)
+}
+
+// AddIdempotencyKey mocks base method.
+func (m *MockStorer) AddIdempotencyKey(arg0 *gophermart.IdempotencyKey) (*gophermart.IdempotencyKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddIdempotencyKey", arg0)
+	ret0, _ := ret[0].(*gophermart.IdempotencyKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddIdempotencyKey indicates an expected call of AddIdempotencyKey.
+func (mr *MockStorerMockRecorder) AddIdempotencyKey(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddIdempotencyKey", reflect.TypeOf((*MockStorer)(nil).AddIdempotencyKey), arg0)
+}
+
+// AddNonce mocks base method.
+func (m *MockStorer) AddNonce(arg0 string, arg1 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddNonce", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddNonce indicates an expected call of AddNonce.
+func (mr *MockStorerMockRecorder) AddNonce(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddNonce", reflect.TypeOf((*MockStorer)(nil).AddNonce), arg0, arg1)
+}
+
 // AddOrder mocks base method.
 func (m *MockStorer) AddOrder(arg0 *gophermart.Order) error {
 	m.ctrl.T.Helper()
@@ -48,6 +121,21 @@ func (mr *MockStorerMockRecorder) AddOrder(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddOrder", reflect.TypeOf((*MockStorer)(nil).AddOrder), arg0)
 }
 
+// AddOrders mocks base method.
+func (m *MockStorer) AddOrders(arg0 []*gophermart.Order) (map[uint64]uint64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddOrders", arg0)
+	ret0, _ := ret[0].(map[uint64]uint64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddOrders indicates an expected call of AddOrders.
+func (mr *MockStorerMockRecorder) AddOrders(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddOrders", reflect.TypeOf((*MockStorer)(nil).AddOrders), arg0)
+}
+
 // AddSession mocks base method.
 func (m *MockStorer) AddSession(arg0 *gophermart.Session) error {
 	m.ctrl.T.Helper()
@@ -77,6 +165,20 @@ func (mr *MockStorerMockRecorder) AddUser(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddUser", reflect.TypeOf((*MockStorer)(nil).AddUser), arg0)
 }
 
+// AddUserEvent mocks base method.
+func (m *MockStorer) AddUserEvent(arg0 *gophermart.UserEvent) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddUserEvent", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddUserEvent indicates an expected call of AddUserEvent.
+func (mr *MockStorerMockRecorder) AddUserEvent(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddUserEvent", reflect.TypeOf((*MockStorer)(nil).AddUserEvent), arg0)
+}
+
 // AddWithdraw mocks base method.
 func (m *MockStorer) AddWithdraw(arg0 *gophermart.Withdraw) error {
 	m.ctrl.T.Helper()
@@ -91,6 +193,122 @@ func (mr *MockStorerMockRecorder) AddWithdraw(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddWithdraw", reflect.TypeOf((*MockStorer)(nil).AddWithdraw), arg0)
 }
 
+// AdjustBalance mocks base method.
+func (m *MockStorer) AdjustBalance(arg0 *gophermart.Adjustment, arg1 *gophermart.AuditEntry, arg2 bool) (gophermart.Balance, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AdjustBalance", arg0, arg1, arg2)
+	ret0, _ := ret[0].(gophermart.Balance)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AdjustBalance indicates an expected call of AdjustBalance.
+func (mr *MockStorerMockRecorder) AdjustBalance(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AdjustBalance", reflect.TypeOf((*MockStorer)(nil).AdjustBalance), arg0, arg1, arg2)
+}
+
+// AnonymizeUser mocks base method.
+func (m *MockStorer) AnonymizeUser(arg0 uint64, arg1 string, arg2 bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AnonymizeUser", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AnonymizeUser indicates an expected call of AnonymizeUser.
+func (mr *MockStorerMockRecorder) AnonymizeUser(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AnonymizeUser", reflect.TypeOf((*MockStorer)(nil).AnonymizeUser), arg0, arg1, arg2)
+}
+
+// ClaimBulkJobs mocks base method.
+func (m *MockStorer) ClaimBulkJobs(arg0, arg1 time.Time, arg2 uint32) ([]*gophermart.BulkJob, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClaimBulkJobs", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]*gophermart.BulkJob)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ClaimBulkJobs indicates an expected call of ClaimBulkJobs.
+func (mr *MockStorerMockRecorder) ClaimBulkJobs(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClaimBulkJobs", reflect.TypeOf((*MockStorer)(nil).ClaimBulkJobs), arg0, arg1, arg2)
+}
+
+// ClearLoginAttempts mocks base method.
+func (m *MockStorer) ClearLoginAttempts(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClearLoginAttempts", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ClearLoginAttempts indicates an expected call of ClearLoginAttempts.
+func (mr *MockStorerMockRecorder) ClearLoginAttempts(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClearLoginAttempts", reflect.TypeOf((*MockStorer)(nil).ClearLoginAttempts), arg0)
+}
+
+// DeleteAPIKey mocks base method.
+func (m *MockStorer) DeleteAPIKey(arg0 uint64, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteAPIKey", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteAPIKey indicates an expected call of DeleteAPIKey.
+func (mr *MockStorerMockRecorder) DeleteAPIKey(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteAPIKey", reflect.TypeOf((*MockStorer)(nil).DeleteAPIKey), arg0, arg1)
+}
+
+// DeleteExpiredSessions mocks base method.
+func (m *MockStorer) DeleteExpiredSessions(arg0 time.Time, arg1 uint32) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteExpiredSessions", arg0, arg1)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteExpiredSessions indicates an expected call of DeleteExpiredSessions.
+func (mr *MockStorerMockRecorder) DeleteExpiredSessions(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteExpiredSessions", reflect.TypeOf((*MockStorer)(nil).DeleteExpiredSessions), arg0, arg1)
+}
+
+// DeleteIdempotencyKey mocks base method.
+func (m *MockStorer) DeleteIdempotencyKey(arg0 uint64, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteIdempotencyKey", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteIdempotencyKey indicates an expected call of DeleteIdempotencyKey.
+func (mr *MockStorerMockRecorder) DeleteIdempotencyKey(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteIdempotencyKey", reflect.TypeOf((*MockStorer)(nil).DeleteIdempotencyKey), arg0, arg1)
+}
+
+// DeleteIdempotencyKeysBefore mocks base method.
+func (m *MockStorer) DeleteIdempotencyKeysBefore(arg0 time.Time, arg1 uint32) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteIdempotencyKeysBefore", arg0, arg1)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteIdempotencyKeysBefore indicates an expected call of DeleteIdempotencyKeysBefore.
+func (mr *MockStorerMockRecorder) DeleteIdempotencyKeysBefore(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteIdempotencyKeysBefore", reflect.TypeOf((*MockStorer)(nil).DeleteIdempotencyKeysBefore), arg0, arg1)
+}
+
 // DeleteSession mocks base method.
 func (m *MockStorer) DeleteSession(arg0 string) error {
 	m.ctrl.T.Helper()
@@ -119,6 +337,96 @@ func (mr *MockStorerMockRecorder) DeleteUser(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUser", reflect.TypeOf((*MockStorer)(nil).DeleteUser), arg0)
 }
 
+// DeleteUserEventsBefore mocks base method.
+func (m *MockStorer) DeleteUserEventsBefore(arg0 time.Time, arg1 uint32) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUserEventsBefore", arg0, arg1)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteUserEventsBefore indicates an expected call of DeleteUserEventsBefore.
+func (mr *MockStorerMockRecorder) DeleteUserEventsBefore(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUserEventsBefore", reflect.TypeOf((*MockStorer)(nil).DeleteUserEventsBefore), arg0, arg1)
+}
+
+// DeleteUserSessions mocks base method.
+func (m *MockStorer) DeleteUserSessions(arg0 uint64) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUserSessions", arg0)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteUserSessions indicates an expected call of DeleteUserSessions.
+func (mr *MockStorerMockRecorder) DeleteUserSessions(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUserSessions", reflect.TypeOf((*MockStorer)(nil).DeleteUserSessions), arg0)
+}
+
+// FindUserOrders mocks base method.
+func (m *MockStorer) FindUserOrders(arg0 gophermart.ListQuery) ([]*gophermart.Order, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindUserOrders", arg0)
+	ret0, _ := ret[0].([]*gophermart.Order)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindUserOrders indicates an expected call of FindUserOrders.
+func (mr *MockStorerMockRecorder) FindUserOrders(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindUserOrders", reflect.TypeOf((*MockStorer)(nil).FindUserOrders), arg0)
+}
+
+// FindUserWithdrawals mocks base method.
+func (m *MockStorer) FindUserWithdrawals(arg0 gophermart.ListQuery) ([]*gophermart.Withdraw, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindUserWithdrawals", arg0)
+	ret0, _ := ret[0].([]*gophermart.Withdraw)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindUserWithdrawals indicates an expected call of FindUserWithdrawals.
+func (mr *MockStorerMockRecorder) FindUserWithdrawals(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindUserWithdrawals", reflect.TypeOf((*MockStorer)(nil).FindUserWithdrawals), arg0)
+}
+
+// GetAPIKey mocks base method.
+func (m *MockStorer) GetAPIKey(arg0 string) (*gophermart.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAPIKey", arg0)
+	ret0, _ := ret[0].(*gophermart.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAPIKey indicates an expected call of GetAPIKey.
+func (mr *MockStorerMockRecorder) GetAPIKey(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAPIKey", reflect.TypeOf((*MockStorer)(nil).GetAPIKey), arg0)
+}
+
+// GetAuditEntries mocks base method.
+func (m *MockStorer) GetAuditEntries(arg0 gophermart.AuditFilter) ([]*gophermart.AuditEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAuditEntries", arg0)
+	ret0, _ := ret[0].([]*gophermart.AuditEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAuditEntries indicates an expected call of GetAuditEntries.
+func (mr *MockStorerMockRecorder) GetAuditEntries(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAuditEntries", reflect.TypeOf((*MockStorer)(nil).GetAuditEntries), arg0)
+}
+
 // GetBalance mocks base method.
 func (m *MockStorer) GetBalance(arg0 uint64) (gophermart.Balance, error) {
 	m.ctrl.T.Helper()
@@ -134,6 +442,97 @@ func (mr *MockStorerMockRecorder) GetBalance(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBalance", reflect.TypeOf((*MockStorer)(nil).GetBalance), arg0)
 }
 
+// GetBulkJob mocks base method.
+func (m *MockStorer) GetBulkJob(arg0 string) (*gophermart.BulkJob, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBulkJob", arg0)
+	ret0, _ := ret[0].(*gophermart.BulkJob)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetBulkJob indicates an expected call of GetBulkJob.
+func (mr *MockStorerMockRecorder) GetBulkJob(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBulkJob", reflect.TypeOf((*MockStorer)(nil).GetBulkJob), arg0)
+}
+
+// GetLastUserEventID mocks base method.
+func (m *MockStorer) GetLastUserEventID(arg0 uint64) (uint64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLastUserEventID", arg0)
+	ret0, _ := ret[0].(uint64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLastUserEventID indicates an expected call of GetLastUserEventID.
+func (mr *MockStorerMockRecorder) GetLastUserEventID(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLastUserEventID", reflect.TypeOf((*MockStorer)(nil).GetLastUserEventID), arg0)
+}
+
+// GetLedgerEntries mocks base method.
+func (m *MockStorer) GetLedgerEntries(arg0 uint64, arg1 time.Time) ([]*gophermart.LedgerEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLedgerEntries", arg0, arg1)
+	ret0, _ := ret[0].([]*gophermart.LedgerEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLedgerEntries indicates an expected call of GetLedgerEntries.
+func (mr *MockStorerMockRecorder) GetLedgerEntries(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLedgerEntries", reflect.TypeOf((*MockStorer)(nil).GetLedgerEntries), arg0, arg1)
+}
+
+// GetLedgerPage mocks base method.
+func (m *MockStorer) GetLedgerPage(arg0 uint64, arg1 time.Time, arg2 uint64, arg3 time.Time, arg4 uint32) ([]*gophermart.LedgerEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLedgerPage", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].([]*gophermart.LedgerEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLedgerPage indicates an expected call of GetLedgerPage.
+func (mr *MockStorerMockRecorder) GetLedgerPage(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLedgerPage", reflect.TypeOf((*MockStorer)(nil).GetLedgerPage), arg0, arg1, arg2, arg3, arg4)
+}
+
+// GetLedgerTotals mocks base method.
+func (m *MockStorer) GetLedgerTotals(arg0 uint64, arg1 time.Time) (gophermart.Money, gophermart.Money, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLedgerTotals", arg0, arg1)
+	ret0, _ := ret[0].(gophermart.Money)
+	ret1, _ := ret[1].(gophermart.Money)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetLedgerTotals indicates an expected call of GetLedgerTotals.
+func (mr *MockStorerMockRecorder) GetLedgerTotals(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLedgerTotals", reflect.TypeOf((*MockStorer)(nil).GetLedgerTotals), arg0, arg1)
+}
+
+// GetLoginAttempts mocks base method.
+func (m *MockStorer) GetLoginAttempts(arg0 string) (*gophermart.LoginAttempts, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLoginAttempts", arg0)
+	ret0, _ := ret[0].(*gophermart.LoginAttempts)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLoginAttempts indicates an expected call of GetLoginAttempts.
+func (mr *MockStorerMockRecorder) GetLoginAttempts(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLoginAttempts", reflect.TypeOf((*MockStorer)(nil).GetLoginAttempts), arg0)
+}
+
 // GetOrder mocks base method.
 func (m *MockStorer) GetOrder(arg0 uint64) (*gophermart.Order, error) {
 	m.ctrl.T.Helper()
@@ -164,19 +563,19 @@ func (mr *MockStorerMockRecorder) GetOrderWithdrawals(arg0 interface{}) *gomock.
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrderWithdrawals", reflect.TypeOf((*MockStorer)(nil).GetOrderWithdrawals), arg0)
 }
 
-// GetPullOrders mocks base method.
-func (m *MockStorer) GetPullOrders(arg0 uint32) (map[uint64]*gophermart.Order, error) {
+// GetParkedOrders mocks base method.
+func (m *MockStorer) GetParkedOrders(arg0 uint32) ([]*gophermart.Order, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetPullOrders", arg0)
-	ret0, _ := ret[0].(map[uint64]*gophermart.Order)
+	ret := m.ctrl.Call(m, "GetParkedOrders", arg0)
+	ret0, _ := ret[0].([]*gophermart.Order)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetPullOrders indicates an expected call of GetPullOrders.
-func (mr *MockStorerMockRecorder) GetPullOrders(arg0 interface{}) *gomock.Call {
+// GetParkedOrders indicates an expected call of GetParkedOrders.
+func (mr *MockStorerMockRecorder) GetParkedOrders(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPullOrders", reflect.TypeOf((*MockStorer)(nil).GetPullOrders), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetParkedOrders", reflect.TypeOf((*MockStorer)(nil).GetParkedOrders), arg0)
 }
 
 // GetSession mocks base method.
@@ -209,6 +608,36 @@ func (mr *MockStorerMockRecorder) GetUser(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUser", reflect.TypeOf((*MockStorer)(nil).GetUser), arg0)
 }
 
+// GetUserAPIKeys mocks base method.
+func (m *MockStorer) GetUserAPIKeys(arg0 uint64) ([]*gophermart.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserAPIKeys", arg0)
+	ret0, _ := ret[0].([]*gophermart.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserAPIKeys indicates an expected call of GetUserAPIKeys.
+func (mr *MockStorerMockRecorder) GetUserAPIKeys(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserAPIKeys", reflect.TypeOf((*MockStorer)(nil).GetUserAPIKeys), arg0)
+}
+
+// GetUserEvents mocks base method.
+func (m *MockStorer) GetUserEvents(arg0, arg1 uint64, arg2 uint32) ([]*gophermart.UserEvent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserEvents", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]*gophermart.UserEvent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserEvents indicates an expected call of GetUserEvents.
+func (mr *MockStorerMockRecorder) GetUserEvents(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserEvents", reflect.TypeOf((*MockStorer)(nil).GetUserEvents), arg0, arg1, arg2)
+}
+
 // GetUserOrders mocks base method.
 func (m *MockStorer) GetUserOrders(arg0 uint64) ([]*gophermart.Order, error) {
 	m.ctrl.T.Helper()
@@ -224,6 +653,21 @@ func (mr *MockStorerMockRecorder) GetUserOrders(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserOrders", reflect.TypeOf((*MockStorer)(nil).GetUserOrders), arg0)
 }
 
+// GetUserSessions mocks base method.
+func (m *MockStorer) GetUserSessions(arg0 uint64) ([]*gophermart.Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserSessions", arg0)
+	ret0, _ := ret[0].([]*gophermart.Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserSessions indicates an expected call of GetUserSessions.
+func (mr *MockStorerMockRecorder) GetUserSessions(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserSessions", reflect.TypeOf((*MockStorer)(nil).GetUserSessions), arg0)
+}
+
 // GetUserWithdrawals mocks base method.
 func (m *MockStorer) GetUserWithdrawals(arg0 uint64) ([]*gophermart.Withdraw, error) {
 	m.ctrl.T.Helper()
@@ -239,6 +683,234 @@ func (mr *MockStorerMockRecorder) GetUserWithdrawals(arg0 interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserWithdrawals", reflect.TypeOf((*MockStorer)(nil).GetUserWithdrawals), arg0)
 }
 
+// LeaseOrders mocks base method.
+func (m *MockStorer) LeaseOrders(arg0 string, arg1 uint32, arg2 time.Duration) (map[uint64]*gophermart.Order, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LeaseOrders", arg0, arg1, arg2)
+	ret0, _ := ret[0].(map[uint64]*gophermart.Order)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LeaseOrders indicates an expected call of LeaseOrders.
+func (mr *MockStorerMockRecorder) LeaseOrders(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LeaseOrders", reflect.TypeOf((*MockStorer)(nil).LeaseOrders), arg0, arg1, arg2)
+}
+
+// LockLogin mocks base method.
+func (m *MockStorer) LockLogin(arg0 string, arg1 time.Time, arg2 uint32) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LockLogin", arg0, arg1, arg2)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LockLogin indicates an expected call of LockLogin.
+func (mr *MockStorerMockRecorder) LockLogin(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LockLogin", reflect.TypeOf((*MockStorer)(nil).LockLogin), arg0, arg1, arg2)
+}
+
+// PublishInvalidation mocks base method.
+func (m *MockStorer) PublishInvalidation(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PublishInvalidation", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PublishInvalidation indicates an expected call of PublishInvalidation.
+func (mr *MockStorerMockRecorder) PublishInvalidation(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PublishInvalidation", reflect.TypeOf((*MockStorer)(nil).PublishInvalidation), arg0)
+}
+
+// ReleaseLoginAttempt mocks base method.
+func (m *MockStorer) ReleaseLoginAttempt(arg0 string, arg1, arg2 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReleaseLoginAttempt", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReleaseLoginAttempt indicates an expected call of ReleaseLoginAttempt.
+func (mr *MockStorerMockRecorder) ReleaseLoginAttempt(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseLoginAttempt", reflect.TypeOf((*MockStorer)(nil).ReleaseLoginAttempt), arg0, arg1, arg2)
+}
+
+// RequeueOrder mocks base method.
+func (m *MockStorer) RequeueOrder(arg0 uint64, arg1 *gophermart.AuditEntry, arg2 bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RequeueOrder", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RequeueOrder indicates an expected call of RequeueOrder.
+func (mr *MockStorerMockRecorder) RequeueOrder(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RequeueOrder", reflect.TypeOf((*MockStorer)(nil).RequeueOrder), arg0, arg1, arg2)
+}
+
+// RescheduleOrder mocks base method.
+func (m *MockStorer) RescheduleOrder(arg0 *gophermart.Order) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RescheduleOrder", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RescheduleOrder indicates an expected call of RescheduleOrder.
+func (mr *MockStorerMockRecorder) RescheduleOrder(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RescheduleOrder", reflect.TypeOf((*MockStorer)(nil).RescheduleOrder), arg0)
+}
+
+// ReserveLoginAttempt mocks base method.
+func (m *MockStorer) ReserveLoginAttempt(arg0 *gophermart.LoginAttempts, arg1, arg2 time.Time) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReserveLoginAttempt", arg0, arg1, arg2)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReserveLoginAttempt indicates an expected call of ReserveLoginAttempt.
+func (mr *MockStorerMockRecorder) ReserveLoginAttempt(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReserveLoginAttempt", reflect.TypeOf((*MockStorer)(nil).ReserveLoginAttempt), arg0, arg1, arg2)
+}
+
+// RotateSession mocks base method.
+func (m *MockStorer) RotateSession(arg0 string, arg1 uint64, arg2 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RotateSession", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RotateSession indicates an expected call of RotateSession.
+func (mr *MockStorerMockRecorder) RotateSession(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RotateSession", reflect.TypeOf((*MockStorer)(nil).RotateSession), arg0, arg1, arg2)
+}
+
+// SaveIdempotencyKey mocks base method.
+func (m *MockStorer) SaveIdempotencyKey(arg0 *gophermart.IdempotencyKey) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveIdempotencyKey", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveIdempotencyKey indicates an expected call of SaveIdempotencyKey.
+func (mr *MockStorerMockRecorder) SaveIdempotencyKey(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveIdempotencyKey", reflect.TypeOf((*MockStorer)(nil).SaveIdempotencyKey), arg0)
+}
+
+// SearchUsers mocks base method.
+func (m *MockStorer) SearchUsers(arg0 string, arg1 uint32) ([]*gophermart.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SearchUsers", arg0, arg1)
+	ret0, _ := ret[0].([]*gophermart.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SearchUsers indicates an expected call of SearchUsers.
+func (mr *MockStorerMockRecorder) SearchUsers(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchUsers", reflect.TypeOf((*MockStorer)(nil).SearchUsers), arg0, arg1)
+}
+
+// SetRecoveryCodes mocks base method.
+func (m *MockStorer) SetRecoveryCodes(arg0 uint64, arg1 []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetRecoveryCodes", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetRecoveryCodes indicates an expected call of SetRecoveryCodes.
+func (mr *MockStorerMockRecorder) SetRecoveryCodes(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetRecoveryCodes", reflect.TypeOf((*MockStorer)(nil).SetRecoveryCodes), arg0, arg1)
+}
+
+// SubscribeInvalidations mocks base method.
+func (m *MockStorer) SubscribeInvalidations(arg0 context.Context, arg1 func(string)) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SubscribeInvalidations", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SubscribeInvalidations indicates an expected call of SubscribeInvalidations.
+func (mr *MockStorerMockRecorder) SubscribeInvalidations(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SubscribeInvalidations", reflect.TypeOf((*MockStorer)(nil).SubscribeInvalidations), arg0, arg1)
+}
+
+// SubscribeUserEvents mocks base method.
+func (m *MockStorer) SubscribeUserEvents(arg0 context.Context, arg1 func(uint64)) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SubscribeUserEvents", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SubscribeUserEvents indicates an expected call of SubscribeUserEvents.
+func (mr *MockStorerMockRecorder) SubscribeUserEvents(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SubscribeUserEvents", reflect.TypeOf((*MockStorer)(nil).SubscribeUserEvents), arg0, arg1)
+}
+
+// TouchAPIKey mocks base method.
+func (m *MockStorer) TouchAPIKey(arg0 string, arg1 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TouchAPIKey", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TouchAPIKey indicates an expected call of TouchAPIKey.
+func (mr *MockStorerMockRecorder) TouchAPIKey(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TouchAPIKey", reflect.TypeOf((*MockStorer)(nil).TouchAPIKey), arg0, arg1)
+}
+
+// TouchSession mocks base method.
+func (m *MockStorer) TouchSession(arg0, arg1, arg2 string, arg3 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TouchSession", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TouchSession indicates an expected call of TouchSession.
+func (mr *MockStorerMockRecorder) TouchSession(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TouchSession", reflect.TypeOf((*MockStorer)(nil).TouchSession), arg0, arg1, arg2, arg3)
+}
+
+// UpdateBulkJob mocks base method.
+func (m *MockStorer) UpdateBulkJob(arg0 *gophermart.BulkJob) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateBulkJob", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateBulkJob indicates an expected call of UpdateBulkJob.
+func (mr *MockStorerMockRecorder) UpdateBulkJob(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateBulkJob", reflect.TypeOf((*MockStorer)(nil).UpdateBulkJob), arg0)
+}
+
 // UpdateOrder mocks base method.
 func (m *MockStorer) UpdateOrder(arg0 *gophermart.Order) error {
 	m.ctrl.T.Helper()
@@ -252,3 +924,73 @@ func (mr *MockStorerMockRecorder) UpdateOrder(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateOrder", reflect.TypeOf((*MockStorer)(nil).UpdateOrder), arg0)
 }
+
+// UpdateUserPassword mocks base method.
+func (m *MockStorer) UpdateUserPassword(arg0 uint64, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateUserPassword", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateUserPassword indicates an expected call of UpdateUserPassword.
+func (mr *MockStorerMockRecorder) UpdateUserPassword(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUserPassword", reflect.TypeOf((*MockStorer)(nil).UpdateUserPassword), arg0, arg1)
+}
+
+// UpdateUserRole mocks base method.
+func (m *MockStorer) UpdateUserRole(arg0 uint64, arg1 string, arg2 *gophermart.AuditEntry, arg3 bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateUserRole", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateUserRole indicates an expected call of UpdateUserRole.
+func (mr *MockStorerMockRecorder) UpdateUserRole(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUserRole", reflect.TypeOf((*MockStorer)(nil).UpdateUserRole), arg0, arg1, arg2, arg3)
+}
+
+// UpdateUserTOTP mocks base method.
+func (m *MockStorer) UpdateUserTOTP(arg0 uint64, arg1 string, arg2 bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateUserTOTP", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateUserTOTP indicates an expected call of UpdateUserTOTP.
+func (mr *MockStorerMockRecorder) UpdateUserTOTP(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUserTOTP", reflect.TypeOf((*MockStorer)(nil).UpdateUserTOTP), arg0, arg1, arg2)
+}
+
+// UseRecoveryCode mocks base method.
+func (m *MockStorer) UseRecoveryCode(arg0 uint64, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseRecoveryCode", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UseRecoveryCode indicates an expected call of UseRecoveryCode.
+func (mr *MockStorerMockRecorder) UseRecoveryCode(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseRecoveryCode", reflect.TypeOf((*MockStorer)(nil).UseRecoveryCode), arg0, arg1)
+}
+
+// UseTOTPStep mocks base method.
+func (m *MockStorer) UseTOTPStep(arg0 uint64, arg1 int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseTOTPStep", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UseTOTPStep indicates an expected call of UseTOTPStep.
+func (mr *MockStorerMockRecorder) UseTOTPStep(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseTOTPStep", reflect.TypeOf((*MockStorer)(nil).UseTOTPStep), arg0, arg1)
+}
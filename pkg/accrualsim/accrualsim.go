@@ -0,0 +1,393 @@
+// Package accrualsim implements the accrual system API for local development
+// and tests. A Sim is an http.Handler, so it can be served by httptest.Server
+// as well as by the accrual-sim binary.
+package accrualsim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Osselnet/gophermart.git/pkg/luhn"
+	"github.com/go-chi/chi/v5"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	StatusNew        = "NEW"
+	StatusProcessing = "PROCESSING"
+	StatusProcessed  = "PROCESSED"
+	StatusInvalid    = "INVALID"
+
+	RewardPercent = "%"
+	RewardPoints  = "pt"
+)
+
+var (
+	ErrRuleExists    = errors.New("reward rule already exists")
+	ErrRuleInvalid   = errors.New("reward rule is invalid")
+	ErrOrderExists   = errors.New("order already registered")
+	ErrOrderInvalid  = errors.New("order number is invalid")
+	ErrOrderNotFound = errors.New("order not found")
+)
+
+// Rule rewards every good whose description contains Match, either with a
+// percent of its price or with a fixed number of points.
+type Rule struct {
+	Match      string  `json:"match"`
+	Reward     float64 `json:"reward"`
+	RewardType string  `json:"reward_type"`
+}
+
+type Good struct {
+	Description string  `json:"description"`
+	Price       float64 `json:"price"`
+}
+
+// Fault is a scripted response returned instead of the real one. Faults are
+// served in the order they were scripted, one per request.
+type Fault struct {
+	Status     int    `json:"status"`
+	RetryAfter string `json:"retry_after,omitempty"`
+	Body       string `json:"body,omitempty"`
+}
+
+type Config struct {
+	Rules []Rule
+
+	// An order is NEW for ProcessingDelay after registration, then PROCESSING
+	// for ProcessedDelay, then PROCESSED or INVALID.
+	ProcessingDelay time.Duration
+	ProcessedDelay  time.Duration
+
+	// AutoRegister registers orders on their first poll with AutoGoods instead
+	// of answering 204.
+	AutoRegister bool
+	AutoGoods    []Good
+
+	// RateLimit is the number of requests per minute answered before 429,
+	// 0 for no limit.
+	RateLimit int
+
+	// Now replaces the wall clock, e.g. to move orders through statuses
+	// without waiting.
+	Now func() time.Time
+}
+
+type Answer struct {
+	Order   string   `json:"order"`
+	Status  string   `json:"status"`
+	Accrual *float64 `json:"accrual,omitempty"`
+}
+
+type order struct {
+	number       string
+	goods        []Good
+	rejected     bool
+	registeredAt time.Time
+}
+
+type Sim struct {
+	mu          sync.Mutex
+	cfg         Config
+	rules       []Rule
+	orders      map[string]*order
+	faults      []Fault
+	requests    int
+	windowStart time.Time
+	windowCount int
+	router      chi.Router
+}
+
+func New(cfg Config) *Sim {
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+
+	s := &Sim{
+		cfg:    cfg,
+		orders: make(map[string]*order),
+		router: chi.NewRouter(),
+	}
+	s.rules = append(s.rules, cfg.Rules...)
+
+	s.router.Get("/api/orders/{number}", s.getOrder)
+	s.router.Post("/api/orders", s.postOrder)
+	s.router.Post("/api/goods", s.postGoods)
+	s.router.Post("/sim/faults", s.postFaults)
+
+	return s
+}
+
+func (s *Sim) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.router.ServeHTTP(w, r)
+}
+
+func (s *Sim) AddRule(rule Rule) error {
+	if rule.Match == "" || rule.Reward < 0 || (rule.RewardType != RewardPercent && rule.RewardType != RewardPoints) {
+		return ErrRuleInvalid
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, r := range s.rules {
+		if r.Match == rule.Match {
+			return ErrRuleExists
+		}
+	}
+	s.rules = append(s.rules, rule)
+
+	return nil
+}
+
+func (s *Sim) Register(number string, goods ...Good) error {
+	if _, err := strconv.ParseUint(number, 10, 64); err != nil {
+		return ErrOrderInvalid
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.orders[number]; ok {
+		return ErrOrderExists
+	}
+	s.register(number, goods)
+
+	return nil
+}
+
+func (s *Sim) register(number string, goods []Good) *order {
+	o := &order{
+		number:       number,
+		goods:        append([]Good(nil), goods...),
+		rejected:     !luhn.IsValid(number),
+		registeredAt: s.cfg.Now(),
+	}
+	s.orders[number] = o
+
+	return o
+}
+
+// Reject makes a registered order end up INVALID.
+func (s *Sim) Reject(number string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[number]
+	if !ok {
+		return ErrOrderNotFound
+	}
+	o.rejected = true
+
+	return nil
+}
+
+func (s *Sim) Script(faults ...Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults = append(s.faults, faults...)
+}
+
+// Requests returns the number of order polls received so far.
+func (s *Sim) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests
+}
+
+// Lookup returns what a poll of the order would answer right now.
+func (s *Sim) Lookup(number string) (Answer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[number]
+	if !ok {
+		return Answer{}, ErrOrderNotFound
+	}
+
+	return s.answer(o), nil
+}
+
+func (s *Sim) answer(o *order) Answer {
+	a := Answer{Order: o.number}
+
+	elapsed := s.cfg.Now().Sub(o.registeredAt)
+	switch {
+	case elapsed < s.cfg.ProcessingDelay:
+		a.Status = StatusNew
+	case elapsed < s.cfg.ProcessingDelay+s.cfg.ProcessedDelay:
+		a.Status = StatusProcessing
+	case o.rejected:
+		a.Status = StatusInvalid
+	default:
+		a.Status = StatusProcessed
+		accrual := s.accrual(o.goods)
+		a.Accrual = &accrual
+	}
+
+	return a
+}
+
+func (s *Sim) accrual(goods []Good) float64 {
+	var sum float64
+	for _, g := range goods {
+		for _, r := range s.rules {
+			if !strings.Contains(g.Description, r.Match) {
+				continue
+			}
+			if r.RewardType == RewardPercent {
+				sum += g.Price * r.Reward / 100
+			} else {
+				sum += r.Reward
+			}
+			break
+		}
+	}
+
+	return math.Round(sum*100) / 100
+}
+
+// throttle tells whether the request is over the rate limit. The limit is
+// counted in fixed one minute windows like the reference accrual system does.
+func (s *Sim) throttle(now time.Time) (time.Duration, bool) {
+	if s.cfg.RateLimit <= 0 {
+		return 0, false
+	}
+
+	if now.Sub(s.windowStart) >= time.Minute {
+		s.windowStart = now
+		s.windowCount = 0
+	}
+	s.windowCount++
+	if s.windowCount <= s.cfg.RateLimit {
+		return 0, false
+	}
+
+	return s.windowStart.Add(time.Minute).Sub(now), true
+}
+
+func (s *Sim) getOrder(w http.ResponseWriter, r *http.Request) {
+	number := chi.URLParam(r, "number")
+
+	s.mu.Lock()
+	s.requests++
+
+	if len(s.faults) > 0 {
+		f := s.faults[0]
+		s.faults = s.faults[1:]
+		s.mu.Unlock()
+
+		if f.RetryAfter != "" {
+			w.Header().Set("Retry-After", f.RetryAfter)
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(f.Status)
+		w.Write([]byte(f.Body))
+		return
+	}
+
+	if wait, ok := s.throttle(s.cfg.Now()); ok {
+		s.mu.Unlock()
+
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprintf(w, "No more than %d requests per minute allowed", s.cfg.RateLimit)
+		return
+	}
+
+	o, ok := s.orders[number]
+	if !ok && s.cfg.AutoRegister && luhn.IsValid(number) {
+		o, ok = s.register(number, s.cfg.AutoGoods), true
+	}
+	if !ok {
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	a := s.answer(o)
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, a)
+}
+
+type orderRequest struct {
+	Order string `json:"order"`
+	Goods []Good `json:"goods"`
+}
+
+func (s *Sim) postOrder(w http.ResponseWriter, r *http.Request) {
+	req := orderRequest{}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = s.Register(req.Order, req.Goods...)
+	switch {
+	case errors.Is(err, ErrOrderExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func (s *Sim) postGoods(w http.ResponseWriter, r *http.Request) {
+	rule := Rule{}
+	err := json.NewDecoder(r.Body).Decode(&rule)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = s.AddRule(rule)
+	switch {
+	case errors.Is(err, ErrRuleExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (s *Sim) postFaults(w http.ResponseWriter, r *http.Request) {
+	var faults []Fault
+	err := json.NewDecoder(r.Body).Decode(&faults)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for _, f := range faults {
+		if f.Status < 100 || f.Status > 599 {
+			http.Error(w, fmt.Sprintf("bad fault status %d", f.Status), http.StatusBadRequest)
+			return
+		}
+	}
+	s.Script(faults...)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(body)
+}
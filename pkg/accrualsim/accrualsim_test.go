@@ -0,0 +1,91 @@
+package accrualsim
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func poll(t *testing.T, s *Sim, number string) (*httptest.ResponseRecorder, Answer) {
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/orders/"+number, nil))
+
+	var a Answer
+	if w.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &a))
+	}
+
+	return w, a
+}
+
+func TestSim_statuses(t *testing.T) {
+	now := time.Now()
+	s := New(Config{
+		Rules: []Rule{
+			{Match: "Bork", Reward: 10, RewardType: RewardPercent},
+			{Match: "LG", Reward: 50, RewardType: RewardPoints},
+		},
+		ProcessingDelay: time.Second,
+		ProcessedDelay:  time.Second,
+		Now:             func() time.Time { return now },
+	})
+
+	w, _ := poll(t, s, "6767584380420")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = httptest.NewRecorder()
+	body := `{"order":"6767584380420","goods":[{"description":"Чайник Bork","price":7000},{"description":"Телевизор LG","price":50000},{"description":"Хлеб","price":50}]}`
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/orders", strings.NewReader(body)))
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.ErrorIs(t, s.Register("6767584380420"), ErrOrderExists)
+	require.NoError(t, s.Register("12345678"))
+
+	_, a := poll(t, s, "6767584380420")
+	assert.Equal(t, StatusNew, a.Status)
+
+	now = now.Add(time.Second)
+	_, a = poll(t, s, "6767584380420")
+	assert.Equal(t, StatusProcessing, a.Status)
+	assert.Nil(t, a.Accrual)
+
+	now = now.Add(time.Second)
+	_, a = poll(t, s, "6767584380420")
+	assert.Equal(t, StatusProcessed, a.Status)
+	require.NotNil(t, a.Accrual)
+	assert.Equal(t, 750.0, *a.Accrual)
+
+	_, a = poll(t, s, "12345678")
+	assert.Equal(t, StatusInvalid, a.Status, "number fails the Luhn check")
+}
+
+func TestSim_faults(t *testing.T) {
+	s := New(Config{AutoRegister: true, RateLimit: 2})
+	s.Script(
+		Fault{Status: http.StatusTooManyRequests, RetryAfter: "7", Body: "slow down"},
+		Fault{Status: http.StatusInternalServerError},
+	)
+
+	w, _ := poll(t, s, "6767584380420")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "7", w.Header().Get("Retry-After"))
+	assert.Equal(t, "slow down", w.Body.String())
+
+	w, _ = poll(t, s, "6767584380420")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	w, a := poll(t, s, "6767584380420")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, StatusProcessed, a.Status)
+
+	poll(t, s, "6767584380420")
+	w, _ = poll(t, s, "6767584380420")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "No more than 2 requests per minute allowed", w.Body.String())
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	assert.Equal(t, 5, s.Requests())
+}
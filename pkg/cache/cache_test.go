@@ -0,0 +1,45 @@
+package cache
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestCache_LRU(t *testing.T) {
+	c := New[string, int](2, 0)
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+	_, ok := c.Get("a")
+	assert.True(t, ok)
+
+	c.Set("c", 3)
+	_, ok = c.Get("b")
+	assert.False(t, ok, "least recently used entry is evicted")
+	v, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+
+	c.DeleteFunc(func(key string, value int) bool { return value == 3 })
+	_, ok = c.Get("c")
+	assert.False(t, ok)
+
+	assert.Equal(t, Stats{Size: 1, Capacity: 2, Hits: 2, Misses: 2, Evictions: 1}, c.Stats())
+}
+
+func TestCache_TTL(t *testing.T) {
+	now := time.Now()
+	c := New[int, string](10, time.Minute)
+	c.now = func() time.Time { return now }
+
+	c.Set(1, "one")
+	now = now.Add(59 * time.Second)
+	_, ok := c.Get(1)
+	assert.True(t, ok)
+
+	now = now.Add(time.Second)
+	_, ok = c.Get(1)
+	assert.False(t, ok, "entry expires after ttl")
+	assert.Zero(t, c.Stats().Size)
+}
@@ -0,0 +1,164 @@
+// Package jwt signs and verifies compact JSON Web Tokens with HMAC-SHA256.
+// Keys are identified by the kid header, so tokens signed with an older key
+// stay valid while that key is kept in the Keyring for verification.
+package jwt
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	algHS256 = "HS256"
+	typJWT   = "JWT"
+
+	MinKeySize = 32
+)
+
+var (
+	ErrMalformed      = errors.New("malformed token")
+	ErrUnsupportedAlg = errors.New("unsupported token algorithm")
+	ErrUnknownKey     = errors.New("token signed with unknown key")
+	ErrSignature      = errors.New("token signature is invalid")
+	ErrKeyring        = errors.New("invalid keyring")
+)
+
+var encoding = base64.RawURLEncoding
+
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid"`
+}
+
+type Keyring struct {
+	signing string
+	keys    map[string][]byte
+}
+
+// NewKeyring signs with the signingKID key and accepts tokens signed with any
+// of keys.
+func NewKeyring(signingKID string, keys map[string][]byte) (*Keyring, error) {
+	if _, ok := keys[signingKID]; !ok {
+		return nil, fmt.Errorf("%w: no signing key %q", ErrKeyring, signingKID)
+	}
+
+	k := &Keyring{signing: signingKID, keys: make(map[string][]byte, len(keys))}
+	for kid, key := range keys {
+		if kid == "" || len(key) < MinKeySize {
+			return nil, fmt.Errorf("%w: key %q must have an ID and at least %d bytes", ErrKeyring, kid, MinKeySize)
+		}
+		k.keys[kid] = append([]byte(nil), key...)
+	}
+
+	return k, nil
+}
+
+// ParseKeyring reads keys in "kid:secret,kid:secret" form. The first key
+// signs new tokens, the others only verify.
+func ParseKeyring(spec string) (*Keyring, error) {
+	var signing string
+	keys := make(map[string][]byte)
+
+	for _, pair := range strings.Split(spec, ",") {
+		kid, secret, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok {
+			return nil, fmt.Errorf("%w: key must be in kid:secret form", ErrKeyring)
+		}
+		if _, dup := keys[kid]; dup {
+			return nil, fmt.Errorf("%w: duplicate key %q", ErrKeyring, kid)
+		}
+		if signing == "" {
+			signing = kid
+		}
+		keys[kid] = []byte(secret)
+	}
+
+	return NewKeyring(signing, keys)
+}
+
+// RandomKeyring returns a keyring with a single random key. Tokens signed with
+// it can't be verified by other processes.
+func RandomKeyring() *Keyring {
+	key := make([]byte, MinKeySize)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+
+	return &Keyring{signing: "random", keys: map[string][]byte{"random": key}}
+}
+
+func (k *Keyring) Sign(claims interface{}) (string, error) {
+	h, err := json.Marshal(header{Alg: algHS256, Typ: typJWT, Kid: k.signing})
+	if err != nil {
+		return "", err
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := encoding.EncodeToString(h) + "." + encoding.EncodeToString(c)
+
+	return unsigned + "." + encoding.EncodeToString(sign(k.keys[k.signing], unsigned)), nil
+}
+
+// Verify checks the token signature and decodes its claims. Time based claims
+// are left to the caller.
+func (k *Keyring) Verify(token string, claims interface{}) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ErrMalformed
+	}
+
+	var h header
+	if err := decode(parts[0], &h); err != nil {
+		return err
+	}
+	if h.Alg != algHS256 {
+		return fmt.Errorf("%w: %q", ErrUnsupportedAlg, h.Alg)
+	}
+
+	key, ok := k.keys[h.Kid]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownKey, h.Kid)
+	}
+
+	sig, err := encoding.DecodeString(parts[2])
+	if err != nil {
+		return ErrMalformed
+	}
+	if !hmac.Equal(sig, sign(key, parts[0]+"."+parts[1])) {
+		return ErrSignature
+	}
+
+	return decode(parts[1], claims)
+}
+
+func sign(key []byte, unsigned string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(unsigned))
+
+	return mac.Sum(nil)
+}
+
+func decode(part string, v interface{}) error {
+	data, err := encoding.DecodeString(part)
+	if err != nil {
+		return ErrMalformed
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("%w: %s", ErrMalformed, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package jwt
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+type claims struct {
+	Subject string `json:"sub"`
+}
+
+func TestKeyring(t *testing.T) {
+	oldKey := strings.Repeat("o", MinKeySize)
+	newKey := strings.Repeat("n", MinKeySize)
+
+	old, err := ParseKeyring("k1:" + oldKey)
+	require.NoError(t, err)
+	rotated, err := ParseKeyring("k2:" + newKey + ",k1:" + oldKey)
+	require.NoError(t, err)
+	dropped, err := ParseKeyring("k2:" + newKey)
+	require.NoError(t, err)
+
+	token, err := old.Sign(&claims{Subject: "173"})
+	require.NoError(t, err)
+
+	var got claims
+	require.NoError(t, rotated.Verify(token, &got), "old key is still accepted after rotation")
+	assert.Equal(t, "173", got.Subject)
+	assert.ErrorIs(t, dropped.Verify(token, &got), ErrUnknownKey)
+
+	token, err = rotated.Sign(&claims{Subject: "173"})
+	require.NoError(t, err)
+	assert.NoError(t, dropped.Verify(token, &got), "new tokens are signed with the first key")
+	assert.ErrorIs(t, old.Verify(token, &got), ErrUnknownKey)
+
+	parts := strings.Split(token, ".")
+	forged := parts[0] + "." + encoding.EncodeToString([]byte(`{"sub":"1"}`)) + "." + parts[2]
+	assert.ErrorIs(t, rotated.Verify(forged, &got), ErrSignature)
+
+	none := encoding.EncodeToString([]byte(`{"alg":"none","kid":"k2"}`)) + "." + parts[1] + "."
+	assert.ErrorIs(t, rotated.Verify(none, &got), ErrUnsupportedAlg)
+	assert.ErrorIs(t, rotated.Verify("abc", &got), ErrMalformed)
+}
+
+func TestParseKeyring(t *testing.T) {
+	for _, spec := range []string{"", "k1", "k1:short", ":" + strings.Repeat("x", MinKeySize), "k1:" + strings.Repeat("x", MinKeySize) + ",k1:" + strings.Repeat("y", MinKeySize)} {
+		_, err := ParseKeyring(spec)
+		assert.ErrorIs(t, err, ErrKeyring, spec)
+	}
+}
@@ -0,0 +1,171 @@
+// Package password hashes passwords into self-describing strings: argon2id
+// hashes in the PHC string format, bcrypt hashes in their usual $2a$ form.
+// The algorithm and its parameters are read back from the hash, so hashes
+// made with older settings keep working and can be told apart for rehashing.
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+)
+
+const (
+	Argon2id = "argon2id"
+	Bcrypt   = "bcrypt"
+
+	saltSize = 16
+	keySize  = 32
+)
+
+var (
+	ErrUnknownAlgorithm = errors.New("password: unknown hash algorithm")
+	ErrMalformedHash    = errors.New("password: malformed hash")
+)
+
+// Params of the hashes made by Hash. Memory is in KiB.
+type Params struct {
+	Algorithm string
+	Memory    uint32
+	Time      uint32
+	Threads   uint8
+	Cost      int
+}
+
+// DefaultParams follow the OWASP recommendation for argon2id.
+var DefaultParams = Params{
+	Algorithm: Argon2id,
+	Memory:    19 * 1024,
+	Time:      2,
+	Threads:   1,
+	Cost:      bcrypt.DefaultCost,
+}
+
+type argon2Hash struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+var b64 = base64.RawStdEncoding
+
+func Hash(password string, p Params) (string, error) {
+	switch p.Algorithm {
+	case Argon2id:
+		salt := make([]byte, saltSize)
+		_, err := rand.Read(salt)
+		if err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(password), salt, p.Time, p.Memory, p.Threads, keySize)
+
+		return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", Argon2id, argon2.Version, p.Memory, p.Time, p.Threads,
+			b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+	case Bcrypt:
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), p.Cost)
+		if err != nil {
+			return "", err
+		}
+
+		return string(hash), nil
+	default:
+		return "", fmt.Errorf("%w `%s`", ErrUnknownAlgorithm, p.Algorithm)
+	}
+}
+
+// Verify tells whether the password matches the hash.
+func Verify(password, hash string) (bool, error) {
+	switch algorithm(hash) {
+	case Argon2id:
+		h, err := parseArgon2(hash)
+		if err != nil {
+			return false, err
+		}
+		key := argon2.IDKey([]byte(password), h.salt, h.time, h.memory, h.threads, uint32(len(h.key)))
+
+		return subtle.ConstantTimeCompare(key, h.key) == 1, nil
+	case Bcrypt:
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("%w - %s", ErrMalformedHash, err)
+		}
+
+		return true, nil
+	default:
+		return false, ErrUnknownAlgorithm
+	}
+}
+
+// NeedsRehash tells whether the hash was made with another algorithm or
+// other parameters than p.
+func NeedsRehash(hash string, p Params) bool {
+	if algorithm(hash) != p.Algorithm {
+		return true
+	}
+
+	switch p.Algorithm {
+	case Argon2id:
+		h, err := parseArgon2(hash)
+		if err != nil {
+			return true
+		}
+		return h.memory != p.Memory || h.time != p.Time || h.threads != p.Threads || len(h.key) != keySize
+	case Bcrypt:
+		cost, err := bcrypt.Cost([]byte(hash))
+		return err != nil || cost != p.Cost
+	}
+
+	return true
+}
+
+func algorithm(hash string) string {
+	switch {
+	case strings.HasPrefix(hash, "$"+Argon2id+"$"):
+		return Argon2id
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		return Bcrypt
+	default:
+		return ""
+	}
+}
+
+// parseArgon2 parses $argon2id$v=19$m=65536,t=3,p=4$salt$key.
+func parseArgon2(hash string) (*argon2Hash, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return nil, ErrMalformedHash
+	}
+
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return nil, fmt.Errorf("%w - unsupported version", ErrMalformedHash)
+	}
+
+	h := &argon2Hash{}
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.memory, &h.time, &h.threads)
+	if err != nil || h.time == 0 || h.threads == 0 {
+		return nil, fmt.Errorf("%w - bad parameters", ErrMalformedHash)
+	}
+
+	h.salt, err = b64.DecodeString(parts[4])
+	if err != nil {
+		return nil, fmt.Errorf("%w - bad salt", ErrMalformedHash)
+	}
+	h.key, err = b64.DecodeString(parts[5])
+	if err != nil || len(h.key) == 0 {
+		return nil, fmt.Errorf("%w - bad key", ErrMalformedHash)
+	}
+
+	return h, nil
+}
@@ -0,0 +1,84 @@
+package password
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"testing"
+)
+
+var testParams = Params{Algorithm: Argon2id, Memory: 1024, Time: 1, Threads: 1, Cost: bcrypt.MinCost}
+
+func TestHashVerify(t *testing.T) {
+	for _, alg := range []string{Argon2id, Bcrypt} {
+		p := testParams
+		p.Algorithm = alg
+
+		hash, err := Hash("Passw0rd33", p)
+		require.NoError(t, err, alg)
+
+		ok, err := Verify("Passw0rd33", hash)
+		require.NoError(t, err, alg)
+		assert.True(t, ok, alg)
+
+		ok, err = Verify("Passw0rd34", hash)
+		require.NoError(t, err, alg)
+		assert.False(t, ok, alg)
+
+		assert.False(t, NeedsRehash(hash, p), alg)
+	}
+
+	hash, err := Hash("Passw0rd33", testParams)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$"), hash)
+
+	again, err := Hash("Passw0rd33", testParams)
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, again, "salted")
+}
+
+func TestVerify_Legacy(t *testing.T) {
+	// Hashes stored before the algorithm could be chosen: bcrypt of cost 8.
+	legacy, err := bcrypt.GenerateFromPassword([]byte("Passw0rd33"), 8)
+	require.NoError(t, err)
+
+	ok, err := Verify("Passw0rd33", string(legacy))
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	assert.True(t, NeedsRehash(string(legacy), testParams), "other algorithm")
+	assert.True(t, NeedsRehash(string(legacy), Params{Algorithm: Bcrypt, Cost: 10}), "other cost")
+	assert.False(t, NeedsRehash(string(legacy), Params{Algorithm: Bcrypt, Cost: 8}))
+
+	p := testParams
+	p.Time = 2
+	hash, err := Hash("Passw0rd33", testParams)
+	require.NoError(t, err)
+	assert.True(t, NeedsRehash(hash, p), "other parameters")
+}
+
+func TestVerify_Malformed(t *testing.T) {
+	for _, hash := range []string{
+		"",
+		"plain text",
+		"$argon2id$v=19$m=1024,t=1,p=1$c2FsdA",
+		"$argon2id$v=18$m=1024,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=1024,t=0,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=1024,t=1,p=1$!!!$a2V5",
+	} {
+		_, err := Verify("Passw0rd33", hash)
+		assert.Error(t, err, hash)
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	p := DefaultPolicy
+	assert.NoError(t, p.Check("Passw0rd33"))
+	assert.ErrorIs(t, p.Check("Sh0rt"), ErrTooShort)
+	assert.ErrorIs(t, p.Check(strings.Repeat("x", MaxBcryptLength+1)), ErrTooLong)
+	assert.NoError(t, p.Check(strings.Repeat("я", MaxBcryptLength/2)), "length limit is in bytes")
+	assert.ErrorIs(t, p.Check(strings.Repeat("я", MaxBcryptLength/2+1)), ErrTooLong)
+	assert.ErrorIs(t, p.Check("Password123"), ErrCommon, "case is ignored")
+	assert.ErrorIs(t, p.Check("qwertyuiop"), ErrCommon)
+}
@@ -0,0 +1,65 @@
+package password
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxBcryptLength is the number of bytes bcrypt hashes, the rest is ignored.
+const MaxBcryptLength = 72
+
+var (
+	ErrTooShort = errors.New("password is too short")
+	ErrTooLong  = errors.New("password is too long")
+	ErrCommon   = errors.New("password is too common")
+)
+
+//go:embed common.txt
+var commonList string
+
+var common = func() map[string]struct{} {
+	m := make(map[string]struct{})
+	for _, p := range strings.Split(commonList, "\n") {
+		if p = strings.TrimSpace(p); p != "" {
+			m[p] = struct{}{}
+		}
+	}
+
+	return m
+}()
+
+// Policy is checked for new passwords only. MinLength is in characters,
+// MaxLength in bytes.
+type Policy struct {
+	MinLength int
+	MaxLength int
+}
+
+var DefaultPolicy = Policy{
+	MinLength: 8,
+	MaxLength: MaxBcryptLength,
+}
+
+func (p Policy) Check(password string) error {
+	if n := utf8.RuneCountInString(password); n < p.MinLength {
+		return fmt.Errorf("%w, at least %d characters needed", ErrTooShort, p.MinLength)
+	}
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		return fmt.Errorf("%w, at most %d bytes allowed", ErrTooLong, p.MaxLength)
+	}
+	if IsCommon(password) {
+		return ErrCommon
+	}
+
+	return nil
+}
+
+// IsCommon tells whether the password, ignoring case, is on the bundled
+// list of common passwords.
+func IsCommon(password string) bool {
+	_, ok := common[strings.ToLower(password)]
+	return ok
+}
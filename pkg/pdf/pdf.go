@@ -0,0 +1,195 @@
+// Package pdf writes plain text documents as PDF 1.4. Text is set in the
+// standard Courier fonts, which every reader has, so no font is embedded and
+// columns line up by character count. Every page is written out as soon as
+// it is full, so documents of any length take little memory.
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	// A4 in points.
+	PageWidth  = 595.0
+	PageHeight = 842.0
+
+	Margin     = 40.0
+	FontSize   = 9.0
+	LineHeight = 12.0
+	// CharWidth is the advance of every Courier glyph.
+	CharWidth = FontSize * 0.6
+
+	objCatalog  = 1
+	objPages    = 2
+	objFont     = 3
+	objFontBold = 4
+	objFirst    = 5
+)
+
+// Writer lays text out line by line, top down, starting new pages as
+// needed. Errors are sticky and returned by Close.
+type Writer struct {
+	w       io.Writer
+	written int64
+	err     error
+
+	offsets map[int]int64
+	nextObj int
+	pages   []int
+
+	content *bytes.Buffer
+	y       float64
+	// header is drawn at the top of every page.
+	header func()
+}
+
+func New(w io.Writer) *Writer {
+	p := &Writer{
+		w:       w,
+		offsets: make(map[int]int64),
+		nextObj: objFirst,
+	}
+	// The binary comment tells transfer programs the file is not text.
+	p.write("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	p.writeObject(objFont, "<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	p.writeObject(objFontBold, "<< /Type /Font /Subtype /Type1 /BaseFont /Courier-Bold /Encoding /WinAnsiEncoding >>")
+
+	return p
+}
+
+// SetHeader sets the lines drawn at the top of every following page, e.g.
+// the titles of table columns.
+func (p *Writer) SetHeader(fn func()) {
+	p.header = fn
+}
+
+// Columns returns how many characters fit between the margins.
+func Columns() int {
+	width := PageWidth - 2*Margin
+	return int(width / CharWidth)
+}
+
+// Line writes s on a line of its own, starting a page if the current one is
+// full. Text past the right margin is cut.
+func (p *Writer) Line(s string, bold bool) {
+	if p.content == nil || p.y < Margin {
+		p.newPage()
+	}
+	p.text(s, bold)
+}
+
+// Space leaves an empty line unless the page is full.
+func (p *Writer) Space() {
+	if p.content != nil && p.y >= Margin {
+		p.y -= LineHeight
+	}
+}
+
+func (p *Writer) text(s string, bold bool) {
+	if len(s) > Columns() {
+		s = s[:Columns()]
+	}
+
+	font := "/F1"
+	if bold {
+		font = "/F2"
+	}
+	fmt.Fprintf(p.content, "BT %s %.1f Tf %.1f %.1f Td (%s) Tj ET\n", font, FontSize, Margin, p.y, escape(s))
+	p.y -= LineHeight
+}
+
+func (p *Writer) newPage() {
+	p.flushPage()
+
+	p.content = new(bytes.Buffer)
+	p.y = PageHeight - Margin - FontSize
+	if p.header != nil {
+		p.header()
+	}
+}
+
+// flushPage writes the contents and the object of the current page.
+func (p *Writer) flushPage() {
+	if p.content == nil {
+		return
+	}
+
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	_, _ = zw.Write(p.content.Bytes())
+	_ = zw.Close()
+
+	contents := p.nextObj
+	page := p.nextObj + 1
+	p.nextObj += 2
+
+	p.writeObject(contents, fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", z.Len(), z.Bytes()))
+	p.writeObject(page, fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.0f %.0f] "+
+		"/Resources << /Font << /F1 %d 0 R /F2 %d 0 R >> >> /Contents %d 0 R >>",
+		objPages, PageWidth, PageHeight, objFont, objFontBold, contents))
+	p.pages = append(p.pages, page)
+	p.content = nil
+}
+
+// Close finishes the last page and writes the page tree and the cross
+// reference table. It returns the first error met while writing.
+func (p *Writer) Close() error {
+	if p.content == nil && len(p.pages) == 0 {
+		p.newPage()
+	}
+	p.flushPage()
+
+	kids := make([]string, 0, len(p.pages))
+	for _, id := range p.pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", id))
+	}
+	p.writeObject(objPages, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(p.pages)))
+	p.writeObject(objCatalog, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", objPages))
+
+	xref := p.written
+	p.write(fmt.Sprintf("xref\n0 %d\n0000000000 65535 f \n", p.nextObj))
+	for id := 1; id < p.nextObj; id++ {
+		p.write(fmt.Sprintf("%010d 00000 n \n", p.offsets[id]))
+	}
+	p.write(fmt.Sprintf("trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", p.nextObj, objCatalog, xref))
+
+	return p.err
+}
+
+func (p *Writer) writeObject(id int, body string) {
+	p.offsets[id] = p.written
+	p.write(fmt.Sprintf("%d 0 obj\n%s\nendobj\n", id, body))
+}
+
+func (p *Writer) write(s string) {
+	if p.err != nil {
+		return
+	}
+
+	n, err := io.WriteString(p.w, s)
+	p.written += int64(n)
+	p.err = err
+}
+
+// escape makes s a PDF string literal in WinAnsiEncoding, characters it
+// lacks are replaced with a question mark.
+func escape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r > 0xff || (r >= 0x7f && r < 0xa0):
+			b.WriteByte('?')
+		default:
+			b.WriteByte(byte(r))
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,50 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	p := New(&buf)
+	headers := 0
+	p.SetHeader(func() {
+		headers++
+		p.Line("Header (page)", true)
+	})
+	for i := 0; i < 100; i++ {
+		p.Line(fmt.Sprintf("line %d \\ Привет", i), false)
+	}
+	require.NoError(t, p.Close())
+
+	doc := buf.Bytes()
+	assert.True(t, bytes.HasPrefix(doc, []byte("%PDF-1.4\n")))
+	assert.True(t, bytes.HasSuffix(doc, []byte("%%EOF\n")))
+	assert.Equal(t, 2, headers, "a header on every page")
+	assert.Contains(t, string(doc), "/Count 2")
+
+	// Every cross reference points at its object.
+	m := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(doc)
+	require.Len(t, m, 2)
+	xref, err := strconv.Atoi(string(m[1]))
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(doc[xref:], []byte("xref\n0 ")))
+
+	offsets := regexp.MustCompile(`(\d{10}) 00000 n \n`).FindAllSubmatch(doc[xref:], -1)
+	require.Len(t, offsets, 8)
+	for i, o := range offsets {
+		off, err := strconv.Atoi(string(o[1]))
+		require.NoError(t, err)
+		assert.True(t, bytes.HasPrefix(doc[off:], []byte(fmt.Sprintf("%d 0 obj\n", i+1))), "object %d", i+1)
+	}
+}
+
+func TestEscape(t *testing.T) {
+	assert.Equal(t, `a\(b\)c\\d ?`, escape("a(b)c\\d Ж"))
+}
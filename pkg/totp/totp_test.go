@@ -0,0 +1,72 @@
+package totp
+
+import (
+	"encoding/base32"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenerate_RFC6238(t *testing.T) {
+	key := []byte("12345678901234567890")
+	for _, tt := range []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	} {
+		assert.Equal(t, tt.code, generate(key, Step(time.Unix(tt.unix, 0)), 8), tt.unix)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(59, 0)
+
+	code, err := Code(secret, now)
+	require.NoError(t, err)
+	assert.Equal(t, "287082", code)
+
+	step, ok := Validate(secret, code, now, 1)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), step)
+
+	_, ok = Validate(secret, code, now.Add(Period), 1)
+	assert.True(t, ok, "previous step is accepted")
+	_, ok = Validate(secret, code, now.Add(2*Period), 1)
+	assert.False(t, ok)
+	_, ok = Validate(secret, "287083", now, 1)
+	assert.False(t, ok)
+	_, ok = Validate(secret, "", now, 1)
+	assert.False(t, ok)
+	_, ok = Validate("not base32!", code, now, 1)
+	assert.False(t, ok)
+}
+
+func TestGenerateSecret(t *testing.T) {
+	s1, err := GenerateSecret()
+	require.NoError(t, err)
+	s2, err := GenerateSecret()
+	require.NoError(t, err)
+	assert.NotEqual(t, s1, s2)
+	assert.Len(t, s1, 32)
+
+	_, err = Code(s1, time.Now())
+	assert.NoError(t, err)
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("Gophermart", "user@example.com", "JBSWY3DPEHPK3PXP")
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/Gophermart:user@example.com?"), uri)
+	assert.Contains(t, uri, "secret=JBSWY3DPEHPK3PXP")
+	assert.Contains(t, uri, "issuer=Gophermart")
+	assert.Contains(t, uri, "digits=6")
+	assert.Contains(t, uri, "period=30")
+}
@@ -0,0 +1,123 @@
+package test
+
+import (
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/Osselnet/gophermart.git/internal/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGopherMart_ChangePassword(t *testing.T) {
+	gm := gophermart.New(memory.New())
+
+	creds := &gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}
+	current, err := gm.Register(creds, gophermart.Client{})
+	require.NoError(t, err)
+	other, err := gm.Login(creds, "", gophermart.Client{})
+	require.NoError(t, err)
+
+	_, err = gm.ChangePassword(current.UserID, current.ID, "wrongPass", "N3wPassw0rd", gophermart.Client{})
+	assert.ErrorIs(t, err, gophermart.ErrInvalidPair)
+	_, err = gm.ChangePassword(current.UserID, current.ID, "Passw0rd33", "short", gophermart.Client{})
+	assert.ErrorIs(t, err, gophermart.ErrPasswordWeak)
+
+	ids, err := gm.ChangePassword(current.UserID, current.ID, "Passw0rd33", "N3wPassw0rd", gophermart.Client{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{other.ID}, ids)
+
+	_, err = gm.Sessions.Get(current.ID)
+	assert.NoError(t, err, "the session that changed the password is kept")
+	_, err = gm.Sessions.Get(other.ID)
+	assert.ErrorIs(t, err, gophermart.ErrSessionNotFound)
+
+	_, err = gm.Login(creds, "", gophermart.Client{})
+	assert.ErrorIs(t, err, gophermart.ErrInvalidPair)
+	_, err = gm.Login(&gophermart.Credentials{Login: "testov", Password: "N3wPassw0rd"}, "", gophermart.Client{})
+	assert.NoError(t, err)
+
+	es, err := gm.Audit.Query(gophermart.AuditFilter{Action: gophermart.AuditPasswordChange})
+	require.NoError(t, err)
+	require.Len(t, es, 1, "refused changes are not recorded")
+	assert.Equal(t, current.UserID, es[0].ActorID)
+	assert.JSONEq(t, `{"sessions_revoked":1}`, es[0].Details)
+}
+
+func TestGopherMart_DeleteAccount(t *testing.T) {
+	st := memory.New()
+	gm := gophermart.New(st)
+
+	creds := &gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}
+	session, err := gm.Register(creds, gophermart.Client{})
+	require.NoError(t, err)
+	userID := session.UserID
+
+	require.NoError(t, gm.PostOrders(6767584380420, userID, gophermart.Client{}))
+	pool, err := st.LeaseOrders("test", 10, time.Minute)
+	require.NoError(t, err)
+	order := pool[6767584380420]
+	order.Status = gophermart.StatusProcessed
+	order.Accrual = 79998
+	require.NoError(t, st.UpdateOrder(order))
+	require.NoError(t, gm.PostWithdraw(&gophermart.WithdrawProxy{Order: "2377225624", Sum: 26061, UserID: userID}))
+
+	// An order being polled while the account is deleted.
+	require.NoError(t, gm.PostOrders(49927398716, userID, gophermart.Client{}))
+	pool, err = st.LeaseOrders("test", 10, time.Minute)
+	require.NoError(t, err)
+	pending := pool[49927398716]
+	require.NotNil(t, pending)
+
+	assert.ErrorIs(t, gm.DeleteAccount(userID, "wrongPass", true, gophermart.Client{}), gophermart.ErrInvalidPair)
+	assert.ErrorIs(t, gm.DeleteAccount(userID, "Passw0rd33", false, gophermart.Client{}), gophermart.ErrBalanceNotEmpty)
+	_, err = gm.Sessions.Get(session.ID)
+	require.NoError(t, err, "refused deletion changes nothing")
+
+	require.NoError(t, gm.DeleteAccount(userID, "Passw0rd33", true, gophermart.Client{}))
+
+	_, err = gm.Sessions.Get(session.ID)
+	assert.ErrorIs(t, err, gophermart.ErrSessionNotFound)
+	_, err = gm.Login(creds, "", gophermart.Client{})
+	assert.ErrorIs(t, err, gophermart.ErrUserNotFound)
+
+	u, err := st.GetUser(userID)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(u.Login, "deleted:"), u.Login)
+	assert.Empty(t, u.PasswordHash)
+
+	orders, err := gm.GetOrders(userID)
+	require.NoError(t, err)
+	assert.Len(t, orders, 2, "orders are kept for accounting")
+
+	o, err := st.GetOrder(49927398716)
+	require.NoError(t, err)
+	assert.Equal(t, gophermart.StatusInvalid, o.Status, "orders not processed yet are cancelled")
+	assert.Equal(t, gophermart.OrderCancelledAccountDeleted, o.LastError)
+	pending.Status = gophermart.StatusProcessed
+	pending.Accrual = 50000
+	assert.ErrorIs(t, st.UpdateOrder(pending), gophermart.ErrOrderFinalized, "late accruals are not credited")
+	pool, err = st.LeaseOrders("test", 10, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, pool)
+	withdrawals, err := gm.GetWithdrawals(userID)
+	require.NoError(t, err)
+	assert.Len(t, withdrawals, 1, "withdrawals are kept for accounting")
+
+	balance, err := st.GetBalance(userID)
+	require.NoError(t, err)
+	assert.Equal(t, gophermart.Balance{UserID: userID, Current: 0, Withdrawn: 26061}, balance)
+	assert.NoError(t, gm.Balances.Verify(userID), "forfeited balance is posted to the ledger")
+
+	es, err := gm.Audit.Query(gophermart.AuditFilter{Action: gophermart.AuditAccountDelete})
+	require.NoError(t, err)
+	require.Len(t, es, 1, "refused deletions are not recorded")
+	assert.Equal(t, userID, es[0].TargetUserID)
+	assert.JSONEq(t, `{"forfeit_balance":true}`, es[0].Details)
+	assert.JSONEq(t, `{"current":539.37,"withdrawn":260.61}`, es[0].Before)
+	assert.JSONEq(t, `{"current":0,"withdrawn":260.61}`, es[0].After)
+
+	_, err = gm.Register(creds, gophermart.Client{})
+	assert.NoError(t, err, "the login is free again")
+}
@@ -0,0 +1,83 @@
+package test
+
+import (
+	"encoding/json"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/Osselnet/gophermart.git/internal/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestAdmin(t *testing.T) {
+	st := memory.New()
+	gm := gophermart.New(st)
+
+	staff, err := gm.Register(&gophermart.Credentials{Login: "support", Password: "Passw0rd33"}, gophermart.Client{})
+	require.NoError(t, err)
+	customer, err := gm.Register(&gophermart.Credentials{Login: "Testov", Password: "Passw0rd33"}, gophermart.Client{})
+	require.NoError(t, err)
+	adminID, userID := staff.UserID, customer.UserID
+
+	u, err := gm.Users.Get(adminID)
+	require.NoError(t, err)
+	assert.Equal(t, gophermart.RoleUser, u.Role)
+	assert.ErrorIs(t, gm.Users.SetRole(u, "root"), gophermart.ErrRoleInvalid)
+	require.NoError(t, gm.Users.SetRole(u, gophermart.RoleAdmin))
+	u, err = gm.Users.Get(adminID)
+	require.NoError(t, err)
+	assert.True(t, u.IsAdmin(), "cached user is refreshed")
+
+	found, err := gm.Admin.SearchUsers(adminID, gophermart.Client{}, "testo", 0)
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	assert.Equal(t, userID, found[0].ID)
+
+	_, err = gm.Admin.AdjustBalance(adminID, userID, gophermart.Client{}, gophermart.DirectionCredit, 10000, " ")
+	assert.ErrorIs(t, err, gophermart.ErrAdjustmentInvalid, "reason is mandatory")
+	_, err = gm.Admin.AdjustBalance(adminID, userID, gophermart.Client{}, gophermart.DirectionDebit, 100, "typo")
+	assert.ErrorIs(t, err, gophermart.ErrNotEnoughFunds)
+
+	b, err := gm.Admin.AdjustBalance(adminID, userID, gophermart.Client{}, gophermart.DirectionCredit, 10000, "goodwill for ticket 42")
+	require.NoError(t, err)
+	assert.Equal(t, gophermart.Money(10000), b.Current)
+	b, err = gm.Admin.AdjustBalance(adminID, userID, gophermart.Client{}, gophermart.DirectionDebit, 2550, "double credit")
+	require.NoError(t, err)
+	assert.Equal(t, gophermart.Balance{UserID: userID, Current: 7450}, b)
+	assert.NoError(t, gm.Balances.Verify(userID), "adjustments are posted to the ledger")
+
+	require.NoError(t, gm.PostOrders(6767584380420, userID, gophermart.Client{}))
+	assert.ErrorIs(t, gm.Admin.RequeueOrder(adminID, 303653406, gophermart.Client{}, ""), gophermart.ErrOrderNotFound)
+	require.NoError(t, gm.Admin.RequeueOrder(adminID, 6767584380420, gophermart.Client{}, "accrual outage"))
+
+	es, err := gm.Audit.Query(gophermart.AuditFilter{Action: gophermart.AuditAdminPrefix})
+	require.NoError(t, err)
+	var actions []string
+	for _, e := range es[:len(es)-1] {
+		assert.Equal(t, adminID, e.ActorID)
+		actions = append(actions, e.Action)
+	}
+	assert.Equal(t, []string{
+		gophermart.AuditAdminRequeueOrder,
+		gophermart.AuditAdminAdjustBalance,
+		gophermart.AuditAdminAdjustBalance,
+		gophermart.AuditAdminSearchUsers,
+	}, actions, "refused actions are not audited")
+
+	grant := es[len(es)-1]
+	assert.Equal(t, gophermart.AuditAdminGrantRole, grant.Action)
+	assert.Zero(t, grant.ActorID, "roles are granted by the operator")
+	assert.Equal(t, adminID, grant.TargetUserID)
+	assert.JSONEq(t, `{"role":"user"}`, grant.Before)
+	assert.JSONEq(t, `{"role":"admin"}`, grant.After)
+
+	var details, before, after map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(es[1].Details), &details))
+	require.NoError(t, json.Unmarshal([]byte(es[1].Before), &before))
+	require.NoError(t, json.Unmarshal([]byte(es[1].After), &after))
+	assert.Equal(t, userID, es[1].TargetUserID)
+	assert.Equal(t, "double credit", details["reason"])
+	assert.Equal(t, 100.0, before["current"])
+	assert.Equal(t, 74.5, after["current"])
+	assert.Equal(t, "order:6767584380420", es[0].Target)
+}
@@ -0,0 +1,70 @@
+package test
+
+import (
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/Osselnet/gophermart.git/internal/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIKeys(t *testing.T) {
+	st := memory.New()
+	gm := gophermart.New(st)
+
+	session, err := gm.Register(&gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}, gophermart.Client{})
+	require.NoError(t, err)
+	userID := session.UserID
+
+	_, err = gm.APIKeys.Create(userID, " ", []string{gophermart.ScopeOrdersWrite}, time.Time{})
+	assert.ErrorIs(t, err, gophermart.ErrAPIKeyInvalid)
+	_, err = gm.APIKeys.Create(userID, "erp", nil, time.Time{})
+	assert.ErrorIs(t, err, gophermart.ErrAPIKeyInvalid)
+	_, err = gm.APIKeys.Create(userID, "erp", []string{"admin"}, time.Time{})
+	assert.ErrorIs(t, err, gophermart.ErrAPIKeyInvalid)
+	_, err = gm.APIKeys.Create(userID, "erp", []string{gophermart.ScopeWithdraw}, time.Now().Add(-time.Minute))
+	assert.ErrorIs(t, err, gophermart.ErrAPIKeyInvalid)
+
+	key, err := gm.APIKeys.Create(userID, "erp", []string{gophermart.ScopeWithdraw, gophermart.ScopeOrdersWrite, gophermart.ScopeWithdraw}, time.Time{})
+	require.NoError(t, err)
+	assert.True(t, gophermart.IsAPIKey(key.Key))
+	assert.Equal(t, []string{gophermart.ScopeOrdersWrite, gophermart.ScopeWithdraw}, key.Scopes)
+
+	stored, err := st.GetAPIKey(key.ID)
+	require.NoError(t, err)
+	assert.Empty(t, stored.Key)
+	assert.NotContains(t, key.Key, stored.Hash, "only the hash is stored")
+	assert.True(t, stored.LastUsedAt.IsZero())
+
+	got, err := gm.APIKeys.Authenticate(key.Key)
+	require.NoError(t, err)
+	assert.Equal(t, userID, got.UserID)
+	stored, err = st.GetAPIKey(key.ID)
+	require.NoError(t, err)
+	assert.False(t, stored.LastUsedAt.IsZero(), "last use is recorded")
+
+	_, err = gm.APIKeys.Authenticate(key.Key + "x")
+	assert.ErrorIs(t, err, gophermart.ErrAPIKeyNotFound)
+	_, err = gm.APIKeys.Authenticate(strings.Replace(key.Key, key.ID, "0000000000000000", 1))
+	assert.ErrorIs(t, err, gophermart.ErrAPIKeyNotFound)
+
+	expiring, err := gm.APIKeys.Create(userID, "short lived", []string{gophermart.ScopeBalanceRead}, time.Now().Add(50*time.Millisecond))
+	require.NoError(t, err)
+	_, err = gm.APIKeys.Authenticate(expiring.Key)
+	require.NoError(t, err)
+	time.Sleep(60 * time.Millisecond)
+	_, err = gm.APIKeys.Authenticate(expiring.Key)
+	assert.ErrorIs(t, err, gophermart.ErrAPIKeyExpired)
+
+	assert.ErrorIs(t, gm.APIKeys.Revoke(userID+1, key.ID), gophermart.ErrAPIKeyNotFound, "keys of other users can't be revoked")
+	require.NoError(t, gm.APIKeys.Revoke(userID, key.ID))
+	_, err = gm.APIKeys.Authenticate(key.Key)
+	assert.ErrorIs(t, err, gophermart.ErrAPIKeyNotFound)
+
+	require.NoError(t, gm.DeleteAccount(userID, "Passw0rd33", false, gophermart.Client{}))
+	keys, err := gm.APIKeys.ListForUser(userID)
+	require.NoError(t, err)
+	assert.Empty(t, keys, "keys are deleted along with the account")
+}
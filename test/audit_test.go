@@ -0,0 +1,116 @@
+package test
+
+import (
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/Osselnet/gophermart.git/internal/memory"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// tamperedStorer alters an audit entry on the way out.
+type tamperedStorer struct {
+	*memory.StorageMem
+	id uint64
+}
+
+func (s *tamperedStorer) GetAuditEntries(f gophermart.AuditFilter) ([]*gophermart.AuditEntry, error) {
+	es, err := s.StorageMem.GetAuditEntries(f)
+	for i, e := range es {
+		if e.ID == s.id {
+			c := *e
+			c.Details = `{"sum":1}`
+			es[i] = &c
+		}
+	}
+
+	return es, err
+}
+
+func TestAudit(t *testing.T) {
+	st := memory.New()
+	gm := gophermart.New(st)
+	gm.SetAuditConfig(gophermart.AuditConfig{HashChain: true})
+	client := gophermart.Client{IP: "192.0.2.1", RequestID: "vm/req-000001"}
+	start := time.Now().Add(-time.Second)
+
+	session, err := gm.Register(&gophermart.Credentials{Login: "Testov", Password: "Passw0rd33"}, client)
+	require.NoError(t, err)
+	userID := session.UserID
+
+	_, err = gm.Login(&gophermart.Credentials{Login: "Testov", Password: "wrong"}, "", client)
+	require.ErrorIs(t, err, gophermart.ErrInvalidPair)
+	_, err = gm.Login(&gophermart.Credentials{Login: "nobody", Password: "wrong"}, "", gophermart.Client{IP: "198.51.100.7"})
+	require.ErrorIs(t, err, gophermart.ErrUserNotFound)
+	session, err = gm.Login(&gophermart.Credentials{Login: "Testov", Password: "Passw0rd33"}, "", client)
+	require.NoError(t, err)
+
+	require.NoError(t, gm.PostOrders(6767584380420, userID, client))
+	_, err = st.AdjustBalance(&gophermart.Adjustment{ID: uuid.NewString(), UserID: userID, Direction: gophermart.DirectionCredit,
+		Amount: 50000, Reason: "test", CreatedAt: time.Now()}, nil, false)
+	require.NoError(t, err)
+	require.NoError(t, gm.PostWithdraw(&gophermart.WithdrawProxy{Order: "2377225624", UserID: userID, Sum: 20000, Client: client}))
+	require.NoError(t, gm.Logout(session.Token, client))
+
+	es, err := gm.Audit.Query(gophermart.AuditFilter{})
+	require.NoError(t, err)
+	var actions []string
+	for _, e := range es {
+		actions = append(actions, e.Action)
+	}
+	assert.Equal(t, []string{
+		gophermart.AuditLogout,
+		gophermart.AuditWithdraw,
+		gophermart.AuditOrderUpload,
+		gophermart.AuditLogin,
+		gophermart.AuditLoginFailed,
+		gophermart.AuditLoginFailed,
+		gophermart.AuditUserRegister,
+	}, actions)
+
+	withdraw := es[1]
+	assert.Equal(t, userID, withdraw.ActorID)
+	assert.Equal(t, "order:2377225624", withdraw.Target)
+	assert.Equal(t, "192.0.2.1", withdraw.IP)
+	assert.Equal(t, "vm/req-000001", withdraw.RequestID)
+	assert.JSONEq(t, `{"current":500,"withdrawn":0}`, withdraw.Before)
+	assert.JSONEq(t, `{"current":300,"withdrawn":200}`, withdraw.After)
+
+	unknown := es[4]
+	assert.Zero(t, unknown.ActorID)
+	assert.Zero(t, unknown.TargetUserID, "unknown logins have no target user")
+	assert.Equal(t, "login:nobody", unknown.Target)
+	assert.Equal(t, userID, es[5].TargetUserID)
+
+	es, err = gm.Audit.Query(gophermart.AuditFilter{Action: "user."})
+	require.NoError(t, err)
+	assert.Len(t, es, 5, "action prefix")
+	es, err = gm.Audit.Query(gophermart.AuditFilter{Action: gophermart.AuditLogin})
+	require.NoError(t, err)
+	assert.Len(t, es, 1, "exact action")
+	es, err = gm.Audit.Query(gophermart.AuditFilter{IP: "198.51.100.7"})
+	require.NoError(t, err)
+	assert.Len(t, es, 1)
+	es, err = gm.Audit.Query(gophermart.AuditFilter{TargetUserID: userID, Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, es, 2)
+	es, err = gm.Audit.Query(gophermart.AuditFilter{TargetUserID: userID, BeforeID: es[1].ID})
+	require.NoError(t, err)
+	assert.Len(t, es, 4, "paging back")
+	es, err = gm.Audit.Query(gophermart.AuditFilter{Since: start, Until: start.Add(time.Hour)})
+	require.NoError(t, err)
+	assert.Len(t, es, 7)
+	es, err = gm.Audit.Query(gophermart.AuditFilter{Until: start})
+	require.NoError(t, err)
+	assert.Empty(t, es)
+
+	n, err := gm.Audit.Verify()
+	require.NoError(t, err)
+	assert.Equal(t, 7, n)
+
+	tampered := gophermart.NewAuditor(&tamperedStorer{StorageMem: st, id: withdraw.ID}, gophermart.AuditConfig{HashChain: true})
+	_, err = tampered.Verify()
+	assert.ErrorIs(t, err, gophermart.ErrAuditChainBroken)
+}
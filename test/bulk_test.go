@@ -0,0 +1,240 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/Osselnet/gophermart.git/internal/memory"
+	"github.com/Osselnet/gophermart.git/pkg/luhn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// luhnNumbers returns n valid order numbers.
+func luhnNumbers(n int) []string {
+	var ns []string
+	for i := 1000; len(ns) < n; i++ {
+		for d := 0; d < 10; d++ {
+			s := fmt.Sprintf("%d%d", i, d)
+			if luhn.IsValid(s) {
+				ns = append(ns, s)
+				break
+			}
+		}
+	}
+
+	return ns
+}
+
+func TestReadBulkOrders(t *testing.T) {
+	gm := gophermart.New(memory.New())
+	gm.SetBulkConfig(gophermart.BulkConfig{MaxOrders: 3})
+
+	lines, err := gm.ReadBulkOrders(strings.NewReader("number,note\n79927398713,first\n\n 12345678903\n"), gophermart.BulkFormatCSV)
+	require.NoError(t, err)
+	assert.Equal(t, []gophermart.BulkResult{{Line: 2, Number: "79927398713"}, {Line: 4, Number: "12345678903"}}, lines)
+
+	lines, err = gm.ReadBulkOrders(strings.NewReader(`{"number":"79927398713"}`+"\n"+`{"number":12345678903}`+"\n"+`oops`+"\n"), gophermart.BulkFormatNDJSON)
+	require.NoError(t, err)
+	require.Len(t, lines, 3)
+	assert.Equal(t, "79927398713", lines[0].Number)
+	assert.Equal(t, "12345678903", lines[1].Number, "JSON numbers")
+	assert.Equal(t, gophermart.BulkInvalid, lines[2].Result, "malformed lines are kept")
+	assert.Equal(t, 3, lines[2].Line)
+
+	_, err = gm.ReadBulkOrders(strings.NewReader("1\n2\n3\n4\n"), gophermart.BulkFormatCSV)
+	assert.ErrorIs(t, err, gophermart.ErrBulkTooLarge)
+	_, err = gm.ReadBulkOrders(strings.NewReader("number\n"), gophermart.BulkFormatCSV)
+	assert.ErrorIs(t, err, gophermart.ErrBulkInvalid, "empty upload")
+	_, err = gm.ReadBulkOrders(strings.NewReader(`"79927398713`), gophermart.BulkFormatCSV)
+	assert.ErrorIs(t, err, gophermart.ErrBulkInvalid)
+}
+
+func TestPostOrdersBulk(t *testing.T) {
+	st := memory.New()
+	gm := gophermart.New(st)
+	session, err := gm.Register(&gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}, gophermart.Client{})
+	require.NoError(t, err)
+	userID := session.UserID
+
+	require.NoError(t, gm.PostOrders(79927398713, userID, gophermart.Client{}))
+	require.NoError(t, gm.PostOrders(12345678903, userID+1, gophermart.Client{}))
+	last, err := gm.Events.Last(userID)
+	require.NoError(t, err)
+
+	lines := []gophermart.BulkResult{
+		{Line: 1, Number: "6767584380420"},
+		{Line: 2, Number: "79927398713"},
+		{Line: 3, Number: "12345678903"},
+		{Line: 4, Number: "12345678900"},
+		{Line: 5, Number: "abc"},
+		{Line: 6, Number: "6767584380420"},
+		{Line: 7, Result: gophermart.BulkInvalid, Error: "line is not an object with a number"},
+	}
+	job, err := gm.PostOrdersBulk(userID, lines, gophermart.Client{})
+	require.NoError(t, err)
+	assert.Equal(t, gophermart.BulkJobDone, job.Status)
+	assert.Equal(t, 7, job.Processed)
+
+	var results []string
+	for _, r := range job.Results {
+		results = append(results, r.Result)
+	}
+	assert.Equal(t, []string{
+		gophermart.BulkAccepted,
+		gophermart.BulkDuplicateOwn,
+		gophermart.BulkDuplicateOther,
+		gophermart.BulkInvalid,
+		gophermart.BulkInvalid,
+		gophermart.BulkDuplicateOwn,
+		gophermart.BulkInvalid,
+	}, results)
+	assert.Equal(t, map[string]int{
+		gophermart.BulkAccepted:       1,
+		gophermart.BulkDuplicateOwn:   2,
+		gophermart.BulkDuplicateOther: 1,
+		gophermart.BulkInvalid:        3,
+	}, job.Summary())
+
+	o, err := st.GetOrder(6767584380420)
+	require.NoError(t, err)
+	assert.Equal(t, userID, o.UserID)
+	assert.Equal(t, gophermart.StatusNew, o.Status)
+
+	es, err := gm.Events.Since(userID, last)
+	require.NoError(t, err)
+	require.Len(t, es, 1, "accepted orders are published")
+	assert.Contains(t, es[0].Data, "6767584380420")
+	audit, err := gm.Audit.Query(gophermart.AuditFilter{Target: "order:6767584380420"})
+	require.NoError(t, err)
+	require.Len(t, audit, 1)
+	assert.Equal(t, gophermart.AuditOrderUpload, audit[0].Action)
+
+	_, err = gm.BulkJob(userID, job.ID)
+	assert.ErrorIs(t, err, gophermart.ErrBulkJobNotFound, "jobs done right away are not stored")
+}
+
+func TestPostOrdersBulkJob(t *testing.T) {
+	st := memory.New()
+	gm := gophermart.New(st)
+	gm.SetBulkConfig(gophermart.BulkConfig{MaxOrders: 2000, SyncLimit: 10})
+	session, err := gm.Register(&gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}, gophermart.Client{})
+	require.NoError(t, err)
+	userID := session.UserID
+
+	var lines []gophermart.BulkResult
+	for i, n := range luhnNumbers(1200) {
+		lines = append(lines, gophermart.BulkResult{Line: i + 1, Number: n})
+	}
+	job, err := gm.PostOrdersBulk(userID, lines, gophermart.Client{})
+	require.NoError(t, err)
+	assert.Equal(t, gophermart.BulkJobPending, job.Status)
+	assert.Equal(t, 1200, job.Total)
+	assert.NotEmpty(t, job.ID)
+
+	_, err = gm.BulkJob(userID+1, job.ID)
+	assert.ErrorIs(t, err, gophermart.ErrBulkJobNotFound, "jobs of other users")
+
+	require.Eventually(t, func() bool {
+		job, err = gm.BulkJob(userID, job.ID)
+		require.NoError(t, err)
+		return job.Status == gophermart.BulkJobDone
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1200, job.Processed)
+	assert.Equal(t, 1200, job.Summary()[gophermart.BulkAccepted])
+
+	ors, err := st.GetUserOrders(userID)
+	require.NoError(t, err)
+	assert.Len(t, ors, 1200)
+
+	_, err = gm.PostOrdersBulk(userID, make([]gophermart.BulkResult, 2001), gophermart.Client{})
+	assert.ErrorIs(t, err, gophermart.ErrBulkTooLarge)
+}
+
+func TestResumeBulkJobs(t *testing.T) {
+	st := memory.New()
+	gm := gophermart.New(st)
+	gm.SetBulkConfig(gophermart.BulkConfig{MaxOrders: 2000, SyncLimit: 10, ResumeAfter: time.Minute})
+	session, err := gm.Register(&gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}, gophermart.Client{})
+	require.NoError(t, err)
+	userID := session.UserID
+
+	// A job of a crashed server, saved after its first chunk.
+	numbers := luhnNumbers(700)
+	var lines []gophermart.BulkResult
+	for i, n := range numbers {
+		lines = append(lines, gophermart.BulkResult{Line: i + 1, Number: n})
+	}
+	for i := 0; i < 500; i++ {
+		lines[i].Result = gophermart.BulkAccepted
+		id, err := strconv.ParseUint(numbers[i], 10, 64)
+		require.NoError(t, err)
+		require.NoError(t, st.AddOrder(&gophermart.Order{ID: id, UserID: userID, Status: gophermart.StatusNew}))
+	}
+	lines[700-1].Number = numbers[0]
+	stale := time.Now().Add(-2 * time.Minute)
+	require.NoError(t, st.AddBulkJob(&gophermart.BulkJob{
+		ID:        "crashed",
+		UserID:    userID,
+		Status:    gophermart.BulkJobRunning,
+		Total:     len(lines),
+		Processed: 500,
+		Results:   lines,
+		CreatedAt: stale,
+		UpdatedAt: stale,
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go gm.ResumeBulkJobs(ctx)
+	defer func() {
+		cancel()
+		gm.StopBulkJobs()
+	}()
+
+	var job *gophermart.BulkJob
+	require.Eventually(t, func() bool {
+		job, err = gm.BulkJob(userID, "crashed")
+		require.NoError(t, err)
+		return job.Status == gophermart.BulkJobDone
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 700, job.Processed)
+	assert.Equal(t, 699, job.Summary()[gophermart.BulkAccepted])
+	assert.Equal(t, gophermart.BulkAccepted, job.Results[0].Result, "lines processed before the crash are kept")
+	assert.Equal(t, gophermart.BulkDuplicateOwn, job.Results[700-1].Result)
+
+	ors, err := st.GetUserOrders(userID)
+	require.NoError(t, err)
+	assert.Len(t, ors, 699)
+}
+
+func TestStopBulkJobs(t *testing.T) {
+	st := memory.New()
+	gm := gophermart.New(st)
+	gm.SetBulkConfig(gophermart.BulkConfig{MaxOrders: 2000, SyncLimit: 10})
+	session, err := gm.Register(&gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}, gophermart.Client{})
+	require.NoError(t, err)
+	userID := session.UserID
+
+	gm.StopBulkJobs()
+
+	var lines []gophermart.BulkResult
+	for i, n := range luhnNumbers(20) {
+		lines = append(lines, gophermart.BulkResult{Line: i + 1, Number: n})
+	}
+	job, err := gm.PostOrdersBulk(userID, lines, gophermart.Client{})
+	require.NoError(t, err)
+
+	// Uploads after the stop are left to the next server.
+	job, err = gm.BulkJob(userID, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, gophermart.BulkJobPending, job.Status)
+
+	jobs, err := st.ClaimBulkJobs(time.Now().Add(time.Second), time.Now(), 10)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, job.ID, jobs[0].ID)
+}
@@ -0,0 +1,105 @@
+package test
+
+import (
+	"context"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/Osselnet/gophermart.git/internal/memory"
+	"github.com/Osselnet/gophermart.git/pkg/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestGopherMart_CacheInvalidation(t *testing.T) {
+	keys := jwt.RandomKeyring()
+
+	// Two replicas sharing one storage.
+	st := memory.New()
+	gm1 := gophermart.New(st)
+	gm1.SetTokenConfig(gophermart.TokenConfig{Keys: keys})
+	gm2 := gophermart.New(st)
+	gm2.SetTokenConfig(gophermart.TokenConfig{Keys: keys})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go gm2.ListenInvalidations(ctx)
+
+	creds := &gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}
+	session, err := gm1.Register(creds, gophermart.Client{})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		_, err := gm2.Authenticate(session.Token, gophermart.Client{})
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	_, err = gm2.Authenticate(session.Token, gophermart.Client{})
+	require.NoError(t, err)
+	assert.NotZero(t, gm2.CacheStats().Sessions.Hits)
+
+	require.NoError(t, gm1.Logout(session.Token, gophermart.Client{}))
+	assert.Eventually(t, func() bool {
+		_, err := gm2.Authenticate(session.Token, gophermart.Client{})
+		return err != nil
+	}, time.Second, 10*time.Millisecond, "session deleted on another replica")
+
+	_, err = gm2.Users.Get(creds.Login)
+	require.NoError(t, err)
+	require.NoError(t, gm1.Users.Delete(creds.Login))
+	assert.Eventually(t, func() bool {
+		_, err := gm2.Users.Get(creds.Login)
+		return err != nil
+	}, time.Second, 10*time.Millisecond, "user deleted on another replica")
+}
+
+func TestGopherMart_CacheLimits(t *testing.T) {
+	gm := gophermart.New(memory.New())
+	gm.SetCacheConfig(gophermart.CacheConfig{SessionSize: 2, UserSize: 2})
+
+	for _, login := range []string{"first", "second", "third"} {
+		_, err := gm.Register(&gophermart.Credentials{Login: login, Password: "Passw0rd33"}, gophermart.Client{})
+		require.NoError(t, err)
+	}
+
+	stats := gm.CacheStats()
+	assert.Equal(t, 2, stats.Sessions.Size)
+	assert.Equal(t, 2, stats.Users.Size)
+	assert.NotZero(t, stats.Users.Evictions)
+
+	u, err := gm.Users.Get("first")
+	require.NoError(t, err, "evicted users are loaded from the storage")
+	assert.Equal(t, "first", u.Login)
+
+	before := gm.CacheStats().UsersByID
+	_, err = gm.Users.Get(u.ID)
+	require.NoError(t, err)
+	_, err = gm.Users.Get(u.ID)
+	require.NoError(t, err)
+	after := gm.CacheStats().UsersByID
+	assert.Equal(t, before.Hits+before.Misses+2, after.Hits+after.Misses, "lookups by ID are counted")
+	assert.Greater(t, after.Hits, before.Hits)
+}
+
+func TestGopherMart_ReapSessions(t *testing.T) {
+	st := memory.New()
+	gm := gophermart.New(st)
+
+	now := time.Now()
+	for _, s := range []*gophermart.Session{
+		{ID: "expired1", UserID: 1, Expiry: now.Add(-time.Hour)},
+		{ID: "expired2", UserID: 1, Expiry: now.Add(-time.Minute)},
+		{ID: "expired3", UserID: 2, Expiry: now.Add(-time.Second)},
+		{ID: "alive", UserID: 2, Expiry: now.Add(time.Hour)},
+	} {
+		require.NoError(t, gm.Sessions.Add(s))
+	}
+
+	n, err := gm.Sessions.Reap(2)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	_, err = gm.Sessions.Get("expired1")
+	assert.ErrorIs(t, err, gophermart.ErrSessionNotFound)
+	_, err = st.GetSession("alive")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,82 @@
+package test
+
+import (
+	"context"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/Osselnet/gophermart.git/internal/memory"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestEvents(t *testing.T) {
+	// Two replicas sharing one storage.
+	st := memory.New()
+	gm1 := gophermart.New(st)
+	gm2 := gophermart.New(st)
+
+	session, err := gm1.Register(&gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}, gophermart.Client{})
+	require.NoError(t, err)
+	userID := session.UserID
+
+	last, err := gm2.Events.Last(userID)
+	require.NoError(t, err)
+	assert.Zero(t, last)
+
+	wake, unsubscribe := gm2.Events.Subscribe(userID)
+	defer unsubscribe()
+	other, unsubscribeOther := gm2.Events.Subscribe(userID + 1)
+	defer unsubscribeOther()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go gm2.ListenEvents(ctx)
+	// Every stream is woken once listening, events may have been missed.
+	select {
+	case <-wake:
+	case <-time.After(time.Second):
+		t.Fatal("streams are not woken once listening")
+	}
+	<-other
+
+	require.NoError(t, gm1.PostOrders(6767584380420, userID, gophermart.Client{}))
+	select {
+	case <-wake:
+	case <-time.After(time.Second):
+		t.Fatal("stream on another replica is not woken")
+	}
+	select {
+	case <-other:
+		t.Fatal("stream of another user is woken")
+	default:
+	}
+
+	_, err = st.AdjustBalance(&gophermart.Adjustment{ID: uuid.NewString(), UserID: userID, Direction: gophermart.DirectionCredit,
+		Amount: 50000, Reason: "test", CreatedAt: time.Now()}, nil, false)
+	require.NoError(t, err)
+	require.NoError(t, gm1.PostWithdraw(&gophermart.WithdrawProxy{Order: "2377225624", UserID: userID, Sum: 20000}))
+
+	es, err := gm2.Events.Since(userID, 0)
+	require.NoError(t, err)
+	require.Len(t, es, 2)
+	assert.Equal(t, gophermart.EventOrder, es[0].Type)
+	assert.Contains(t, es[0].Data, `"number":"6767584380420","status":"NEW"`)
+	assert.Equal(t, gophermart.EventBalance, es[1].Type)
+	assert.JSONEq(t, `{"current":300,"withdrawn":200}`, es[1].Data)
+
+	es, err = gm2.Events.Since(userID, es[0].ID)
+	require.NoError(t, err)
+	assert.Len(t, es, 1, "resumed after the first event")
+	last, err = gm2.Events.Last(userID)
+	require.NoError(t, err)
+	assert.Equal(t, es[0].ID, last)
+
+	n, err := st.DeleteUserEventsBefore(time.Now().Add(time.Minute), 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	es, err = gm2.Events.Since(userID, 0)
+	require.NoError(t, err)
+	assert.Len(t, es, 1, "the oldest event is pruned")
+}
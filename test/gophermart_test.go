@@ -35,7 +35,7 @@ func TestGopherMart_GetOrders(t *testing.T) {
 				{
 					Number:     "6767584380420",
 					Status:     "PROCESSED",
-					Accrual:    799.98,
+					Accrual:    79998,
 					UploadedAt: rTime.Format(time.RFC3339),
 				},
 			},
@@ -57,7 +57,7 @@ func TestGopherMart_GetOrders(t *testing.T) {
 				{
 					Number:     "6767584380420",
 					Status:     "PROCESSED",
-					Accrual:    79.98,
+					Accrual:    7998,
 					UploadedAt: rTime.Format(time.RFC3339),
 				},
 			},
@@ -101,7 +101,7 @@ func TestGopherMart_PostWithdraw(t *testing.T) {
 			wpr: &gophermart.WithdrawProxy{
 				Order:  "303653406",
 				UserID: 173,
-				Sum:    260.61,
+				Sum:    26061,
 			},
 			wantErr: true,
 		},
@@ -115,7 +115,7 @@ func TestGopherMart_PostWithdraw(t *testing.T) {
 			wpr: &gophermart.WithdrawProxy{
 				Order:  "303656",
 				UserID: 173,
-				Sum:    260.61,
+				Sum:    26061,
 			},
 			wantErr: false,
 		},
@@ -125,12 +125,16 @@ func TestGopherMart_PostWithdraw(t *testing.T) {
 
 	m := mocks.NewMockStorer(ctrl)
 	gm := gophermart.New(m)
+	m.EXPECT().GetUser(uint64(173)).Return(&gophermart.User{ID: 173, Login: "testov"}, nil).AnyTimes()
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			if tt.wantErr {
 				m.EXPECT().GetOrderWithdrawals(tt.bw.OrderID).Return(nil, nil)
 				m.EXPECT().AddWithdraw(tt.bw).Return(nil)
+				m.EXPECT().GetBalance(tt.bw.UserID).Return(gophermart.Balance{UserID: tt.bw.UserID}, nil).Times(2)
+				m.EXPECT().AddAuditEntry(gomock.Any(), false).Return(nil)
+				m.EXPECT().AddUserEvent(gomock.Any()).Return(nil)
 			}
 			err := gm.PostWithdraw(tt.wpr)
 			if tt.wantErr {
@@ -171,7 +175,7 @@ func TestGopherMart_GetWithdrawals(t *testing.T) {
 			want: []*gophermart.WithdrawProxy{
 				{
 					Order:       "303653406",
-					Sum:         260.61,
+					Sum:         26061,
 					ProcessedAt: rTime.Format(time.RFC3339),
 				},
 			},
@@ -193,7 +197,7 @@ func TestGopherMart_GetWithdrawals(t *testing.T) {
 			want: []*gophermart.WithdrawProxy{
 				{
 					Order:       "67625566",
-					Sum:         260.61,
+					Sum:         26061,
 					ProcessedAt: rTime.Format(time.RFC3339),
 				},
 			},
@@ -241,7 +245,7 @@ func TestGopherMart_GetBalance(t *testing.T) {
 				Current: 145996,
 			},
 			want: &gophermart.BalanceProxy{
-				Current: 1459.96,
+				Current: 145996,
 			},
 			wantErr: true,
 		},
@@ -255,8 +259,8 @@ func TestGopherMart_GetBalance(t *testing.T) {
 				Current: 145996,
 			},
 			want: &gophermart.BalanceProxy{
-				Current:   1459.96,
-				Withdrawn: 1.0,
+				Current:   145996,
+				Withdrawn: 100,
 			},
 			wantErr: false,
 		},
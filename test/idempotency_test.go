@@ -0,0 +1,36 @@
+package test
+
+import (
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/Osselnet/gophermart.git/internal/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyKeysExpiry(t *testing.T) {
+	st := memory.New()
+	gm := gophermart.New(st)
+	gm.IdempotencyKeys.SetRetention(time.Millisecond)
+
+	k, err := gm.IdempotencyKeys.Reserve(1, "key-1", "first")
+	require.NoError(t, err)
+	k.StatusCode = 200
+	require.NoError(t, gm.IdempotencyKeys.Save(k))
+	_, err = gm.IdempotencyKeys.Reserve(2, "key-1", "other user")
+	require.NoError(t, err)
+
+	time.Sleep(5 * time.Millisecond)
+	gm.IdempotencyKeys.SetRetention(time.Hour)
+	k, err = gm.IdempotencyKeys.Reserve(1, "key-1", "second")
+	require.NoError(t, err, "expired keys not pruned yet are taken over")
+	assert.Equal(t, "second", k.Fingerprint)
+	assert.Zero(t, k.StatusCode)
+
+	n, err := st.DeleteIdempotencyKeysBefore(time.Now(), 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n, "the key of user 2 has expired, the new one of user 1 has not")
+	_, err = gm.IdempotencyKeys.Reserve(1, "key-1", "second")
+	assert.ErrorIs(t, err, gophermart.ErrIdempotencyKeyExists)
+}
@@ -0,0 +1,113 @@
+package test
+
+import (
+	"fmt"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/Osselnet/gophermart.git/internal/memory"
+	"github.com/Osselnet/gophermart.git/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestBalanceFromLedger(t *testing.T) {
+	rTime := time.Now()
+
+	var entries []*gophermart.LedgerEntry
+	entries = append(entries, gophermart.NewAccrualEntries(&gophermart.Order{ID: 6767584380420, UserID: 173, Accrual: 79998}, rTime)...)
+	entries = append(entries, gophermart.NewAccrualEntries(&gophermart.Order{ID: 303653406, UserID: 173, Accrual: 10002}, rTime)...)
+	entries = append(entries, gophermart.NewWithdrawalEntries(&gophermart.Withdraw{OrderID: 2377225624, UserID: 173, Sum: 26061}, rTime)...)
+
+	var sum int64
+	for _, e := range entries {
+		if e.Direction == gophermart.DirectionCredit {
+			sum += int64(e.Amount)
+		} else {
+			sum -= int64(e.Amount)
+		}
+	}
+	assert.Zero(t, sum, "every transaction must balance")
+
+	got, err := gophermart.BalanceFromLedger(173, entries)
+	require.NoError(t, err)
+	assert.Equal(t, gophermart.Balance{UserID: 173, Current: 63939, Withdrawn: 26061}, got)
+
+	_, err = gophermart.BalanceFromLedger(173, entries[4:])
+	assert.Error(t, err, "withdrawal without accrual must be reported as overdraft")
+}
+
+func TestBalances_Verify(t *testing.T) {
+	rTime := time.Now()
+	entries := gophermart.NewAccrualEntries(&gophermart.Order{ID: 6767584380420, UserID: 173, Accrual: 79998}, rTime)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	m := mocks.NewMockStorer(ctrl)
+	gm := gophermart.New(m)
+
+	m.EXPECT().GetBalance(uint64(173)).Return(gophermart.Balance{UserID: 173, Current: 79998}, nil)
+	m.EXPECT().GetLedgerEntries(uint64(173), gomock.Any()).Return(entries, nil)
+	assert.NoError(t, gm.Balances.Verify(173))
+
+	m.EXPECT().GetBalance(uint64(173)).Return(gophermart.Balance{UserID: 173, Current: 1}, nil)
+	m.EXPECT().GetLedgerEntries(uint64(173), gomock.Any()).Return(entries, nil)
+	assert.ErrorIs(t, gm.Balances.Verify(173), gophermart.ErrBalanceMismatch)
+}
+
+func TestBalances_AtBoundary(t *testing.T) {
+	st := memory.New()
+	gm := gophermart.New(st)
+	session, err := gm.Register(&gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}, gophermart.Client{})
+	require.NoError(t, err)
+	userID := session.UserID
+
+	at := time.Now().Add(-time.Hour).Truncate(time.Microsecond)
+	_, err = st.AdjustBalance(&gophermart.Adjustment{
+		ID: "goodwill", UserID: userID, Direction: gophermart.DirectionCredit, Amount: 10000, Reason: "goodwill", CreatedAt: at,
+	}, nil, false)
+	require.NoError(t, err)
+
+	// Entries created at until are left out by the balance, the ledger and
+	// the statement alike.
+	b, err := gm.Balances.At(userID, at)
+	require.NoError(t, err)
+	assert.Zero(t, b.Current)
+	entries, err := gm.Balances.Ledger(userID, at)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+	credits, _, err := st.GetLedgerTotals(userID, at)
+	require.NoError(t, err)
+	assert.Zero(t, credits)
+
+	b, err = gm.Balances.At(userID, at.Add(time.Microsecond))
+	require.NoError(t, err)
+	assert.Equal(t, gophermart.Money(10000), b.Current)
+}
+
+func TestLedgerTotalsOverflow(t *testing.T) {
+	st := memory.New()
+	gm := gophermart.New(st)
+	session, err := gm.Register(&gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}, gophermart.Client{})
+	require.NoError(t, err)
+	userID := session.UserID
+
+	for i, adj := range []struct {
+		direction string
+		amount    gophermart.Money
+	}{
+		{gophermart.DirectionCredit, gophermart.MaxMoney},
+		{gophermart.DirectionDebit, gophermart.MaxMoney},
+		{gophermart.DirectionCredit, 1},
+	} {
+		_, err = st.AdjustBalance(&gophermart.Adjustment{
+			ID: fmt.Sprint(i), UserID: userID, Direction: adj.direction, Amount: adj.amount, Reason: "test", CreatedAt: time.Now(),
+		}, nil, false)
+		require.NoError(t, err)
+	}
+
+	_, _, err = st.GetLedgerTotals(userID, time.Now().Add(time.Second))
+	assert.ErrorIs(t, err, gophermart.ErrMoneyOverflow)
+}
@@ -0,0 +1,137 @@
+package test
+
+import (
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/Osselnet/gophermart.git/internal/memory"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestListOrders(t *testing.T) {
+	st := memory.New()
+	gm := gophermart.New(st)
+	session, err := gm.Register(&gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}, gophermart.Client{})
+	require.NoError(t, err)
+	userID := session.UserID
+
+	start := time.Now().Add(-time.Hour)
+	statuses := []string{gophermart.StatusNew, gophermart.StatusProcessed, gophermart.StatusInvalid}
+	for i := uint64(1); i <= 7; i++ {
+		require.NoError(t, st.AddOrder(&gophermart.Order{ID: i, UserID: userID, Status: gophermart.StatusNew,
+			UploadedAt: start.Add(time.Duration(i) * time.Minute)}))
+		o, err := st.GetOrder(i)
+		require.NoError(t, err)
+		o.Status = statuses[i%3]
+		if o.Status == gophermart.StatusProcessed {
+			o.Accrual = gophermart.Money(i * 100)
+		}
+		require.NoError(t, st.UpdateOrder(o))
+	}
+	// Another user's order never shows up.
+	require.NoError(t, st.AddOrder(&gophermart.Order{ID: 100, UserID: userID + 1, Status: gophermart.StatusNew, UploadedAt: start}))
+
+	numbers := func(ors []*gophermart.OrderProxy) []string {
+		var ns []string
+		for _, o := range ors {
+			ns = append(ns, o.Number)
+		}
+		return ns
+	}
+
+	var pages [][]string
+	q := gophermart.ListQuery{UserID: userID, Limit: 3}
+	for {
+		ors, next, err := gm.ListOrders(q)
+		require.NoError(t, err)
+		pages = append(pages, numbers(ors))
+		if next == "" {
+			break
+		}
+		q.After, err = gophermart.ParseCursor(next)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, [][]string{{"1", "2", "3"}, {"4", "5", "6"}, {"7"}}, pages, "oldest first by default")
+
+	ors, next, err := gm.ListOrders(gophermart.ListQuery{UserID: userID, Sort: gophermart.SortUploadedAtDesc, Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"7", "6"}, numbers(ors))
+	c, err := gophermart.ParseCursor(next)
+	require.NoError(t, err)
+	ors, _, err = gm.ListOrders(gophermart.ListQuery{UserID: userID, Sort: gophermart.SortUploadedAtDesc, Limit: 2, After: c})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"5", "4"}, numbers(ors))
+
+	ors, _, err = gm.ListOrders(gophermart.ListQuery{UserID: userID, Statuses: []string{"processed", "INVALID"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "2", "4", "5", "7"}, numbers(ors))
+
+	ors, _, err = gm.ListOrders(gophermart.ListQuery{UserID: userID, Sort: gophermart.SortAccrualDesc, MinAmount: 100, MaxAmount: 400})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"4", "1"}, numbers(ors), "accrual is in kopecks")
+
+	ors, _, err = gm.ListOrders(gophermart.ListQuery{UserID: userID, From: start.Add(2 * time.Minute), To: start.Add(4 * time.Minute)})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2", "3"}, numbers(ors), "from is inclusive, to is exclusive")
+
+	_, _, err = gm.ListOrders(gophermart.ListQuery{UserID: userID, Sort: "status"})
+	assert.ErrorIs(t, err, gophermart.ErrListQueryInvalid)
+	_, _, err = gm.ListOrders(gophermart.ListQuery{UserID: userID, Statuses: []string{"LOST"}})
+	assert.ErrorIs(t, err, gophermart.ErrListQueryInvalid)
+	_, _, err = gm.ListOrders(gophermart.ListQuery{UserID: userID, Limit: gophermart.MaxPageLimit + 1})
+	assert.ErrorIs(t, err, gophermart.ErrListQueryInvalid)
+	_, _, err = gm.ListOrders(gophermart.ListQuery{UserID: userID, Sort: gophermart.SortAccrual, After: c})
+	assert.ErrorIs(t, err, gophermart.ErrCursorInvalid, "cursor of another sort order")
+	_, err = gophermart.ParseCursor("not a cursor")
+	assert.ErrorIs(t, err, gophermart.ErrCursorInvalid)
+}
+
+func TestListWithdrawals(t *testing.T) {
+	st := memory.New()
+	gm := gophermart.New(st)
+	session, err := gm.Register(&gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}, gophermart.Client{})
+	require.NoError(t, err)
+	userID := session.UserID
+
+	_, err = st.AdjustBalance(&gophermart.Adjustment{ID: uuid.NewString(), UserID: userID, Direction: gophermart.DirectionCredit,
+		Amount: 100000, Reason: "test", CreatedAt: time.Now()}, nil, false)
+	require.NoError(t, err)
+	for _, w := range []*gophermart.Withdraw{{OrderID: 11, Sum: 300}, {OrderID: 12, Sum: 100}, {OrderID: 13, Sum: 200}} {
+		w.UserID = userID
+		require.NoError(t, st.AddWithdraw(w))
+	}
+
+	orders := func(ws []*gophermart.WithdrawProxy) []string {
+		var ns []string
+		for _, w := range ws {
+			ns = append(ns, w.Order)
+		}
+		return ns
+	}
+
+	ws, next, err := gm.ListWithdrawals(gophermart.ListQuery{UserID: userID})
+	require.NoError(t, err)
+	assert.Empty(t, next)
+	assert.Equal(t, []string{"13", "12", "11"}, orders(ws), "latest first by default")
+
+	ws, next, err = gm.ListWithdrawals(gophermart.ListQuery{UserID: userID, Sort: gophermart.SortSum, Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"12", "13"}, orders(ws))
+	c, err := gophermart.ParseCursor(next)
+	require.NoError(t, err)
+	ws, next, err = gm.ListWithdrawals(gophermart.ListQuery{UserID: userID, Sort: gophermart.SortSum, Limit: 2, After: c})
+	require.NoError(t, err)
+	assert.Empty(t, next)
+	assert.Equal(t, []string{"11"}, orders(ws))
+
+	ws, _, err = gm.ListWithdrawals(gophermart.ListQuery{UserID: userID, MinAmount: 150})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"13", "11"}, orders(ws))
+
+	_, _, err = gm.ListWithdrawals(gophermart.ListQuery{UserID: userID, Statuses: []string{gophermart.StatusNew}})
+	assert.ErrorIs(t, err, gophermart.ErrListQueryInvalid)
+	_, _, err = gm.ListWithdrawals(gophermart.ListQuery{UserID: userID, Sort: gophermart.SortUploadedAt})
+	assert.ErrorIs(t, err, gophermart.ErrListQueryInvalid)
+}
@@ -0,0 +1,192 @@
+package test
+
+import (
+	"errors"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/Osselnet/gophermart.git/internal/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGopherMart_LoginDelays(t *testing.T) {
+	st := memory.New()
+	gm := gophermart.New(st)
+	gm.SetLoginGuardConfig(gophermart.LoginGuardConfig{FreeAttempts: 2, BaseDelay: time.Minute, MaxDelay: time.Hour})
+
+	creds := &gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}
+	wrong := &gophermart.Credentials{Login: "testov", Password: "wrongPass"}
+	_, err := gm.Register(creds, gophermart.Client{})
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err = gm.Login(wrong, "", gophermart.Client{})
+		assert.ErrorIs(t, err, gophermart.ErrInvalidPair, "attempt %d", i+1)
+	}
+
+	_, err = gm.Login(creds, "", gophermart.Client{})
+	var throttled *gophermart.LoginThrottledError
+	require.ErrorAs(t, err, &throttled, "even the right password waits")
+	assert.ErrorIs(t, err, gophermart.ErrLoginThrottled)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), throttled.Until, 5*time.Second)
+
+	a, err := st.GetLoginAttempts("login:testov")
+	require.NoError(t, err)
+	assert.Equal(t, uint32(3), a.Failures, "refused attempts are not counted")
+
+	require.NoError(t, gm.Unlock("testov"))
+	_, err = gm.Login(creds, "", gophermart.Client{})
+	require.NoError(t, err)
+
+	_, err = gm.Login(wrong, "", gophermart.Client{})
+	assert.ErrorIs(t, err, gophermart.ErrInvalidPair)
+	_, err = gm.Login(creds, "", gophermart.Client{})
+	require.NoError(t, err)
+	a, err = st.GetLoginAttempts("login:testov")
+	require.NoError(t, err)
+	assert.Zero(t, a.Failures, "successful login clears the failures")
+
+	// Good logins from an address keep its failures where they were.
+	office := gophermart.Client{IP: "192.0.2.80"}
+	_, err = gm.Login(wrong, "", office)
+	assert.ErrorIs(t, err, gophermart.ErrInvalidPair)
+	before, err := st.GetLoginAttempts("ip:192.0.2.80")
+	require.NoError(t, err)
+	_, err = gm.Login(creds, "", office)
+	require.NoError(t, err)
+	a, err = st.GetLoginAttempts("ip:192.0.2.80")
+	require.NoError(t, err)
+	assert.Equal(t, before.Failures, a.Failures)
+	assert.True(t, before.LastFailure.Equal(a.LastFailure), "the failure window is not moved forward")
+}
+
+func TestGopherMart_LoginLockout(t *testing.T) {
+	st := memory.New()
+	gm := gophermart.New(st)
+	gm.SetLoginGuardConfig(gophermart.LoginGuardConfig{FreeAttempts: 100, LockAfter: 3, LockAfterIP: 5})
+
+	creds := &gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}
+	_, err := gm.Register(creds, gophermart.Client{})
+	require.NoError(t, err)
+
+	attacker := gophermart.Client{IP: "192.0.2.66"}
+	for i := 0; i < 3; i++ {
+		_, err = gm.Login(&gophermart.Credentials{Login: "testov", Password: "guess"}, "", attacker)
+		assert.ErrorIs(t, err, gophermart.ErrInvalidPair)
+	}
+	_, err = gm.Login(creds, "", gophermart.Client{IP: "192.0.2.10"})
+	assert.ErrorIs(t, err, gophermart.ErrLoginLocked, "the login is locked from every address")
+
+	require.NoError(t, gm.Unlock("testov"))
+	_, err = gm.Login(creds, "", gophermart.Client{IP: "192.0.2.10"})
+	require.NoError(t, err)
+
+	for _, login := range []string{"unknown1", "unknown2"} {
+		_, err = gm.Login(&gophermart.Credentials{Login: login, Password: "guess"}, "", attacker)
+		assert.ErrorIs(t, err, gophermart.ErrUserNotFound)
+	}
+	_, err = gm.Login(creds, "", attacker)
+	assert.ErrorIs(t, err, gophermart.ErrLoginLocked, "the address is locked for every login")
+	_, err = gm.Login(creds, "", gophermart.Client{IP: "192.0.2.10"})
+	require.NoError(t, err)
+
+	require.NoError(t, gm.UnlockIP(attacker.IP))
+	_, err = gm.Login(creds, "", attacker)
+	assert.NoError(t, err)
+}
+
+func TestGopherMart_WithdrawTOTPDelays(t *testing.T) {
+	st := memory.New()
+	gm := gophermart.New(st)
+	gm.SetTOTPConfig(gophermart.TOTPConfig{WithdrawThreshold: 100})
+	gm.SetLoginGuardConfig(gophermart.LoginGuardConfig{FreeAttempts: 2, BaseDelay: time.Minute, MaxDelay: time.Hour})
+
+	session, err := gm.Register(&gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}, gophermart.Client{})
+	require.NoError(t, err)
+	enrollment, err := gm.EnrollTOTP(session.UserID)
+	require.NoError(t, err)
+	_, err = gm.ConfirmTOTP(session.UserID, totpCode(t, enrollment.Secret, 0), gophermart.Client{})
+	require.NoError(t, err)
+
+	w := &gophermart.WithdrawProxy{Order: "2377225624", Sum: 1000, UserID: session.UserID, TOTPCode: "wrong"}
+	for i := 0; i < 3; i++ {
+		assert.ErrorIs(t, gm.PostWithdraw(w), gophermart.ErrTOTPCodeInvalid, "attempt %d", i+1)
+	}
+
+	w.TOTPCode = totpCode(t, enrollment.Secret, 1)
+	assert.ErrorIs(t, gm.PostWithdraw(w), gophermart.ErrLoginThrottled, "even the right code waits")
+	_, err = gm.Login(&gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}, "", gophermart.Client{})
+	assert.ErrorIs(t, err, gophermart.ErrLoginThrottled, "and so does the login")
+}
+
+func TestGopherMart_LoginParallelGuesses(t *testing.T) {
+	st := memory.New()
+	gm := gophermart.New(st)
+	gm.SetLoginGuardConfig(gophermart.LoginGuardConfig{FreeAttempts: 2, BaseDelay: time.Minute, LockAfter: 3})
+
+	creds := &gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}
+	_, err := gm.Register(creds, gophermart.Client{})
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := gm.Login(&gophermart.Credentials{Login: "testov", Password: "guess"}, "", gophermart.Client{})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	var checked int
+	for err := range errs {
+		if errors.Is(err, gophermart.ErrInvalidPair) {
+			checked++
+			continue
+		}
+		assert.ErrorIs(t, err, gophermart.ErrLoginThrottled)
+	}
+	assert.LessOrEqual(t, checked, 3, "only the allowed attempts check the password")
+
+	_, err = gm.Login(creds, "", gophermart.Client{})
+	assert.ErrorIs(t, err, gophermart.ErrLoginLocked)
+	require.NoError(t, gm.Unlock("testov"))
+
+	for action, n := range map[string]int{gophermart.AuditLoginLocked: 1, gophermart.AuditLoginUnlocked: 1} {
+		es, err := gm.Audit.Query(gophermart.AuditFilter{Action: action, Target: "login:testov"})
+		require.NoError(t, err)
+		assert.Len(t, es, n, action)
+	}
+}
+
+func TestGopherMart_DisableTOTPDelays(t *testing.T) {
+	st := memory.New()
+	gm := gophermart.New(st)
+	gm.SetLoginGuardConfig(gophermart.LoginGuardConfig{FreeAttempts: 2, BaseDelay: time.Minute, MaxDelay: time.Hour})
+
+	session, err := gm.Register(&gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}, gophermart.Client{})
+	require.NoError(t, err)
+	enrollment, err := gm.EnrollTOTP(session.UserID)
+	require.NoError(t, err)
+	_, err = gm.ConfirmTOTP(session.UserID, "000000", gophermart.Client{})
+	assert.ErrorIs(t, err, gophermart.ErrTOTPCodeInvalid)
+	codes, err := gm.ConfirmTOTP(session.UserID, totpCode(t, enrollment.Secret, 0), gophermart.Client{})
+	require.NoError(t, err)
+
+	// The right password doesn't forget the wrong codes sent with it.
+	for i := 0; i < 3; i++ {
+		err = gm.DisableTOTP(session.UserID, "Passw0rd33", "wrong", gophermart.Client{})
+		assert.ErrorIs(t, err, gophermart.ErrTOTPCodeInvalid, "attempt %d", i+1)
+	}
+
+	err = gm.DisableTOTP(session.UserID, "Passw0rd33", codes[0], gophermart.Client{})
+	assert.ErrorIs(t, err, gophermart.ErrLoginThrottled, "even the right code waits")
+	user, err := gm.Users.Get(session.UserID)
+	require.NoError(t, err)
+	assert.True(t, user.TOTPEnabled())
+}
@@ -0,0 +1,90 @@
+package test
+
+import (
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/Osselnet/gophermart.git/internal/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStorageMem_Users(t *testing.T) {
+	gm := gophermart.New(memory.New())
+
+	_, err := gm.Register(&gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}, gophermart.Client{})
+	require.NoError(t, err)
+
+	_, err = gm.Register(&gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}, gophermart.Client{})
+	assert.ErrorIs(t, err, gophermart.ErrLoginAlreadyTaken)
+
+	_, err = gm.Login(&gophermart.Credentials{Login: "testov", Password: "wrongPass"}, "", gophermart.Client{})
+	assert.ErrorIs(t, err, gophermart.ErrInvalidPair)
+
+	_, err = gm.Login(&gophermart.Credentials{Login: "unknownUser", Password: "Passw0rd33"}, "", gophermart.Client{})
+	assert.ErrorIs(t, err, gophermart.ErrUserNotFound)
+}
+
+func TestStorageMem_OrdersAndBalance(t *testing.T) {
+	st := memory.New()
+	gm := gophermart.New(st)
+
+	owner, err := gm.Users.Add(&gophermart.Credentials{Login: "owner", Password: "Passw0rd33"})
+	require.NoError(t, err)
+	other, err := gm.Users.Add(&gophermart.Credentials{Login: "other", Password: "Passw0rd33"})
+	require.NoError(t, err)
+
+	require.NoError(t, gm.PostOrders(6767584380420, owner, gophermart.Client{}))
+	assert.ErrorIs(t, gm.PostOrders(6767584380420, owner, gophermart.Client{}), gophermart.ErrOrderAlreadyLoadedByUser)
+	assert.ErrorIs(t, gm.PostOrders(6767584380420, other, gophermart.Client{}), gophermart.ErrOrderAlreadyLoadedByAnotherUser)
+	assert.ErrorIs(t, gm.PostOrders(6767584380421, owner, gophermart.Client{}), gophermart.ErrOrderInvalidFormat)
+
+	pool, err := st.LeaseOrders("first", 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, pool, 1)
+
+	leased, err := st.LeaseOrders("second", 10, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, leased, "leased orders must not be handed out twice")
+
+	order := pool[6767584380420]
+	order.Status = gophermart.StatusProcessed
+	order.Accrual = 79998
+	require.NoError(t, st.UpdateOrder(order))
+	assert.ErrorIs(t, st.UpdateOrder(order), gophermart.ErrOrderFinalized)
+
+	pool, err = st.LeaseOrders("first", 10, 0)
+	require.NoError(t, err)
+	assert.Empty(t, pool)
+
+	err = gm.PostWithdraw(&gophermart.WithdrawProxy{Order: "2377225624", UserID: owner, Sum: 100000})
+	assert.ErrorIs(t, err, gophermart.ErrNotEnoughFunds)
+
+	var wg sync.WaitGroup
+	failed := make(chan error, 2)
+	for _, number := range []string{"2377225624", "303653406"} {
+		wg.Add(1)
+		go func(number string) {
+			defer wg.Done()
+			err := gm.PostWithdraw(&gophermart.WithdrawProxy{Order: number, UserID: owner, Sum: 50000})
+			if err != nil {
+				failed <- err
+			}
+		}(number)
+	}
+	wg.Wait()
+	close(failed)
+
+	require.Len(t, failed, 1, "only one of two concurrent withdrawals fits the balance")
+	assert.ErrorIs(t, <-failed, gophermart.ErrNotEnoughFunds)
+
+	balance, err := gm.GetBalance(owner)
+	require.NoError(t, err)
+	assert.Equal(t, &gophermart.BalanceProxy{Current: 29998, Withdrawn: 50000}, balance)
+	assert.NoError(t, gm.Balances.Verify(owner))
+
+	before, err := gm.Balances.At(owner, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, before.Current)
+}
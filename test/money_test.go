@@ -0,0 +1,74 @@
+package test
+
+import (
+	"encoding/json"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in   string
+		want gophermart.Money
+		err  error
+	}{
+		{in: "0", want: 0},
+		{in: "0.29", want: 29},
+		{in: "729.98", want: 72998},
+		{in: "500.5", want: 50050},
+		{in: "1.100", want: 110},
+		{in: "5e2", want: 50000},
+		{in: "1.5E-1", want: 15},
+		{in: "0e999", want: 0},
+		{in: "92233720368547758.07", want: gophermart.MaxMoney},
+		{in: "-1", err: gophermart.ErrMoneyNegative},
+		{in: "0.291", err: gophermart.ErrMoneyPrecision},
+		{in: "1e-3", err: gophermart.ErrMoneyPrecision},
+		{in: "92233720368547758.08", err: gophermart.ErrMoneyOverflow},
+		{in: "1e30", err: gophermart.ErrMoneyOverflow},
+		{in: "NaN", err: gophermart.ErrMoneyInvalid},
+		{in: "1/2", err: gophermart.ErrMoneyInvalid},
+		{in: ".5", err: gophermart.ErrMoneyInvalid},
+		{in: `"1"`, err: gophermart.ErrMoneyInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := gophermart.ParseMoney(tt.in)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMoney_JSON(t *testing.T) {
+	for _, s := range []string{"0", "0.29", "0.3", "729.98", "1000"} {
+		var m gophermart.Money
+		require.NoError(t, json.Unmarshal([]byte(s), &m))
+
+		out, err := json.Marshal(m)
+		require.NoError(t, err)
+		assert.Equal(t, s, string(out))
+	}
+
+	wpr := gophermart.WithdrawProxy{}
+	err := json.Unmarshal([]byte(`{"order":"2377225624","sum":-751}`), &wpr)
+	assert.ErrorIs(t, err, gophermart.ErrMoneyNegative)
+}
+
+func TestMoney_Arithmetic(t *testing.T) {
+	sum, err := gophermart.Money(29).Add(1)
+	require.NoError(t, err)
+	assert.Equal(t, gophermart.Money(30), sum)
+
+	_, err = gophermart.MaxMoney.Add(1)
+	assert.ErrorIs(t, err, gophermart.ErrMoneyOverflow)
+
+	_, err = gophermart.Money(29).Sub(30)
+	assert.ErrorIs(t, err, gophermart.ErrMoneyNegative)
+}
@@ -0,0 +1,57 @@
+package test
+
+import (
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/Osselnet/gophermart.git/internal/memory"
+	"github.com/Osselnet/gophermart.git/pkg/password"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"testing"
+)
+
+func TestGopherMart_PasswordPolicy(t *testing.T) {
+	gm := gophermart.New(memory.New())
+
+	for _, pass := range []string{"short", "password123", strings.Repeat("x", 73)} {
+		_, err := gm.Register(&gophermart.Credentials{Login: "testov", Password: pass}, gophermart.Client{})
+		assert.ErrorIs(t, err, gophermart.ErrPasswordWeak, pass)
+	}
+
+	_, err := gm.Register(&gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}, gophermart.Client{})
+	require.NoError(t, err)
+}
+
+func TestGopherMart_PasswordRehash(t *testing.T) {
+	st := memory.New()
+	gm := gophermart.New(st)
+
+	// A user registered when passwords were bcrypt hashes of cost 8.
+	legacy, err := bcrypt.GenerateFromPassword([]byte("Passw0rd33"), 8)
+	require.NoError(t, err)
+	id, err := st.AddUser(&gophermart.User{Login: "testov", PasswordHash: string(legacy)})
+	require.NoError(t, err)
+
+	_, err = gm.Login(&gophermart.Credentials{Login: "testov", Password: "wrongPass"}, "", gophermart.Client{})
+	assert.ErrorIs(t, err, gophermart.ErrInvalidPair)
+	u, err := st.GetUser(id)
+	require.NoError(t, err)
+	assert.Equal(t, string(legacy), u.PasswordHash, "failed logins don't rehash")
+
+	_, err = gm.Login(&gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}, "", gophermart.Client{})
+	require.NoError(t, err)
+	u, err = st.GetUser(id)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(u.PasswordHash, "$argon2id$"), u.PasswordHash)
+	assert.False(t, password.NeedsRehash(u.PasswordHash, password.DefaultParams))
+
+	gm.SetPasswordConfig(gophermart.PasswordConfig{Params: password.Params{Algorithm: password.Bcrypt, Cost: bcrypt.MinCost}})
+	_, err = gm.Login(&gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}, "", gophermart.Client{})
+	require.NoError(t, err)
+	u, err = st.GetUser(id)
+	require.NoError(t, err)
+	cost, err := bcrypt.Cost([]byte(u.PasswordHash))
+	require.NoError(t, err, "downgrades are possible too")
+	assert.Equal(t, bcrypt.MinCost, cost)
+}
@@ -0,0 +1,106 @@
+package test
+
+import (
+	"fmt"
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/Osselnet/gophermart.git/internal/memory"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+type statementRecorder struct {
+	q       gophermart.StatementQuery
+	opening gophermart.Money
+	lines   []gophermart.StatementLine
+	totals  *gophermart.StatementTotals
+}
+
+func (s *statementRecorder) Open(q gophermart.StatementQuery, opening gophermart.Money) error {
+	s.q, s.opening = q, opening
+	return nil
+}
+
+func (s *statementRecorder) Line(l *gophermart.StatementLine) error {
+	s.lines = append(s.lines, *l)
+	return nil
+}
+
+func (s *statementRecorder) Close(t gophermart.StatementTotals) error {
+	s.totals = &t
+	return nil
+}
+
+func TestStatement(t *testing.T) {
+	st := memory.New()
+	gm := gophermart.New(st)
+	session, err := gm.Register(&gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}, gophermart.Client{})
+	require.NoError(t, err)
+	userID := session.UserID
+
+	now := time.Now()
+	adjust := func(direction string, amount gophermart.Money, at time.Time) {
+		_, err := st.AdjustBalance(&gophermart.Adjustment{ID: uuid.NewString(), UserID: userID, Direction: direction,
+			Amount: amount, Reason: "test", CreatedAt: at}, nil, false)
+		require.NoError(t, err)
+	}
+	adjust(gophermart.DirectionCredit, 50000, now.Add(-72*time.Hour))
+	adjust(gophermart.DirectionCredit, 10000, now.Add(-36*time.Hour))
+	adjust(gophermart.DirectionDebit, 3000, now.Add(-24*time.Hour))
+
+	require.NoError(t, st.AddOrder(&gophermart.Order{ID: 79927398713, UserID: userID, Status: gophermart.StatusNew, UploadedAt: now}))
+	require.NoError(t, st.UpdateOrder(&gophermart.Order{ID: 79927398713, UserID: userID, Status: gophermart.StatusProcessed, Accrual: 25000}))
+	require.NoError(t, gm.PostWithdraw(&gophermart.WithdrawProxy{Order: "2377225624", UserID: userID, Sum: 20000}))
+	adjust(gophermart.DirectionCredit, 100, now.Add(2*time.Hour))
+
+	rec := &statementRecorder{}
+	q := gophermart.StatementQuery{UserID: userID, From: now.Add(-48 * time.Hour), To: now.Add(time.Hour)}
+	require.NoError(t, gm.Statement(q, rec))
+
+	assert.Equal(t, gophermart.Money(50000), rec.opening)
+	var kinds []string
+	var balances []gophermart.Money
+	for _, l := range rec.lines {
+		kinds = append(kinds, l.Kind)
+		balances = append(balances, l.Balance)
+	}
+	assert.Equal(t, []string{gophermart.EntryKindAdjustment, gophermart.EntryKindAdjustment,
+		gophermart.EntryKindAccrual, gophermart.EntryKindWithdrawal}, kinds)
+	assert.Equal(t, []gophermart.Money{60000, 57000, 82000, 62000}, balances)
+	assert.Equal(t, "79927398713", rec.lines[2].Ref)
+	assert.Equal(t, gophermart.Money(25000), rec.lines[2].Credit)
+	assert.Equal(t, gophermart.Money(20000), rec.lines[3].Debit)
+	require.NotNil(t, rec.totals)
+	assert.Equal(t, gophermart.StatementTotals{Opening: 50000, Credits: 35000, Debits: 23000, Closing: 62000}, *rec.totals)
+
+	rec = &statementRecorder{}
+	require.NoError(t, gm.Statement(gophermart.StatementQuery{UserID: userID, To: now.Add(time.Hour)}, rec))
+	assert.Equal(t, 1, rec.q.From.Day(), "the month of to by default")
+
+	err = gm.Statement(gophermart.StatementQuery{UserID: userID, From: now, To: now}, &statementRecorder{})
+	assert.ErrorIs(t, err, gophermart.ErrStatementInvalid)
+}
+
+func TestStatementBatches(t *testing.T) {
+	st := memory.New()
+	gm := gophermart.New(st)
+	session, err := gm.Register(&gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}, gophermart.Client{})
+	require.NoError(t, err)
+	userID := session.UserID
+
+	// Entries of one moment are paged by ID.
+	at := time.Now().Add(-time.Hour)
+	for i := 0; i < 1005; i++ {
+		_, err := st.AdjustBalance(&gophermart.Adjustment{ID: fmt.Sprint(i), UserID: userID, Direction: gophermart.DirectionCredit,
+			Amount: 1, Reason: "test", CreatedAt: at}, nil, false)
+		require.NoError(t, err)
+	}
+
+	rec := &statementRecorder{}
+	require.NoError(t, gm.Statement(gophermart.StatementQuery{UserID: userID, From: at, To: time.Now()}, rec))
+	require.Len(t, rec.lines, 1005)
+	assert.Equal(t, "1004", rec.lines[1004].Ref)
+	assert.Equal(t, gophermart.Money(1005), rec.totals.Closing)
+}
@@ -0,0 +1,77 @@
+package test
+
+import (
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/Osselnet/gophermart.git/internal/memory"
+	"github.com/Osselnet/gophermart.git/pkg/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGopherMart_Refresh(t *testing.T) {
+	st := memory.New()
+	gm := gophermart.New(st)
+
+	s1, err := gm.Register(&gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}, gophermart.Client{})
+	require.NoError(t, err)
+
+	auth, err := gm.Authenticate(s1.Token, gophermart.Client{})
+	require.NoError(t, err)
+	assert.Equal(t, s1.UserID, auth.UserID)
+	assert.Equal(t, s1.ID, auth.ID)
+
+	_, err = gm.Authenticate(s1.RefreshToken, gophermart.Client{})
+	assert.ErrorIs(t, err, gophermart.ErrTokenInvalid, "refresh token is not an access token")
+	_, err = gm.Refresh(s1.Token, gophermart.Client{})
+	assert.ErrorIs(t, err, gophermart.ErrTokenInvalid, "access token is not a refresh token")
+
+	s2, err := gm.Refresh(s1.RefreshToken, gophermart.Client{})
+	require.NoError(t, err)
+	assert.Equal(t, s1.ID, s2.ID)
+	assert.NotEqual(t, s1.RefreshToken, s2.RefreshToken)
+
+	s3, err := gm.Refresh(s2.RefreshToken, gophermart.Client{})
+	require.NoError(t, err)
+
+	_, err = gm.Refresh(s1.RefreshToken, gophermart.Client{})
+	assert.ErrorIs(t, err, gophermart.ErrTokenReused)
+
+	_, err = gm.Refresh(s3.RefreshToken, gophermart.Client{})
+	assert.ErrorIs(t, err, gophermart.ErrSessionNotFound, "reuse revokes the whole family")
+	_, err = st.GetSession(s1.ID)
+	assert.ErrorIs(t, err, gophermart.ErrSessionNotFound)
+
+	s4, err := gm.Login(&gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}, "", gophermart.Client{})
+	require.NoError(t, err)
+	require.NoError(t, gm.Logout(s4.Token, gophermart.Client{}))
+	_, err = gm.Refresh(s4.RefreshToken, gophermart.Client{})
+	assert.ErrorIs(t, err, gophermart.ErrSessionNotFound)
+}
+
+func TestGopherMart_TokenKeys(t *testing.T) {
+	oldKeys, err := jwt.ParseKeyring("k1:" + strings.Repeat("o", jwt.MinKeySize))
+	require.NoError(t, err)
+	newKeys, err := jwt.ParseKeyring("k2:" + strings.Repeat("n", jwt.MinKeySize) + ",k1:" + strings.Repeat("o", jwt.MinKeySize))
+	require.NoError(t, err)
+
+	st := memory.New()
+	gm := gophermart.New(st)
+	gm.SetTokenConfig(gophermart.TokenConfig{Keys: oldKeys, AccessTTL: time.Minute})
+
+	s, err := gm.Register(&gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}, gophermart.Client{})
+	require.NoError(t, err)
+
+	gm.SetTokenConfig(gophermart.TokenConfig{Keys: newKeys, AccessTTL: time.Minute})
+	_, err = gm.Authenticate(s.Token, gophermart.Client{})
+	assert.NoError(t, err, "tokens signed before key rotation stay valid")
+
+	gm.SetTokenConfig(gophermart.TokenConfig{Keys: newKeys, AccessTTL: time.Nanosecond})
+	s, err = gm.Refresh(s.RefreshToken, gophermart.Client{})
+	require.NoError(t, err)
+	time.Sleep(time.Second)
+	_, err = gm.Authenticate(s.Token, gophermart.Client{})
+	assert.ErrorIs(t, err, gophermart.ErrTokenExpired)
+}
@@ -0,0 +1,97 @@
+package test
+
+import (
+	"github.com/Osselnet/gophermart.git/internal/gophermart"
+	"github.com/Osselnet/gophermart.git/internal/memory"
+	"github.com/Osselnet/gophermart.git/pkg/totp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// totpCode returns the code of the time step offset steps from now. The
+// codes of consecutive offsets are all accepted, in that order.
+func totpCode(t *testing.T, secret string, offset int) string {
+	code, err := totp.Code(secret, time.Now().Add(time.Duration(offset)*totp.Period))
+	require.NoError(t, err)
+
+	return code
+}
+
+func TestGopherMart_TOTP(t *testing.T) {
+	st := memory.New()
+	gm := gophermart.New(st)
+	gm.SetTOTPConfig(gophermart.TOTPConfig{WithdrawThreshold: 10000})
+
+	creds := &gophermart.Credentials{Login: "testov", Password: "Passw0rd33"}
+	session, err := gm.Register(creds, gophermart.Client{})
+	require.NoError(t, err)
+
+	_, err = gm.ConfirmTOTP(session.UserID, "123456", gophermart.Client{})
+	assert.ErrorIs(t, err, gophermart.ErrTOTPNotEnrolled)
+
+	enrollment, err := gm.EnrollTOTP(session.UserID)
+	require.NoError(t, err)
+	assert.Contains(t, enrollment.URI, "secret="+enrollment.Secret)
+
+	_, err = gm.Login(creds, "", gophermart.Client{})
+	require.NoError(t, err, "TOTP is not required before confirmation")
+
+	_, err = gm.ConfirmTOTP(session.UserID, "000000", gophermart.Client{})
+	assert.ErrorIs(t, err, gophermart.ErrTOTPCodeInvalid)
+	codes, err := gm.ConfirmTOTP(session.UserID, totpCode(t, enrollment.Secret, -1), gophermart.Client{})
+	require.NoError(t, err)
+	require.Len(t, codes, 10)
+
+	_, err = gm.EnrollTOTP(session.UserID)
+	assert.ErrorIs(t, err, gophermart.ErrTOTPAlreadyEnabled)
+
+	_, err = gm.Login(creds, "", gophermart.Client{})
+	var totpErr *gophermart.TOTPRequiredError
+	require.ErrorAs(t, err, &totpErr)
+	assert.ErrorIs(t, err, gophermart.ErrTOTPRequired)
+
+	_, err = gm.LoginTOTP(totpErr.Challenge, totpCode(t, enrollment.Secret, -1), "", gophermart.Client{})
+	assert.ErrorIs(t, err, gophermart.ErrTOTPCodeReused)
+	_, err = gm.LoginTOTP(session.Token, totpCode(t, enrollment.Secret, 0), "", gophermart.Client{})
+	assert.ErrorIs(t, err, gophermart.ErrTokenInvalid, "access token is not a challenge")
+
+	s2, err := gm.LoginTOTP(totpErr.Challenge, totpCode(t, enrollment.Secret, 0), "", gophermart.Client{})
+	require.NoError(t, err)
+	assert.Equal(t, session.UserID, s2.UserID)
+
+	_, err = gm.LoginTOTP(totpErr.Challenge, codes[0], "", gophermart.Client{})
+	require.NoError(t, err, "recovery codes are accepted at login")
+	_, err = gm.LoginTOTP(totpErr.Challenge, codes[0], "", gophermart.Client{})
+	assert.ErrorIs(t, err, gophermart.ErrTOTPCodeInvalid, "recovery codes are single use")
+
+	// Fund the account with a processed order.
+	require.NoError(t, gm.PostOrders(6767584380420, session.UserID, gophermart.Client{}))
+	pool, err := st.LeaseOrders("test", 10, time.Minute)
+	require.NoError(t, err)
+	order := pool[6767584380420]
+	order.Status = gophermart.StatusProcessed
+	order.Accrual = 50000
+	require.NoError(t, st.UpdateOrder(order))
+
+	small := &gophermart.WithdrawProxy{Order: "2377225624", Sum: 10000, UserID: session.UserID}
+	require.NoError(t, gm.PostWithdraw(small), "sums up to the threshold need no code")
+
+	large := &gophermart.WithdrawProxy{Order: "49927398716", Sum: 10001, UserID: session.UserID}
+	assert.ErrorIs(t, gm.PostWithdraw(large), gophermart.ErrTOTPRequired)
+	large.TOTPCode = codes[1]
+	assert.ErrorIs(t, gm.PostWithdraw(large), gophermart.ErrTOTPCodeInvalid, "recovery codes are not accepted")
+	a, err := st.GetLoginAttempts("login:testov")
+	require.NoError(t, err)
+	assert.Equal(t, uint32(2), a.Failures, "wrong codes count as failed logins")
+	large.TOTPCode = totpCode(t, enrollment.Secret, 1)
+	require.NoError(t, gm.PostWithdraw(large))
+
+	assert.ErrorIs(t, gm.DisableTOTP(session.UserID, "Passw0rd33", "", gophermart.Client{}), gophermart.ErrTOTPRequired)
+	assert.ErrorIs(t, gm.DisableTOTP(session.UserID, "wrong", codes[2], gophermart.Client{}), gophermart.ErrInvalidPair)
+	assert.ErrorIs(t, gm.DisableTOTP(session.UserID, "Passw0rd33", "wrong", gophermart.Client{}), gophermart.ErrTOTPCodeInvalid)
+	require.NoError(t, gm.DisableTOTP(session.UserID, "Passw0rd33", codes[2], gophermart.Client{}))
+	_, err = gm.Login(creds, "", gophermart.Client{})
+	assert.NoError(t, err)
+}